@@ -1,5 +1,7 @@
 package rtsp
 
+import "github.com/icholy/rtsp/internal/authutil"
+
 // Auth provides a mechanism for authenticating requests.
 // Implementations may be found in the auth subpackage.
 type Auth interface {
@@ -10,8 +12,23 @@ type Auth interface {
 	Authorize(*Request, *Response) (bool, error)
 }
 
-type noAuth struct{}
+// userinfoAuth is the default Auth. It answers the challenge with the
+// url userinfo when there is one, preferring digest over basic.
+type userinfoAuth struct{}
 
-func (noAuth) Authorize(req *Request, resp *Response) (bool, error) {
-	return false, nil
+func (userinfoAuth) Authorize(req *Request, resp *Response) (bool, error) {
+	if resp == nil || req.URL == nil || req.URL.User == nil {
+		return false, nil
+	}
+	username := req.URL.User.Username()
+	password, _ := req.URL.User.Password()
+	value, err := authutil.Digest(resp.Header, req.Method, req.URL.RequestURI(), username, password)
+	if err != nil {
+		if !authutil.HasBasic(resp.Header) {
+			return false, nil
+		}
+		value = authutil.Basic(username, password)
+	}
+	req.Header.Set("Authorization", value)
+	return true, nil
 }
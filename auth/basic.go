@@ -1,15 +1,17 @@
 package auth
 
 import (
-	"encoding/base64"
-
 	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/internal/authutil"
 )
 
 // Basic is an Auth implementation for basic authentication.
+// When Credentials is nil, the Username and Password are used.
+// When those are also empty, the request url userinfo is used.
 type Basic struct {
-	Username string
-	Password string
+	Username    string
+	Password    string
+	Credentials Credentials
 }
 
 // WithBasic returns an Option for using basic auth
@@ -20,13 +22,18 @@ func WithBasic(username, password string) rtsp.Option {
 	})
 }
 
+// WithBasicCredentials returns an Option for using basic auth
+// with the provided credentials.
+func WithBasicCredentials(c Credentials) rtsp.Option {
+	return rtsp.WithAuth(Basic{Credentials: c})
+}
+
 // Authorize the request
 func (a Basic) Authorize(req *rtsp.Request, resp *rtsp.Response) (bool, error) {
-	req.Header.Set("Authorization", "Basic "+a.encoded())
+	username, password, err := lookup(a.Credentials, a.Username, a.Password, req.URL)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", authutil.Basic(username, password))
 	return false, nil
 }
-
-func (a Basic) encoded() string {
-	auth := a.Username + ":" + a.Password
-	return base64.StdEncoding.EncodeToString([]byte(auth))
-}
@@ -1,16 +1,17 @@
 package auth
 
 import (
-	"net/http"
-
-	"github.com/icholy/digest"
 	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/internal/authutil"
 )
 
 // Digest is an Auth implementation for the digest authentication.
+// When Credentials is nil, the Username and Password are used.
+// When those are also empty, the request url userinfo is used.
 type Digest struct {
-	Username string
-	Password string
+	Username    string
+	Password    string
+	Credentials Credentials
 }
 
 // WithDigest returns a client option for using digest auth
@@ -21,24 +22,25 @@ func WithDigest(username, password string) rtsp.Option {
 	})
 }
 
+// WithDigestCredentials returns a client option for using digest auth
+// with the provided credentials.
+func WithDigestCredentials(c Credentials) rtsp.Option {
+	return rtsp.WithAuth(Digest{Credentials: c})
+}
+
 // Authorize the request.
 func (a Digest) Authorize(req *rtsp.Request, resp *rtsp.Response) (bool, error) {
 	if resp == nil {
 		return true, nil
 	}
-	chal, err := digest.FindChallenge(http.Header(resp.Header))
+	username, password, err := lookup(a.Credentials, a.Username, a.Password, req.URL)
 	if err != nil {
 		return false, err
 	}
-	cred, err := digest.Digest(chal, digest.Options{
-		Method:   req.Method,
-		URI:      req.URL.RequestURI(),
-		Username: a.Username,
-		Password: a.Password,
-	})
+	value, err := authutil.Digest(resp.Header, req.Method, req.URL.RequestURI(), username, password)
 	if err != nil {
 		return false, err
 	}
-	req.Header.Set("Authorization", cred.String())
+	req.Header.Set("Authorization", value)
 	return true, nil
 }
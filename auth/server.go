@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/icholy/digest"
+	"github.com/icholy/rtsp"
+)
+
+// DefaultNonceLifetime is how long a digest nonce is accepted.
+const DefaultNonceLifetime = 5 * time.Minute
+
+// Authenticator verifies the Authorization header of requests received
+// by a server. Digest authentication is always offered, Basic is only
+// accepted when enabled.
+//
+// Nonces are not stored, so a digest response can be replayed for the
+// same method and url until its nonce expires. Use NonceLifetime to limit
+// how long that is.
+type Authenticator struct {
+	Realm string
+	// Password returns the password of the user for the request url.
+	// Returning false rejects the user. The url allows using different
+	// credentials for each path.
+	Password func(u *url.URL, username string) (string, bool)
+	// Basic enables basic authentication.
+	Basic bool
+	// NonceLifetime is how long a digest nonce is valid for.
+	NonceLifetime time.Duration
+
+	once   sync.Once
+	secret []byte
+}
+
+// Authenticate returns the username when the request has valid credentials.
+func (a *Authenticator) Authenticate(req *rtsp.Request) (string, bool) {
+	header := req.Header.Get("Authorization")
+	switch {
+	case digest.IsDigest(header):
+		return a.digest(req, header)
+	case a.Basic && strings.HasPrefix(header, "Basic "):
+		return a.basic(req, strings.TrimPrefix(header, "Basic "))
+	default:
+		return "", false
+	}
+}
+
+// Unauthorized returns a 401 response with the challenges.
+func (a *Authenticator) Unauthorized() *rtsp.Response {
+	res, _ := rtsp.NewResponse(rtsp.StatusUnauthorized, nil)
+	chal := &digest.Challenge{
+		Realm:     a.Realm,
+		Nonce:     a.nonce(time.Now()),
+		Algorithm: "MD5",
+	}
+	res.Header.Add("WWW-Authenticate", chal.String())
+	if a.Basic {
+		res.Header.Add("WWW-Authenticate", `Basic realm="`+a.Realm+`"`)
+	}
+	return res
+}
+
+func (a *Authenticator) basic(req *rtsp.Request, value string) (string, bool) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.SplitN(string(data), ":", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+	password, ok := a.Password(req.URL, parts[0])
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(parts[1])) != 1 {
+		return "", false
+	}
+	return parts[0], true
+}
+
+func (a *Authenticator) digest(req *rtsp.Request, value string) (string, bool) {
+	cred, err := digest.ParseCredentials(value)
+	if err != nil || cred.Realm != a.Realm || !a.validNonce(cred.Nonce, time.Now()) {
+		return "", false
+	}
+	if !validURI(cred.URI, req.URL) {
+		return "", false
+	}
+	password, ok := a.Password(req.URL, cred.Username)
+	if !ok {
+		return "", false
+	}
+	chal := &digest.Challenge{
+		Realm:     cred.Realm,
+		Nonce:     cred.Nonce,
+		Algorithm: cred.Algorithm,
+		Opaque:    cred.Opaque,
+	}
+	if cred.QOP != "" {
+		chal.QOP = []string{cred.QOP}
+	}
+	expected, err := digest.Digest(chal, digest.Options{
+		Method:   req.Method,
+		URI:      cred.URI,
+		Username: cred.Username,
+		Password: password,
+		Cnonce:   cred.Cnonce,
+		Count:    cred.Nc,
+	})
+	if err != nil {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(expected.Response), []byte(cred.Response)) != 1 {
+		return "", false
+	}
+	return cred.Username, true
+}
+
+// validURI returns true when the digest uri refers to the request url.
+// Some clients send the absolute url and others only the path.
+func validURI(uri string, u *url.URL) bool {
+	if uri == u.RequestURI() {
+		return true
+	}
+	v, err := url.Parse(uri)
+	if err != nil || v.Host == "" {
+		return false
+	}
+	return v.Host == u.Host && v.RequestURI() == u.RequestURI()
+}
+
+// nonce returns a nonce containing the issue time signed with a secret
+// so that they can be validated without storing them.
+func (a *Authenticator) nonce(now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 16)
+	return ts + "." + a.sign(ts)
+}
+
+func (a *Authenticator) validNonce(nonce string, now time.Time) bool {
+	parts := strings.SplitN(nonce, ".", 2)
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(a.sign(parts[0]))) {
+		return false
+	}
+	sec, err := strconv.ParseInt(parts[0], 16, 64)
+	if err != nil {
+		return false
+	}
+	lifetime := a.NonceLifetime
+	if lifetime <= 0 {
+		lifetime = DefaultNonceLifetime
+	}
+	return now.Sub(time.Unix(sec, 0)) <= lifetime
+}
+
+func (a *Authenticator) sign(s string) string {
+	a.once.Do(func() {
+		a.secret = make([]byte, 32)
+		_, _ = rand.Read(a.secret)
+	})
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
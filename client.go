@@ -2,10 +2,15 @@ package rtsp
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"io"
 	"strconv"
 	"sync"
+	"time"
+
+	"github.com/icholy/rtsp/rtcp"
+	"github.com/icholy/rtsp/rtp"
 )
 
 // Client allows sending and recieving rtsp data over a
@@ -14,7 +19,12 @@ type Client struct {
 	auth         Auth
 	userAgent    string
 	frameHandler func(Frame) error
+	reuseFrames  bool
+	frameBuf     []byte
+	receivers    map[int]*rtcp.Receiver
+	packet       rtp.Packet
 
+	wmu  sync.Mutex
 	w    io.Writer
 	r    *bufio.Reader
 	cseq int
@@ -32,20 +42,24 @@ func NewClient(conn io.ReadWriter, options ...Option) *Client {
 		r:            bufio.NewReader(conn),
 		doneCh:       make(chan struct{}),
 		respCh:       make(chan errResponse),
-		auth:         noAuth{},
+		auth:         userinfoAuth{},
 		frameHandler: func(Frame) error { return nil },
 	}
 	for _, o := range options {
 		o(c)
 	}
 	go c.recvLoop()
+	for channel, r := range c.receivers {
+		go c.sendReports(channel+1, r)
+	}
 	return c
 }
 
 // Option configures a client.
 type Option func(*Client)
 
-// WithAuth configures the client authentication.
+// WithAuth configures the client authentication. Without it, the url
+// userinfo is used to answer challenges.
 func WithAuth(a Auth) Option {
 	return func(c *Client) { c.auth = a }
 }
@@ -56,6 +70,26 @@ func WithFrameHandler(handler func(Frame) error) Option {
 	return func(c *Client) { c.frameHandler = handler }
 }
 
+// WithFrameBufferReuse makes the client read every interleaved frame into
+// the same buffer. This avoids an allocation per frame, but the Frame's
+// Data is only valid until the frame handler returns.
+func WithFrameBufferReuse() Option {
+	return func(c *Client) { c.reuseFrames = true }
+}
+
+// WithReceiver makes the client track the RTP packets received on the
+// interleaved channel and send periodic RTCP receiver reports on the
+// following channel. Sender reports received on that channel are used
+// for the report delay. The reports stop when the connection fails.
+func WithReceiver(channel int, r *rtcp.Receiver) Option {
+	return func(c *Client) {
+		if c.receivers == nil {
+			c.receivers = map[int]*rtcp.Receiver{}
+		}
+		c.receivers[channel] = r
+	}
+}
+
 // WithUserAgent specifies the user-agent to be sent with
 // each request.
 func WithUserAgent(userAgent string) Option {
@@ -135,6 +169,28 @@ func (c *Client) Play(endpoint, session string) (*Response, error) {
 	return c.Do(req)
 }
 
+// Announce is a helper method for sending an ANNOUNCE request with
+// a session description.
+func (c *Client) Announce(endpoint string, sdp []byte) (*Response, error) {
+	req, err := NewRequest(MethodAnnounce, endpoint, sdp)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/sdp")
+	return c.Do(req)
+}
+
+// Record is a helper method for sending a RECORD request.
+func (c *Client) Record(endpoint, session string) (*Response, error) {
+	req, err := NewRequest(MethodRecord, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Session", session)
+	req.Header.Set("Range", "npt=0.000-")
+	return c.Do(req)
+}
+
 // Teardown is a helper method for sending a TEARDOWN request.
 func (c *Client) Teardown(endpoint, session string) (*Response, error) {
 	req, err := NewRequest(MethodTeardown, endpoint, nil)
@@ -145,6 +201,27 @@ func (c *Client) Teardown(endpoint, session string) (*Response, error) {
 	return c.Do(req)
 }
 
+// WriteFrame sends an interleaved binary frame. This can be used to send
+// RTCP reports on the channels negotiated during SETUP.
+func (c *Client) WriteFrame(f Frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return f.Write(c.w)
+}
+
+// Done returns a channel which is closed when the connection fails.
+func (c *Client) Done() <-chan struct{} {
+	return c.doneCh
+}
+
+// Err returns the error which terminated the connection, or nil
+// while it's still running.
+func (c *Client) Err() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
 type errResponse struct {
 	res *Response
 	err error
@@ -156,18 +233,68 @@ func (c *Client) recv() error {
 		return err
 	}
 	if ok {
-		f, err := ReadFrame(c.r)
+		f, err := c.readFrame()
 		if err != nil {
 			return err
 		}
+		c.receive(f)
 		return c.frameHandler(f)
 	} else {
 		res, err := ReadResponse(c.r)
-		c.respCh <- errResponse{res: res, err: err}
-		return err
+		if err != nil {
+			// waiting requests get the error from Done
+			return err
+		}
+		c.respCh <- errResponse{res: res}
+		return nil
 	}
 }
 
+func (c *Client) readFrame() (Frame, error) {
+	if !c.reuseFrames {
+		return ReadFrame(c.r)
+	}
+	f, err := ReadFrameBuffer(c.r, c.frameBuf)
+	if err != nil {
+		return Frame{}, err
+	}
+	c.frameBuf = f.Data
+	return f, nil
+}
+
+// receive passes the frame to the receiver of its channel.
+func (c *Client) receive(f Frame) {
+	if len(c.receivers) == 0 {
+		return
+	}
+	if r, ok := c.receivers[f.Channel]; ok {
+		if err := c.packet.Unmarshal(f.Data); err == nil {
+			r.ReceiveRTP(&c.packet, time.Now())
+		}
+		return
+	}
+	if r, ok := c.receivers[f.Channel-1]; ok && f.Channel%2 == 1 {
+		_ = r.ReceiveRTCP(f.Data, time.Now())
+	}
+}
+
+// sendReports sends receiver reports on the channel until the
+// connection fails.
+func (c *Client) sendReports(channel int, r *rtcp.Receiver) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.doneCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	_ = r.Run(ctx, func(data []byte) error {
+		return c.WriteFrame(Frame{Channel: channel, Data: data})
+	})
+}
+
 func (c *Client) recvLoop() {
 	for {
 		if err := c.recv(); err != nil {
@@ -195,6 +322,8 @@ func (c *Client) roundTrip(req *Request) (*Response, error) {
 	// clone the request so we can modify it
 	clone := *req
 	clone.Header = req.Header.Clone()
+	// never send the userinfo on the request line
+	clone.URL = stripUserinfo(req.URL)
 	// add the sequence number
 	c.cseq++
 	clone.Header.Set("CSeq", strconv.Itoa(c.cseq))
@@ -203,7 +332,10 @@ func (c *Client) roundTrip(req *Request) (*Response, error) {
 		clone.Header.Set("User-Agent", c.userAgent)
 	}
 	// make the request
-	if err := clone.Write(c.w); err != nil {
+	c.wmu.Lock()
+	err := clone.Write(c.w)
+	c.wmu.Unlock()
+	if err != nil {
 		return nil, err
 	}
 	// wait for a response
@@ -0,0 +1,160 @@
+package aac
+
+import (
+	"testing"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+	"gotest.tools/v3/assert"
+)
+
+func TestAudioSpecificConfig(t *testing.T) {
+	c, err := ParseAudioSpecificConfig("1210")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c, AudioSpecificConfig{
+		ObjectType:   ObjectTypeAACLC,
+		SampleRate:   44100,
+		ChannelCount: 2,
+	})
+	assert.Equal(t, c.String(), "1210")
+}
+
+func TestStreamMuxConfig(t *testing.T) {
+	c, err := ParseStreamMuxConfig("40002410adca00")
+	assert.NilError(t, err)
+	assert.Equal(t, c.Config.SampleRate, 44100)
+	c2, err := ParseStreamMuxConfig(c.String())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c, c2)
+}
+
+func TestDepacketizer(t *testing.T) {
+	d, err := NewDepacketizer(map[string]string{
+		"sizelength":       "13",
+		"indexlength":      "3",
+		"indexdeltalength": "3",
+		"config":           "1210",
+	})
+	assert.NilError(t, err)
+	// two access units in one packet
+	p := &rtp.Packet{
+		TS:      1000,
+		Payload: []byte{0x00, 0x20, 0x00, 0x10, 0x00, 0x08, 1, 2, 3},
+	}
+	p.SetMarker(true)
+	units, err := d.Depacketize(p)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, units, []*codec.AccessUnit{
+		{Timestamp: 1000, Data: [][]byte{{1, 2}}, Key: true},
+		{Timestamp: 2024, Data: [][]byte{{3}}, Key: true},
+	})
+
+	// the header field lengths are validated
+	for _, fmtp := range []map[string]string{
+		{"sizelength": "-1"},
+		{"sizelength": "33"},
+		{"sizelength": "13", "indexlength": "-3"},
+		{"sizelength": "13", "indexdeltalength": "64"},
+	} {
+		_, err := NewDepacketizer(fmtp)
+		assert.Assert(t, err != nil, "%v", fmtp)
+	}
+}
+
+func TestMTUTooSmall(t *testing.T) {
+	config := AudioSpecificConfig{ObjectType: ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2}
+	au := &codec.AccessUnit{Data: [][]byte{make([]byte, 100)}}
+	p := NewPacketizer(97, config)
+	for _, mtu := range []int{0, 12, 16} {
+		p.MTU = mtu
+		_, err := p.Packetize(au)
+		assert.Equal(t, err, ErrMTUTooSmall)
+	}
+	lp := NewLATMPacketizer(97, config)
+	for _, mtu := range []int{0, 12} {
+		lp.MTU = mtu
+		_, err := lp.Packetize(au)
+		assert.Equal(t, err, ErrMTUTooSmall)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	config := AudioSpecificConfig{ObjectType: ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2}
+	frame := make([]byte, 3000)
+	for i := range frame {
+		frame[i] = byte(i)
+	}
+	au := &codec.AccessUnit{Timestamp: 5000, Data: [][]byte{frame}, Key: true}
+
+	t.Run("generic", func(t *testing.T) {
+		p := NewPacketizer(97, config)
+		d, err := NewDepacketizer(p.Fmtp())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, d.Config, config)
+		packets, err := p.Packetize(au)
+		assert.NilError(t, err)
+		assert.Equal(t, len(packets), 3)
+		var units []*codec.AccessUnit
+		for _, pkt := range packets {
+			u, err := d.Depacketize(pkt)
+			assert.NilError(t, err)
+			units = append(units, u...)
+		}
+		assert.DeepEqual(t, units, []*codec.AccessUnit{au})
+	})
+
+	t.Run("latm", func(t *testing.T) {
+		p := NewLATMPacketizer(97, config)
+		d, err := NewLATMDepacketizer(p.Fmtp())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, d.Config.Config, config)
+		packets, err := p.Packetize(au)
+		assert.NilError(t, err)
+		var units []*codec.AccessUnit
+		for _, pkt := range packets {
+			u, err := d.Depacketize(pkt)
+			assert.NilError(t, err)
+			units = append(units, u...)
+		}
+		assert.DeepEqual(t, units, []*codec.AccessUnit{au})
+	})
+}
+
+func TestLATMLoss(t *testing.T) {
+	config := AudioSpecificConfig{ObjectType: ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2}
+	p := NewLATMPacketizer(97, config)
+	d, err := NewLATMDepacketizer(p.Fmtp())
+	assert.NilError(t, err)
+	var packets []*rtp.Packet
+	aus := []*codec.AccessUnit{
+		{Timestamp: 0, Data: [][]byte{make([]byte, 3000)}, Key: true},
+		{Timestamp: 1024, Data: [][]byte{{1, 2, 3}}, Key: true},
+	}
+	for _, au := range aus {
+		pp, err := p.Packetize(au)
+		assert.NilError(t, err)
+		packets = append(packets, pp...)
+	}
+	assert.Equal(t, len(packets), 4)
+	// lose a fragment in the middle of the first frame
+	var units []*codec.AccessUnit
+	for _, pkt := range append([]*rtp.Packet{packets[0]}, packets[2:]...) {
+		u, err := d.Depacketize(pkt)
+		assert.NilError(t, err)
+		units = append(units, u...)
+	}
+	assert.DeepEqual(t, units, []*codec.AccessUnit{aus[1]})
+}
+
+func TestADTS(t *testing.T) {
+	c := AudioSpecificConfig{ObjectType: ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2}
+	b := AppendADTS(nil, c, []byte{1, 2, 3})
+	b = AppendADTS(b, c, []byte{4, 5})
+	config, frames, err := SplitADTS(b)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config, c)
+	assert.DeepEqual(t, frames, [][]byte{{1, 2, 3}, {4, 5}})
+
+	_, _, err = SplitADTS(b[:9])
+	assert.Equal(t, err, ErrTruncated)
+}
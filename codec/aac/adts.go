@@ -0,0 +1,87 @@
+package aac
+
+import "errors"
+
+// ErrInvalidADTS is returned when an ADTS header is malformed.
+var ErrInvalidADTS = errors.New("aac: invalid adts header")
+
+// ADTSHeader is the header preceding each frame in an ADTS stream
+// (ISO 13818-7 6.2). ADTS is used to carry AAC in MPEG-TS.
+type ADTSHeader struct {
+	Config      AudioSpecificConfig
+	HeaderSize  int // 7, or 9 when a CRC is present
+	FrameLength int // including the header
+}
+
+// ParseADTSHeader decodes the ADTS header at the start of b.
+func ParseADTSHeader(b []byte) (ADTSHeader, error) {
+	if len(b) < 7 {
+		return ADTSHeader{}, ErrTruncated
+	}
+	if b[0] != 0xFF || b[1]&0xF0 != 0xF0 {
+		return ADTSHeader{}, ErrInvalidADTS
+	}
+	var h ADTSHeader
+	h.HeaderSize = 7
+	if b[1]&0x01 == 0 {
+		h.HeaderSize = 9
+	}
+	h.Config.ObjectType = int(b[2]>>6) + 1
+	index := int(b[2]>>2) & 0x0F
+	if index >= len(sampleRates) {
+		return ADTSHeader{}, ErrInvalidFrequency
+	}
+	h.Config.SampleRate = sampleRates[index]
+	h.Config.ChannelCount = int(b[2]&0x01)<<2 | int(b[3]>>6)
+	h.FrameLength = int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5]>>5)
+	if h.FrameLength < h.HeaderSize {
+		return ADTSHeader{}, ErrInvalidADTS
+	}
+	return h, nil
+}
+
+// SplitADTS splits an ADTS stream into raw AAC frames. The config of the
+// first frame is returned.
+func SplitADTS(b []byte) (AudioSpecificConfig, [][]byte, error) {
+	var (
+		config AudioSpecificConfig
+		frames [][]byte
+	)
+	for len(b) > 0 {
+		h, err := ParseADTSHeader(b)
+		if err != nil {
+			return config, nil, err
+		}
+		if len(b) < h.FrameLength {
+			return config, nil, ErrTruncated
+		}
+		if len(frames) == 0 {
+			config = h.Config
+		}
+		frames = append(frames, b[h.HeaderSize:h.FrameLength])
+		b = b[h.FrameLength:]
+	}
+	return config, frames, nil
+}
+
+// AppendADTS appends the frame with an ADTS header to b. The config must
+// use a standard sample rate.
+func AppendADTS(b []byte, c AudioSpecificConfig, frame []byte) []byte {
+	index := 0
+	for i, rate := range sampleRates {
+		if rate == c.SampleRate {
+			index = i
+		}
+	}
+	length := 7 + len(frame)
+	b = append(b,
+		0xFF,
+		0xF1, // MPEG-4, no CRC
+		byte(c.ObjectType-1)<<6|byte(index)<<2|byte(c.ChannelCount>>2)&0x01,
+		byte(c.ChannelCount&0x03)<<6|byte(length>>11)&0x03,
+		byte(length>>3),
+		byte(length&0x07)<<5|0x1F,
+		0xFC,
+	)
+	return append(b, frame...)
+}
@@ -0,0 +1,42 @@
+package aac
+
+// bitReader reads big endian bit fields.
+type bitReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *bitReader) left() int {
+	return len(r.buf)*8 - r.pos
+}
+
+func (r *bitReader) read(n int) (uint32, error) {
+	if n > r.left() {
+		return 0, ErrTruncated
+	}
+	var v uint32
+	for i := 0; i < n; i++ {
+		bit := r.buf[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+	return v, nil
+}
+
+// bitWriter writes big endian bit fields.
+type bitWriter struct {
+	buf []byte
+	pos int
+}
+
+func (w *bitWriter) write(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[w.pos/8] |= 1 << (7 - uint(w.pos%8))
+		}
+		w.pos++
+	}
+}
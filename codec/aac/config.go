@@ -0,0 +1,130 @@
+// Package aac implements the AAC RTP payload formats: mpeg4-generic
+// (RFC 3640) and MP4A-LATM (RFC 3016).
+package aac
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Errors returned when decoding AAC payloads.
+var (
+	ErrTruncated          = errors.New("aac: truncated data")
+	ErrInvalidFrequency   = errors.New("aac: invalid sampling frequency")
+	ErrUnsupportedMux     = errors.New("aac: unsupported latm mux config")
+	ErrFragmentedMultiple = errors.New("aac: fragmented packet contains multiple access units")
+	ErrMTUTooSmall        = errors.New("aac: mtu too small")
+)
+
+// SamplesPerFrame is the number of samples in an AAC frame.
+const SamplesPerFrame = 1024
+
+// Audio object types
+const (
+	ObjectTypeAACMain = 1
+	ObjectTypeAACLC   = 2
+	ObjectTypeAACSSR  = 3
+	ObjectTypeAACLTP  = 4
+	ObjectTypeSBR     = 5
+)
+
+var sampleRates = []int{
+	96000, 88200, 64000, 48000, 44100, 32000,
+	24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// AudioSpecificConfig describes an AAC stream (ISO 14496-3 1.6.2.1).
+type AudioSpecificConfig struct {
+	ObjectType   int
+	SampleRate   int
+	ChannelCount int
+}
+
+// ParseAudioSpecificConfig decodes the hex encoded config fmtp parameter.
+func ParseAudioSpecificConfig(config string) (AudioSpecificConfig, error) {
+	data, err := hex.DecodeString(config)
+	if err != nil {
+		return AudioSpecificConfig{}, fmt.Errorf("aac: invalid config: %v", err)
+	}
+	var c AudioSpecificConfig
+	return c, c.Unmarshal(data)
+}
+
+// Unmarshal decodes the config.
+func (c *AudioSpecificConfig) Unmarshal(data []byte) error {
+	r := &bitReader{buf: data}
+	return c.read(r)
+}
+
+func (c *AudioSpecificConfig) read(r *bitReader) error {
+	typ, err := r.read(5)
+	if err != nil {
+		return err
+	}
+	if typ == 31 {
+		ext, err := r.read(6)
+		if err != nil {
+			return err
+		}
+		typ = 32 + ext
+	}
+	c.ObjectType = int(typ)
+	index, err := r.read(4)
+	if err != nil {
+		return err
+	}
+	if index == 0xF {
+		freq, err := r.read(24)
+		if err != nil {
+			return err
+		}
+		c.SampleRate = int(freq)
+	} else if int(index) < len(sampleRates) {
+		c.SampleRate = sampleRates[index]
+	} else {
+		return ErrInvalidFrequency
+	}
+	channels, err := r.read(4)
+	if err != nil {
+		return err
+	}
+	c.ChannelCount = int(channels)
+	return nil
+}
+
+// Marshal encodes the config.
+func (c AudioSpecificConfig) Marshal() []byte {
+	w := &bitWriter{}
+	c.write(w)
+	return w.buf
+}
+
+func (c AudioSpecificConfig) write(w *bitWriter) {
+	if c.ObjectType >= 32 {
+		w.write(31, 5)
+		w.write(uint32(c.ObjectType-32), 6)
+	} else {
+		w.write(uint32(c.ObjectType), 5)
+	}
+	index := -1
+	for i, rate := range sampleRates {
+		if rate == c.SampleRate {
+			index = i
+		}
+	}
+	if index == -1 {
+		w.write(0xF, 4)
+		w.write(uint32(c.SampleRate), 24)
+	} else {
+		w.write(uint32(index), 4)
+	}
+	w.write(uint32(c.ChannelCount), 4)
+	// GASpecificConfig: frameLengthFlag, dependsOnCoreCoder, extensionFlag
+	w.write(0, 3)
+}
+
+// String returns the hex encoded config as used in the fmtp.
+func (c AudioSpecificConfig) String() string {
+	return hex.EncodeToString(c.Marshal())
+}
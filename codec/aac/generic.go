@@ -0,0 +1,198 @@
+package aac
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// Depacketizer extracts AAC frames from mpeg4-generic payloads (RFC 3640).
+type Depacketizer struct {
+	Config           AudioSpecificConfig
+	SizeLength       int
+	IndexLength      int
+	IndexDeltaLength int
+
+	fragment []byte
+	fragSize int
+	fragTS   uint32
+	started  bool
+	sn       uint16
+}
+
+// NewDepacketizer constructs a Depacketizer using the sizelength,
+// indexlength, indexdeltalength and config fmtp parameters.
+func NewDepacketizer(fmtp map[string]string) (*Depacketizer, error) {
+	d := &Depacketizer{}
+	for _, p := range []struct {
+		key   string
+		value *int
+	}{
+		{"sizelength", &d.SizeLength},
+		{"indexlength", &d.IndexLength},
+		{"indexdeltalength", &d.IndexDeltaLength},
+	} {
+		if s, ok := fmtp[p.key]; ok {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("aac: invalid %s: %v", p.key, err)
+			}
+			// the fields are read with a 32 bit reader
+			if n < 0 || n > 32 {
+				return nil, fmt.Errorf("aac: invalid %s: %d", p.key, n)
+			}
+			*p.value = n
+		}
+	}
+	if d.SizeLength == 0 {
+		return nil, fmt.Errorf("aac: missing sizelength")
+	}
+	if config, ok := fmtp["config"]; ok {
+		c, err := ParseAudioSpecificConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		d.Config = c
+	}
+	return d, nil
+}
+
+// Depacketize consumes a packet and returns the contained frames.
+// Frames fragmented across multiple packets are reassembled.
+func (d *Depacketizer) Depacketize(p *rtp.Packet) ([]*codec.AccessUnit, error) {
+	if d.started && p.SN != d.sn+1 {
+		// packet loss, drop the partial fragment
+		d.fragment = nil
+	}
+	d.started = true
+	d.sn = p.SN
+
+	r := &bitReader{buf: p.Payload}
+	headersLength, err := r.read(16)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := d.SizeLength + d.IndexLength
+	var sizes []int
+	for bits := int(headersLength); bits > 0; {
+		size, err := r.read(d.SizeLength)
+		if err != nil {
+			return nil, err
+		}
+		// the index of the first unit and the delta of the following units
+		if _, err := r.read(headerSize - d.SizeLength); err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, int(size))
+		bits -= headerSize
+		headerSize = d.SizeLength + d.IndexDeltaLength
+	}
+	data := p.Payload[2+(int(headersLength)+7)/8:]
+
+	// a single access unit which is larger than the payload is fragmented
+	if len(sizes) == 1 && sizes[0] > len(data) || d.fragment != nil {
+		if len(sizes) != 1 {
+			return nil, ErrFragmentedMultiple
+		}
+		if d.fragment == nil {
+			d.fragSize = sizes[0]
+			d.fragTS = p.TS
+		}
+		d.fragment = append(d.fragment, data...)
+		if !p.Marker() {
+			return nil, nil
+		}
+		frame := d.fragment
+		d.fragment = nil
+		if len(frame) != d.fragSize {
+			return nil, ErrTruncated
+		}
+		return []*codec.AccessUnit{{
+			Timestamp: d.fragTS,
+			Data:      [][]byte{frame},
+			Key:       true,
+		}}, nil
+	}
+
+	units := make([]*codec.AccessUnit, len(sizes))
+	for i, size := range sizes {
+		if size > len(data) {
+			return nil, ErrTruncated
+		}
+		units[i] = &codec.AccessUnit{
+			Timestamp: p.TS + uint32(i*SamplesPerFrame),
+			Data:      [][]byte{append([]byte(nil), data[:size]...)},
+			Key:       true,
+		}
+		data = data[size:]
+	}
+	return units, nil
+}
+
+// DefaultMTU is the default maximum RTP packet size.
+const DefaultMTU = 1200
+
+// Packetizer creates mpeg4-generic payloads using the AAC-hbr mode:
+// sizelength=13, indexlength=3 and indexdeltalength=3. Each packet
+// contains a single frame which is fragmented if it exceeds the MTU.
+type Packetizer struct {
+	MTU    int
+	Config AudioSpecificConfig
+
+	seq *rtp.Sequencer
+}
+
+// NewPacketizer constructs a Packetizer using the dynamic payload type.
+func NewPacketizer(pt int, config AudioSpecificConfig) *Packetizer {
+	return &Packetizer{
+		MTU:    DefaultMTU,
+		Config: config,
+		seq:    rtp.NewSequencer(pt),
+	}
+}
+
+// Sequencer returns the sequencer used to fill in the packet headers.
+func (p *Packetizer) Sequencer() *rtp.Sequencer {
+	return p.seq
+}
+
+// Packetize creates packets containing the frame.
+func (p *Packetizer) Packetize(au *codec.AccessUnit) ([]*rtp.Packet, error) {
+	max := p.MTU - rtp.HeaderSize - 4
+	if max <= 0 {
+		return nil, ErrMTUTooSmall
+	}
+	var packets []*rtp.Packet
+	for _, frame := range au.Data {
+		size := len(frame)
+		for first := true; first || len(frame) > 0; first = false {
+			n := len(frame)
+			if n > max {
+				n = max
+			}
+			payload := make([]byte, 4, 4+n)
+			// AU-headers-length in bits followed by a single AU header
+			payload[0], payload[1] = 0, 16
+			payload[2], payload[3] = byte(size>>5), byte(size<<3)
+			payload = append(payload, frame[:n]...)
+			frame = frame[n:]
+			packets = append(packets, p.seq.Packet(au.Timestamp, len(frame) == 0, payload))
+		}
+	}
+	return packets, nil
+}
+
+// Fmtp returns the SDP fmtp parameters describing the stream.
+func (p *Packetizer) Fmtp() map[string]string {
+	return map[string]string{
+		"streamtype":       "5",
+		"profile-level-id": "1",
+		"mode":             "AAC-hbr",
+		"sizelength":       "13",
+		"indexlength":      "3",
+		"indexdeltalength": "3",
+		"config":           p.Config.String(),
+	}
+}
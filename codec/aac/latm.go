@@ -0,0 +1,225 @@
+package aac
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// StreamMuxConfig is the LATM configuration (ISO 14496-3 1.7.3).
+// Only a single program and layer with one subframe per payload
+// are supported.
+type StreamMuxConfig struct {
+	Config AudioSpecificConfig
+}
+
+// ParseStreamMuxConfig decodes the hex encoded config fmtp parameter
+// of an MP4A-LATM stream.
+func ParseStreamMuxConfig(config string) (StreamMuxConfig, error) {
+	data, err := hex.DecodeString(config)
+	if err != nil {
+		return StreamMuxConfig{}, fmt.Errorf("aac: invalid config: %v", err)
+	}
+	var c StreamMuxConfig
+	return c, c.Unmarshal(data)
+}
+
+// Unmarshal decodes the config.
+func (c *StreamMuxConfig) Unmarshal(data []byte) error {
+	r := &bitReader{buf: data}
+	version, err := r.read(1)
+	if err != nil {
+		return err
+	}
+	if version != 0 {
+		return ErrUnsupportedMux
+	}
+	// allStreamsSameTimeFraming
+	if _, err := r.read(1); err != nil {
+		return err
+	}
+	subFrames, err := r.read(6)
+	if err != nil {
+		return err
+	}
+	programs, err := r.read(4)
+	if err != nil {
+		return err
+	}
+	layers, err := r.read(3)
+	if err != nil {
+		return err
+	}
+	if subFrames != 0 || programs != 0 || layers != 0 {
+		return ErrUnsupportedMux
+	}
+	if err := c.Config.read(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Marshal encodes the config.
+func (c StreamMuxConfig) Marshal() []byte {
+	w := &bitWriter{}
+	w.write(0, 1) // audioMuxVersion
+	w.write(1, 1) // allStreamsSameTimeFraming
+	w.write(0, 6) // numSubFrames
+	w.write(0, 4) // numProgram
+	w.write(0, 3) // numLayer
+	c.Config.write(w)
+	w.write(0, 3)    // frameLengthType
+	w.write(0xFF, 8) // latmBufferFullness
+	w.write(0, 1)    // otherDataPresent
+	w.write(0, 1)    // crcCheckPresent
+	return w.buf
+}
+
+// String returns the hex encoded config as used in the fmtp.
+func (c StreamMuxConfig) String() string {
+	return hex.EncodeToString(c.Marshal())
+}
+
+// LATMDepacketizer extracts AAC frames from MP4A-LATM payloads (RFC 3016)
+// with cpresent=0. A frame may be split across multiple packets and is
+// completed by the marker bit.
+type LATMDepacketizer struct {
+	Config StreamMuxConfig
+
+	buf      []byte
+	ts       uint32
+	started  bool
+	sn       uint16
+	dropping bool
+}
+
+// NewLATMDepacketizer constructs a LATMDepacketizer using the config fmtp parameter.
+func NewLATMDepacketizer(fmtp map[string]string) (*LATMDepacketizer, error) {
+	d := &LATMDepacketizer{}
+	if cpresent, ok := fmtp["cpresent"]; ok && cpresent != "0" {
+		return nil, ErrUnsupportedMux
+	}
+	if config, ok := fmtp["config"]; ok {
+		c, err := ParseStreamMuxConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		d.Config = c
+	}
+	return d, nil
+}
+
+// Depacketize consumes a packet and returns any completed frames.
+func (d *LATMDepacketizer) Depacketize(p *rtp.Packet) ([]*codec.AccessUnit, error) {
+	if d.started && p.SN != d.sn+1 {
+		// packet loss, drop the partial frame
+		d.buf = nil
+		d.dropping = true
+	}
+	d.started = true
+	d.sn = p.SN
+	if d.dropping {
+		// the packet may continue a lost frame, resume after the marker
+		d.dropping = !p.Marker()
+		return nil, nil
+	}
+	if len(d.buf) == 0 {
+		d.ts = p.TS
+	}
+	d.buf = append(d.buf, p.Payload...)
+	if !p.Marker() {
+		return nil, nil
+	}
+	data := d.buf
+	d.buf = nil
+	var units []*codec.AccessUnit
+	for i := 0; len(data) > 0; i++ {
+		// PayloadLengthInfo
+		size := 0
+		for {
+			if len(data) == 0 {
+				return units, ErrTruncated
+			}
+			b := data[0]
+			data = data[1:]
+			size += int(b)
+			if b != 0xFF {
+				break
+			}
+		}
+		if size > len(data) {
+			return units, ErrTruncated
+		}
+		units = append(units, &codec.AccessUnit{
+			Timestamp: d.ts + uint32(i*SamplesPerFrame),
+			Data:      [][]byte{append([]byte(nil), data[:size]...)},
+			Key:       true,
+		})
+		data = data[size:]
+	}
+	return units, nil
+}
+
+// LATMPacketizer creates MP4A-LATM payloads with cpresent=0.
+type LATMPacketizer struct {
+	MTU    int
+	Config StreamMuxConfig
+
+	seq *rtp.Sequencer
+}
+
+// NewLATMPacketizer constructs a LATMPacketizer using the dynamic payload type.
+func NewLATMPacketizer(pt int, config AudioSpecificConfig) *LATMPacketizer {
+	return &LATMPacketizer{
+		MTU:    DefaultMTU,
+		Config: StreamMuxConfig{Config: config},
+		seq:    rtp.NewSequencer(pt),
+	}
+}
+
+// Sequencer returns the sequencer used to fill in the packet headers.
+func (p *LATMPacketizer) Sequencer() *rtp.Sequencer {
+	return p.seq
+}
+
+// Packetize creates packets containing the frame. Frames larger than
+// the MTU are split across packets with the marker on the last one.
+func (p *LATMPacketizer) Packetize(au *codec.AccessUnit) ([]*rtp.Packet, error) {
+	max := p.MTU - rtp.HeaderSize
+	if max <= 0 {
+		return nil, ErrMTUTooSmall
+	}
+	var packets []*rtp.Packet
+	for _, frame := range au.Data {
+		var data []byte
+		for n := len(frame); ; n -= 0xFF {
+			if n < 0xFF {
+				data = append(data, byte(n))
+				break
+			}
+			data = append(data, 0xFF)
+		}
+		data = append(data, frame...)
+		for len(data) > 0 {
+			n := len(data)
+			if n > max {
+				n = max
+			}
+			packets = append(packets, p.seq.Packet(au.Timestamp, n == len(data), data[:n]))
+			data = data[n:]
+		}
+	}
+	return packets, nil
+}
+
+// Fmtp returns the SDP fmtp parameters describing the stream.
+func (p *LATMPacketizer) Fmtp() map[string]string {
+	return map[string]string{
+		"profile-level-id": "30",
+		"cpresent":         "0",
+		"object":           fmt.Sprint(p.Config.Config.ObjectType),
+		"config":           p.Config.String(),
+	}
+}
@@ -0,0 +1,32 @@
+package aac
+
+import "github.com/icholy/rtsp/codec"
+
+func init() {
+	codec.Register(codec.Codec{
+		Encoding: "MPEG4-GENERIC",
+		NewDepacketizer: func(f codec.Format) (codec.Depacketizer, error) {
+			return NewDepacketizer(f.Fmtp)
+		},
+		NewPacketizer: func(f codec.Format) (codec.Packetizer, error) {
+			config, err := ParseAudioSpecificConfig(f.Fmtp["config"])
+			if err != nil {
+				return nil, err
+			}
+			return NewPacketizer(f.PayloadType, config), nil
+		},
+	})
+	codec.Register(codec.Codec{
+		Encoding: "MP4A-LATM",
+		NewDepacketizer: func(f codec.Format) (codec.Depacketizer, error) {
+			return NewLATMDepacketizer(f.Fmtp)
+		},
+		NewPacketizer: func(f codec.Format) (codec.Packetizer, error) {
+			mux, err := ParseStreamMuxConfig(f.Fmtp["config"])
+			if err != nil {
+				return nil, err
+			}
+			return NewLATMPacketizer(f.PayloadType, mux.Config), nil
+		},
+	})
+}
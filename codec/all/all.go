@@ -0,0 +1,18 @@
+// Package all registers every codec implemented by this module.
+//
+//	import _ "github.com/icholy/rtsp/codec/all"
+package all
+
+import (
+	// register codecs
+	_ "github.com/icholy/rtsp/codec/aac"
+	_ "github.com/icholy/rtsp/codec/av1"
+	_ "github.com/icholy/rtsp/codec/h264"
+	_ "github.com/icholy/rtsp/codec/h265"
+	_ "github.com/icholy/rtsp/codec/mjpeg"
+	_ "github.com/icholy/rtsp/codec/mp2t"
+	_ "github.com/icholy/rtsp/codec/opus"
+	_ "github.com/icholy/rtsp/codec/pcm"
+	_ "github.com/icholy/rtsp/codec/vp8"
+	_ "github.com/icholy/rtsp/codec/vp9"
+)
@@ -0,0 +1,322 @@
+// Package av1 implements the AV1 RTP payload format as specified by the
+// Alliance for Open Media.
+package av1
+
+import (
+	"errors"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// ClockRate is the RTP clock rate for AV1.
+const ClockRate = 90000
+
+// OBU types
+const (
+	OBUSequenceHeader       = 1
+	OBUTemporalDelimiter    = 2
+	OBUFrameHeader          = 3
+	OBUTileGroup            = 4
+	OBUMetadata             = 5
+	OBUFrame                = 6
+	OBURedundantFrameHeader = 7
+	OBUTileList             = 8
+	OBUPadding              = 15
+)
+
+// Errors returned when processing AV1 payloads.
+var (
+	ErrTruncated   = errors.New("av1: truncated payload")
+	ErrInvalidOBU  = errors.New("av1: invalid obu")
+	ErrMTUTooSmall = errors.New("av1: mtu too small")
+)
+
+// OBUType returns the type of the OBU.
+func OBUType(obu []byte) int {
+	if len(obu) == 0 {
+		return 0
+	}
+	return int(obu[0]>>3) & 0x0F
+}
+
+// AggregationHeader is the first byte of every AV1 RTP payload.
+//
+//	+-+-+-+-+-+-+-+-+
+//	|Z|Y| W |N|-|-|-|
+//	+-+-+-+-+-+-+-+-+
+type AggregationHeader struct {
+	Z bool  // the first OBU element continues an OBU from the previous packet
+	Y bool  // the last OBU element continues in the next packet
+	W uint8 // number of OBU elements, or zero if each element has a length
+	N bool  // the packet is the first of a new coded video sequence
+}
+
+// Unmarshal decodes the aggregation header.
+func (h *AggregationHeader) Unmarshal(b byte) {
+	h.Z = b&0x80 != 0
+	h.Y = b&0x40 != 0
+	h.W = (b >> 4) & 0x03
+	h.N = b&0x08 != 0
+}
+
+// Marshal encodes the aggregation header.
+func (h AggregationHeader) Marshal() byte {
+	b := h.W << 4
+	if h.Z {
+		b |= 0x80
+	}
+	if h.Y {
+		b |= 0x40
+	}
+	if h.N {
+		b |= 0x08
+	}
+	return b
+}
+
+// ReadLEB128 decodes an unsigned LEB128 value and returns the number of
+// bytes consumed. Zero is returned when the encoding is truncated.
+func ReadLEB128(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 8; i++ {
+		v |= uint64(b[i]&0x7F) << (7 * uint(i))
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// AppendLEB128 appends the LEB128 encoding of v to b.
+func AppendLEB128(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// stripSize removes the obu_size field from an OBU, which is not allowed
+// in RTP payloads.
+func stripSize(obu []byte) ([]byte, error) {
+	if len(obu) == 0 {
+		return nil, ErrInvalidOBU
+	}
+	if obu[0]&0x02 == 0 {
+		return obu, nil
+	}
+	hdr := 1
+	if obu[0]&0x04 != 0 {
+		hdr = 2
+	}
+	if len(obu) < hdr {
+		return nil, ErrInvalidOBU
+	}
+	size, n := ReadLEB128(obu[hdr:])
+	if n == 0 || uint64(len(obu)-hdr-n) < size {
+		return nil, ErrInvalidOBU
+	}
+	out := make([]byte, 0, hdr+int(size))
+	out = append(out, obu[0]&^0x02)
+	out = append(out, obu[1:hdr]...)
+	return append(out, obu[hdr+n:hdr+n+int(size)]...), nil
+}
+
+// Depacketizer reassembles AV1 temporal units. Each access unit contains
+// the OBUs of a temporal unit without obu_size fields.
+type Depacketizer struct {
+	obus    [][]byte
+	frag    []byte
+	ts      uint32
+	sn      uint16
+	key     bool
+	started bool
+	broken  bool
+}
+
+// NewDepacketizer constructs a Depacketizer.
+func NewDepacketizer() *Depacketizer {
+	return &Depacketizer{}
+}
+
+// Depacketize consumes a packet and returns the temporal unit once the
+// marker bit is set. Temporal units with missing packets are discarded.
+func (d *Depacketizer) Depacketize(p *rtp.Packet) ([]*codec.AccessUnit, error) {
+	if len(p.Payload) < 1 {
+		return nil, ErrTruncated
+	}
+	var h AggregationHeader
+	h.Unmarshal(p.Payload[0])
+	if !d.started || p.TS != d.ts {
+		d.reset(p.TS)
+		// a continued fragment can't be used without its beginning
+		d.broken = h.Z
+	} else if p.SN != d.sn+1 {
+		d.broken = true
+	}
+	d.sn = p.SN
+	if h.N {
+		d.key = true
+	}
+	if !d.broken {
+		if err := d.parse(h, p.Payload[1:]); err != nil {
+			d.broken = true
+		}
+	}
+	if !p.Marker() {
+		return nil, nil
+	}
+	d.started = false
+	if d.broken || len(d.obus) == 0 {
+		return nil, nil
+	}
+	return []*codec.AccessUnit{{
+		Timestamp: d.ts,
+		Data:      d.obus,
+		Key:       d.key,
+	}}, nil
+}
+
+func (d *Depacketizer) reset(ts uint32) {
+	d.obus = nil
+	d.frag = nil
+	d.ts = ts
+	d.key = false
+	d.broken = false
+	d.started = true
+}
+
+func (d *Depacketizer) parse(h AggregationHeader, b []byte) error {
+	for i := 0; len(b) > 0; i++ {
+		var elem []byte
+		if h.W != 0 && i == int(h.W)-1 {
+			elem, b = b, nil
+		} else {
+			size, n := ReadLEB128(b)
+			if n == 0 || uint64(len(b)-n) < size {
+				return ErrTruncated
+			}
+			elem, b = b[n:n+int(size)], b[n+int(size):]
+		}
+		first := i == 0 && h.Z
+		last := len(b) == 0 && h.Y
+		if first {
+			elem = append(d.frag, elem...)
+			d.frag = nil
+		}
+		if last {
+			d.frag = append([]byte(nil), elem...)
+			continue
+		}
+		if err := d.add(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Depacketizer) add(obu []byte) error {
+	obu, err := stripSize(obu)
+	if err != nil {
+		return err
+	}
+	switch OBUType(obu) {
+	case OBUTemporalDelimiter, OBUTileList, OBUPadding:
+		return nil
+	case OBUSequenceHeader:
+		d.key = true
+	}
+	d.obus = append(d.obus, append([]byte(nil), obu...))
+	return nil
+}
+
+// DefaultMTU is the default maximum RTP packet size.
+const DefaultMTU = 1200
+
+// Packetizer splits AV1 temporal units into packets. Each OBU is carried
+// as a length-prefixed element and fragmented across packets when it
+// doesn't fit.
+type Packetizer struct {
+	MTU int
+
+	seq *rtp.Sequencer
+}
+
+// NewPacketizer constructs a Packetizer using the dynamic payload type.
+func NewPacketizer(pt int) *Packetizer {
+	return &Packetizer{
+		MTU: DefaultMTU,
+		seq: rtp.NewSequencer(pt),
+	}
+}
+
+// Sequencer returns the sequencer used to fill in the packet headers.
+func (p *Packetizer) Sequencer() *rtp.Sequencer {
+	return p.seq
+}
+
+// Packetize converts the OBUs of a temporal unit into packets. Temporal
+// delimiters are dropped and obu_size fields are removed. The N bit is
+// set when the access unit is a key frame starting with a sequence header.
+func (p *Packetizer) Packetize(au *codec.AccessUnit) ([]*rtp.Packet, error) {
+	max := p.MTU - rtp.HeaderSize - 1
+	if max <= 8 {
+		return nil, ErrMTUTooSmall
+	}
+	var obus [][]byte
+	for _, obu := range au.Data {
+		obu, err := stripSize(obu)
+		if err != nil {
+			return nil, err
+		}
+		if t := OBUType(obu); t == OBUTemporalDelimiter || t == OBUTileList {
+			continue
+		}
+		obus = append(obus, obu)
+	}
+	var (
+		packets []*rtp.Packet
+		payload []byte
+		h       = AggregationHeader{N: au.Key && len(obus) > 0 && OBUType(obus[0]) == OBUSequenceHeader}
+	)
+	flush := func(last bool) {
+		payload[0] = h.Marshal()
+		packets = append(packets, p.seq.Packet(au.Timestamp, last, payload))
+		payload = nil
+		h = AggregationHeader{Z: h.Y}
+	}
+	for i, obu := range obus {
+		for len(obu) > 0 {
+			if payload == nil {
+				payload = []byte{0}
+			}
+			// leave room for the length prefix
+			room := max - (len(payload) - 1) - len(AppendLEB128(nil, uint64(max)))
+			if room <= 0 {
+				flush(false)
+				continue
+			}
+			n := len(obu)
+			if n > room {
+				n = room
+			}
+			payload = AppendLEB128(payload, uint64(n))
+			payload = append(payload, obu[:n]...)
+			obu = obu[n:]
+			if len(obu) > 0 {
+				h.Y = true
+				flush(false)
+			} else {
+				h.Y = false
+			}
+		}
+		if i == len(obus)-1 && payload != nil {
+			flush(true)
+		}
+	}
+	return packets, nil
+}
@@ -0,0 +1,63 @@
+package av1
+
+import (
+	"testing"
+
+	"github.com/icholy/rtsp/codec"
+	"gotest.tools/v3/assert"
+)
+
+func TestLEB128(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 300, 1 << 20} {
+		b := AppendLEB128(nil, v)
+		got, n := ReadLEB128(b)
+		assert.Equal(t, got, v)
+		assert.Equal(t, n, len(b))
+	}
+	_, n := ReadLEB128([]byte{0x80})
+	assert.Equal(t, n, 0)
+}
+
+func TestRoundTrip(t *testing.T) {
+	seq := []byte{OBUSequenceHeader << 3, 1, 2, 3}
+	td := []byte{OBUTemporalDelimiter<<3 | 0x02, 0x00}
+	frame := make([]byte, 2500)
+	frame[0] = OBUFrame << 3
+	for i := 1; i < len(frame); i++ {
+		frame[i] = byte(i)
+	}
+	// obu_size fields are removed by the packetizer
+	sized := append([]byte{OBUFrame<<3 | 0x02}, AppendLEB128(nil, uint64(len(frame)-1))...)
+	sized = append(sized, frame[1:]...)
+
+	p := NewPacketizer(35)
+	packets, err := p.Packetize(&codec.AccessUnit{
+		Timestamp: 3000,
+		Data:      [][]byte{td, seq, sized},
+		Key:       true,
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(packets), 3)
+	assert.Assert(t, packets[0].Payload[0]&0x08 != 0)
+	assert.Assert(t, packets[2].Marker())
+
+	d := NewDepacketizer()
+	var aus []*codec.AccessUnit
+	for _, pkt := range packets {
+		out, err := d.Depacketize(pkt)
+		assert.NilError(t, err)
+		aus = append(aus, out...)
+	}
+	assert.Equal(t, len(aus), 1)
+	assert.Assert(t, aus[0].Key)
+	assert.DeepEqual(t, aus[0].Data, [][]byte{seq, frame})
+
+	// a missing fragment discards the temporal unit
+	packets, err = p.Packetize(&codec.AccessUnit{Timestamp: 6000, Data: [][]byte{frame}})
+	assert.NilError(t, err)
+	for _, pkt := range []int{0, 2} {
+		out, err := d.Depacketize(packets[pkt])
+		assert.NilError(t, err)
+		assert.Equal(t, len(out), 0)
+	}
+}
@@ -0,0 +1,10 @@
+// Package codec contains the types shared by the RTP payload format
+// implementations in its subpackages.
+package codec
+
+// AccessUnit is a unit of media reassembled from RTP packets.
+type AccessUnit struct {
+	Timestamp uint32   // RTP timestamp
+	Data      [][]byte // NAL units for video, a single frame for audio
+	Key       bool     // can be decoded without previous access units
+}
@@ -0,0 +1,81 @@
+package h264
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrInvalidAVCC is returned when a length prefixed NAL unit is truncated.
+var ErrInvalidAVCC = errors.New("h264: invalid avcc data")
+
+var startCode = []byte{0, 0, 0, 1}
+
+// SplitAnnexB splits an Annex-B byte stream into NAL units.
+// Both 3 and 4 byte start codes are supported.
+func SplitAnnexB(b []byte) [][]byte {
+	var nalus [][]byte
+	start := -1
+	for i := 0; i+2 < len(b); {
+		if b[i] != 0 || b[i+1] != 0 || b[i+2] != 1 {
+			i++
+			continue
+		}
+		if start >= 0 {
+			nalus = appendNALU(nalus, b[start:i])
+		}
+		i += 3
+		start = i
+	}
+	if start >= 0 {
+		nalus = appendNALU(nalus, b[start:])
+	}
+	return nalus
+}
+
+func appendNALU(nalus [][]byte, nalu []byte) [][]byte {
+	// the trailing zero belongs to a 4 byte start code
+	nalu = bytes.TrimRight(nalu, "\x00")
+	if len(nalu) == 0 {
+		return nalus
+	}
+	return append(nalus, nalu)
+}
+
+// JoinAnnexB joins NAL units into an Annex-B byte stream using 4 byte start codes.
+func JoinAnnexB(nalus [][]byte) []byte {
+	var b []byte
+	for _, nalu := range nalus {
+		b = append(b, startCode...)
+		b = append(b, nalu...)
+	}
+	return b
+}
+
+// SplitAVCC splits 4 byte length prefixed NAL units as found in MP4 samples.
+func SplitAVCC(b []byte) ([][]byte, error) {
+	var nalus [][]byte
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, ErrInvalidAVCC
+		}
+		size := int(b[0])<<24 | int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+		b = b[4:]
+		if size > len(b) {
+			return nil, ErrInvalidAVCC
+		}
+		nalus = append(nalus, b[:size])
+		b = b[size:]
+	}
+	return nalus, nil
+}
+
+// JoinAVCC joins NAL units using 4 byte length prefixes.
+func JoinAVCC(nalus [][]byte) []byte {
+	var b []byte
+	for _, nalu := range nalus {
+		n := len(nalu)
+		b = append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+		b = append(b, nalu...)
+	}
+	return b
+}
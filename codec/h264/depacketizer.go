@@ -0,0 +1,139 @@
+package h264
+
+import (
+	"fmt"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// Depacketizer reassembles H.264 access units from RTP packets using
+// packetization-mode 0 or 1: single NAL unit, STAP-A and FU-A packets.
+type Depacketizer struct {
+	// SPS and PPS contain the latest parameter sets either from the
+	// sprop-parameter-sets fmtp parameter or seen in band.
+	SPS []byte
+	PPS []byte
+
+	started  bool
+	sn       uint16
+	ts       uint32
+	nalus    [][]byte
+	fragment []byte
+	dropping bool
+}
+
+// NewDepacketizer constructs a Depacketizer using the SDP fmtp parameters.
+// The fmtp may be nil.
+func NewDepacketizer(fmtp map[string]string) (*Depacketizer, error) {
+	d := &Depacketizer{}
+	if sprop, ok := fmtp["sprop-parameter-sets"]; ok {
+		sps, pps, err := ParseSpropParameterSets(sprop)
+		if err != nil {
+			return nil, err
+		}
+		d.SPS, d.PPS = sps, pps
+	}
+	return d, nil
+}
+
+// Depacketize consumes a packet and returns any completed access units.
+// An access unit is completed by the marker bit or a timestamp change.
+// When packets are lost, any partially received FU-A fragment is discarded.
+func (d *Depacketizer) Depacketize(p *rtp.Packet) ([]*codec.AccessUnit, error) {
+	var units []*codec.AccessUnit
+	if d.started {
+		if p.SN != d.sn+1 {
+			// packet loss, drop the partial fragment
+			d.fragment = nil
+			d.dropping = true
+		}
+		if p.TS != d.ts {
+			units = d.flush(units)
+		}
+	}
+	d.started = true
+	d.sn = p.SN
+	d.ts = p.TS
+	if err := d.payload(p.Payload); err != nil {
+		return units, err
+	}
+	if p.Marker() {
+		units = d.flush(units)
+	}
+	return units, nil
+}
+
+func (d *Depacketizer) payload(payload []byte) error {
+	if len(payload) == 0 {
+		return ErrEmptyPayload
+	}
+	switch typ := NALUType(payload); typ {
+	case NALUTypeSTAPA:
+		payload = payload[1:]
+		for len(payload) > 0 {
+			if len(payload) < 2 {
+				return ErrTruncatedPayload
+			}
+			size := int(payload[0])<<8 | int(payload[1])
+			payload = payload[2:]
+			if size == 0 || size > len(payload) {
+				return ErrTruncatedPayload
+			}
+			d.append(payload[:size])
+			payload = payload[size:]
+		}
+	case NALUTypeFUA:
+		if len(payload) < 2 {
+			return ErrTruncatedPayload
+		}
+		indicator, header := payload[0], payload[1]
+		start := header&0x80 != 0
+		end := header&0x40 != 0
+		if start {
+			d.dropping = false
+			d.fragment = append(d.fragment[:0], indicator&0xE0|header&0x1F)
+		} else if d.dropping || len(d.fragment) == 0 {
+			// the start of this fragment was lost
+			d.dropping = true
+			return nil
+		}
+		d.fragment = append(d.fragment, payload[2:]...)
+		if end {
+			d.append(d.fragment)
+			d.fragment = nil
+		}
+	case NALUTypeSTAPB, NALUTypeMTAP16, NALUTypeMTAP24, NALUTypeFUB:
+		return fmt.Errorf("h264: unsupported packet type: %d", typ)
+	default:
+		d.dropping = false
+		d.append(payload)
+	}
+	return nil
+}
+
+// append adds a copy of the NAL unit to the current access unit.
+func (d *Depacketizer) append(nalu []byte) {
+	nalu = append([]byte(nil), nalu...)
+	switch NALUType(nalu) {
+	case NALUTypeSPS:
+		d.SPS = nalu
+	case NALUTypePPS:
+		d.PPS = nalu
+	}
+	d.nalus = append(d.nalus, nalu)
+}
+
+func (d *Depacketizer) flush(units []*codec.AccessUnit) []*codec.AccessUnit {
+	d.fragment = nil
+	if len(d.nalus) == 0 {
+		return units
+	}
+	au := &codec.AccessUnit{
+		Timestamp: d.ts,
+		Data:      d.nalus,
+		Key:       IsKey(d.nalus),
+	}
+	d.nalus = nil
+	return append(units, au)
+}
@@ -0,0 +1,78 @@
+// Package h264 implements the H.264 RTP payload format (RFC 6184).
+package h264
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// NAL unit types
+const (
+	NALUTypeNonIDR = 1
+	NALUTypeIDR    = 5
+	NALUTypeSEI    = 6
+	NALUTypeSPS    = 7
+	NALUTypePPS    = 8
+	NALUTypeAUD    = 9
+	NALUTypeSTAPA  = 24
+	NALUTypeSTAPB  = 25
+	NALUTypeMTAP16 = 26
+	NALUTypeMTAP24 = 27
+	NALUTypeFUA    = 28
+	NALUTypeFUB    = 29
+)
+
+// Errors returned by the depacketizer.
+var (
+	ErrEmptyPayload     = errors.New("h264: empty payload")
+	ErrTruncatedPayload = errors.New("h264: truncated payload")
+)
+
+// NALUType returns the type of the NAL unit.
+func NALUType(nalu []byte) int {
+	if len(nalu) == 0 {
+		return 0
+	}
+	return int(nalu[0] & 0x1F)
+}
+
+// IsKey returns true when the NAL units contain an IDR slice.
+func IsKey(nalus [][]byte) bool {
+	for _, nalu := range nalus {
+		if NALUType(nalu) == NALUTypeIDR {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSpropParameterSets decodes the sprop-parameter-sets fmtp parameter
+// into the SPS and PPS NAL units.
+// ie: sprop-parameter-sets=Z00AKeKQDwBE/LgLcBAQGkHiRFQ=,aO48gA==
+func ParseSpropParameterSets(value string) (sps, pps []byte, err error) {
+	for _, s := range strings.Split(value, ",") {
+		if s == "" {
+			continue
+		}
+		nalu, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("h264: invalid sprop-parameter-sets: %v", err)
+		}
+		switch NALUType(nalu) {
+		case NALUTypeSPS:
+			sps = nalu
+		case NALUTypePPS:
+			pps = nalu
+		}
+	}
+	return sps, pps, nil
+}
+
+// FormatSpropParameterSets encodes the SPS and PPS NAL units as the value
+// of the sprop-parameter-sets fmtp parameter.
+func FormatSpropParameterSets(sps, pps []byte) string {
+	return base64.StdEncoding.EncodeToString(sps) + "," +
+		base64.StdEncoding.EncodeToString(pps)
+}
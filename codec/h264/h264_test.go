@@ -0,0 +1,182 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+	"gotest.tools/v3/assert"
+)
+
+func packet(sn uint16, ts uint32, marker bool, payload ...byte) *rtp.Packet {
+	p := &rtp.Packet{SN: sn, TS: ts, Payload: payload}
+	p.SetMarker(marker)
+	return p
+}
+
+func TestDepacketizer(t *testing.T) {
+	d, err := NewDepacketizer(map[string]string{
+		"sprop-parameter-sets": "Z00AKeKQDwBE/LgLcBAQGkHiRFQ=,aO48gA==",
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, NALUType(d.SPS), NALUTypeSPS)
+	assert.Equal(t, NALUType(d.PPS), NALUTypePPS)
+
+	var units []*codec.AccessUnit
+	for _, p := range []*rtp.Packet{
+		// STAP-A with an AUD and SEI
+		packet(1, 1000, false, 0x18, 0x00, 0x02, 0x09, 0xF0, 0x00, 0x02, 0x06, 0x01),
+		// FU-A IDR slice split in three
+		packet(2, 1000, false, 0x7C, 0x85, 1, 2),
+		packet(3, 1000, false, 0x7C, 0x05, 3, 4),
+		packet(4, 1000, true, 0x7C, 0x45, 5),
+		// single NAL unit
+		packet(5, 4000, true, 0x41, 9, 9),
+		// FU-A with a lost middle packet
+		packet(6, 7000, false, 0x7C, 0x81, 1),
+		packet(8, 7000, false, 0x7C, 0x41, 3),
+		// timestamp change without a marker
+		packet(9, 10000, false, 0x41, 7),
+		packet(10, 13000, true, 0x41, 8),
+	} {
+		au, err := d.Depacketize(p)
+		assert.NilError(t, err)
+		units = append(units, au...)
+	}
+	assert.DeepEqual(t, units, []*codec.AccessUnit{
+		{
+			Timestamp: 1000,
+			Data:      [][]byte{{0x09, 0xF0}, {0x06, 0x01}, {0x65, 1, 2, 3, 4, 5}},
+			Key:       true,
+		},
+		{Timestamp: 4000, Data: [][]byte{{0x41, 9, 9}}},
+		{Timestamp: 10000, Data: [][]byte{{0x41, 7}}},
+		{Timestamp: 13000, Data: [][]byte{{0x41, 8}}},
+	})
+}
+
+func TestPacketizer(t *testing.T) {
+	sps, pps, err := ParseSpropParameterSets("Z00AKeKQDwBE/LgLcBAQGkHiRFQ=,aO48gA==")
+	assert.NilError(t, err)
+	idr := make([]byte, 3000)
+	idr[0] = 0x65
+	for i := 1; i < len(idr); i++ {
+		idr[i] = byte(i)
+	}
+	au := &codec.AccessUnit{
+		Timestamp: 9000,
+		Data:      SplitAnnexB(JoinAnnexB([][]byte{sps, pps, idr})),
+		Key:       true,
+	}
+	p := NewPacketizer(96)
+	p.MTU = 1000
+	packets, err := p.Packetize(au)
+	assert.NilError(t, err)
+	// STAP-A with the parameter sets followed by 4 FU-A fragments
+	assert.Equal(t, len(packets), 5)
+	assert.Equal(t, NALUType(packets[0].Payload), NALUTypeSTAPA)
+	for i, pkt := range packets {
+		assert.Assert(t, pkt.MarshalSize() <= p.MTU)
+		assert.Equal(t, pkt.Marker(), i == len(packets)-1)
+		assert.Equal(t, pkt.PayloadType(), 96)
+	}
+	assert.Equal(t, p.Fmtp()["profile-level-id"], "4d0029")
+
+	// round trip through the depacketizer
+	d, err := NewDepacketizer(nil)
+	assert.NilError(t, err)
+	var units []*codec.AccessUnit
+	for _, pkt := range packets {
+		buf, err := pkt.Marshal()
+		assert.NilError(t, err)
+		parsed, err := rtp.Parse(buf)
+		assert.NilError(t, err)
+		au, err := d.Depacketize(parsed)
+		assert.NilError(t, err)
+		units = append(units, au...)
+	}
+	assert.DeepEqual(t, units, []*codec.AccessUnit{au})
+}
+
+func TestParseSPS(t *testing.T) {
+	sps, _, err := ParseSpropParameterSets("Z00AKeKQDwBE/LgLcBAQGkHiRFQ=,aO48gA==")
+	assert.NilError(t, err)
+	s, err := ParseSPS(sps)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s, SPS{ProfileIDC: 77, LevelIDC: 41, ChromaFormatIDC: 1, Width: 1920, Height: 1080})
+
+	// high profile with frame cropping
+	sps, _, err = ParseSpropParameterSets("Z2QAKKwbGoB4AiflwFuAgICgAAB9AAAXcAHjBEww,aO48sA==")
+	assert.NilError(t, err)
+	s, err = ParseSPS(sps)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Width, 1920)
+	assert.Equal(t, s.Height, 1080)
+
+	// high 10 profile
+	var w bitWriter
+	w.u(0x67, 8)
+	w.u(110, 8) // profile_idc
+	w.u(0, 8)   // constraint flags
+	w.u(40, 8)  // level_idc
+	w.ue(0)     // seq_parameter_set_id
+	w.ue(1)     // chroma_format_idc
+	w.ue(2)     // bit_depth_luma_minus8
+	w.ue(2)     // bit_depth_chroma_minus8
+	w.u(0, 2)   // qpprime_y_zero_transform_bypass_flag, seq_scaling_matrix_present_flag
+	w.ue(0)     // log2_max_frame_num_minus4
+	w.ue(2)     // pic_order_cnt_type
+	w.ue(1)     // max_num_ref_frames
+	w.u(0, 1)   // gaps_in_frame_num_value_allowed_flag
+	w.ue(119)   // pic_width_in_mbs_minus1
+	w.ue(67)    // pic_height_in_map_units_minus1
+	w.u(3, 2)   // frame_mbs_only_flag, direct_8x8_inference_flag
+	w.u(1, 1)   // frame_cropping_flag
+	w.ue(0)
+	w.ue(0)
+	w.ue(0)
+	w.ue(4)
+	w.u(0, 1) // vui_parameters_present_flag
+	w.u(1, 1) // rbsp_stop_one_bit
+	s, err = ParseSPS(w.bytes())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s, SPS{
+		ProfileIDC:           110,
+		LevelIDC:             40,
+		ChromaFormatIDC:      1,
+		BitDepthLumaMinus8:   2,
+		BitDepthChromaMinus8: 2,
+		Width:                1920,
+		Height:               1080,
+	})
+}
+
+// bitWriter builds test bitstreams.
+type bitWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *bitWriter) u(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>uint(i)&1) << uint(7-w.n%8)
+		w.n++
+	}
+}
+
+func (w *bitWriter) ue(v uint32) {
+	v++
+	n := 0
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.u(0, n)
+	w.u(v, n+1)
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
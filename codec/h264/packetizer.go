@@ -0,0 +1,147 @@
+package h264
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// DefaultMTU is the default maximum RTP packet size.
+const DefaultMTU = 1200
+
+// ErrMTUTooSmall is returned when the MTU can't fit a FU-A fragment.
+var ErrMTUTooSmall = errors.New("h264: mtu too small")
+
+// Packetizer splits H.264 access units into RTP packets using
+// packetization-mode 1. NAL units larger than the MTU are fragmented
+// with FU-A, and consecutive small NAL units are aggregated with STAP-A.
+type Packetizer struct {
+	// MTU is the maximum size of a packet including the RTP header.
+	MTU int
+	// SPS and PPS contain the latest parameter sets seen in the access units.
+	SPS []byte
+	PPS []byte
+
+	seq *rtp.Sequencer
+}
+
+// NewPacketizer constructs a Packetizer using the dynamic payload type.
+func NewPacketizer(pt int) *Packetizer {
+	return &Packetizer{
+		MTU: DefaultMTU,
+		seq: rtp.NewSequencer(pt),
+	}
+}
+
+// Sequencer returns the sequencer used to fill in the packet headers.
+func (p *Packetizer) Sequencer() *rtp.Sequencer {
+	return p.seq
+}
+
+// Packetize splits the access unit's NAL units into packets.
+// The marker bit is set on the last packet.
+func (p *Packetizer) Packetize(au *codec.AccessUnit) ([]*rtp.Packet, error) {
+	max := p.MTU - rtp.HeaderSize
+	if max < 3 {
+		return nil, ErrMTUTooSmall
+	}
+	var payloads [][]byte
+	var stap [][]byte
+	stapSize := 1
+	flush := func() {
+		switch len(stap) {
+		case 0:
+		case 1:
+			payloads = append(payloads, stap[0])
+		default:
+			payload := make([]byte, 1, stapSize)
+			// use the highest NRI of the aggregated units
+			var nri byte
+			for _, nalu := range stap {
+				if nalu[0]&0x60 > nri {
+					nri = nalu[0] & 0x60
+				}
+				payload = append(payload, byte(len(nalu)>>8), byte(len(nalu)))
+				payload = append(payload, nalu...)
+			}
+			payload[0] = nri | NALUTypeSTAPA
+			payloads = append(payloads, payload)
+		}
+		stap = nil
+		stapSize = 1
+	}
+	for _, nalu := range au.Data {
+		if len(nalu) == 0 {
+			continue
+		}
+		switch NALUType(nalu) {
+		case NALUTypeSPS:
+			p.SPS = nalu
+		case NALUTypePPS:
+			p.PPS = nalu
+		}
+		if len(nalu) > max {
+			flush()
+			payloads = append(payloads, fragment(nalu, max)...)
+			continue
+		}
+		if stapSize+2+len(nalu) > max {
+			flush()
+		}
+		stap = append(stap, nalu)
+		stapSize += 2 + len(nalu)
+	}
+	flush()
+	packets := make([]*rtp.Packet, len(payloads))
+	for i, payload := range payloads {
+		packets[i] = p.seq.Packet(au.Timestamp, i == len(payloads)-1, payload)
+	}
+	return packets, nil
+}
+
+// fragment splits the NAL unit into FU-A payloads.
+func fragment(nalu []byte, max int) [][]byte {
+	indicator := nalu[0]&0xE0 | NALUTypeFUA
+	typ := nalu[0] & 0x1F
+	data := nalu[1:]
+	var payloads [][]byte
+	for first := true; len(data) > 0; first = false {
+		n := max - 2
+		if n > len(data) {
+			n = len(data)
+		}
+		header := typ
+		if first {
+			header |= 0x80
+		}
+		if n == len(data) {
+			header |= 0x40
+		}
+		payload := make([]byte, 2, 2+n)
+		payload[0], payload[1] = indicator, header
+		payloads = append(payloads, append(payload, data[:n]...))
+		data = data[n:]
+	}
+	return payloads
+}
+
+// Fmtp returns the SDP fmtp parameters describing the stream.
+// The parameter sets are taken from the SPS and PPS fields.
+func (p *Packetizer) Fmtp() map[string]string {
+	return Fmtp(p.SPS, p.PPS)
+}
+
+// Fmtp returns the SDP fmtp parameters for packetization-mode 1 using the
+// provided parameter sets. The profile-level-id is taken from the SPS.
+func Fmtp(sps, pps []byte) map[string]string {
+	fmtp := map[string]string{"packetization-mode": "1"}
+	if len(sps) >= 4 {
+		fmtp["profile-level-id"] = hex.EncodeToString(sps[1:4])
+	}
+	if len(sps) > 0 && len(pps) > 0 {
+		fmtp["sprop-parameter-sets"] = FormatSpropParameterSets(sps, pps)
+	}
+	return fmtp
+}
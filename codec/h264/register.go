@@ -0,0 +1,23 @@
+package h264
+
+import "github.com/icholy/rtsp/codec"
+
+func init() {
+	codec.Register(codec.Codec{
+		Encoding: "H264",
+		NewDepacketizer: func(f codec.Format) (codec.Depacketizer, error) {
+			return NewDepacketizer(f.Fmtp)
+		},
+		NewPacketizer: func(f codec.Format) (codec.Packetizer, error) {
+			p := NewPacketizer(f.PayloadType)
+			if sprop, ok := f.Fmtp["sprop-parameter-sets"]; ok {
+				sps, pps, err := ParseSpropParameterSets(sprop)
+				if err != nil {
+					return nil, err
+				}
+				p.SPS, p.PPS = sps, pps
+			}
+			return p, nil
+		},
+	})
+}
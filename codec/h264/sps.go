@@ -0,0 +1,172 @@
+package h264
+
+import "errors"
+
+// ErrInvalidSPS is returned when a sequence parameter set can't be parsed.
+var ErrInvalidSPS = errors.New("h264: invalid sps")
+
+// SPS contains the fields of a sequence parameter set needed to describe
+// the stream in containers (ITU-T H.264 7.3.2.1.1).
+type SPS struct {
+	ProfileIDC           uint8
+	ConstraintFlags      uint8
+	LevelIDC             uint8
+	ChromaFormatIDC      int
+	BitDepthLumaMinus8   int
+	BitDepthChromaMinus8 int
+	Width                int
+	Height               int
+}
+
+// ParseSPS decodes the SPS NAL unit.
+func ParseSPS(nalu []byte) (SPS, error) {
+	var s SPS
+	if len(nalu) < 4 || NALUType(nalu) != NALUTypeSPS {
+		return s, ErrInvalidSPS
+	}
+	s.ProfileIDC = nalu[1]
+	s.ConstraintFlags = nalu[2]
+	s.LevelIDC = nalu[3]
+	r := &bitReader{buf: unescapeRBSP(nalu[4:])}
+	r.ue() // seq_parameter_set_id
+	chroma := uint32(1)
+	switch s.ProfileIDC {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chroma = r.ue()
+		if chroma == 3 {
+			r.u(1) // separate_colour_plane_flag
+		}
+		s.BitDepthLumaMinus8 = int(r.ue())
+		s.BitDepthChromaMinus8 = int(r.ue())
+		r.u(1) // qpprime_y_zero_transform_bypass_flag
+		if r.u(1) == 1 {
+			n := 8
+			if chroma == 3 {
+				n = 12
+			}
+			for i := 0; i < n; i++ {
+				if r.u(1) == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				skipScalingList(r, size)
+			}
+		}
+	}
+	r.ue() // log2_max_frame_num_minus4
+	switch r.ue() {
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.u(1) // delta_pic_order_always_zero_flag
+		r.se() // offset_for_non_ref_pic
+		r.se() // offset_for_top_to_bottom_field
+		n := r.ue()
+		for i := uint32(0); i < n && r.err == nil; i++ {
+			r.se()
+		}
+	}
+	r.ue() // max_num_ref_frames
+	r.u(1) // gaps_in_frame_num_value_allowed_flag
+	width := int(r.ue()) + 1
+	height := int(r.ue()) + 1
+	frameMBsOnly := int(r.u(1))
+	if frameMBsOnly == 0 {
+		r.u(1) // mb_adaptive_frame_field_flag
+	}
+	r.u(1) // direct_8x8_inference_flag
+	s.Width = width * 16
+	s.Height = (2 - frameMBsOnly) * height * 16
+	if r.u(1) == 1 {
+		left, right, top, bottom := int(r.ue()), int(r.ue()), int(r.ue()), int(r.ue())
+		cropX, cropY := 1, 2-frameMBsOnly
+		switch chroma {
+		case 1:
+			cropX, cropY = 2, 2*(2-frameMBsOnly)
+		case 2:
+			cropX = 2
+		}
+		s.Width -= cropX * (left + right)
+		s.Height -= cropY * (top + bottom)
+	}
+	s.ChromaFormatIDC = int(chroma)
+	if r.err != nil || s.Width <= 0 || s.Height <= 0 {
+		return SPS{}, ErrInvalidSPS
+	}
+	return s, nil
+}
+
+func skipScalingList(r *bitReader, size int) {
+	last, next := int32(8), int32(8)
+	for j := 0; j < size && r.err == nil; j++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// unescapeRBSP removes the emulation prevention bytes.
+func unescapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// bitReader reads exp-golomb coded fields. The first error is recorded
+// and subsequent reads return zero.
+type bitReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *bitReader) u(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.buf)*8 {
+			r.err = ErrInvalidSPS
+			return 0
+		}
+		v = v<<1 | uint32(r.buf[r.pos/8]>>(7-uint(r.pos%8))&1)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) ue() uint32 {
+	zeros := 0
+	for r.u(1) == 0 {
+		if r.err != nil || zeros == 31 {
+			r.err = ErrInvalidSPS
+			return 0
+		}
+		zeros++
+	}
+	return 1<<uint(zeros) - 1 + r.u(zeros)
+}
+
+func (r *bitReader) se() int32 {
+	v := r.ue()
+	if v&1 == 1 {
+		return int32(v/2) + 1
+	}
+	return -int32(v / 2)
+}
@@ -0,0 +1,193 @@
+package h265
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// Depacketizer reassembles H.265 access units from single NAL unit,
+// aggregation (AP) and fragmentation unit (FU) packets.
+type Depacketizer struct {
+	// ParameterSets contains the latest parameter sets either from the
+	// fmtp parameters or seen in band.
+	ParameterSets ParameterSets
+
+	// donl is true when the packets carry decoding order numbers.
+	donl bool
+
+	started  bool
+	sn       uint16
+	ts       uint32
+	nalus    []donNALU
+	fragment []byte
+	fragDON  uint16
+	dropping bool
+}
+
+type donNALU struct {
+	don  uint16
+	nalu []byte
+}
+
+// NewDepacketizer constructs a Depacketizer using the SDP fmtp parameters.
+// The fmtp may be nil.
+func NewDepacketizer(fmtp map[string]string) (*Depacketizer, error) {
+	ps, err := ParseParameterSets(fmtp)
+	if err != nil {
+		return nil, err
+	}
+	donl, err := hasDON(fmtp)
+	if err != nil {
+		return nil, err
+	}
+	return &Depacketizer{
+		ParameterSets: ps,
+		donl:          donl,
+	}, nil
+}
+
+// Depacketize consumes a packet and returns any completed access units.
+// An access unit is completed by the marker bit or a timestamp change.
+// When decoding order numbers are present, the NAL units of an access
+// unit are sorted by them.
+func (d *Depacketizer) Depacketize(p *rtp.Packet) ([]*codec.AccessUnit, error) {
+	var units []*codec.AccessUnit
+	if d.started {
+		if p.SN != d.sn+1 {
+			// packet loss, drop the partial fragment
+			d.fragment = nil
+			d.dropping = true
+		}
+		if p.TS != d.ts {
+			units = d.flush(units)
+		}
+	}
+	d.started = true
+	d.sn = p.SN
+	d.ts = p.TS
+	if err := d.payload(p.Payload); err != nil {
+		return units, err
+	}
+	if p.Marker() {
+		units = d.flush(units)
+	}
+	return units, nil
+}
+
+func (d *Depacketizer) payload(payload []byte) error {
+	if len(payload) < 2 {
+		return ErrEmptyPayload
+	}
+	switch typ := NALUType(payload); typ {
+	case NALUTypeAP:
+		payload = payload[2:]
+		var don uint16
+		for first := true; len(payload) > 0; first = false {
+			if d.donl {
+				if first {
+					if len(payload) < 2 {
+						return ErrTruncatedPayload
+					}
+					don = uint16(payload[0])<<8 | uint16(payload[1])
+					payload = payload[2:]
+				} else {
+					if len(payload) < 1 {
+						return ErrTruncatedPayload
+					}
+					don += uint16(payload[0]) + 1
+					payload = payload[1:]
+				}
+			}
+			if len(payload) < 2 {
+				return ErrTruncatedPayload
+			}
+			size := int(payload[0])<<8 | int(payload[1])
+			payload = payload[2:]
+			if size == 0 || size > len(payload) {
+				return ErrTruncatedPayload
+			}
+			d.append(don, payload[:size])
+			payload = payload[size:]
+		}
+	case NALUTypeFU:
+		if len(payload) < 3 {
+			return ErrTruncatedPayload
+		}
+		header := payload[2]
+		start := header&0x80 != 0
+		end := header&0x40 != 0
+		data := payload[3:]
+		if start {
+			if d.donl {
+				if len(data) < 2 {
+					return ErrTruncatedPayload
+				}
+				d.fragDON = uint16(data[0])<<8 | uint16(data[1])
+				data = data[2:]
+			}
+			d.dropping = false
+			// rebuild the NAL unit header using the FU type
+			d.fragment = append(d.fragment[:0],
+				payload[0]&0x81|(header&0x3F)<<1,
+				payload[1],
+			)
+		} else if d.dropping || len(d.fragment) == 0 {
+			// the start of this fragment was lost
+			d.dropping = true
+			return nil
+		}
+		d.fragment = append(d.fragment, data...)
+		if end {
+			d.append(d.fragDON, d.fragment)
+			d.fragment = nil
+		}
+	case NALUTypePACI:
+		return fmt.Errorf("h265: unsupported packet type: %d", typ)
+	default:
+		d.dropping = false
+		var don uint16
+		if d.donl {
+			if len(payload) < 4 {
+				return ErrTruncatedPayload
+			}
+			don = uint16(payload[2])<<8 | uint16(payload[3])
+			payload = append(payload[:2:2], payload[4:]...)
+		}
+		d.append(don, payload)
+	}
+	return nil
+}
+
+// append adds a copy of the NAL unit to the current access unit.
+func (d *Depacketizer) append(don uint16, nalu []byte) {
+	nalu = append([]byte(nil), nalu...)
+	d.ParameterSets.update(nalu)
+	d.nalus = append(d.nalus, donNALU{don: don, nalu: nalu})
+}
+
+func (d *Depacketizer) flush(units []*codec.AccessUnit) []*codec.AccessUnit {
+	d.fragment = nil
+	if len(d.nalus) == 0 {
+		return units
+	}
+	if d.donl {
+		// compare relative to the first unit to handle wraparound
+		base := d.nalus[0].don
+		sort.SliceStable(d.nalus, func(i, j int) bool {
+			return int16(d.nalus[i].don-base) < int16(d.nalus[j].don-base)
+		})
+	}
+	nalus := make([][]byte, len(d.nalus))
+	for i, n := range d.nalus {
+		nalus[i] = n.nalu
+	}
+	d.nalus = nil
+	return append(units, &codec.AccessUnit{
+		Timestamp: d.ts,
+		Data:      nalus,
+		Key:       IsKey(nalus),
+	})
+}
@@ -0,0 +1,128 @@
+// Package h265 implements the H.265/HEVC RTP payload format (RFC 7798).
+package h265
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NAL unit types
+const (
+	NALUTypeBLAWLP    = 16
+	NALUTypeCRANUT    = 21
+	NALUTypeVPS       = 32
+	NALUTypeSPS       = 33
+	NALUTypePPS       = 34
+	NALUTypeAUD       = 35
+	NALUTypePrefixSEI = 39
+	NALUTypeAP        = 48
+	NALUTypeFU        = 49
+	NALUTypePACI      = 50
+)
+
+// Errors returned by the depacketizer.
+var (
+	ErrEmptyPayload     = errors.New("h265: empty payload")
+	ErrTruncatedPayload = errors.New("h265: truncated payload")
+	ErrMTUTooSmall      = errors.New("h265: mtu too small")
+)
+
+// NALUType returns the type of the NAL unit.
+func NALUType(nalu []byte) int {
+	if len(nalu) == 0 {
+		return 0
+	}
+	return int(nalu[0]>>1) & 0x3F
+}
+
+// IsKey returns true when the NAL units contain an IRAP picture.
+func IsKey(nalus [][]byte) bool {
+	for _, nalu := range nalus {
+		if typ := NALUType(nalu); typ >= NALUTypeBLAWLP && typ <= 23 {
+			return true
+		}
+	}
+	return false
+}
+
+// ParameterSets contains the VPS, SPS and PPS NAL units.
+type ParameterSets struct {
+	VPS []byte
+	SPS []byte
+	PPS []byte
+}
+
+// ParseParameterSets decodes the sprop-vps, sprop-sps and sprop-pps
+// fmtp parameters. Only the first of each parameter set is used.
+func ParseParameterSets(fmtp map[string]string) (ParameterSets, error) {
+	var ps ParameterSets
+	for _, p := range []struct {
+		key  string
+		nalu *[]byte
+	}{
+		{"sprop-vps", &ps.VPS},
+		{"sprop-sps", &ps.SPS},
+		{"sprop-pps", &ps.PPS},
+	} {
+		value, ok := fmtp[p.key]
+		if !ok || value == "" {
+			continue
+		}
+		nalu, err := base64.StdEncoding.DecodeString(strings.Split(value, ",")[0])
+		if err != nil {
+			return ps, fmt.Errorf("h265: invalid %s: %v", p.key, err)
+		}
+		*p.nalu = nalu
+	}
+	return ps, nil
+}
+
+// Fmtp returns the SDP fmtp parameters for the parameter sets.
+func (ps ParameterSets) Fmtp() map[string]string {
+	fmtp := map[string]string{}
+	if len(ps.VPS) > 0 {
+		fmtp["sprop-vps"] = base64.StdEncoding.EncodeToString(ps.VPS)
+	}
+	if len(ps.SPS) > 0 {
+		fmtp["sprop-sps"] = base64.StdEncoding.EncodeToString(ps.SPS)
+	}
+	if len(ps.PPS) > 0 {
+		fmtp["sprop-pps"] = base64.StdEncoding.EncodeToString(ps.PPS)
+	}
+	return fmtp
+}
+
+// update records the NAL unit if it's a parameter set.
+func (ps *ParameterSets) update(nalu []byte) {
+	switch NALUType(nalu) {
+	case NALUTypeVPS:
+		ps.VPS = nalu
+	case NALUTypeSPS:
+		ps.SPS = nalu
+	case NALUTypePPS:
+		ps.PPS = nalu
+	}
+}
+
+// hasDON returns true when the packets contain decoding order number
+// fields. This is the case when sprop-max-don-diff or
+// sprop-depack-buf-nalus is greater than zero (RFC 7798 section 7.1).
+func hasDON(fmtp map[string]string) (bool, error) {
+	for _, key := range []string{"sprop-max-don-diff", "sprop-depack-buf-nalus"} {
+		value, ok := fmtp[key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return false, fmt.Errorf("h265: invalid %s: %v", key, err)
+		}
+		if n > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,151 @@
+package h265
+
+import (
+	"testing"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+	"gotest.tools/v3/assert"
+)
+
+func nalu(typ int, size int) []byte {
+	b := make([]byte, size)
+	b[0] = byte(typ << 1)
+	b[1] = 1
+	for i := 2; i < size; i++ {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	au := &codec.AccessUnit{
+		Timestamp: 3000,
+		Data: [][]byte{
+			nalu(NALUTypeVPS, 20),
+			nalu(NALUTypeSPS, 40),
+			nalu(NALUTypePPS, 8),
+			nalu(19, 5000),
+		},
+		Key: true,
+	}
+	p := NewPacketizer(96)
+	packets, err := p.Packetize(au)
+	assert.NilError(t, err)
+	assert.Equal(t, NALUType(packets[0].Payload), NALUTypeAP)
+	assert.Equal(t, NALUType(packets[1].Payload), NALUTypeFU)
+
+	d, err := NewDepacketizer(p.Fmtp())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, d.ParameterSets.SPS, au.Data[1])
+	var units []*codec.AccessUnit
+	for _, pkt := range packets {
+		assert.Assert(t, pkt.MarshalSize() <= p.MTU)
+		u, err := d.Depacketize(pkt)
+		assert.NilError(t, err)
+		units = append(units, u...)
+	}
+	assert.DeepEqual(t, units, []*codec.AccessUnit{au})
+}
+
+func TestDONL(t *testing.T) {
+	for _, fmtp := range []map[string]string{
+		{"sprop-max-don-diff": "2"},
+		{"sprop-max-don-diff": "0", "sprop-depack-buf-nalus": "1"},
+	} {
+		testDONL(t, fmtp)
+	}
+}
+
+func testDONL(t *testing.T, fmtp map[string]string) {
+	d, err := NewDepacketizer(fmtp)
+	assert.NilError(t, err)
+	// aggregation packet with DONL 10 followed by DOND 0 (DON 11)
+	ap := []byte{NALUTypeAP << 1, 1, 0, 10, 0, 3, 2, 1, 0xAA, 0, 0, 3, 2, 1, 0xBB}
+	// single NAL unit with DONL 9
+	single := []byte{2, 1, 0, 9, 0xCC}
+	p1 := &rtp.Packet{SN: 1, TS: 100, Payload: ap}
+	p2 := &rtp.Packet{SN: 2, TS: 100, Payload: single}
+	p2.SetMarker(true)
+	_, err = d.Depacketize(p1)
+	assert.NilError(t, err)
+	units, err := d.Depacketize(p2)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, units, []*codec.AccessUnit{{
+		Timestamp: 100,
+		Data:      [][]byte{{2, 1, 0xCC}, {2, 1, 0xAA}, {2, 1, 0xBB}},
+	}})
+}
+
+func TestParseSPS(t *testing.T) {
+	ps, err := ParseParameterSets(map[string]string{
+		"sprop-sps": "QgEBAWAAAAMAsAAAAwAAAwB4oAPAgBDlja5JMvTcBAQEAg==",
+	})
+	assert.NilError(t, err)
+	s, err := ParseSPS(ps.SPS)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Width, 1920)
+	assert.Equal(t, s.Height, 1080)
+	assert.Equal(t, s.ChromaFormatIDC, 1)
+	assert.Equal(t, s.BitDepthLumaMinus8, 0)
+	assert.Equal(t, s.BitDepthChromaMinus8, 0)
+	assert.Equal(t, s.ProfileTierLevel[0], byte(0x01))
+
+	// main 10 profile
+	var w bitWriter
+	w.u(NALUTypeSPS<<1, 8)
+	w.u(1, 8)
+	w.u(0, 4)    // sps_video_parameter_set_id
+	w.u(0, 3)    // sps_max_sub_layers_minus1
+	w.u(1, 1)    // sps_temporal_id_nesting_flag
+	w.u(0x02, 8) // general_profile_idc
+	w.u(0x20000000, 32)
+	w.u(0x90, 8)
+	w.u(0, 32)
+	w.u(0, 8)
+	w.u(93, 8) // general_level_idc
+	w.ue(0)    // sps_seq_parameter_set_id
+	w.ue(1)    // chroma_format_idc
+	w.ue(3840) // pic_width_in_luma_samples
+	w.ue(2160) // pic_height_in_luma_samples
+	w.u(0, 1)  // conformance_window_flag
+	w.ue(2)    // bit_depth_luma_minus8
+	w.ue(2)    // bit_depth_chroma_minus8
+	w.u(1, 1)  // rbsp_stop_one_bit
+	s, err = ParseSPS(w.bytes())
+	assert.NilError(t, err)
+	assert.Equal(t, s.Width, 3840)
+	assert.Equal(t, s.Height, 2160)
+	assert.Equal(t, s.BitDepthLumaMinus8, 2)
+	assert.Equal(t, s.BitDepthChromaMinus8, 2)
+}
+
+// bitWriter builds test bitstreams.
+type bitWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *bitWriter) u(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>uint(i)&1) << uint(7-w.n%8)
+		w.n++
+	}
+}
+
+func (w *bitWriter) ue(v uint32) {
+	v++
+	n := 0
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.u(0, n)
+	w.u(v, n+1)
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
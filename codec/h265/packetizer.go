@@ -0,0 +1,131 @@
+package h265
+
+import (
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// DefaultMTU is the default maximum RTP packet size.
+const DefaultMTU = 1200
+
+// Packetizer splits H.265 access units into RTP packets. NAL units
+// larger than the MTU are fragmented into FUs, and consecutive small
+// NAL units are aggregated into APs. Decoding order numbers are not
+// used, so the fmtp must not set sprop-max-don-diff or
+// sprop-depack-buf-nalus.
+type Packetizer struct {
+	// MTU is the maximum size of a packet including the RTP header.
+	MTU int
+	// ParameterSets contains the latest parameter sets seen in the access units.
+	ParameterSets ParameterSets
+
+	seq *rtp.Sequencer
+}
+
+// NewPacketizer constructs a Packetizer using the dynamic payload type.
+func NewPacketizer(pt int) *Packetizer {
+	return &Packetizer{
+		MTU: DefaultMTU,
+		seq: rtp.NewSequencer(pt),
+	}
+}
+
+// Sequencer returns the sequencer used to fill in the packet headers.
+func (p *Packetizer) Sequencer() *rtp.Sequencer {
+	return p.seq
+}
+
+// Fmtp returns the SDP fmtp parameters describing the stream.
+func (p *Packetizer) Fmtp() map[string]string {
+	return p.ParameterSets.Fmtp()
+}
+
+// Packetize splits the access unit's NAL units into packets.
+// The marker bit is set on the last packet.
+func (p *Packetizer) Packetize(au *codec.AccessUnit) ([]*rtp.Packet, error) {
+	max := p.MTU - rtp.HeaderSize
+	if max < 4 {
+		return nil, ErrMTUTooSmall
+	}
+	var payloads [][]byte
+	var ap [][]byte
+	apSize := 2
+	flush := func() {
+		switch len(ap) {
+		case 0:
+		case 1:
+			payloads = append(payloads, ap[0])
+		default:
+			// the AP header uses the lowest layer and temporal ids
+			// and sets F if any aggregated unit has it set
+			payload := make([]byte, 2, apSize)
+			var f byte
+			layer, tid := byte(0x3F), byte(0x07)
+			for _, nalu := range ap {
+				f |= nalu[0] & 0x80
+				if l := (nalu[0]&0x01)<<5 | nalu[1]>>3; l < layer {
+					layer = l
+				}
+				if t := nalu[1] & 0x07; t < tid {
+					tid = t
+				}
+				payload = append(payload, byte(len(nalu)>>8), byte(len(nalu)))
+				payload = append(payload, nalu...)
+			}
+			payload[0] = f | NALUTypeAP<<1 | layer>>5
+			payload[1] = layer<<3 | tid
+			payloads = append(payloads, payload)
+		}
+		ap = nil
+		apSize = 2
+	}
+	for _, nalu := range au.Data {
+		if len(nalu) < 2 {
+			continue
+		}
+		p.ParameterSets.update(nalu)
+		if len(nalu) > max {
+			flush()
+			payloads = append(payloads, fragment(nalu, max)...)
+			continue
+		}
+		if apSize+2+len(nalu) > max {
+			flush()
+		}
+		ap = append(ap, nalu)
+		apSize += 2 + len(nalu)
+	}
+	flush()
+	packets := make([]*rtp.Packet, len(payloads))
+	for i, payload := range payloads {
+		packets[i] = p.seq.Packet(au.Timestamp, i == len(payloads)-1, payload)
+	}
+	return packets, nil
+}
+
+// fragment splits the NAL unit into FU payloads.
+func fragment(nalu []byte, max int) [][]byte {
+	hdr0 := nalu[0]&0x81 | NALUTypeFU<<1
+	hdr1 := nalu[1]
+	typ := byte(NALUType(nalu))
+	data := nalu[2:]
+	var payloads [][]byte
+	for first := true; len(data) > 0; first = false {
+		n := max - 3
+		if n > len(data) {
+			n = len(data)
+		}
+		header := typ
+		if first {
+			header |= 0x80
+		}
+		if n == len(data) {
+			header |= 0x40
+		}
+		payload := make([]byte, 3, 3+n)
+		payload[0], payload[1], payload[2] = hdr0, hdr1, header
+		payloads = append(payloads, append(payload, data[:n]...))
+		data = data[n:]
+	}
+	return payloads
+}
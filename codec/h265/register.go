@@ -0,0 +1,21 @@
+package h265
+
+import "github.com/icholy/rtsp/codec"
+
+func init() {
+	codec.Register(codec.Codec{
+		Encoding: "H265",
+		NewDepacketizer: func(f codec.Format) (codec.Depacketizer, error) {
+			return NewDepacketizer(f.Fmtp)
+		},
+		NewPacketizer: func(f codec.Format) (codec.Packetizer, error) {
+			ps, err := ParseParameterSets(f.Fmtp)
+			if err != nil {
+				return nil, err
+			}
+			p := NewPacketizer(f.PayloadType)
+			p.ParameterSets = ps
+			return p, nil
+		},
+	})
+}
@@ -0,0 +1,131 @@
+package h265
+
+import "errors"
+
+// ErrInvalidSPS is returned when a sequence parameter set can't be parsed.
+var ErrInvalidSPS = errors.New("h265: invalid sps")
+
+// SPS contains the fields of a sequence parameter set needed to describe
+// the stream in containers (ITU-T H.265 7.3.2.2).
+type SPS struct {
+	// ProfileTierLevel contains the 12 byte general profile, tier and level.
+	ProfileTierLevel     []byte
+	ChromaFormatIDC      int
+	BitDepthLumaMinus8   int
+	BitDepthChromaMinus8 int
+	Width                int
+	Height               int
+}
+
+// ParseSPS decodes the SPS NAL unit.
+func ParseSPS(nalu []byte) (SPS, error) {
+	var s SPS
+	if len(nalu) < 3 || NALUType(nalu) != NALUTypeSPS {
+		return s, ErrInvalidSPS
+	}
+	rbsp := unescapeRBSP(nalu[2:])
+	if len(rbsp) < 13 {
+		return s, ErrInvalidSPS
+	}
+	s.ProfileTierLevel = rbsp[1:13]
+	r := &bitReader{buf: rbsp}
+	r.u(4) // sps_video_parameter_set_id
+	subLayers := int(r.u(3))
+	r.u(1)  // sps_temporal_id_nesting_flag
+	r.u(96) // general profile, tier and level
+	var profilePresent, levelPresent [8]bool
+	for i := 0; i < subLayers; i++ {
+		profilePresent[i] = r.u(1) == 1
+		levelPresent[i] = r.u(1) == 1
+	}
+	if subLayers > 0 {
+		for i := subLayers; i < 8; i++ {
+			r.u(2) // reserved_zero_2bits
+		}
+	}
+	for i := 0; i < subLayers; i++ {
+		if profilePresent[i] {
+			r.u(88)
+		}
+		if levelPresent[i] {
+			r.u(8)
+		}
+	}
+	r.ue() // sps_seq_parameter_set_id
+	s.ChromaFormatIDC = int(r.ue())
+	if s.ChromaFormatIDC == 3 {
+		r.u(1) // separate_colour_plane_flag
+	}
+	s.Width = int(r.ue())
+	s.Height = int(r.ue())
+	if r.u(1) == 1 {
+		left, right, top, bottom := int(r.ue()), int(r.ue()), int(r.ue()), int(r.ue())
+		subWidth, subHeight := 1, 1
+		switch s.ChromaFormatIDC {
+		case 1:
+			subWidth, subHeight = 2, 2
+		case 2:
+			subWidth = 2
+		}
+		s.Width -= subWidth * (left + right)
+		s.Height -= subHeight * (top + bottom)
+	}
+	s.BitDepthLumaMinus8 = int(r.ue())
+	s.BitDepthChromaMinus8 = int(r.ue())
+	if r.err != nil || s.Width <= 0 || s.Height <= 0 {
+		return SPS{}, ErrInvalidSPS
+	}
+	return s, nil
+}
+
+// unescapeRBSP removes the emulation prevention bytes.
+func unescapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// bitReader reads exp-golomb coded fields. The first error is recorded
+// and subsequent reads return zero.
+type bitReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *bitReader) u(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.buf)*8 {
+			r.err = ErrInvalidSPS
+			return 0
+		}
+		v = v<<1 | uint32(r.buf[r.pos/8]>>(7-uint(r.pos%8))&1)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) ue() uint32 {
+	zeros := 0
+	for r.u(1) == 0 {
+		if r.err != nil || zeros == 31 {
+			r.err = ErrInvalidSPS
+			return 0
+		}
+		zeros++
+	}
+	return 1<<uint(zeros) - 1 + r.u(zeros)
+}
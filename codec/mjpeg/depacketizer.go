@@ -0,0 +1,140 @@
+package mjpeg
+
+import (
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// Depacketizer reassembles JPEG images from RTP packets and rebuilds
+// the JFIF headers which are not transmitted.
+type Depacketizer struct {
+	// tables caches in-band quantization tables for Q values 128-254
+	tables map[byte][]byte
+
+	header  header
+	data    []byte
+	ts      uint32
+	started bool
+	broken  bool
+}
+
+// NewDepacketizer constructs a Depacketizer.
+func NewDepacketizer() *Depacketizer {
+	return &Depacketizer{tables: map[byte][]byte{}}
+}
+
+// Depacketize consumes a packet and returns the image once it's complete.
+// Images with missing fragments are discarded.
+func (d *Depacketizer) Depacketize(p *rtp.Packet) ([]*codec.AccessUnit, error) {
+	payload := p.Payload
+	if len(payload) < 8 {
+		return nil, ErrTruncated
+	}
+	offset := int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3])
+	h := header{
+		Type:   payload[4],
+		Q:      payload[5],
+		Width:  int(payload[6]) * 8,
+		Height: int(payload[7]) * 8,
+	}
+	payload = payload[8:]
+
+	// only the types of RFC 2435 section 4.1 are supported
+	if h.Type&^64 > 1 {
+		return nil, ErrUnsupportedJPEG
+	}
+	if h.Type >= 64 && h.Type < 128 {
+		if len(payload) < 4 {
+			return nil, ErrTruncated
+		}
+		h.RestartInterval = uint16(payload[0])<<8 | uint16(payload[1])
+		payload = payload[4:]
+	}
+
+	if offset == 0 {
+		if h.Q >= 128 {
+			if len(payload) < 4 {
+				return nil, ErrTruncated
+			}
+			precision := payload[1]
+			length := int(payload[2])<<8 | int(payload[3])
+			payload = payload[4:]
+			if length > len(payload) {
+				return nil, ErrTruncated
+			}
+			if length > 0 {
+				tables, err := convertTables(precision, payload[:length])
+				if err != nil {
+					return nil, err
+				}
+				if h.Q != 255 {
+					d.tables[h.Q] = tables
+				}
+				h.Tables = tables
+			} else {
+				h.Tables = d.tables[h.Q]
+			}
+			payload = payload[length:]
+			if h.Tables == nil {
+				return nil, ErrMissingTables
+			}
+		} else {
+			h.Tables = makeTables(int(h.Q))
+		}
+		d.header = h
+		d.data = d.data[:0]
+		d.ts = p.TS
+		d.started = true
+		d.broken = false
+	} else if !d.started || p.TS != d.ts || offset != len(d.data) {
+		// the first fragment or a fragment in the middle is missing
+		d.broken = true
+		return nil, nil
+	}
+
+	d.data = append(d.data, payload...)
+	if !p.Marker() {
+		return nil, nil
+	}
+	d.started = false
+	if d.broken {
+		return nil, nil
+	}
+	img := d.header.jfif()
+	img = append(img, d.data...)
+	if n := len(img); img[n-2] != 0xFF || img[n-1] != markerEOI {
+		img = append(img, 0xFF, markerEOI)
+	}
+	return []*codec.AccessUnit{{
+		Timestamp: d.ts,
+		Data:      [][]byte{img},
+		Key:       true,
+	}}, nil
+}
+
+// convertTables returns 8 bit tables. 16 bit tables are clamped.
+func convertTables(precision byte, data []byte) ([]byte, error) {
+	var tables []byte
+	for i := 0; len(data) > 0; i++ {
+		if precision&(1<<uint(i)) == 0 {
+			if len(data) < 64 {
+				return nil, ErrTruncated
+			}
+			tables = append(tables, data[:64]...)
+			data = data[64:]
+			continue
+		}
+		if len(data) < 128 {
+			return nil, ErrTruncated
+		}
+		for j := 0; j < 64; j++ {
+			v := int(data[j*2])<<8 | int(data[j*2+1])
+			if v > 255 {
+				v = 255
+			}
+			tables = append(tables, byte(v))
+		}
+		data = data[128:]
+	}
+	return tables, nil
+}
@@ -0,0 +1,190 @@
+// Package mjpeg implements the JPEG RTP payload format (RFC 2435).
+package mjpeg
+
+import (
+	"errors"
+)
+
+// PayloadType is the static payload type for JPEG.
+const PayloadType = 26
+
+// ClockRate is the RTP clock rate for JPEG.
+const ClockRate = 90000
+
+// JPEG markers
+const (
+	markerSOF0 = 0xC0
+	markerDHT  = 0xC4
+	markerSOI  = 0xD8
+	markerEOI  = 0xD9
+	markerSOS  = 0xDA
+	markerDQT  = 0xDB
+	markerDRI  = 0xDD
+)
+
+// Errors returned when processing JPEG data.
+var (
+	ErrTruncated       = errors.New("mjpeg: truncated data")
+	ErrInvalidJPEG     = errors.New("mjpeg: invalid jpeg")
+	ErrUnsupportedJPEG = errors.New("mjpeg: unsupported jpeg")
+	ErrMissingTables   = errors.New("mjpeg: missing quantization tables")
+	ErrImageTooLarge   = errors.New("mjpeg: image dimensions must not exceed 2040")
+	ErrMTUTooSmall     = errors.New("mjpeg: mtu too small")
+)
+
+// header contains the information carried in the RTP JPEG headers.
+type header struct {
+	Type            byte // 0 for 4:2:2, 1 for 4:2:0, +64 with restart markers
+	Q               byte
+	Width           int
+	Height          int
+	RestartInterval uint16
+	Tables          []byte // zigzag ordered 8 bit quantization tables
+}
+
+// jfif builds the JPEG headers for the scan data as described in
+// RFC 2435 Appendix B.
+func (h header) jfif() []byte {
+	b := []byte{0xFF, markerSOI}
+
+	// quantization tables
+	for i := 0; i*64 < len(h.Tables); i++ {
+		b = append(b, 0xFF, markerDQT, 0, 67, byte(i))
+		b = append(b, h.Tables[i*64:i*64+64]...)
+	}
+	chroma := byte(0)
+	if len(h.Tables) > 64 {
+		chroma = 1
+	}
+
+	// frame header
+	sampling := byte(0x21)
+	if h.Type&0x3F == 1 {
+		sampling = 0x22
+	}
+	b = append(b, 0xFF, markerSOF0, 0, 17, 8,
+		byte(h.Height>>8), byte(h.Height),
+		byte(h.Width>>8), byte(h.Width),
+		3,
+		1, sampling, 0,
+		2, 0x11, chroma,
+		3, 0x11, chroma,
+	)
+
+	// restart interval
+	if h.RestartInterval != 0 {
+		b = append(b, 0xFF, markerDRI, 0, 4, byte(h.RestartInterval>>8), byte(h.RestartInterval))
+	}
+
+	// huffman tables
+	b = appendHuffman(b, 0x00, lumDCCodeLens, lumDCSymbols)
+	b = appendHuffman(b, 0x10, lumACCodeLens, lumACSymbols)
+	b = appendHuffman(b, 0x01, chmDCCodeLens, chmDCSymbols)
+	b = appendHuffman(b, 0x11, chmACCodeLens, chmACSymbols)
+
+	// scan header
+	b = append(b, 0xFF, markerSOS, 0, 12, 3,
+		1, 0x00,
+		2, 0x11,
+		3, 0x11,
+		0, 63, 0,
+	)
+	return b
+}
+
+func appendHuffman(b []byte, class byte, lens, symbols []byte) []byte {
+	size := 3 + len(lens) + len(symbols)
+	b = append(b, 0xFF, markerDHT, byte(size>>8), byte(size), class)
+	b = append(b, lens...)
+	return append(b, symbols...)
+}
+
+// parseJPEG extracts the RTP JPEG header fields and the scan data
+// from a baseline JFIF image.
+func parseJPEG(img []byte) (header, []byte, error) {
+	var h header
+	if len(img) < 4 || img[0] != 0xFF || img[1] != markerSOI {
+		return h, nil, ErrInvalidJPEG
+	}
+	tables := map[byte][]byte{}
+	var qt [3]byte
+	sof := false
+	for i := 2; ; {
+		// skip fill bytes
+		for i < len(img) && img[i] == 0xFF && i+1 < len(img) && img[i+1] == 0xFF {
+			i++
+		}
+		if i+4 > len(img) || img[i] != 0xFF {
+			return h, nil, ErrInvalidJPEG
+		}
+		marker := img[i+1]
+		size := int(img[i+2])<<8 | int(img[i+3])
+		seg := i + 4
+		end := i + 2 + size
+		if size < 2 || end > len(img) {
+			return h, nil, ErrTruncated
+		}
+		switch marker {
+		case markerDQT:
+			for j := seg; j < end; {
+				precision, id := img[j]>>4, img[j]&0x0F
+				if precision != 0 {
+					return h, nil, ErrUnsupportedJPEG
+				}
+				if j+65 > end {
+					return h, nil, ErrTruncated
+				}
+				tables[id] = img[j+1 : j+65]
+				j += 65
+			}
+		case markerSOF0:
+			if size != 17 || img[seg] != 8 || img[seg+5] != 3 {
+				return h, nil, ErrUnsupportedJPEG
+			}
+			h.Height = int(img[seg+1])<<8 | int(img[seg+2])
+			h.Width = int(img[seg+3])<<8 | int(img[seg+4])
+			comps := img[seg+6:]
+			switch comps[1] {
+			case 0x21:
+				h.Type = 0
+			case 0x22:
+				h.Type = 1
+			default:
+				return h, nil, ErrUnsupportedJPEG
+			}
+			if comps[4] != 0x11 || comps[7] != 0x11 {
+				return h, nil, ErrUnsupportedJPEG
+			}
+			qt = [3]byte{comps[2], comps[5], comps[8]}
+			sof = true
+		case 0xC1, 0xC2, 0xC3, 0xC5, 0xC6, 0xC7, 0xC9, 0xCA, 0xCB, 0xCD, 0xCE, 0xCF:
+			// only baseline sequential is supported
+			return h, nil, ErrUnsupportedJPEG
+		case markerDRI:
+			h.RestartInterval = uint16(img[seg])<<8 | uint16(img[seg+1])
+		case markerSOS:
+			if !sof {
+				return h, nil, ErrInvalidJPEG
+			}
+			if h.Width > 2040 || h.Height > 2040 {
+				return h, nil, ErrImageTooLarge
+			}
+			luma, ok1 := tables[qt[0]]
+			chroma, ok2 := tables[qt[1]]
+			if !ok1 || !ok2 {
+				return h, nil, ErrMissingTables
+			}
+			h.Tables = append(append([]byte(nil), luma...), chroma...)
+			if h.RestartInterval != 0 {
+				h.Type |= 64
+			}
+			data := img[end:]
+			// strip the end of image marker
+			if n := len(data); n >= 2 && data[n-2] == 0xFF && data[n-1] == markerEOI {
+				data = data[:n-2]
+			}
+			return h, data, nil
+		}
+		i = end
+	}
+}
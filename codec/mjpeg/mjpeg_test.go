@@ -0,0 +1,97 @@
+package mjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/icholy/rtsp/codec"
+	"gotest.tools/v3/assert"
+)
+
+func TestHuffmanTables(t *testing.T) {
+	sum := func(lens []byte) int {
+		var n int
+		for _, l := range lens {
+			n += int(l)
+		}
+		return n
+	}
+	assert.Equal(t, sum(lumDCCodeLens), len(lumDCSymbols))
+	assert.Equal(t, sum(lumACCodeLens), len(lumACSymbols))
+	assert.Equal(t, sum(chmDCCodeLens), len(chmDCSymbols))
+	assert.Equal(t, sum(chmACCodeLens), len(chmACSymbols))
+}
+
+func TestRoundTrip(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 128, 96))
+	for y := 0; y < 96; y++ {
+		for x := 0; x < 128; x++ {
+			src.Set(x, y, color.RGBA{uint8(x * 2), uint8(y * 2), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NilError(t, jpeg.Encode(&buf, src, &jpeg.Options{Quality: 80}))
+
+	p := NewPacketizer()
+	p.MTU = 500
+	packets, err := p.Packetize(&codec.AccessUnit{Timestamp: 90000, Data: [][]byte{buf.Bytes()}})
+	assert.NilError(t, err)
+	assert.Assert(t, len(packets) > 1)
+
+	d := NewDepacketizer()
+	var units []*codec.AccessUnit
+	for _, pkt := range packets {
+		u, err := d.Depacketize(pkt)
+		assert.NilError(t, err)
+		units = append(units, u...)
+	}
+	assert.Equal(t, len(units), 1)
+	assert.Equal(t, units[0].Timestamp, uint32(90000))
+
+	// the rebuilt image decodes to the same pixels
+	want, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+	assert.NilError(t, err)
+	got, err := jpeg.Decode(bytes.NewReader(units[0].Data[0]))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got.Bounds(), want.Bounds())
+	for y := 0; y < 96; y++ {
+		for x := 0; x < 128; x++ {
+			assert.Equal(t, got.At(x, y), want.At(x, y))
+		}
+	}
+
+	// a lost fragment discards the image
+	for i, pkt := range packets {
+		if i == 1 {
+			continue
+		}
+		u, err := d.Depacketize(pkt)
+		assert.NilError(t, err)
+		assert.Equal(t, len(u), 0)
+	}
+
+	// the headers must fit in the mtu
+	p.MTU = 20
+	_, err = p.Packetize(&codec.AccessUnit{Data: [][]byte{buf.Bytes()}})
+	assert.Equal(t, err, ErrMTUTooSmall)
+
+	// unknown types have an unknown layout
+	for _, typ := range []byte{2, 63, 66, 128, 255} {
+		pkt := *packets[0]
+		pkt.Payload = append([]byte(nil), pkt.Payload...)
+		pkt.Payload[4] = typ
+		_, err := d.Depacketize(&pkt)
+		assert.Equal(t, err, ErrUnsupportedJPEG, "type %d", typ)
+	}
+}
+
+func TestMakeTables(t *testing.T) {
+	tables := makeTables(50)
+	assert.Equal(t, len(tables), 128)
+	// Q=50 yields the unscaled tables in zigzag order
+	assert.DeepEqual(t, tables[:8], []byte{16, 11, 12, 14, 12, 10, 16, 14})
+	assert.DeepEqual(t, tables[64:72], []byte{17, 18, 18, 24, 21, 24, 47, 26})
+}
@@ -0,0 +1,73 @@
+package mjpeg
+
+import (
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// DefaultMTU is the default maximum RTP packet size.
+const DefaultMTU = 1200
+
+// Packetizer splits baseline JFIF images into RTP packets. The
+// quantization tables are sent in-band using Q=255.
+type Packetizer struct {
+	MTU int
+
+	seq *rtp.Sequencer
+}
+
+// NewPacketizer constructs a Packetizer using the static payload type.
+func NewPacketizer() *Packetizer {
+	return &Packetizer{
+		MTU: DefaultMTU,
+		seq: rtp.NewSequencer(PayloadType),
+	}
+}
+
+// Sequencer returns the sequencer used to fill in the packet headers.
+func (p *Packetizer) Sequencer() *rtp.Sequencer {
+	return p.seq
+}
+
+// Packetize splits each image in the access unit into packets.
+func (p *Packetizer) Packetize(au *codec.AccessUnit) ([]*rtp.Packet, error) {
+	var packets []*rtp.Packet
+	for _, img := range au.Data {
+		h, data, err := parseJPEG(img)
+		if err != nil {
+			return nil, err
+		}
+		for offset, first := 0, true; first || len(data) > 0; first = false {
+			payload := []byte{
+				0,
+				byte(offset >> 16), byte(offset >> 8), byte(offset),
+				h.Type, 255,
+				byte((h.Width + 7) / 8), byte((h.Height + 7) / 8),
+			}
+			if h.RestartInterval != 0 {
+				// F=1 L=1 and a count of 0x3FFF since fragments
+				// aren't aligned to restart intervals
+				payload = append(payload,
+					byte(h.RestartInterval>>8), byte(h.RestartInterval),
+					0xFF, 0xFF,
+				)
+			}
+			if first {
+				payload = append(payload, 0, 0, byte(len(h.Tables)>>8), byte(len(h.Tables)))
+				payload = append(payload, h.Tables...)
+			}
+			n := p.MTU - rtp.HeaderSize - len(payload)
+			if n <= 0 {
+				return nil, ErrMTUTooSmall
+			}
+			if n > len(data) {
+				n = len(data)
+			}
+			payload = append(payload, data[:n]...)
+			data = data[n:]
+			offset += n
+			packets = append(packets, p.seq.Packet(au.Timestamp, len(data) == 0, payload))
+		}
+	}
+	return packets, nil
+}
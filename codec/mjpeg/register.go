@@ -0,0 +1,17 @@
+package mjpeg
+
+import "github.com/icholy/rtsp/codec"
+
+func init() {
+	codec.Register(codec.Codec{
+		Encoding: "JPEG",
+		NewDepacketizer: func(f codec.Format) (codec.Depacketizer, error) {
+			return NewDepacketizer(), nil
+		},
+		NewPacketizer: func(f codec.Format) (codec.Packetizer, error) {
+			p := NewPacketizer()
+			p.Sequencer().PayloadType = f.PayloadType
+			return p, nil
+		},
+	})
+}
@@ -0,0 +1,126 @@
+// Package mp2t implements the MPEG-2 transport stream RTP payload format
+// (RFC 2250). Payloads contain an integral number of 188 byte TS packets
+// which can be demultiplexed using the mpegts package.
+package mp2t
+
+import (
+	"errors"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// PayloadType is the static payload type assigned to MP2T.
+const PayloadType = 33
+
+// ClockRate is the RTP clock rate for MP2T.
+const ClockRate = 90000
+
+// PacketSize is the size of a TS packet.
+const PacketSize = 188
+
+// SyncByte is the first byte of every TS packet.
+const SyncByte = 0x47
+
+// Errors returned when processing MP2T payloads.
+var (
+	ErrInvalidLength = errors.New("mp2t: payload is not a multiple of 188 bytes")
+	ErrLostSync      = errors.New("mp2t: missing sync byte")
+	ErrMTUTooSmall   = errors.New("mp2t: mtu too small")
+)
+
+// Split splits an RTP payload into TS packets. The returned packets
+// reference the payload.
+func Split(payload []byte) ([][]byte, error) {
+	if len(payload)%PacketSize != 0 {
+		return nil, ErrInvalidLength
+	}
+	packets := make([][]byte, 0, len(payload)/PacketSize)
+	for len(payload) > 0 {
+		if payload[0] != SyncByte {
+			return nil, ErrLostSync
+		}
+		packets = append(packets, payload[:PacketSize])
+		payload = payload[PacketSize:]
+	}
+	return packets, nil
+}
+
+// Depacketizer extracts TS packets from RTP packets.
+type Depacketizer struct{}
+
+// NewDepacketizer constructs a Depacketizer.
+func NewDepacketizer() *Depacketizer {
+	return &Depacketizer{}
+}
+
+// Depacketize returns a single access unit whose Data contains the
+// 188 byte TS packets carried by the RTP packet. The Key field is never
+// set, the mpegts.Demuxer should be used to obtain the elementary streams.
+func (d *Depacketizer) Depacketize(p *rtp.Packet) ([]*codec.AccessUnit, error) {
+	packets, err := Split(p.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(packets) == 0 {
+		return nil, nil
+	}
+	for i, pkt := range packets {
+		packets[i] = append([]byte(nil), pkt...)
+	}
+	return []*codec.AccessUnit{{
+		Timestamp: p.TS,
+		Data:      packets,
+	}}, nil
+}
+
+// DefaultMTU is the default maximum RTP packet size. It fits the usual 7
+// TS packets per RTP packet.
+const DefaultMTU = rtp.HeaderSize + 7*PacketSize
+
+// Packetizer groups TS packets into RTP packets.
+type Packetizer struct {
+	MTU int
+
+	seq *rtp.Sequencer
+}
+
+// NewPacketizer constructs a Packetizer using the static payload type.
+func NewPacketizer() *Packetizer {
+	return &Packetizer{
+		MTU: DefaultMTU,
+		seq: rtp.NewSequencer(PayloadType),
+	}
+}
+
+// Sequencer returns the sequencer used to fill in the packet headers.
+func (p *Packetizer) Sequencer() *rtp.Sequencer {
+	return p.seq
+}
+
+// Packetize places as many TS packets from the access unit into each
+// RTP packet as the MTU allows.
+func (p *Packetizer) Packetize(au *codec.AccessUnit) ([]*rtp.Packet, error) {
+	per := (p.MTU - rtp.HeaderSize) / PacketSize
+	if per == 0 {
+		return nil, ErrMTUTooSmall
+	}
+	var (
+		packets []*rtp.Packet
+		payload []byte
+	)
+	for _, pkt := range au.Data {
+		if len(pkt) != PacketSize {
+			return nil, ErrInvalidLength
+		}
+		payload = append(payload, pkt...)
+		if len(payload) == per*PacketSize {
+			packets = append(packets, p.seq.Packet(au.Timestamp, false, payload))
+			payload = nil
+		}
+	}
+	if len(payload) > 0 {
+		packets = append(packets, p.seq.Packet(au.Timestamp, false, payload))
+	}
+	return packets, nil
+}
@@ -0,0 +1,36 @@
+package mp2t
+
+import (
+	"testing"
+
+	"github.com/icholy/rtsp/codec"
+	"gotest.tools/v3/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var packets [][]byte
+	for i := 0; i < 10; i++ {
+		pkt := make([]byte, PacketSize)
+		pkt[0] = SyncByte
+		pkt[3] = byte(i)
+		packets = append(packets, pkt)
+	}
+	p := NewPacketizer()
+	rtpPackets, err := p.Packetize(&codec.AccessUnit{Timestamp: 1, Data: packets})
+	assert.NilError(t, err)
+	assert.Equal(t, len(rtpPackets), 2)
+
+	d := NewDepacketizer()
+	var out [][]byte
+	for _, pkt := range rtpPackets {
+		aus, err := d.Depacketize(pkt)
+		assert.NilError(t, err)
+		out = append(out, aus[0].Data...)
+	}
+	assert.DeepEqual(t, out, packets)
+
+	_, err = Split(make([]byte, 100))
+	assert.Equal(t, err, ErrInvalidLength)
+	_, err = Split(make([]byte, PacketSize))
+	assert.Equal(t, err, ErrLostSync)
+}
@@ -0,0 +1,80 @@
+// Package opus implements the Opus RTP payload format (RFC 7587).
+package opus
+
+import (
+	"errors"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// ClockRate is the RTP clock rate for Opus regardless of the sample rate.
+const ClockRate = 48000
+
+// ErrTooLarge is returned when an Opus packet doesn't fit in the MTU.
+var ErrTooLarge = errors.New("opus: packet exceeds mtu")
+
+// Depacketizer extracts Opus packets. Each RTP payload contains
+// exactly one Opus packet.
+type Depacketizer struct{}
+
+// NewDepacketizer constructs a Depacketizer.
+func NewDepacketizer() *Depacketizer {
+	return &Depacketizer{}
+}
+
+// Depacketize returns the Opus packet contained in the payload.
+func (d *Depacketizer) Depacketize(p *rtp.Packet) ([]*codec.AccessUnit, error) {
+	if len(p.Payload) == 0 {
+		return nil, nil
+	}
+	return []*codec.AccessUnit{{
+		Timestamp: p.TS,
+		Data:      [][]byte{append([]byte(nil), p.Payload...)},
+		Key:       true,
+	}}, nil
+}
+
+// DefaultMTU is the default maximum RTP packet size.
+const DefaultMTU = 1200
+
+// Packetizer places each Opus packet in its own RTP packet.
+type Packetizer struct {
+	MTU int
+
+	seq *rtp.Sequencer
+}
+
+// NewPacketizer constructs a Packetizer using the dynamic payload type.
+func NewPacketizer(pt int) *Packetizer {
+	return &Packetizer{
+		MTU: DefaultMTU,
+		seq: rtp.NewSequencer(pt),
+	}
+}
+
+// Sequencer returns the sequencer used to fill in the packet headers.
+func (p *Packetizer) Sequencer() *rtp.Sequencer {
+	return p.seq
+}
+
+// Packetize creates a packet for each Opus packet in the access unit.
+// Opus packets cannot be fragmented.
+func (p *Packetizer) Packetize(au *codec.AccessUnit) ([]*rtp.Packet, error) {
+	packets := make([]*rtp.Packet, 0, len(au.Data))
+	for _, data := range au.Data {
+		if rtp.HeaderSize+len(data) > p.MTU {
+			return nil, ErrTooLarge
+		}
+		packets = append(packets, p.seq.Packet(au.Timestamp, false, data))
+	}
+	return packets, nil
+}
+
+// Fmtp returns the SDP fmtp parameters for a stereo stream.
+func Fmtp() map[string]string {
+	return map[string]string{
+		"sprop-stereo": "1",
+		"stereo":       "1",
+	}
+}
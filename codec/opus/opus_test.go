@@ -0,0 +1,22 @@
+package opus
+
+import (
+	"testing"
+
+	"github.com/icholy/rtsp/codec"
+	"gotest.tools/v3/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	p := NewPacketizer(111)
+	packets, err := p.Packetize(&codec.AccessUnit{Timestamp: 960, Data: [][]byte{{0xFC, 1, 2}}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(packets), 1)
+	aus, err := NewDepacketizer().Depacketize(packets[0])
+	assert.NilError(t, err)
+	assert.DeepEqual(t, aus[0].Data, [][]byte{{0xFC, 1, 2}})
+
+	p.MTU = 14
+	_, err = p.Packetize(&codec.AccessUnit{Data: [][]byte{{1, 2, 3}}})
+	assert.Equal(t, err, ErrTooLarge)
+}
@@ -0,0 +1,137 @@
+package pcm
+
+import "encoding/binary"
+
+const (
+	mulawBias = 0x84
+	mulawClip = 32635
+)
+
+// MulawToLinear converts a G.711 mu-law sample to 16 bit linear PCM.
+func MulawToLinear(u byte) int16 {
+	u = ^u
+	t := (int(u&0x0F) << 3) + mulawBias
+	t <<= uint(u&0x70) >> 4
+	if u&0x80 != 0 {
+		return int16(mulawBias - t)
+	}
+	return int16(t - mulawBias)
+}
+
+// LinearToMulaw converts a 16 bit linear PCM sample to G.711 mu-law.
+func LinearToMulaw(s int16) byte {
+	sample := int(s)
+	sign := 0
+	if sample < 0 {
+		sample = -sample
+		sign = 0x80
+	}
+	if sample > mulawClip {
+		sample = mulawClip
+	}
+	sample += mulawBias
+	exponent := 7
+	for mask := 0x4000; sample&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (sample >> uint(exponent+3)) & 0x0F
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+// AlawToLinear converts a G.711 A-law sample to 16 bit linear PCM.
+func AlawToLinear(a byte) int16 {
+	a ^= 0x55
+	t := int(a&0x0F) << 4
+	seg := int(a&0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= uint(seg - 1)
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+// LinearToAlaw converts a 16 bit linear PCM sample to G.711 A-law.
+func LinearToAlaw(s int16) byte {
+	sample := int(s) >> 3
+	mask := 0xD5
+	if sample < 0 {
+		mask = 0x55
+		sample = -sample - 1
+	}
+	seg := 0
+	for end := 0x1F; seg < 8 && sample > end; end = end<<1 | 1 {
+		seg++
+	}
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+	aval := seg << 4
+	if seg < 2 {
+		aval |= (sample >> 1) & 0x0F
+	} else {
+		aval |= (sample >> uint(seg)) & 0x0F
+	}
+	return byte(aval ^ mask)
+}
+
+// DecodeMulaw converts mu-law data to linear PCM samples.
+func DecodeMulaw(data []byte) []int16 {
+	samples := make([]int16, len(data))
+	for i, b := range data {
+		samples[i] = MulawToLinear(b)
+	}
+	return samples
+}
+
+// EncodeMulaw converts linear PCM samples to mu-law data.
+func EncodeMulaw(samples []int16) []byte {
+	data := make([]byte, len(samples))
+	for i, s := range samples {
+		data[i] = LinearToMulaw(s)
+	}
+	return data
+}
+
+// DecodeAlaw converts A-law data to linear PCM samples.
+func DecodeAlaw(data []byte) []int16 {
+	samples := make([]int16, len(data))
+	for i, b := range data {
+		samples[i] = AlawToLinear(b)
+	}
+	return samples
+}
+
+// EncodeAlaw converts linear PCM samples to A-law data.
+func EncodeAlaw(samples []int16) []byte {
+	data := make([]byte, len(samples))
+	for i, s := range samples {
+		data[i] = LinearToAlaw(s)
+	}
+	return data
+}
+
+// DecodeL16 converts network byte order L16 data to linear PCM samples.
+func DecodeL16(data []byte) []int16 {
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.BigEndian.Uint16(data[i*2:]))
+	}
+	return samples
+}
+
+// EncodeL16 converts linear PCM samples to network byte order L16 data.
+func EncodeL16(samples []int16) []byte {
+	data := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.BigEndian.PutUint16(data[i*2:], uint16(s))
+	}
+	return data
+}
@@ -0,0 +1,156 @@
+// Package pcm implements the sample based audio payload formats from
+// RFC 3551: G.711 (PCMU and PCMA), G.722 and L16.
+package pcm
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// Errors returned by this package.
+var (
+	ErrUnsupported = errors.New("pcm: unsupported encoding")
+	ErrMTUTooSmall = errors.New("pcm: mtu too small")
+)
+
+// Format describes a sample based audio encoding.
+type Format struct {
+	Encoding    string // rtpmap encoding name
+	PayloadType int
+	ClockRate   int // RTP timestamp rate
+	SampleRate  int // actual audio sample rate
+	Channels    int
+	// BytesPerTick is the number of payload bytes per RTP timestamp unit.
+	BytesPerTick int
+}
+
+// Static formats. G.722 samples at 16000 Hz but uses an 8000 Hz RTP
+// clock rate for historical reasons (RFC 3551 4.5.2).
+var (
+	PCMU = Format{Encoding: "PCMU", PayloadType: 0, ClockRate: 8000, SampleRate: 8000, Channels: 1, BytesPerTick: 1}
+	PCMA = Format{Encoding: "PCMA", PayloadType: 8, ClockRate: 8000, SampleRate: 8000, Channels: 1, BytesPerTick: 1}
+	G722 = Format{Encoding: "G722", PayloadType: 9, ClockRate: 8000, SampleRate: 16000, Channels: 1, BytesPerTick: 1}
+)
+
+// L16 returns the format for 16 bit linear PCM. The static payload
+// types 10 and 11 are used for 44100 Hz stereo and mono, otherwise the
+// dynamic payload type 96 is used.
+func L16(rate, channels int) Format {
+	f := Format{
+		Encoding:     "L16",
+		PayloadType:  96,
+		ClockRate:    rate,
+		SampleRate:   rate,
+		Channels:     channels,
+		BytesPerTick: 2 * channels,
+	}
+	if rate == 44100 && channels == 2 {
+		f.PayloadType = 10
+	}
+	if rate == 44100 && channels == 1 {
+		f.PayloadType = 11
+	}
+	return f
+}
+
+// LookupFormat returns the format for the rtpmap encoding name.
+func LookupFormat(encoding string, rate, channels int) (Format, error) {
+	if channels == 0 {
+		channels = 1
+	}
+	switch strings.ToUpper(encoding) {
+	case "PCMU":
+		return PCMU, nil
+	case "PCMA":
+		return PCMA, nil
+	case "G722":
+		return G722, nil
+	case "L16":
+		return L16(rate, channels), nil
+	default:
+		return Format{}, ErrUnsupported
+	}
+}
+
+// Duration returns the number of RTP timestamp units in the payload.
+func (f Format) Duration(payload []byte) uint32 {
+	return uint32(len(payload) / f.BytesPerTick)
+}
+
+// Depacketizer returns each packet payload as an access unit.
+type Depacketizer struct {
+	Format Format
+}
+
+// NewDepacketizer constructs a Depacketizer for the format.
+func NewDepacketizer(f Format) *Depacketizer {
+	return &Depacketizer{Format: f}
+}
+
+// Depacketize returns the packet payload as an access unit.
+func (d *Depacketizer) Depacketize(p *rtp.Packet) ([]*codec.AccessUnit, error) {
+	if len(p.Payload) == 0 {
+		return nil, nil
+	}
+	return []*codec.AccessUnit{{
+		Timestamp: p.TS,
+		Data:      [][]byte{append([]byte(nil), p.Payload...)},
+		Key:       true,
+	}}, nil
+}
+
+// DefaultMTU is the default maximum RTP packet size.
+const DefaultMTU = 1200
+
+// Packetizer splits audio data into packets. The timestamp of each
+// packet is advanced by the number of samples in the previous ones.
+type Packetizer struct {
+	MTU    int
+	Format Format
+
+	seq *rtp.Sequencer
+}
+
+// NewPacketizer constructs a Packetizer for the format. Formats using
+// a dynamic payload type should have it set to the negotiated value.
+func NewPacketizer(f Format) *Packetizer {
+	return &Packetizer{
+		MTU:    DefaultMTU,
+		Format: f,
+		seq:    rtp.NewSequencer(f.PayloadType),
+	}
+}
+
+// Sequencer returns the sequencer used to fill in the packet headers.
+func (p *Packetizer) Sequencer() *rtp.Sequencer {
+	return p.seq
+}
+
+// Packetize splits the access unit data into packets on sample boundaries.
+func (p *Packetizer) Packetize(au *codec.AccessUnit) ([]*rtp.Packet, error) {
+	if p.Format.BytesPerTick <= 0 {
+		return nil, ErrUnsupported
+	}
+	max := p.MTU - rtp.HeaderSize
+	max -= max % p.Format.BytesPerTick
+	if max <= 0 {
+		return nil, ErrMTUTooSmall
+	}
+	var packets []*rtp.Packet
+	ts := au.Timestamp
+	for _, data := range au.Data {
+		for len(data) > 0 {
+			n := len(data)
+			if n > max {
+				n = max
+			}
+			packets = append(packets, p.seq.Packet(ts, false, data[:n]))
+			ts += p.Format.Duration(data[:n])
+			data = data[n:]
+		}
+	}
+	return packets, nil
+}
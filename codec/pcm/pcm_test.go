@@ -0,0 +1,54 @@
+package pcm
+
+import (
+	"testing"
+
+	"github.com/icholy/rtsp/codec"
+	"gotest.tools/v3/assert"
+)
+
+func TestG711(t *testing.T) {
+	assert.Equal(t, MulawToLinear(0xFF), int16(0))
+	assert.Equal(t, MulawToLinear(0x00), int16(-32124))
+	assert.Equal(t, MulawToLinear(0x80), int16(32124))
+	assert.Equal(t, LinearToMulaw(0), byte(0xFF))
+	assert.Equal(t, AlawToLinear(0xD5), int16(8))
+	assert.Equal(t, AlawToLinear(0x55), int16(-8))
+	assert.Equal(t, LinearToAlaw(0), byte(0xD5))
+
+	// every code word survives a round trip
+	for i := 0; i < 256; i++ {
+		assert.Equal(t, LinearToMulaw(MulawToLinear(byte(i))), byte(i)|boolByte(i == 0x7F))
+		assert.Equal(t, LinearToAlaw(AlawToLinear(byte(i))), byte(i))
+	}
+}
+
+// boolByte accounts for the mu-law negative zero (0x7F) which
+// decodes to 0 and encodes as positive zero (0xFF).
+func boolByte(b bool) byte {
+	if b {
+		return 0x80
+	}
+	return 0
+}
+
+func TestPacketizer(t *testing.T) {
+	f, err := LookupFormat("L16", 8000, 2)
+	assert.NilError(t, err)
+	p := NewPacketizer(f)
+	p.MTU = 12 + 100
+	data := EncodeL16(make([]int16, 200))
+	packets, err := p.Packetize(&codec.AccessUnit{Timestamp: 10, Data: [][]byte{data}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(packets), 4)
+	// 100 bytes is 25 stereo samples
+	assert.Equal(t, packets[1].TS, uint32(35))
+	assert.Equal(t, len(packets[0].Payload), 100)
+
+	assert.Equal(t, G722.Duration(make([]byte, 160)), uint32(160))
+
+	// a stereo L16 sample doesn't fit
+	p.MTU = 12 + 2
+	_, err = p.Packetize(&codec.AccessUnit{Data: [][]byte{data}})
+	assert.Equal(t, err, ErrMTUTooSmall)
+}
@@ -0,0 +1,34 @@
+package pcm
+
+import "github.com/icholy/rtsp/codec"
+
+func init() {
+	for _, encoding := range []string{"PCMU", "PCMA", "G722", "L16"} {
+		codec.Register(codec.Codec{
+			Encoding: encoding,
+			NewDepacketizer: func(f codec.Format) (codec.Depacketizer, error) {
+				format, err := lookup(f)
+				if err != nil {
+					return nil, err
+				}
+				return NewDepacketizer(format), nil
+			},
+			NewPacketizer: func(f codec.Format) (codec.Packetizer, error) {
+				format, err := lookup(f)
+				if err != nil {
+					return nil, err
+				}
+				return NewPacketizer(format), nil
+			},
+		})
+	}
+}
+
+func lookup(f codec.Format) (Format, error) {
+	format, err := LookupFormat(f.Encoding, f.ClockRate, f.Channels)
+	if err != nil {
+		return Format{}, err
+	}
+	format.PayloadType = f.PayloadType
+	return format, nil
+}
@@ -0,0 +1,139 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/icholy/rtsp/rtp"
+	"github.com/icholy/rtsp/sdp"
+)
+
+// ErrUnknownEncoding is returned when no codec is registered for an encoding.
+var ErrUnknownEncoding = errors.New("codec: unknown encoding")
+
+// Depacketizer reassembles access units from RTP packets.
+type Depacketizer interface {
+	Depacketize(p *rtp.Packet) ([]*AccessUnit, error)
+}
+
+// Packetizer splits access units into RTP packets.
+type Packetizer interface {
+	Packetize(au *AccessUnit) ([]*rtp.Packet, error)
+	Sequencer() *rtp.Sequencer
+}
+
+// Format is the payload format of a media description.
+type Format struct {
+	sdp.RTPMap
+	Fmtp map[string]string
+}
+
+// ParseFormat returns the format of the first payload type in the media
+// description.
+func ParseFormat(m *sdp.Media) (Format, error) {
+	pt, ok := m.PayloadType()
+	if !ok {
+		return Format{}, fmt.Errorf("codec: media has no payload type")
+	}
+	rtpmap, ok := m.RTPMap(pt)
+	if !ok {
+		return Format{}, fmt.Errorf("codec: missing rtpmap for payload type %d", pt)
+	}
+	fmtp, _ := m.Fmtp(pt)
+	return Format{RTPMap: rtpmap, Fmtp: fmtp}, nil
+}
+
+// Codec constructs the depacketizer and packetizer of an encoding.
+type Codec struct {
+	// Encoding is the rtpmap encoding name. ie: H264
+	Encoding        string
+	NewDepacketizer func(f Format) (Depacketizer, error)
+	NewPacketizer   func(f Format) (Packetizer, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+// Register makes a codec available to NewDepacketizer and NewPacketizer.
+// The codec packages in this module register themselves when imported.
+// Encoding names are case insensitive and registering an encoding again
+// replaces the previous codec.
+func Register(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[strings.ToUpper(c.Encoding)] = c
+}
+
+// Lookup returns the codec registered for the encoding.
+func Lookup(encoding string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[strings.ToUpper(encoding)]
+	return c, ok
+}
+
+// NewDepacketizer constructs the depacketizer for the format.
+func NewDepacketizer(f Format) (Depacketizer, error) {
+	c, ok := Lookup(f.Encoding)
+	if !ok || c.NewDepacketizer == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEncoding, f.Encoding)
+	}
+	return c.NewDepacketizer(f)
+}
+
+// NewPacketizer constructs the packetizer for the format.
+func NewPacketizer(f Format) (Packetizer, error) {
+	c, ok := Lookup(f.Encoding)
+	if !ok || c.NewPacketizer == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEncoding, f.Encoding)
+	}
+	return c.NewPacketizer(f)
+}
+
+// Track is a media description with the depacketizer for its format.
+type Track struct {
+	Media        *sdp.Media
+	Format       Format       // zero when the media has no usable rtpmap
+	Depacketizer Depacketizer // nil when the encoding isn't supported
+}
+
+// Control returns the control url of the track.
+func (t *Track) Control() string {
+	return t.Media.Control()
+}
+
+// Depacketize passes the packet to the track depacketizer. Packets of
+// unsupported tracks are ignored.
+func (t *Track) Depacketize(p *rtp.Packet) ([]*AccessUnit, error) {
+	if t.Depacketizer == nil {
+		return nil, nil
+	}
+	return t.Depacketizer.Depacketize(p)
+}
+
+// NewTracks creates a track for each media description in the session.
+// Tracks with an unknown encoding, or without an rtpmap for a dynamic
+// payload type, are included without a depacketizer so that the track
+// indices match the media descriptions.
+func NewTracks(s *sdp.Session) ([]*Track, error) {
+	tracks := make([]*Track, len(s.Media))
+	for i, m := range s.Media {
+		f, err := ParseFormat(m)
+		if err != nil {
+			tracks[i] = &Track{Media: m}
+			continue
+		}
+		t := &Track{Media: m, Format: f}
+		d, err := NewDepacketizer(f)
+		if err != nil && !errors.Is(err, ErrUnknownEncoding) {
+			return nil, err
+		}
+		t.Depacketizer = d
+		tracks[i] = t
+	}
+	return tracks, nil
+}
@@ -0,0 +1,61 @@
+package codec_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/icholy/rtsp/codec"
+	_ "github.com/icholy/rtsp/codec/all"
+	"github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/codec/pcm"
+	"github.com/icholy/rtsp/sdp"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewTracks(t *testing.T) {
+	s, err := sdp.Parse([]byte("v=0\r\n" +
+		"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+		"s=test\r\n" +
+		"t=0 0\r\n" +
+		"m=video 0 RTP/AVP 96\r\n" +
+		"a=rtpmap:96 H264/90000\r\n" +
+		"a=fmtp:96 packetization-mode=1;sprop-parameter-sets=Z0IAKeKQFAe2AtwEBAaQeJEV,aM48gA==\r\n" +
+		"a=control:trackID=0\r\n" +
+		"m=audio 0 RTP/AVP 0\r\n" +
+		"a=control:trackID=1\r\n" +
+		"m=application 0 RTP/AVP 107\r\n" +
+		"a=rtpmap:107 vnd.onvif.metadata/90000\r\n" +
+		"m=application 0 RTP/AVP 108\r\n" +
+		"a=control:trackID=3\r\n"))
+	assert.NilError(t, err)
+	tracks, err := codec.NewTracks(s)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tracks), 4)
+
+	d, ok := tracks[0].Depacketizer.(*h264.Depacketizer)
+	assert.Assert(t, ok)
+	assert.Assert(t, len(d.SPS) > 0)
+	assert.Equal(t, tracks[0].Control(), "trackID=0")
+
+	_, ok = tracks[1].Depacketizer.(*pcm.Depacketizer)
+	assert.Assert(t, ok)
+	assert.Equal(t, tracks[1].Format.Encoding, "PCMU")
+
+	assert.Assert(t, tracks[2].Depacketizer == nil)
+
+	// media without an rtpmap are kept so the indices match
+	assert.Assert(t, tracks[3].Depacketizer == nil)
+	assert.Equal(t, tracks[3].Format.Encoding, "")
+	assert.Equal(t, tracks[3].Control(), "trackID=3")
+}
+
+func TestNewPacketizer(t *testing.T) {
+	p, err := codec.NewPacketizer(codec.Format{
+		RTPMap: sdp.RTPMap{PayloadType: 97, Encoding: "opus", ClockRate: 48000, Channels: 2},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, p.Sequencer().PayloadType, 97)
+
+	_, err = codec.NewPacketizer(codec.Format{RTPMap: sdp.RTPMap{Encoding: "H261"}})
+	assert.Assert(t, errors.Is(err, codec.ErrUnknownEncoding))
+}
@@ -0,0 +1,15 @@
+package vp8
+
+import "github.com/icholy/rtsp/codec"
+
+func init() {
+	codec.Register(codec.Codec{
+		Encoding: "VP8",
+		NewDepacketizer: func(f codec.Format) (codec.Depacketizer, error) {
+			return NewDepacketizer(), nil
+		},
+		NewPacketizer: func(f codec.Format) (codec.Packetizer, error) {
+			return NewPacketizer(f.PayloadType), nil
+		},
+	})
+}
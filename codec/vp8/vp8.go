@@ -0,0 +1,238 @@
+// Package vp8 implements the VP8 RTP payload format (RFC 7741).
+package vp8
+
+import (
+	"errors"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// ClockRate is the RTP clock rate for VP8.
+const ClockRate = 90000
+
+// Errors returned when processing VP8 payloads.
+var (
+	ErrTruncated   = errors.New("vp8: truncated payload")
+	ErrMTUTooSmall = errors.New("vp8: mtu too small")
+)
+
+// Descriptor is the VP8 payload descriptor.
+type Descriptor struct {
+	NonReference bool   // N
+	Start        bool   // S
+	PartitionID  uint8  // PID
+	HasPictureID bool   // I
+	PictureID    uint16 // 7 or 15 bits
+	HasTL0PicIdx bool   // L
+	TL0PicIdx    uint8
+	HasTID       bool // T
+	TID          uint8
+	LayerSync    bool // Y
+	HasKeyIdx    bool // K
+	KeyIdx       uint8
+}
+
+// Unmarshal decodes the descriptor and returns the remaining VP8 payload.
+func (d *Descriptor) Unmarshal(b []byte) ([]byte, error) {
+	if len(b) < 1 {
+		return nil, ErrTruncated
+	}
+	x := b[0]&0x80 != 0
+	d.NonReference = b[0]&0x20 != 0
+	d.Start = b[0]&0x10 != 0
+	d.PartitionID = b[0] & 0x07
+	b = b[1:]
+	if !x {
+		return b, nil
+	}
+	if len(b) < 1 {
+		return nil, ErrTruncated
+	}
+	flags := b[0]
+	b = b[1:]
+	d.HasPictureID = flags&0x80 != 0
+	d.HasTL0PicIdx = flags&0x40 != 0
+	d.HasTID = flags&0x20 != 0
+	d.HasKeyIdx = flags&0x10 != 0
+	if d.HasPictureID {
+		if len(b) < 1 {
+			return nil, ErrTruncated
+		}
+		if b[0]&0x80 != 0 {
+			if len(b) < 2 {
+				return nil, ErrTruncated
+			}
+			d.PictureID = uint16(b[0]&0x7F)<<8 | uint16(b[1])
+			b = b[2:]
+		} else {
+			d.PictureID = uint16(b[0])
+			b = b[1:]
+		}
+	}
+	if d.HasTL0PicIdx {
+		if len(b) < 1 {
+			return nil, ErrTruncated
+		}
+		d.TL0PicIdx = b[0]
+		b = b[1:]
+	}
+	if d.HasTID || d.HasKeyIdx {
+		if len(b) < 1 {
+			return nil, ErrTruncated
+		}
+		d.TID = b[0] >> 6
+		d.LayerSync = b[0]&0x20 != 0
+		d.KeyIdx = b[0] & 0x1F
+		b = b[1:]
+	}
+	return b, nil
+}
+
+// Marshal encodes the descriptor. Picture IDs are always encoded using 15 bits.
+func (d Descriptor) Marshal() []byte {
+	b := []byte{d.PartitionID & 0x07}
+	if d.NonReference {
+		b[0] |= 0x20
+	}
+	if d.Start {
+		b[0] |= 0x10
+	}
+	if !d.HasPictureID && !d.HasTL0PicIdx && !d.HasTID && !d.HasKeyIdx {
+		return b
+	}
+	b[0] |= 0x80
+	var flags byte
+	if d.HasPictureID {
+		flags |= 0x80
+	}
+	if d.HasTL0PicIdx {
+		flags |= 0x40
+	}
+	if d.HasTID {
+		flags |= 0x20
+	}
+	if d.HasKeyIdx {
+		flags |= 0x10
+	}
+	b = append(b, flags)
+	if d.HasPictureID {
+		b = append(b, 0x80|byte(d.PictureID>>8)&0x7F, byte(d.PictureID))
+	}
+	if d.HasTL0PicIdx {
+		b = append(b, d.TL0PicIdx)
+	}
+	if d.HasTID || d.HasKeyIdx {
+		y := byte(0)
+		if d.LayerSync {
+			y = 0x20
+		}
+		b = append(b, d.TID<<6|y|d.KeyIdx&0x1F)
+	}
+	return b
+}
+
+// IsKeyFrame returns true when the VP8 frame is a key frame.
+// The P bit of the frame tag is zero for key frames.
+func IsKeyFrame(frame []byte) bool {
+	return len(frame) > 0 && frame[0]&0x01 == 0
+}
+
+// Depacketizer reassembles VP8 frames.
+type Depacketizer struct {
+	frame   []byte
+	ts      uint32
+	sn      uint16
+	started bool
+	broken  bool
+}
+
+// NewDepacketizer constructs a Depacketizer.
+func NewDepacketizer() *Depacketizer {
+	return &Depacketizer{}
+}
+
+// Depacketize consumes a packet and returns the frame once it's complete.
+// Frames with missing packets are discarded.
+func (d *Depacketizer) Depacketize(p *rtp.Packet) ([]*codec.AccessUnit, error) {
+	var desc Descriptor
+	payload, err := desc.Unmarshal(p.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if desc.Start && desc.PartitionID == 0 {
+		d.frame = d.frame[:0]
+		d.ts = p.TS
+		d.broken = false
+		d.started = true
+	} else if !d.started || p.SN != d.sn+1 || p.TS != d.ts {
+		d.broken = true
+	}
+	d.sn = p.SN
+	d.frame = append(d.frame, payload...)
+	if !p.Marker() {
+		return nil, nil
+	}
+	d.started = false
+	if d.broken || len(d.frame) == 0 {
+		return nil, nil
+	}
+	frame := append([]byte(nil), d.frame...)
+	return []*codec.AccessUnit{{
+		Timestamp: d.ts,
+		Data:      [][]byte{frame},
+		Key:       IsKeyFrame(frame),
+	}}, nil
+}
+
+// DefaultMTU is the default maximum RTP packet size.
+const DefaultMTU = 1200
+
+// Packetizer splits VP8 frames into packets using a 15 bit picture id.
+type Packetizer struct {
+	MTU int
+
+	pictureID uint16
+	seq       *rtp.Sequencer
+}
+
+// NewPacketizer constructs a Packetizer using the dynamic payload type.
+func NewPacketizer(pt int) *Packetizer {
+	return &Packetizer{
+		MTU: DefaultMTU,
+		seq: rtp.NewSequencer(pt),
+	}
+}
+
+// Sequencer returns the sequencer used to fill in the packet headers.
+func (p *Packetizer) Sequencer() *rtp.Sequencer {
+	return p.seq
+}
+
+// Packetize splits each frame in the access unit into packets.
+func (p *Packetizer) Packetize(au *codec.AccessUnit) ([]*rtp.Packet, error) {
+	var packets []*rtp.Packet
+	for _, frame := range au.Data {
+		desc := Descriptor{
+			Start:        true,
+			HasPictureID: true,
+			PictureID:    p.pictureID & 0x7FFF,
+		}
+		p.pictureID++
+		for len(frame) > 0 {
+			hdr := desc.Marshal()
+			n := p.MTU - rtp.HeaderSize - len(hdr)
+			if n <= 0 {
+				return nil, ErrMTUTooSmall
+			}
+			if n > len(frame) {
+				n = len(frame)
+			}
+			payload := append(hdr, frame[:n]...)
+			frame = frame[n:]
+			packets = append(packets, p.seq.Packet(au.Timestamp, len(frame) == 0, payload))
+			desc.Start = false
+		}
+	}
+	return packets, nil
+}
@@ -0,0 +1,58 @@
+package vp8
+
+import (
+	"testing"
+
+	"github.com/icholy/rtsp/codec"
+	"gotest.tools/v3/assert"
+)
+
+func TestDescriptor(t *testing.T) {
+	in := Descriptor{
+		Start:        true,
+		HasPictureID: true,
+		PictureID:    0x1234,
+		HasTL0PicIdx: true,
+		TL0PicIdx:    7,
+		HasTID:       true,
+		TID:          2,
+		LayerSync:    true,
+	}
+	var out Descriptor
+	rest, err := out.Unmarshal(append(in.Marshal(), 0xAA))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, rest, []byte{0xAA})
+	assert.Equal(t, out, in)
+}
+
+func TestRoundTrip(t *testing.T) {
+	frame := make([]byte, 2500)
+	for i := range frame {
+		frame[i] = byte(i)
+	}
+	frame[0] = 0x10 // key frame
+	p := NewPacketizer(96)
+	packets, err := p.Packetize(&codec.AccessUnit{Timestamp: 3000, Data: [][]byte{frame}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(packets), 3)
+
+	d := NewDepacketizer()
+	var aus []*codec.AccessUnit
+	for _, pkt := range packets {
+		out, err := d.Depacketize(pkt)
+		assert.NilError(t, err)
+		aus = append(aus, out...)
+	}
+	assert.Equal(t, len(aus), 1)
+	assert.Assert(t, aus[0].Key)
+	assert.DeepEqual(t, aus[0].Data[0], frame)
+
+	// losing the middle packet discards the frame
+	packets, err = p.Packetize(&codec.AccessUnit{Timestamp: 6000, Data: [][]byte{frame}})
+	assert.NilError(t, err)
+	for _, pkt := range []int{0, 2} {
+		out, err := d.Depacketize(packets[pkt])
+		assert.NilError(t, err)
+		assert.Equal(t, len(out), 0)
+	}
+}
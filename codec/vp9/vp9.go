@@ -0,0 +1,279 @@
+// Package vp9 implements the VP9 RTP payload format (RFC 9628).
+package vp9
+
+import (
+	"errors"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// ClockRate is the RTP clock rate for VP9.
+const ClockRate = 90000
+
+// Errors returned when processing VP9 payloads.
+var (
+	ErrTruncated   = errors.New("vp9: truncated payload")
+	ErrMTUTooSmall = errors.New("vp9: mtu too small")
+)
+
+// Descriptor is the VP9 payload descriptor.
+//
+//	+-+-+-+-+-+-+-+-+
+//	|I|P|L|F|B|E|V|Z|
+//	+-+-+-+-+-+-+-+-+
+type Descriptor struct {
+	HasPictureID      bool   // I
+	InterPicture      bool   // P: the frame depends on previous frames
+	HasLayerIndices   bool   // L
+	Flexible          bool   // F
+	Begin             bool   // B: first packet of a frame
+	End               bool   // E: last packet of a frame
+	HasScalability    bool   // V
+	NotReference      bool   // Z
+	PictureID         uint16 // 7 or 15 bits
+	TID               uint8
+	SwitchingUp       bool
+	SID               uint8
+	InterLayer        bool
+	TL0PicIdx         uint8
+	PDiffs            []uint8
+	ScalabilityLength int // size of the scalability structure in bytes
+}
+
+// Unmarshal decodes the descriptor and returns the remaining VP9 payload.
+func (d *Descriptor) Unmarshal(b []byte) ([]byte, error) {
+	if len(b) < 1 {
+		return nil, ErrTruncated
+	}
+	flags := b[0]
+	b = b[1:]
+	d.HasPictureID = flags&0x80 != 0
+	d.InterPicture = flags&0x40 != 0
+	d.HasLayerIndices = flags&0x20 != 0
+	d.Flexible = flags&0x10 != 0
+	d.Begin = flags&0x08 != 0
+	d.End = flags&0x04 != 0
+	d.HasScalability = flags&0x02 != 0
+	d.NotReference = flags&0x01 != 0
+	if d.HasPictureID {
+		if len(b) < 1 {
+			return nil, ErrTruncated
+		}
+		if b[0]&0x80 != 0 {
+			if len(b) < 2 {
+				return nil, ErrTruncated
+			}
+			d.PictureID = uint16(b[0]&0x7F)<<8 | uint16(b[1])
+			b = b[2:]
+		} else {
+			d.PictureID = uint16(b[0])
+			b = b[1:]
+		}
+	}
+	if d.HasLayerIndices {
+		if len(b) < 1 {
+			return nil, ErrTruncated
+		}
+		d.TID = b[0] >> 5
+		d.SwitchingUp = b[0]&0x10 != 0
+		d.SID = (b[0] >> 1) & 0x07
+		d.InterLayer = b[0]&0x01 != 0
+		b = b[1:]
+		if !d.Flexible {
+			if len(b) < 1 {
+				return nil, ErrTruncated
+			}
+			d.TL0PicIdx = b[0]
+			b = b[1:]
+		}
+	}
+	d.PDiffs = nil
+	if d.Flexible && d.InterPicture {
+		for {
+			if len(b) < 1 || len(d.PDiffs) == 3 {
+				return nil, ErrTruncated
+			}
+			d.PDiffs = append(d.PDiffs, b[0]>>1)
+			more := b[0]&0x01 != 0
+			b = b[1:]
+			if !more {
+				break
+			}
+		}
+	}
+	d.ScalabilityLength = 0
+	if d.HasScalability {
+		n, err := scalabilityLength(b)
+		if err != nil {
+			return nil, err
+		}
+		d.ScalabilityLength = n
+		b = b[n:]
+	}
+	return b, nil
+}
+
+// scalabilityLength returns the size of the scalability structure.
+func scalabilityLength(b []byte) (int, error) {
+	if len(b) < 1 {
+		return 0, ErrTruncated
+	}
+	spatial := int(b[0]>>5) + 1
+	hasSizes := b[0]&0x10 != 0
+	hasGroup := b[0]&0x08 != 0
+	n := 1
+	if hasSizes {
+		n += spatial * 4
+	}
+	if hasGroup {
+		if len(b) < n+1 {
+			return 0, ErrTruncated
+		}
+		pictures := int(b[n])
+		n++
+		for i := 0; i < pictures; i++ {
+			if len(b) < n+1 {
+				return 0, ErrTruncated
+			}
+			refs := int(b[n]>>2) & 0x03
+			n += 1 + refs
+		}
+	}
+	if len(b) < n {
+		return 0, ErrTruncated
+	}
+	return n, nil
+}
+
+// Marshal encodes the descriptor. Only the picture id and flags are
+// encoded, picture ids always use 15 bits.
+func (d Descriptor) Marshal() []byte {
+	var flags byte
+	for _, f := range []struct {
+		set  bool
+		mask byte
+	}{
+		{d.HasPictureID, 0x80},
+		{d.InterPicture, 0x40},
+		{d.Begin, 0x08},
+		{d.End, 0x04},
+		{d.NotReference, 0x01},
+	} {
+		if f.set {
+			flags |= f.mask
+		}
+	}
+	b := []byte{flags}
+	if d.HasPictureID {
+		b = append(b, 0x80|byte(d.PictureID>>8)&0x7F, byte(d.PictureID))
+	}
+	return b
+}
+
+// Depacketizer reassembles VP9 frames. Spatial layers of the same
+// picture are combined into a single access unit.
+type Depacketizer struct {
+	frame   []byte
+	ts      uint32
+	sn      uint16
+	key     bool
+	started bool
+	broken  bool
+}
+
+// NewDepacketizer constructs a Depacketizer.
+func NewDepacketizer() *Depacketizer {
+	return &Depacketizer{}
+}
+
+// Depacketize consumes a packet and returns the frame once the marker
+// bit indicates the end of the picture. Frames with missing packets
+// are discarded.
+func (d *Depacketizer) Depacketize(p *rtp.Packet) ([]*codec.AccessUnit, error) {
+	var desc Descriptor
+	payload, err := desc.Unmarshal(p.Payload)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case desc.Begin && (!d.started || p.TS != d.ts):
+		// first packet of a new picture
+		d.frame = d.frame[:0]
+		d.ts = p.TS
+		d.broken = false
+		d.started = true
+		d.key = !desc.InterPicture && desc.SID == 0
+	case !d.started || p.SN != d.sn+1 || p.TS != d.ts:
+		d.broken = true
+	}
+	d.sn = p.SN
+	d.frame = append(d.frame, payload...)
+	if !p.Marker() {
+		return nil, nil
+	}
+	d.started = false
+	if d.broken || len(d.frame) == 0 {
+		return nil, nil
+	}
+	return []*codec.AccessUnit{{
+		Timestamp: d.ts,
+		Data:      [][]byte{append([]byte(nil), d.frame...)},
+		Key:       d.key,
+	}}, nil
+}
+
+// DefaultMTU is the default maximum RTP packet size.
+const DefaultMTU = 1200
+
+// Packetizer splits VP9 frames into packets using non-flexible mode
+// without layer indices.
+type Packetizer struct {
+	MTU int
+
+	pictureID uint16
+	seq       *rtp.Sequencer
+}
+
+// NewPacketizer constructs a Packetizer using the dynamic payload type.
+func NewPacketizer(pt int) *Packetizer {
+	return &Packetizer{
+		MTU: DefaultMTU,
+		seq: rtp.NewSequencer(pt),
+	}
+}
+
+// Sequencer returns the sequencer used to fill in the packet headers.
+func (p *Packetizer) Sequencer() *rtp.Sequencer {
+	return p.seq
+}
+
+// Packetize splits each frame in the access unit into packets.
+// The access unit Key field determines the P bit.
+func (p *Packetizer) Packetize(au *codec.AccessUnit) ([]*rtp.Packet, error) {
+	var packets []*rtp.Packet
+	for _, frame := range au.Data {
+		desc := Descriptor{
+			HasPictureID: true,
+			InterPicture: !au.Key,
+			Begin:        true,
+			PictureID:    p.pictureID & 0x7FFF,
+		}
+		p.pictureID++
+		for len(frame) > 0 {
+			n := p.MTU - rtp.HeaderSize - 3
+			if n <= 0 {
+				return nil, ErrMTUTooSmall
+			}
+			if n > len(frame) {
+				n = len(frame)
+			}
+			desc.End = n == len(frame)
+			payload := append(desc.Marshal(), frame[:n]...)
+			frame = frame[n:]
+			packets = append(packets, p.seq.Packet(au.Timestamp, len(frame) == 0, payload))
+			desc.Begin = false
+		}
+	}
+	return packets, nil
+}
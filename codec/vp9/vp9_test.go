@@ -0,0 +1,50 @@
+package vp9
+
+import (
+	"testing"
+
+	"github.com/icholy/rtsp/codec"
+	"gotest.tools/v3/assert"
+)
+
+func TestDescriptor(t *testing.T) {
+	// I, L, B, V with a single spatial layer and resolution
+	b := []byte{0xAA, 0x85, 0x01, 0x20, 0x05, 0x10, 0x02, 0x80, 0x01, 0xE0, 0xFF}
+	var d Descriptor
+	rest, err := d.Unmarshal(b)
+	assert.NilError(t, err)
+	assert.Assert(t, d.HasPictureID && d.HasLayerIndices && d.Begin && d.HasScalability)
+	assert.Equal(t, d.PictureID, uint16(0x0501))
+	assert.Equal(t, d.TID, uint8(1))
+	assert.Equal(t, d.TL0PicIdx, uint8(5))
+	assert.Equal(t, d.ScalabilityLength, 5)
+	assert.DeepEqual(t, rest, []byte{0xFF})
+}
+
+func TestRoundTrip(t *testing.T) {
+	frame := make([]byte, 3000)
+	for i := range frame {
+		frame[i] = byte(i)
+	}
+	p := NewPacketizer(98)
+	packets, err := p.Packetize(&codec.AccessUnit{Timestamp: 90, Data: [][]byte{frame}, Key: true})
+	assert.NilError(t, err)
+	assert.Equal(t, len(packets), 3)
+
+	d := NewDepacketizer()
+	var aus []*codec.AccessUnit
+	for _, pkt := range packets {
+		out, err := d.Depacketize(pkt)
+		assert.NilError(t, err)
+		aus = append(aus, out...)
+	}
+	assert.Equal(t, len(aus), 1)
+	assert.Assert(t, aus[0].Key)
+	assert.DeepEqual(t, aus[0].Data[0], frame)
+
+	packets, err = p.Packetize(&codec.AccessUnit{Timestamp: 180, Data: [][]byte{frame[:10]}})
+	assert.NilError(t, err)
+	aus, err = d.Depacketize(packets[0])
+	assert.NilError(t, err)
+	assert.Assert(t, !aus[0].Key)
+}
@@ -0,0 +1,64 @@
+package fmp4
+
+import "encoding/binary"
+
+// writer builds ISO BMFF boxes.
+type writer struct {
+	buf []byte
+}
+
+// box writes a box of the given type. The content is written by the
+// function and the size is patched in afterwards.
+func (w *writer) box(typ string, content func()) {
+	start := len(w.buf)
+	w.u32(0)
+	w.buf = append(w.buf, typ...)
+	content()
+	binary.BigEndian.PutUint32(w.buf[start:], uint32(len(w.buf)-start))
+}
+
+// fullbox writes a box with the version and flags header.
+func (w *writer) fullbox(typ string, version uint8, flags uint32, content func()) {
+	w.box(typ, func() {
+		w.u32(uint32(version)<<24 | flags&0xFFFFFF)
+		content()
+	})
+}
+
+func (w *writer) u8(v uint8) {
+	w.buf = append(w.buf, v)
+}
+
+func (w *writer) u16(v uint16) {
+	w.buf = append(w.buf, byte(v>>8), byte(v))
+}
+
+func (w *writer) u24(v uint32) {
+	w.buf = append(w.buf, byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (w *writer) u32(v uint32) {
+	w.buf = append(w.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (w *writer) u64(v uint64) {
+	w.u32(uint32(v >> 32))
+	w.u32(uint32(v))
+}
+
+func (w *writer) bytes(b []byte) {
+	w.buf = append(w.buf, b...)
+}
+
+func (w *writer) zeros(n int) {
+	for i := 0; i < n; i++ {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+// matrix writes the unity transformation matrix.
+func (w *writer) matrix() {
+	for _, v := range []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		w.u32(v)
+	}
+}
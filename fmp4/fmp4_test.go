@@ -0,0 +1,210 @@
+package fmp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/aac"
+	"github.com/icholy/rtsp/codec/h264"
+	"gotest.tools/v3/assert"
+)
+
+type box struct {
+	typ  string
+	data []byte
+}
+
+func parseBoxes(t *testing.T, b []byte) []box {
+	var boxes []box
+	for len(b) > 0 {
+		assert.Assert(t, len(b) >= 8)
+		size := int(binary.BigEndian.Uint32(b))
+		assert.Assert(t, size >= 8 && size <= len(b))
+		boxes = append(boxes, box{string(b[4:8]), b[8:size]})
+		b = b[size:]
+	}
+	return boxes
+}
+
+func findBox(t *testing.T, b []byte, path ...string) []byte {
+	for _, typ := range path {
+		var found bool
+		for _, bx := range parseBoxes(t, b) {
+			if bx.typ == typ {
+				b, found = bx.data, true
+				break
+			}
+		}
+		assert.Assert(t, found, "missing %s", typ)
+	}
+	return b
+}
+
+func types(boxes []box) []string {
+	var tt []string
+	for _, b := range boxes {
+		tt = append(tt, b.typ)
+	}
+	return tt
+}
+
+func testTracks(t *testing.T) []*Track {
+	sps, pps, err := h264.ParseSpropParameterSets("Z00AKeKQDwBE/LgLcBAQGkHiRFQ=,aO48gA==")
+	assert.NilError(t, err)
+	video, err := NewH264Track(sps, pps)
+	assert.NilError(t, err)
+	audio := NewAACTrack(aac.AudioSpecificConfig{ObjectType: 2, SampleRate: 48000, ChannelCount: 2})
+	return []*Track{video, audio}
+}
+
+func TestMuxer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMuxer(&buf, testTracks(t))
+	m.FragmentDuration = 100 * time.Millisecond
+	for i := 0; i < 10; i++ {
+		ts := uint32(0xFFFFF000 + i*3000) // wraps around
+		err := m.WriteAccessUnit(0, &codec.AccessUnit{
+			Timestamp: ts,
+			Data:      [][]byte{{0x65, byte(i)}},
+			Key:       i%5 == 0,
+		})
+		assert.NilError(t, err)
+		err = m.WriteAccessUnit(1, &codec.AccessUnit{
+			Timestamp: uint32(i * 1600),
+			Data:      [][]byte{{0x21, byte(i)}},
+			Key:       true,
+		})
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, m.Flush())
+
+	top := parseBoxes(t, buf.Bytes())
+	assert.DeepEqual(t, types(top), []string{"ftyp", "moov", "moof", "mdat", "moof", "mdat"})
+	moov := top[1].data
+	assert.Equal(t, len(findBox(t, moov, "trak", "mdia", "minf", "stbl", "stsd")) > 0, true)
+	avcC := findBox(t, moov, "trak", "mdia", "minf", "stbl", "stsd")
+	assert.Assert(t, bytes.Contains(avcC, []byte("avcC")))
+
+	// second fragment starts with the key frame at 15000
+	moof := top[4].data
+	mdat := top[5].data
+	traf := findBox(t, moof, "traf")
+	tfdt := findBox(t, traf, "tfdt")
+	assert.Equal(t, binary.BigEndian.Uint64(tfdt[4:]), uint64(15000))
+	trun := findBox(t, traf, "trun")
+	assert.Equal(t, binary.BigEndian.Uint32(trun[4:]), uint32(5))
+	offset := int(binary.BigEndian.Uint32(trun[8:]))
+	// the data offset points at the first sample in the mdat
+	moofSize := len(moof) + 8
+	assert.Equal(t, offset, moofSize+8)
+	assert.DeepEqual(t, mdat[:6], []byte{0, 0, 0, 2, 0x65, 5})
+	// last sample reuses the previous duration
+	last := trun[12+4*16:]
+	assert.Equal(t, binary.BigEndian.Uint32(last), uint32(3000))
+}
+
+func TestHighProfile(t *testing.T) {
+	sps, pps, err := h264.ParseSpropParameterSets("Z2QAKKwbGoB4AiflwFuAgICgAAB9AAAXcAHjBEww,aO48sA==")
+	assert.NilError(t, err)
+	video, err := NewH264Track(sps, pps)
+	assert.NilError(t, err)
+	moov := parseBoxes(t, InitSegment([]*Track{video}))[1].data
+	stsd := findBox(t, moov, "trak", "mdia", "minf", "stbl", "stsd")
+	avc1 := findBox(t, stsd[8:], "avc1")
+	avcC := findBox(t, avc1[78:], "avcC")
+	// chroma_format and bit depths follow the parameter sets
+	assert.DeepEqual(t, avcC[len(avcC)-4:], []byte{0xFD, 0xF8, 0xF8, 0})
+}
+
+func TestMuxerStart(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMuxer(&buf, testTracks(t))
+	aus := []struct {
+		index int
+		au    *codec.AccessUnit
+	}{
+		// dropped until the key frame
+		{1, &codec.AccessUnit{Timestamp: 100000, Data: [][]byte{{0x21, 0}}, Key: true}},
+		{0, &codec.AccessUnit{Timestamp: 5000, Data: [][]byte{{0x41, 0}}}},
+		{1, &codec.AccessUnit{Timestamp: 101024, Data: [][]byte{{0x21, 1}}, Key: true}},
+		{0, &codec.AccessUnit{Timestamp: 8000, Data: [][]byte{{0x65, 1}}, Key: true}},
+		{1, &codec.AccessUnit{Timestamp: 102048, Data: [][]byte{{0x21, 2}}, Key: true}},
+		{0, &codec.AccessUnit{Timestamp: 11000, Data: [][]byte{{0x41, 2}}}},
+	}
+	for _, a := range aus {
+		assert.NilError(t, m.WriteAccessUnit(a.index, a.au))
+	}
+	assert.NilError(t, m.Flush())
+
+	top := parseBoxes(t, buf.Bytes())
+	assert.DeepEqual(t, types(top), []string{"ftyp", "moov", "moof", "mdat"})
+	var times []uint64
+	for _, b := range parseBoxes(t, top[2].data) {
+		if b.typ == "traf" {
+			tfdt := findBox(t, b.data, "tfdt")
+			times = append(times, binary.BigEndian.Uint64(tfdt[4:]))
+		}
+	}
+	// the audio starts one frame after the last one dropped
+	assert.DeepEqual(t, times, []uint64{0, 1024})
+}
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fmp4")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	var files []string
+	r := NewRecorder(dir, testTracks(t)[:1])
+	r.MaxDuration = time.Second
+	r.Filename = func(time.Time) string {
+		return strconv.Itoa(len(files)) + ".mp4"
+	}
+	r.OnClose = func(path string) {
+		files = append(files, path)
+	}
+	for i := 0; i < 100; i++ {
+		err := r.WriteAccessUnit(0, &codec.AccessUnit{
+			Timestamp: uint32(i * 3000),
+			Data:      [][]byte{{0x41, byte(i)}},
+			Key:       i%30 == 0,
+		})
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, r.Close())
+	assert.DeepEqual(t, files, []string{
+		filepath.Join(dir, "0.mp4"),
+		filepath.Join(dir, "1.mp4"),
+		filepath.Join(dir, "2.mp4"),
+		filepath.Join(dir, "3.mp4"),
+	})
+	data, err := ioutil.ReadFile(files[1])
+	assert.NilError(t, err)
+	assert.DeepEqual(t, types(parseBoxes(t, data))[:2], []string{"ftyp", "moov"})
+
+	// rotating to the same name never overwrites a file
+	dir2, err := ioutil.TempDir("", "fmp4")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir2)
+	r = NewRecorder(dir2, testTracks(t)[:1])
+	r.MaxDuration = time.Millisecond
+	r.Filename = func(time.Time) string { return "recording.mp4" }
+	for i := 0; i < 10; i++ {
+		err := r.WriteAccessUnit(0, &codec.AccessUnit{
+			Timestamp: uint32(i * 3000),
+			Data:      [][]byte{{0x65, byte(i)}},
+			Key:       true,
+		})
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, r.Close())
+	names, err := filepath.Glob(filepath.Join(dir2, "*.mp4"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(names), 10)
+}
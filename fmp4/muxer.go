@@ -0,0 +1,236 @@
+package fmp4
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// ErrInvalidTrack is returned when an access unit refers to an unknown track.
+var ErrInvalidTrack = errors.New("fmp4: invalid track index")
+
+// DefaultFragmentDuration is the default target fragment duration.
+const DefaultFragmentDuration = time.Second
+
+// Muxer writes access units as a fragmented MP4 stream. RTP timestamps
+// are used as presentation and decode times, so streams with B-frames are
+// not supported.
+//
+// The stream starts at the first key frame of the track fragments are cut
+// on. Access units of the other tracks received before it are dropped,
+// and the last one dropped marks the start time in that track's clock.
+// The tracks are aligned by arrival, not with RTCP sender reports.
+type Muxer struct {
+	// FragmentDuration is the minimum duration of a fragment. Fragments are
+	// cut before a key frame of the first video track, or any access unit
+	// when there are no video tracks.
+	FragmentDuration time.Duration
+
+	w       io.Writer
+	tracks  []*muxTrack
+	cut     int
+	seq     uint32
+	init    bool
+	started bool
+}
+
+type muxTrack struct {
+	*Track
+	clock    *rtp.Clock
+	base     int64 // start time in the track clock
+	hasBase  bool
+	started  bool // the first sample was written
+	pending  *muxSample
+	duration uint32 // of the previous sample
+	samples  []muxSample
+	written  uint64 // total duration of the flushed samples
+}
+
+type muxSample struct {
+	Sample
+	time uint64
+}
+
+// NewMuxer constructs a Muxer writing to w. Tracks without an ID are
+// numbered starting at 1. The access units passed to WriteAccessUnit
+// refer to the tracks by index.
+func NewMuxer(w io.Writer, tracks []*Track) *Muxer {
+	m := &Muxer{
+		FragmentDuration: DefaultFragmentDuration,
+		w:                w,
+	}
+	m.cut = -1
+	for i, t := range tracks {
+		if t.ID == 0 {
+			t.ID = uint32(i + 1)
+		}
+		if m.cut < 0 && t.IsVideo() {
+			m.cut = i
+		}
+		m.tracks = append(m.tracks, &muxTrack{
+			Track: t,
+			clock: rtp.NewClock(int(t.TimeScale)),
+		})
+	}
+	return m
+}
+
+// WriteAccessUnit adds an access unit to the current fragment. Video
+// access units contain NAL units and audio access units contain a
+// single frame. Video access units are dropped until the first key frame.
+func (m *Muxer) WriteAccessUnit(index int, au *codec.AccessUnit) error {
+	if index < 0 || index >= len(m.tracks) {
+		return ErrInvalidTrack
+	}
+	t := m.tracks[index]
+	now := t.clock.Unwrap(au.Timestamp)
+	if !m.started {
+		if !m.isCut(index, au) {
+			t.base, t.hasBase = now, true
+			return nil
+		}
+		m.started = true
+		t.base, t.hasBase = now, true
+	}
+	if !t.hasBase {
+		t.base, t.hasBase = now, true
+	}
+	if !t.started {
+		if t.IsVideo() && !au.Key {
+			return nil
+		}
+		t.started = true
+	}
+	ts := now - t.base
+	if ts < 0 {
+		ts = 0
+	}
+	if p := t.pending; p != nil {
+		if uint64(ts) > p.time {
+			p.Duration = uint32(uint64(ts) - p.time)
+			t.duration = p.Duration
+		}
+		t.samples = append(t.samples, *p)
+		t.pending = nil
+	}
+	if m.isCut(index, au) && m.fragmentDuration() >= m.FragmentDuration {
+		if err := m.flush(); err != nil {
+			return err
+		}
+	}
+	var data []byte
+	if t.IsVideo() {
+		data = h264.JoinAVCC(au.Data)
+	} else {
+		data = bytes.Join(au.Data, nil)
+	}
+	t.pending = &muxSample{
+		Sample: Sample{Key: au.Key, Data: data},
+		time:   uint64(ts),
+	}
+	return nil
+}
+
+// isCut returns true when a fragment may start with the access unit.
+func (m *Muxer) isCut(index int, au *codec.AccessUnit) bool {
+	if m.cut < 0 {
+		return true
+	}
+	return index == m.cut && au.Key
+}
+
+// fragmentDuration returns the duration of the samples in the current
+// fragment of the track fragments are cut on.
+func (m *Muxer) fragmentDuration() time.Duration {
+	index := m.cut
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(m.tracks) {
+		return 0
+	}
+	var total int64
+	for _, s := range m.tracks[index].samples {
+		total += int64(s.Duration)
+	}
+	return m.tracks[index].clock.Duration(total)
+}
+
+// Duration returns the duration of the samples written so far using the
+// track fragments are cut on.
+func (m *Muxer) Duration() time.Duration {
+	index := m.cut
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(m.tracks) {
+		return 0
+	}
+	t := m.tracks[index]
+	return t.clock.Duration(int64(t.written)) + m.fragmentDuration()
+}
+
+// elapsed returns the time of the access unit relative to the start of
+// its track.
+func (m *Muxer) elapsed(index int, au *codec.AccessUnit) time.Duration {
+	t := m.tracks[index]
+	if !t.hasBase {
+		return 0
+	}
+	return t.clock.Duration(t.clock.Unwrap(au.Timestamp) - t.base)
+}
+
+// Flush writes the buffered access units as a fragment. The duration
+// of the last access unit in each track is assumed to be the same as the
+// previous one. Flush should be called when the stream ends.
+func (m *Muxer) Flush() error {
+	for _, t := range m.tracks {
+		if p := t.pending; p != nil {
+			p.Duration = t.duration
+			t.samples = append(t.samples, *p)
+			t.pending = nil
+		}
+	}
+	return m.flush()
+}
+
+func (m *Muxer) flush() error {
+	if !m.init {
+		tracks := make([]*Track, len(m.tracks))
+		for i, t := range m.tracks {
+			tracks[i] = t.Track
+		}
+		if _, err := m.w.Write(InitSegment(tracks)); err != nil {
+			return err
+		}
+		m.init = true
+	}
+	var f Fragment
+	for _, t := range m.tracks {
+		if len(t.samples) == 0 {
+			continue
+		}
+		r := Run{
+			TrackID:  t.ID,
+			BaseTime: t.samples[0].time,
+		}
+		for _, s := range t.samples {
+			r.Samples = append(r.Samples, s.Sample)
+			t.written += uint64(s.Duration)
+		}
+		f.Runs = append(f.Runs, r)
+		t.samples = nil
+	}
+	if len(f.Runs) == 0 {
+		return nil
+	}
+	m.seq++
+	f.Sequence = m.seq
+	_, err := m.w.Write(f.Marshal())
+	return err
+}
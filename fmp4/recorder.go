@@ -0,0 +1,82 @@
+package fmp4
+
+import (
+	"io"
+	"time"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/internal/rotate"
+)
+
+// Recorder writes access units to a sequence of fragmented MP4 files.
+// A new file is started at a key frame once the current file reaches
+// MaxDuration or MaxSize.
+type Recorder struct {
+	// Dir is the directory files are created in.
+	Dir string
+	// Tracks describes the tracks of the recording.
+	Tracks []*Track
+	// MaxDuration is the duration at which files are rotated. Zero disables
+	// duration based rotation.
+	MaxDuration time.Duration
+	// MaxSize is the size in bytes at which files are rotated. Zero disables
+	// size based rotation.
+	MaxSize int64
+	// FragmentDuration is passed to the Muxer of each file.
+	FragmentDuration time.Duration
+	// Filename returns the name of a file started at the given time.
+	// The default uses the start time. ie: 20060102T150405.000.mp4
+	// Existing files are never overwritten, a numeric suffix is added to
+	// the name instead. ie: 20060102T150405.000-1.mp4
+	Filename func(start time.Time) string
+	// OnClose is called after a file is closed.
+	OnClose func(path string)
+
+	files rotate.Files
+}
+
+// NewRecorder constructs a Recorder writing to the directory.
+func NewRecorder(dir string, tracks []*Track) *Recorder {
+	return &Recorder{
+		Dir:              dir,
+		Tracks:           tracks,
+		FragmentDuration: DefaultFragmentDuration,
+	}
+}
+
+// WriteAccessUnit writes the access unit to the current file, rotating
+// files when needed. The index refers to the Tracks field.
+func (r *Recorder) WriteAccessUnit(index int, au *codec.AccessUnit) error {
+	return r.files.WriteAccessUnit(r.options(), index, au)
+}
+
+// Close flushes and closes the current file. The next call to
+// WriteAccessUnit starts a new file.
+func (r *Recorder) Close() error {
+	return r.files.Close(r.options())
+}
+
+func (r *Recorder) options() *rotate.Options {
+	return &rotate.Options{
+		Dir:         r.Dir,
+		Ext:         ".mp4",
+		MaxDuration: r.MaxDuration,
+		MaxSize:     r.MaxSize,
+		Filename:    r.Filename,
+		OnClose:     r.OnClose,
+		NewMuxer: func(w io.Writer) rotate.Muxer {
+			m := NewMuxer(w, r.Tracks)
+			m.FragmentDuration = r.FragmentDuration
+			return segment{m}
+		},
+	}
+}
+
+// segment adapts the Muxer for rotation.
+type segment struct{ *Muxer }
+
+func (s segment) Cut(index int, au *codec.AccessUnit) bool { return s.isCut(index, au) }
+
+func (s segment) Elapsed(index int, au *codec.AccessUnit) time.Duration {
+	return s.elapsed(index, au)
+}
@@ -0,0 +1,205 @@
+package fmp4
+
+// InitSegment returns the ftyp and moov boxes describing the tracks.
+func InitSegment(tracks []*Track) []byte {
+	w := &writer{}
+	w.box("ftyp", func() {
+		w.bytes([]byte("iso5"))
+		w.u32(512)
+		w.bytes([]byte("iso5iso6mp41"))
+	})
+	w.box("moov", func() {
+		var next uint32
+		for _, t := range tracks {
+			if t.ID > next {
+				next = t.ID
+			}
+		}
+		w.fullbox("mvhd", 0, 0, func() {
+			w.u32(0)    // creation_time
+			w.u32(0)    // modification_time
+			w.u32(1000) // timescale
+			w.u32(0)    // duration
+			w.u32(0x00010000)
+			w.u16(0x0100)
+			w.zeros(10)
+			w.matrix()
+			w.zeros(24)
+			w.u32(next + 1)
+		})
+		for _, t := range tracks {
+			trak(w, t)
+		}
+		w.box("mvex", func() {
+			for _, t := range tracks {
+				w.fullbox("trex", 0, 0, func() {
+					w.u32(t.ID)
+					w.u32(1) // default_sample_description_index
+					w.u32(0)
+					w.u32(0)
+					w.u32(0)
+				})
+			}
+		})
+	})
+	return w.buf
+}
+
+func trak(w *writer, t *Track) {
+	w.box("trak", func() {
+		w.fullbox("tkhd", 0, 3, func() {
+			w.u32(0)
+			w.u32(0)
+			w.u32(t.ID)
+			w.u32(0)
+			w.u32(0) // duration
+			w.zeros(8)
+			w.u16(0) // layer
+			w.u16(0) // alternate_group
+			if t.IsVideo() {
+				w.u16(0)
+			} else {
+				w.u16(0x0100)
+			}
+			w.u16(0)
+			w.matrix()
+			w.u32(uint32(t.Width) << 16)
+			w.u32(uint32(t.Height) << 16)
+		})
+		w.box("mdia", func() {
+			w.fullbox("mdhd", 0, 0, func() {
+				w.u32(0)
+				w.u32(0)
+				w.u32(t.TimeScale)
+				w.u32(0)
+				w.u16(0x55C4) // und
+				w.u16(0)
+			})
+			w.fullbox("hdlr", 0, 0, func() {
+				w.u32(0)
+				w.bytes([]byte(t.handler))
+				w.zeros(12)
+				if t.IsVideo() {
+					w.bytes([]byte("VideoHandler\x00"))
+				} else {
+					w.bytes([]byte("SoundHandler\x00"))
+				}
+			})
+			w.box("minf", func() {
+				if t.IsVideo() {
+					w.fullbox("vmhd", 0, 1, func() {
+						w.zeros(8)
+					})
+				} else {
+					w.fullbox("smhd", 0, 0, func() {
+						w.zeros(4)
+					})
+				}
+				w.box("dinf", func() {
+					w.fullbox("dref", 0, 0, func() {
+						w.u32(1)
+						w.fullbox("url ", 0, 1, func() {})
+					})
+				})
+				w.box("stbl", func() {
+					w.fullbox("stsd", 0, 0, func() {
+						w.u32(1)
+						t.entry(w)
+					})
+					w.fullbox("stts", 0, 0, func() { w.u32(0) })
+					w.fullbox("stsc", 0, 0, func() { w.u32(0) })
+					w.fullbox("stsz", 0, 0, func() { w.u32(0); w.u32(0) })
+					w.fullbox("stco", 0, 0, func() { w.u32(0) })
+				})
+			})
+		})
+	})
+}
+
+// Sample is a media sample in a fragment.
+type Sample struct {
+	Duration uint32
+	// CompositionOffset is the difference between the presentation and
+	// decode time.
+	CompositionOffset int32
+	Key               bool
+	Data              []byte
+}
+
+// flags returns the trun sample flags.
+func (s Sample) flags() uint32 {
+	if s.Key {
+		// sample_depends_on = 2
+		return 0x02000000
+	}
+	// sample_depends_on = 1, sample_is_non_sync_sample = 1
+	return 0x01010000
+}
+
+// Run contains the samples of a single track in a fragment.
+type Run struct {
+	TrackID uint32
+	// BaseTime is the decode time of the first sample in the track timescale.
+	BaseTime uint64
+	Samples  []Sample
+}
+
+// Fragment is a moof and mdat pair.
+type Fragment struct {
+	Sequence uint32
+	Runs     []Run
+}
+
+// Marshal encodes the fragment.
+func (f Fragment) Marshal() []byte {
+	w := &writer{}
+	var offsets []int
+	w.box("moof", func() {
+		w.fullbox("mfhd", 0, 0, func() {
+			w.u32(f.Sequence)
+		})
+		for _, r := range f.Runs {
+			w.box("traf", func() {
+				// default-base-is-moof
+				w.fullbox("tfhd", 0, 0x020000, func() {
+					w.u32(r.TrackID)
+				})
+				w.fullbox("tfdt", 1, 0, func() {
+					w.u64(r.BaseTime)
+				})
+				// data-offset, duration, size, flags and composition offset present
+				w.fullbox("trun", 1, 0x000F01, func() {
+					w.u32(uint32(len(r.Samples)))
+					offsets = append(offsets, len(w.buf))
+					w.u32(0)
+					for _, s := range r.Samples {
+						w.u32(s.Duration)
+						w.u32(uint32(len(s.Data)))
+						w.u32(s.flags())
+						w.u32(uint32(s.CompositionOffset))
+					}
+				})
+			})
+		}
+	})
+	// data offsets are relative to the start of the moof
+	offset := len(w.buf) + 8
+	for i, r := range f.Runs {
+		pos := offsets[i]
+		w.buf[pos] = byte(offset >> 24)
+		w.buf[pos+1] = byte(offset >> 16)
+		w.buf[pos+2] = byte(offset >> 8)
+		w.buf[pos+3] = byte(offset)
+		for _, s := range r.Samples {
+			offset += len(s.Data)
+		}
+	}
+	w.box("mdat", func() {
+		for _, r := range f.Runs {
+			for _, s := range r.Samples {
+				w.bytes(s.Data)
+			}
+		}
+	})
+	return w.buf
+}
@@ -0,0 +1,213 @@
+package fmp4
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/aac"
+	"github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/codec/h265"
+)
+
+// ErrUnsupported is returned when a track can't be created for a format.
+var ErrUnsupported = errors.New("fmp4: unsupported format")
+
+// Track describes a media track in the init segment.
+type Track struct {
+	// ID is the track id. The Muxer assigns ids when they're zero.
+	ID uint32
+	// TimeScale is the number of time units per second, this is the
+	// RTP clock rate.
+	TimeScale uint32
+	// Width and Height are set for video tracks.
+	Width  int
+	Height int
+
+	handler string // vide or soun
+	entry   func(w *writer)
+}
+
+// IsVideo returns true for video tracks.
+func (t *Track) IsVideo() bool {
+	return t.handler == "vide"
+}
+
+// NewH264Track creates a video track using the SPS and PPS.
+func NewH264Track(sps, pps []byte) (*Track, error) {
+	s, err := h264.ParseSPS(sps)
+	if err != nil {
+		return nil, err
+	}
+	t := &Track{
+		TimeScale: 90000,
+		Width:     s.Width,
+		Height:    s.Height,
+		handler:   "vide",
+	}
+	t.entry = func(w *writer) {
+		t.visualEntry(w, "avc1", func() {
+			w.box("avcC", func() {
+				w.u8(1)
+				w.u8(s.ProfileIDC)
+				w.u8(s.ConstraintFlags)
+				w.u8(s.LevelIDC)
+				w.u8(0xFF) // 4 byte nal unit lengths
+				w.u8(0xE1) // one sps
+				w.u16(uint16(len(sps)))
+				w.bytes(sps)
+				w.u8(1) // one pps
+				w.u16(uint16(len(pps)))
+				w.bytes(pps)
+				switch s.ProfileIDC {
+				case 100, 110, 122, 244:
+					w.u8(0xFC | byte(s.ChromaFormatIDC))
+					w.u8(0xF8 | byte(s.BitDepthLumaMinus8))
+					w.u8(0xF8 | byte(s.BitDepthChromaMinus8))
+					w.u8(0) // no sps extensions
+				}
+			})
+		})
+	}
+	return t, nil
+}
+
+// NewH265Track creates a video track using the VPS, SPS and PPS.
+func NewH265Track(vps, sps, pps []byte) (*Track, error) {
+	s, err := h265.ParseSPS(sps)
+	if err != nil {
+		return nil, err
+	}
+	t := &Track{
+		TimeScale: 90000,
+		Width:     s.Width,
+		Height:    s.Height,
+		handler:   "vide",
+	}
+	t.entry = func(w *writer) {
+		t.visualEntry(w, "hvc1", func() {
+			w.box("hvcC", func() {
+				w.u8(1)
+				w.bytes(s.ProfileTierLevel)
+				w.u16(0xF000) // min_spatial_segmentation_idc
+				w.u8(0xFC)    // parallelismType
+				w.u8(0xFC | byte(s.ChromaFormatIDC))
+				w.u8(0xF8 | byte(s.BitDepthLumaMinus8))
+				w.u8(0xF8 | byte(s.BitDepthChromaMinus8))
+				w.u16(0) // avgFrameRate
+				// one temporal layer, nested, 4 byte nal unit lengths
+				w.u8(1<<3 | 1<<2 | 3)
+				w.u8(3)
+				for _, nalu := range [][]byte{vps, sps, pps} {
+					w.u8(0x80 | byte(h265.NALUType(nalu)))
+					w.u16(1)
+					w.u16(uint16(len(nalu)))
+					w.bytes(nalu)
+				}
+			})
+		})
+	}
+	return t, nil
+}
+
+// NewAACTrack creates an audio track using the config.
+func NewAACTrack(config aac.AudioSpecificConfig) *Track {
+	t := &Track{
+		TimeScale: uint32(config.SampleRate),
+		handler:   "soun",
+	}
+	t.entry = func(w *writer) {
+		w.box("mp4a", func() {
+			w.zeros(6)
+			w.u16(1) // data_reference_index
+			w.zeros(8)
+			w.u16(uint16(config.ChannelCount))
+			w.u16(16) // samplesize
+			w.zeros(4)
+			w.u32(uint32(config.SampleRate) << 16)
+			w.fullbox("esds", 0, 0, func() {
+				asc := config.Marshal()
+				// ES_Descriptor
+				w.u8(0x03)
+				w.u8(byte(23 + len(asc)))
+				w.u16(uint16(t.ID))
+				w.u8(0)
+				// DecoderConfigDescriptor
+				w.u8(0x04)
+				w.u8(byte(15 + len(asc)))
+				w.u8(0x40) // MPEG-4 audio
+				w.u8(0x15) // audio stream
+				w.u24(0)   // bufferSizeDB
+				w.u32(0)   // maxBitrate
+				w.u32(0)   // avgBitrate
+				w.u8(0x05) // DecoderSpecificInfo
+				w.u8(byte(len(asc)))
+				w.bytes(asc)
+				// SLConfigDescriptor
+				w.u8(0x06)
+				w.u8(1)
+				w.u8(0x02)
+			})
+		})
+	}
+	return t
+}
+
+// NewTrack creates a track using the parameter sets or config found in
+// the SDP fmtp.
+func NewTrack(f codec.Format) (*Track, error) {
+	switch strings.ToUpper(f.Encoding) {
+	case "H264":
+		sprop, ok := f.Fmtp["sprop-parameter-sets"]
+		if !ok {
+			return nil, fmt.Errorf("fmp4: missing sprop-parameter-sets")
+		}
+		sps, pps, err := h264.ParseSpropParameterSets(sprop)
+		if err != nil {
+			return nil, err
+		}
+		return NewH264Track(sps, pps)
+	case "H265":
+		ps, err := h265.ParseParameterSets(f.Fmtp)
+		if err != nil {
+			return nil, err
+		}
+		if ps.VPS == nil || ps.SPS == nil || ps.PPS == nil {
+			return nil, fmt.Errorf("fmp4: missing sprop-vps, sprop-sps or sprop-pps")
+		}
+		return NewH265Track(ps.VPS, ps.SPS, ps.PPS)
+	case "MPEG4-GENERIC":
+		config, err := aac.ParseAudioSpecificConfig(f.Fmtp["config"])
+		if err != nil {
+			return nil, err
+		}
+		return NewAACTrack(config), nil
+	case "MP4A-LATM":
+		mux, err := aac.ParseStreamMuxConfig(f.Fmtp["config"])
+		if err != nil {
+			return nil, err
+		}
+		return NewAACTrack(mux.Config), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, f.Encoding)
+	}
+}
+
+func (t *Track) visualEntry(w *writer, typ string, config func()) {
+	w.box(typ, func() {
+		w.zeros(6)
+		w.u16(1) // data_reference_index
+		w.zeros(16)
+		w.u16(uint16(t.Width))
+		w.u16(uint16(t.Height))
+		w.u32(0x00480000) // 72 dpi
+		w.u32(0x00480000)
+		w.u32(0)
+		w.u16(1) // frame_count
+		w.zeros(32)
+		w.u16(0x0018)
+		w.u16(0xFFFF)
+		config()
+	})
+}
@@ -52,6 +52,36 @@ func ReadFrame(r io.Reader) (Frame, error) {
 	}, nil
 }
 
+// ReadFrameBuffer reads an interleaved binary frame from the reader into buf.
+// The returned Frame's Data aliases buf when it has enough capacity, otherwise
+// a new buffer is allocated. Passing the previous frame's Data back in allows
+// reading frames without allocating.
+func ReadFrameBuffer(r io.Reader, buf []byte) (Frame, error) {
+	if cap(buf) < 4 {
+		buf = make([]byte, 4, math.MaxUint16)
+	}
+	hdr := buf[:4]
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return Frame{}, err
+	}
+	if hdr[0] != '$' {
+		return Frame{}, fmt.Errorf("invalid magic prefix: %v", hdr[0])
+	}
+	channel := int(hdr[1])
+	size := int(binary.BigEndian.Uint16(hdr[2:]))
+	if cap(buf) < size {
+		buf = make([]byte, size)
+	}
+	data := buf[:size]
+	if _, err := io.ReadFull(r, data); err != nil {
+		return Frame{}, err
+	}
+	return Frame{
+		Channel: channel,
+		Data:    data,
+	}, nil
+}
+
 // IsFrame returns true when the next message is an interleaved frame.
 // This will block until at least one byte is available in the reader
 func IsFrame(r *bufio.Reader) (bool, error) {
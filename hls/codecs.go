@@ -0,0 +1,83 @@
+package hls
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/aac"
+	"github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/codec/h265"
+)
+
+// CodecString returns the RFC 6381 codec string used in the CODECS
+// attribute of the master playlist.
+func CodecString(f codec.Format) (string, error) {
+	switch strings.ToUpper(f.Encoding) {
+	case "H264":
+		sps, _, err := h264.ParseSpropParameterSets(f.Fmtp["sprop-parameter-sets"])
+		if err != nil {
+			return "", err
+		}
+		if len(sps) < 4 {
+			return "", h264.ErrInvalidSPS
+		}
+		return fmt.Sprintf("avc1.%02x%02x%02x", sps[1], sps[2], sps[3]), nil
+	case "H265":
+		ps, err := h265.ParseParameterSets(f.Fmtp)
+		if err != nil {
+			return "", err
+		}
+		s, err := h265.ParseSPS(ps.SPS)
+		if err != nil {
+			return "", err
+		}
+		return hvc1(s.ProfileTierLevel), nil
+	case "MPEG4-GENERIC":
+		config, err := aac.ParseAudioSpecificConfig(f.Fmtp["config"])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("mp4a.40.%d", config.ObjectType), nil
+	case "MP4A-LATM":
+		mux, err := aac.ParseStreamMuxConfig(f.Fmtp["config"])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("mp4a.40.%d", mux.Config.ObjectType), nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, f.Encoding)
+	}
+}
+
+// hvc1 formats the codec string using the general profile, tier and
+// level as described in ISO 14496-15 Annex E.
+func hvc1(ptl []byte) string {
+	var b strings.Builder
+	b.WriteString("hvc1.")
+	if space := ptl[0] >> 6; space > 0 {
+		b.WriteByte('A' + space - 1)
+	}
+	fmt.Fprintf(&b, "%d.", ptl[0]&0x1F)
+	// compatibility flags in reverse bit order
+	compat := uint32(ptl[1])<<24 | uint32(ptl[2])<<16 | uint32(ptl[3])<<8 | uint32(ptl[4])
+	var reversed uint32
+	for i := 0; i < 32; i++ {
+		reversed = reversed<<1 | compat>>uint(i)&1
+	}
+	fmt.Fprintf(&b, "%X.", reversed)
+	if ptl[0]&0x20 != 0 {
+		b.WriteByte('H')
+	} else {
+		b.WriteByte('L')
+	}
+	fmt.Fprintf(&b, "%d", ptl[11])
+	constraints := ptl[5:11]
+	for len(constraints) > 0 && constraints[len(constraints)-1] == 0 {
+		constraints = constraints[:len(constraints)-1]
+	}
+	for _, c := range constraints {
+		fmt.Fprintf(&b, ".%X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,180 @@
+package hls
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/sdp"
+	"gotest.tools/v3/assert"
+)
+
+var testFormats = []codec.Format{
+	{
+		RTPMap: sdp.RTPMap{PayloadType: 96, Encoding: "H264", ClockRate: 90000},
+		Fmtp:   map[string]string{"sprop-parameter-sets": "Z00AKeKQDwBE/LgLcBAQGkHiRFQ=,aO48gA=="},
+	},
+	{
+		RTPMap: sdp.RTPMap{PayloadType: 97, Encoding: "MPEG4-GENERIC", ClockRate: 48000, Channels: 2},
+		Fmtp:   map[string]string{"config": "1190", "sizelength": "13"},
+	},
+}
+
+// feed writes 30fps video with a key frame every second and 48kHz audio.
+func feed(t *testing.T, p *Packager, from, to int) {
+	for i := from; i < to; i++ {
+		err := p.WriteAccessUnit(0, &codec.AccessUnit{
+			Timestamp: uint32(i * 3000),
+			Data:      [][]byte{{0x65, byte(i)}},
+			Key:       i%30 == 0,
+		})
+		assert.NilError(t, err)
+		err = p.WriteAccessUnit(1, &codec.AccessUnit{
+			Timestamp: uint32(i * 1600),
+			Data:      [][]byte{{0x21, byte(i)}},
+			Key:       true,
+		})
+		assert.NilError(t, err)
+	}
+}
+
+func get(t *testing.T, srv *httptest.Server, path string) (int, string) {
+	res, err := http.Get(srv.URL + "/live/" + path)
+	assert.NilError(t, err)
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NilError(t, err)
+	return res.StatusCode, string(body)
+}
+
+func TestCodecString(t *testing.T) {
+	s, err := CodecString(testFormats[0])
+	assert.NilError(t, err)
+	assert.Equal(t, s, "avc1.4d0029")
+	s, err = CodecString(testFormats[1])
+	assert.NilError(t, err)
+	assert.Equal(t, s, "mp4a.40.2")
+	s, err = CodecString(codec.Format{
+		RTPMap: sdp.RTPMap{Encoding: "H265"},
+		Fmtp:   map[string]string{"sprop-sps": "QgEBAWAAAAMAsAAAAwAAAwB4oAPAgBDlja5JMvTcBAQEAg=="},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, s, "hvc1.1.6.L120.B0")
+}
+
+func TestLowLatency(t *testing.T) {
+	p, err := NewPackager(testFormats, FMP4)
+	assert.NilError(t, err)
+	p.SegmentDuration = time.Second
+	p.PartDuration = 200 * time.Millisecond
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	feed(t, p, 0, 75)
+
+	code, body := get(t, srv, "index.m3u8")
+	assert.Equal(t, code, 200)
+	assert.Assert(t, strings.Contains(body, `CODECS="avc1.4d0029,mp4a.40.2",RESOLUTION=1920x1080`), body)
+
+	_, body = get(t, srv, "stream.m3u8")
+	for _, line := range []string{
+		"#EXT-X-VERSION:9",
+		"#EXT-X-TARGETDURATION:1",
+		"#EXT-X-MEDIA-SEQUENCE:0",
+		"#EXT-X-PART-INF:PART-TARGET=0.200",
+		`#EXT-X-MAP:URI="init.mp4"`,
+		"#EXTINF:1.000,\nseg0.m4s",
+		"#EXTINF:1.000,\nseg1.m4s",
+		`#EXT-X-PART:DURATION=0.200,URI="part1.0.m4s",INDEPENDENT=YES`,
+		`#EXT-X-PART:DURATION=0.200,URI="part2.1.m4s"`,
+		`#EXT-X-PRELOAD-HINT:TYPE=PART,URI="part2.2.m4s"`,
+	} {
+		assert.Assert(t, strings.Contains(body, line), "missing %q in\n%s", line, body)
+	}
+
+	code, body = get(t, srv, "init.mp4")
+	assert.Equal(t, code, 200)
+	assert.Equal(t, body[4:8], "ftyp")
+	code, body = get(t, srv, "seg0.m4s")
+	assert.Equal(t, code, 200)
+	assert.Equal(t, body[4:8], "moof")
+	code, _ = get(t, srv, "seg2.m4s")
+	assert.Equal(t, code, 404)
+
+	// blocking reload waits for the next part
+	done := make(chan string)
+	go func() {
+		_, body := get(t, srv, "stream.m3u8?_HLS_msn=2&_HLS_part=2")
+		done <- body
+	}()
+	go func() {
+		_, body := get(t, srv, "part2.2.m4s")
+		done <- body
+	}()
+	time.Sleep(50 * time.Millisecond)
+	feed(t, p, 75, 90)
+	for i := 0; i < 2; i++ {
+		body := <-done
+		assert.Assert(t, strings.Contains(body, "part2.2.m4s") || body[4:8] == "moof", body)
+	}
+}
+
+func TestPartTarget(t *testing.T) {
+	p, err := NewPackager(testFormats, FMP4)
+	assert.NilError(t, err)
+	p.SegmentDuration = time.Second
+	p.PartDuration = 250 * time.Millisecond
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	feed(t, p, 0, 100)
+
+	// parts never exceed the advertised target
+	_, body := get(t, srv, "stream.m3u8")
+	assert.Assert(t, strings.Contains(body, "#EXT-X-PART-INF:PART-TARGET=0.250"), body)
+	var parts int
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, "#EXT-X-PART:DURATION=") {
+			continue
+		}
+		parts++
+		d, err := strconv.ParseFloat(strings.Split(strings.TrimPrefix(line, "#EXT-X-PART:DURATION="), ",")[0], 64)
+		assert.NilError(t, err)
+		assert.Assert(t, d <= 0.250, line)
+	}
+	assert.Assert(t, parts > 0, body)
+
+	// blocking requests far beyond the last segment are rejected
+	code, _ := get(t, srv, "stream.m3u8?_HLS_msn=100")
+	assert.Equal(t, code, 400)
+}
+
+func TestMPEGTS(t *testing.T) {
+	p, err := NewPackager(testFormats, MPEGTS)
+	assert.NilError(t, err)
+	p.SegmentDuration = time.Second
+	p.SegmentCount = 2
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	feed(t, p, 0, 150)
+
+	_, body := get(t, srv, "stream.m3u8")
+	assert.Equal(t, body, "#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:1\n"+
+		"#EXT-X-MEDIA-SEQUENCE:2\n"+
+		"#EXTINF:1.000,\nseg2.ts\n"+
+		"#EXTINF:1.000,\nseg3.ts\n")
+	code, body := get(t, srv, "seg3.ts")
+	assert.Equal(t, code, 200)
+	assert.Equal(t, len(body)%188, 0)
+	assert.Equal(t, body[0], byte(0x47))
+	code, _ = get(t, srv, "init.mp4")
+	assert.Equal(t, code, 404)
+}
@@ -0,0 +1,343 @@
+// Package hls packages RTSP tracks as HTTP Live Streaming (RFC 8216)
+// including the low latency extensions.
+package hls
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/fmp4"
+	"github.com/icholy/rtsp/mpegts"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// Errors returned by the Packager.
+var (
+	ErrUnsupported  = errors.New("hls: unsupported format")
+	ErrInvalidTrack = errors.New("hls: invalid track index")
+)
+
+// Format is the segment container format.
+type Format int
+
+// Segment formats
+const (
+	FMP4 Format = iota
+	MPEGTS
+)
+
+// Defaults used by NewPackager.
+const (
+	DefaultSegmentDuration = 2 * time.Second
+	DefaultSegmentCount    = 6
+)
+
+// Packager segments access units and maintains the playlists. Tracks are
+// not synchronized using RTCP sender reports, each track starts at the
+// same time.
+type Packager struct {
+	// SegmentDuration is the minimum segment duration. Segments start at
+	// key frames of the first video track.
+	SegmentDuration time.Duration
+	// PartDuration enables LL-HLS partial segments when non-zero. Partial
+	// segments are only supported with the FMP4 format. Parts are cut
+	// before they exceed the duration, so it should be longer than the
+	// frame interval.
+	PartDuration time.Duration
+	// SegmentCount is the number of segments in the media playlist.
+	SegmentCount int
+
+	format  Format
+	formats []codec.Format
+	codecs  []string
+	width   int
+	height  int
+
+	mu       sync.Mutex
+	changed  chan struct{}
+	tracks   []*track
+	cut      int
+	started  bool
+	segments []*segment // the last one is in progress
+	nextSeq  int
+	partTime time.Duration
+
+	// fmp4
+	init    []byte
+	fragSeq uint32
+
+	// mpegts
+	tsbuf bytes.Buffer
+	tsmux *mpegts.Muxer
+}
+
+type track struct {
+	clock   *rtp.Clock
+	base    int64
+	started bool
+	video   bool
+
+	// fmp4
+	mp4      *fmp4.Track
+	pending  *sample
+	duration uint32
+	samples  []sample
+}
+
+type sample struct {
+	fmp4.Sample
+	time uint64
+}
+
+type segment struct {
+	seq      int
+	start    time.Duration
+	duration time.Duration
+	parts    []*part
+	data     []byte
+	done     bool
+}
+
+type part struct {
+	duration    time.Duration
+	data        []byte
+	independent bool
+}
+
+// NewPackager constructs a Packager for the tracks described by the
+// formats. H.264, H.265 and AAC are supported.
+func NewPackager(formats []codec.Format, format Format) (*Packager, error) {
+	p := &Packager{
+		SegmentDuration: DefaultSegmentDuration,
+		SegmentCount:    DefaultSegmentCount,
+		format:          format,
+		formats:         formats,
+		changed:         make(chan struct{}),
+		cut:             -1,
+	}
+	var tsTracks []*mpegts.Track
+	for i, f := range formats {
+		s, err := CodecString(f)
+		if err != nil {
+			return nil, err
+		}
+		p.codecs = append(p.codecs, s)
+		t := &track{clock: rtp.NewClock(f.ClockRate)}
+		switch strings.ToUpper(f.Encoding) {
+		case "H264", "H265":
+			t.video = true
+			if p.cut < 0 {
+				p.cut = i
+			}
+		}
+		switch format {
+		case FMP4:
+			t.mp4, err = fmp4.NewTrack(f)
+			if err != nil {
+				return nil, err
+			}
+			t.mp4.ID = uint32(i + 1)
+			if t.video && p.width == 0 {
+				p.width, p.height = t.mp4.Width, t.mp4.Height
+			}
+		case MPEGTS:
+			tt, err := mpegts.NewTrack(f)
+			if err != nil {
+				return nil, err
+			}
+			tsTracks = append(tsTracks, tt)
+		default:
+			return nil, ErrUnsupported
+		}
+		p.tracks = append(p.tracks, t)
+	}
+	if p.cut < 0 {
+		p.cut = 0
+	}
+	switch format {
+	case FMP4:
+		var tracks []*fmp4.Track
+		for _, t := range p.tracks {
+			tracks = append(tracks, t.mp4)
+		}
+		p.init = fmp4.InitSegment(tracks)
+	case MPEGTS:
+		p.tsmux = mpegts.NewMuxer(&p.tsbuf, tsTracks)
+	}
+	return p, nil
+}
+
+// WriteAccessUnit adds an access unit to the current segment. The index
+// refers to the formats passed to NewPackager. Access units are dropped
+// until the first key frame of the first video track.
+func (p *Packager) WriteAccessUnit(index int, au *codec.AccessUnit) error {
+	if index < 0 || index >= len(p.tracks) {
+		return ErrInvalidTrack
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t := p.tracks[index]
+	if !p.started {
+		if index != p.cut || !au.Key {
+			return nil
+		}
+		p.started = true
+		p.segments = []*segment{{seq: p.nextSeq}}
+		p.nextSeq++
+	}
+	if !t.started {
+		t.started = true
+		t.base = t.clock.Unwrap(au.Timestamp)
+	}
+	units := t.clock.Unwrap(au.Timestamp) - t.base
+	if units < 0 {
+		units = 0
+	}
+	now := t.clock.Duration(units)
+	if p.format == FMP4 {
+		return p.writeFMP4(index, t, uint64(units), now, au)
+	}
+	return p.writeTS(index, now, au)
+}
+
+func (p *Packager) current() *segment {
+	return p.segments[len(p.segments)-1]
+}
+
+func (p *Packager) writeFMP4(index int, t *track, units uint64, now time.Duration, au *codec.AccessUnit) error {
+	if s := t.pending; s != nil {
+		// cut the part before the pending sample would exceed the target
+		if start := t.clock.Duration(int64(s.time)); index == p.cut && p.PartDuration > 0 &&
+			now-p.partTime > p.PartDuration && start > p.partTime {
+			p.flushPart(start)
+			p.notify()
+		}
+		if units > s.time {
+			s.Duration = uint32(units - s.time)
+			t.duration = s.Duration
+		}
+		t.samples = append(t.samples, *s)
+		t.pending = nil
+	}
+	if index == p.cut {
+		seg := p.current()
+		switch {
+		case au.Key && now-seg.start >= p.SegmentDuration:
+			p.flushPart(now)
+			p.finishSegment(now)
+		case p.PartDuration > 0 && now-p.partTime >= p.PartDuration:
+			p.flushPart(now)
+			p.notify()
+		}
+	}
+	var data []byte
+	if t.video {
+		data = h264.JoinAVCC(au.Data)
+	} else {
+		data = bytes.Join(au.Data, nil)
+	}
+	t.pending = &sample{
+		Sample: fmp4.Sample{Key: au.Key, Data: data},
+		time:   units,
+	}
+	return nil
+}
+
+// flushPart writes the buffered samples as a fragment and adds it to the
+// current segment.
+func (p *Packager) flushPart(now time.Duration) {
+	var f fmp4.Fragment
+	independent := false
+	for i, t := range p.tracks {
+		if len(t.samples) == 0 {
+			continue
+		}
+		if i == p.cut {
+			independent = t.samples[0].Key
+		}
+		r := fmp4.Run{TrackID: t.mp4.ID, BaseTime: t.samples[0].time}
+		for _, s := range t.samples {
+			r.Samples = append(r.Samples, s.Sample)
+		}
+		f.Runs = append(f.Runs, r)
+		t.samples = nil
+	}
+	if len(f.Runs) == 0 {
+		return
+	}
+	p.fragSeq++
+	f.Sequence = p.fragSeq
+	seg := p.current()
+	seg.parts = append(seg.parts, &part{
+		duration:    now - p.partTime,
+		data:        f.Marshal(),
+		independent: independent,
+	})
+	p.partTime = now
+}
+
+func (p *Packager) writeTS(index int, now time.Duration, au *codec.AccessUnit) error {
+	if index == p.cut && au.Key && now-p.current().start >= p.SegmentDuration {
+		p.finishSegment(now)
+		if err := p.tsmux.WriteTables(); err != nil {
+			return err
+		}
+	}
+	if err := p.tsmux.WriteAccessUnit(index, au); err != nil {
+		return err
+	}
+	seg := p.current()
+	seg.data = append(seg.data, p.tsbuf.Bytes()...)
+	p.tsbuf.Reset()
+	return nil
+}
+
+// finishSegment completes the current segment and starts a new one.
+func (p *Packager) finishSegment(now time.Duration) {
+	seg := p.current()
+	seg.duration = now - seg.start
+	for _, pt := range seg.parts {
+		seg.data = append(seg.data, pt.data...)
+	}
+	seg.done = true
+	p.segments = append(p.segments, &segment{seq: p.nextSeq, start: now})
+	p.nextSeq++
+	// keep a few extra segments for clients which are behind
+	if n := len(p.segments) - p.SegmentCount - 3; n > 0 {
+		p.segments = append([]*segment(nil), p.segments[n:]...)
+	}
+	p.notify()
+}
+
+// notify wakes up blocked playlist requests.
+func (p *Packager) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+func (p *Packager) segmentExt() string {
+	if p.format == MPEGTS {
+		return "ts"
+	}
+	return "m4s"
+}
+
+// segment returns the segment with the sequence number.
+func (p *Packager) segment(seq int) (*segment, bool) {
+	for _, s := range p.segments {
+		if s.seq == seq {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+func (s *segment) name(ext string) string {
+	return fmt.Sprintf("seg%d.%s", s.seq, ext)
+}
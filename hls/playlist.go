@@ -0,0 +1,282 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Playlist and segment names served by the Packager.
+const (
+	MasterPlaylist = "index.m3u8"
+	MediaPlaylist  = "stream.m3u8"
+	InitSegment    = "init.mp4"
+)
+
+// MasterPlaylist returns the master playlist.
+func (p *Packager) MasterPlaylist() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", p.version())
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=\"%s\"", p.bandwidth(), strings.Join(p.codecs, ","))
+	if p.width > 0 {
+		fmt.Fprintf(&b, ",RESOLUTION=%dx%d", p.width, p.height)
+	}
+	b.WriteString("\n" + MediaPlaylist + "\n")
+	return []byte(b.String())
+}
+
+func (p *Packager) version() int {
+	switch {
+	case p.format == MPEGTS:
+		return 3
+	case p.PartDuration > 0:
+		return 9
+	default:
+		return 7
+	}
+}
+
+// bandwidth returns the peak bit rate of the completed segments.
+func (p *Packager) bandwidth() int {
+	peak := 0
+	for _, s := range p.segments {
+		if !s.done || s.duration <= 0 {
+			continue
+		}
+		if bps := int(float64(len(s.data)*8) / s.duration.Seconds()); bps > peak {
+			peak = bps
+		}
+	}
+	if peak == 0 {
+		// placeholder until the first segment is complete
+		peak = 1000000
+	}
+	return peak
+}
+
+// MediaPlaylist returns the media playlist.
+func (p *Packager) MediaPlaylist() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mediaPlaylist()
+}
+
+func (p *Packager) mediaPlaylist() []byte {
+	var done []*segment
+	for _, s := range p.segments {
+		if s.done {
+			done = append(done, s)
+		}
+	}
+	if len(done) > p.SegmentCount {
+		done = done[len(done)-p.SegmentCount:]
+	}
+	target := p.SegmentDuration
+	for _, s := range done {
+		if s.duration > target {
+			target = s.duration
+		}
+	}
+	ll := p.PartDuration > 0 && p.format == FMP4
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", p.version())
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target.Seconds())))
+	seq := p.nextSeq
+	if len(done) > 0 {
+		seq = done[0].seq
+	}
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", seq)
+	if ll {
+		fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*p.PartDuration.Seconds())
+		fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", p.PartDuration.Seconds())
+	}
+	if p.format == FMP4 {
+		fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\"\n", InitSegment)
+	}
+	ext := p.segmentExt()
+	for i, s := range done {
+		// parts are only listed for the most recent segments
+		if ll && i >= len(done)-3 {
+			p.writeParts(&b, s)
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", s.duration.Seconds(), s.name(ext))
+	}
+	if ll && len(p.segments) > 0 {
+		cur := p.current()
+		p.writeParts(&b, cur)
+		fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"%s\"\n", partName(cur.seq, len(cur.parts)))
+	}
+	return []byte(b.String())
+}
+
+func (p *Packager) writeParts(b *strings.Builder, s *segment) {
+	for i, pt := range s.parts {
+		fmt.Fprintf(b, "#EXT-X-PART:DURATION=%.3f,URI=\"%s\"", pt.duration.Seconds(), partName(s.seq, i))
+		if pt.independent {
+			b.WriteString(",INDEPENDENT=YES")
+		}
+		b.WriteString("\n")
+	}
+}
+
+func partName(seq, index int) string {
+	return fmt.Sprintf("part%d.%d.m4s", seq, index)
+}
+
+// ready returns true once the segment and part exist. A negative part
+// waits for the whole segment.
+func (p *Packager) ready(seq, index int) bool {
+	s, ok := p.segment(seq)
+	if !ok {
+		// segments older than the window are never going to appear
+		return len(p.segments) > 0 && seq < p.segments[0].seq
+	}
+	if index < 0 {
+		return s.done
+	}
+	return index < len(s.parts) || s.done
+}
+
+// wait blocks until the segment and part are ready or the context is done.
+func (p *Packager) wait(ctx context.Context, seq, index int) bool {
+	for {
+		p.mu.Lock()
+		ready := p.ready(seq, index)
+		changed := p.changed
+		p.mu.Unlock()
+		if ready {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// ServeHTTP serves the playlists and segments. Only the last element of
+// the request path is used so the handler can be mounted at any prefix.
+// Media playlist requests support the _HLS_msn and _HLS_part blocking
+// reload parameters, and requests for the preload hint part block until
+// it's available.
+func (p *Packager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	ctx, cancel := context.WithTimeout(r.Context(), 3*p.SegmentDuration)
+	defer cancel()
+	// index is -1 for complete segments
+	seq, index, ok := parsePart(name)
+	if !ok {
+		seq, ok = parseSegment(name, p.segmentExt())
+		index = -1
+	}
+	switch {
+	case name == MasterPlaylist:
+		p.serve(w, "application/vnd.apple.mpegurl", p.MasterPlaylist())
+	case name == MediaPlaylist:
+		q := r.URL.Query()
+		if msn := q.Get("_HLS_msn"); msn != "" {
+			seq, err := strconv.Atoi(msn)
+			if err != nil {
+				http.Error(w, "invalid _HLS_msn", http.StatusBadRequest)
+				return
+			}
+			// sequence numbers more than two segments ahead will not
+			// be available before the request times out
+			p.mu.Lock()
+			last := p.nextSeq - 1
+			p.mu.Unlock()
+			if seq > last+2 {
+				http.Error(w, "_HLS_msn is too far ahead", http.StatusBadRequest)
+				return
+			}
+			index := -1
+			if s := q.Get("_HLS_part"); s != "" {
+				if index, err = strconv.Atoi(s); err != nil {
+					http.Error(w, "invalid _HLS_part", http.StatusBadRequest)
+					return
+				}
+			}
+			if !p.wait(ctx, seq, index) {
+				http.Error(w, "timeout", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		p.serve(w, "application/vnd.apple.mpegurl", p.MediaPlaylist())
+	case name == InitSegment && p.format == FMP4:
+		p.serve(w, "video/mp4", p.init)
+	case ok && index >= 0:
+		if !p.wait(ctx, seq, index) {
+			http.Error(w, "timeout", http.StatusServiceUnavailable)
+			return
+		}
+		p.mu.Lock()
+		var data []byte
+		if s, ok := p.segment(seq); ok && index < len(s.parts) {
+			data = s.parts[index].data
+		}
+		p.mu.Unlock()
+		if data == nil {
+			http.NotFound(w, r)
+			return
+		}
+		p.serve(w, "video/mp4", data)
+	case ok:
+		p.mu.Lock()
+		var data []byte
+		if s, ok := p.segment(seq); ok && s.done {
+			data = s.data
+		}
+		p.mu.Unlock()
+		if data == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if p.format == MPEGTS {
+			p.serve(w, "video/mp2t", data)
+		} else {
+			p.serve(w, "video/mp4", data)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *Packager) serve(w http.ResponseWriter, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// parseSegment parses a segment name. ie: seg12.m4s
+func parseSegment(name, ext string) (int, bool) {
+	if !strings.HasPrefix(name, "seg") || !strings.HasSuffix(name, "."+ext) {
+		return 0, false
+	}
+	seq, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "seg"), "."+ext))
+	return seq, err == nil
+}
+
+// parsePart parses a partial segment name. ie: part12.3.m4s
+func parsePart(name string) (seq, index int, ok bool) {
+	if !strings.HasPrefix(name, "part") || !strings.HasSuffix(name, ".m4s") {
+		return 0, 0, false
+	}
+	fields := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, "part"), ".m4s"), ".")
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	seq, err1 := strconv.Atoi(fields[0])
+	index, err2 := strconv.Atoi(fields[1])
+	return seq, index, err1 == nil && err2 == nil
+}
@@ -0,0 +1,439 @@
+// Package ingest implements an RTSP server which accepts streams pushed by
+// encoders using ANNOUNCE, SETUP with mode=record, and RECORD.
+//
+// Each path can only have one publisher at a time. The incoming packets
+// are passed to the server callbacks, which can record or relay them.
+// Import codec/all to create depacketizers for the publisher tracks.
+package ingest
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/auth"
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/internal/rtsputil"
+	"github.com/icholy/rtsp/rtp"
+	"github.com/icholy/rtsp/sdp"
+)
+
+// Server accepts publishers. It implements rtsp.Handler.
+type Server struct {
+	// Auth authenticates publishers. The Authenticator's Password function
+	// receives the request url, which allows per path credentials. Note that
+	// SETUP requests use the track control urls. OPTIONS requests are never
+	// authenticated since they only list the supported methods.
+	// Publishing is unauthenticated when nil.
+	Auth *auth.Authenticator
+	// OnPublish is called when a publisher starts recording. Returning an
+	// error rejects the publisher.
+	OnPublish func(p *Publisher) error
+	// OnPacket is called with every RTP packet received from a publisher.
+	// The track is the index of the media description in the SDP. RTCP
+	// packets sent by publishers are read and discarded.
+	OnPacket func(p *Publisher, track int, pkt *rtp.Packet)
+	// OnClose is called when a publisher which started recording leaves.
+	// No OnPacket call for the publisher runs during or after it.
+	OnClose func(p *Publisher)
+
+	mu         sync.Mutex
+	publishers map[string]*Publisher
+}
+
+// NewServer constructs a Server.
+func NewServer() *Server {
+	return &Server{}
+}
+
+// Publisher is an encoder pushing a stream to a path.
+type Publisher struct {
+	// Path is the url path the stream was announced on.
+	Path string
+	// User is the authenticated username.
+	User string
+	// SDP is the announced session description.
+	SDP    *sdp.Session
+	Tracks []*codec.Track
+
+	id        string
+	conn      *rtsp.ServerConn
+	base      string
+	channels  map[int]int
+	udp       []*udpTrack
+	recording bool
+	deliver   sync.RWMutex // held while a packet is delivered
+	done      chan struct{}
+	once      sync.Once
+}
+
+// RemoteAddr returns the address of the publisher.
+func (p *Publisher) RemoteAddr() net.Addr {
+	return p.conn.RemoteAddr()
+}
+
+// Close disconnects the publisher.
+func (p *Publisher) Close() error {
+	return p.conn.Close()
+}
+
+// Publisher returns the publisher of the path.
+func (s *Server) Publisher(path string) (*Publisher, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.publishers[path]
+	if !ok || !p.recording {
+		return nil, false
+	}
+	return p, true
+}
+
+// ServeRTSP implements rtsp.Handler.
+func (s *Server) ServeRTSP(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	if req.Method == rtsp.MethodOptions {
+		res := rtsputil.Response(rtsp.StatusOK)
+		res.Header.Set("Public", rtsputil.RecordMethods)
+		return res
+	}
+	var user string
+	if s.Auth != nil {
+		var ok bool
+		if user, ok = s.Auth.Authenticate(req); !ok {
+			return s.Auth.Unauthorized()
+		}
+	}
+	switch req.Method {
+	case rtsp.MethodAnnounce:
+		return s.announce(conn, req, user)
+	case rtsp.MethodSetup:
+		return s.setup(conn, req)
+	case rtsp.MethodRecord:
+		return s.record(conn, req)
+	case rtsp.MethodTeardown:
+		p, res := s.lookup(conn, req)
+		if res != nil {
+			return res
+		}
+		s.remove(p)
+		return rtsputil.Response(rtsp.StatusOK)
+	case rtsp.MethodGetParameter:
+		if _, res := s.lookup(conn, req); res != nil {
+			return res
+		}
+		return rtsputil.Response(rtsp.StatusOK)
+	default:
+		return rtsputil.Response(rtsp.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) announce(conn *rtsp.ServerConn, req *rtsp.Request, user string) *rtsp.Response {
+	if ct := req.Header.Get("Content-Type"); ct != "application/sdp" {
+		return rtsputil.Response(rtsp.StatusUnsupportedMediaType)
+	}
+	desc, err := sdp.Parse(req.Body)
+	if err != nil || len(desc.Media) == 0 {
+		return rtsputil.Response(rtsp.StatusBadRequest)
+	}
+	tracks, err := codec.NewTracks(desc)
+	if err != nil {
+		return rtsputil.Response(rtsp.StatusBadRequest)
+	}
+	u := *req.URL
+	u.User = nil
+	p := &Publisher{
+		Path:     strings.TrimSuffix(req.URL.Path, "/"),
+		User:     user,
+		SDP:      desc,
+		Tracks:   tracks,
+		id:       rtsputil.NewSessionID(),
+		conn:     conn,
+		base:     strings.TrimSuffix(u.String(), "/"),
+		channels: map[int]int{},
+		udp:      make([]*udpTrack, len(tracks)),
+		done:     make(chan struct{}),
+	}
+	s.mu.Lock()
+	if s.publishers == nil {
+		s.publishers = map[string]*Publisher{}
+	}
+	if _, ok := s.publishers[p.Path]; ok {
+		s.mu.Unlock()
+		// another encoder is already publishing to the path
+		return rtsputil.Response(rtsp.StatusServiceUnavailable)
+	}
+	s.publishers[p.Path] = p
+	s.mu.Unlock()
+	conn.SetFrameHandler(func(f rtsp.Frame) error {
+		s.handleFrame(p, f)
+		return nil
+	})
+	go func() {
+		select {
+		case <-conn.Done():
+			s.remove(p)
+		case <-p.done:
+		}
+	}()
+	res := rtsputil.Response(rtsp.StatusOK)
+	res.Header.Set("Session", p.id)
+	return res
+}
+
+func (s *Server) setup(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	p, res := s.lookup(conn, req)
+	if res != nil {
+		return res
+	}
+	index, ok := p.track(req)
+	if !ok {
+		return rtsputil.Response(rtsp.StatusNotFound)
+	}
+	t, err := rtsp.ParseTransport(req.Header.Get("Transport"))
+	if err != nil {
+		return rtsputil.Response(rtsp.StatusBadRequest)
+	}
+	if t.Mode != "RECORD" {
+		return rtsputil.Response(rtsp.StatusMethodNotValidInThisState)
+	}
+	if t.Multicast {
+		return rtsputil.Response(rtsp.StatusUnsupportedTransport)
+	}
+	transport := rtsp.Transport{
+		Protocol: t.Protocol,
+		Unicast:  true,
+		Mode:     "RECORD",
+	}
+	if t.IsTCP() {
+		if t.Interleaved[0] < 0 {
+			t.Interleaved = [2]int{2 * index, 2*index + 1}
+		}
+		s.mu.Lock()
+		p.channels[t.Interleaved[0]] = index
+		s.mu.Unlock()
+		transport.Interleaved = t.Interleaved
+	} else {
+		u, err := newUDPTrack(conn, index)
+		if err != nil {
+			return rtsputil.Response(rtsp.StatusUnsupportedTransport)
+		}
+		s.mu.Lock()
+		if old := p.udp[index]; old != nil {
+			old.close()
+		}
+		p.udp[index] = u
+		s.mu.Unlock()
+		transport.ClientPort = t.ClientPort
+		transport.ServerPort = u.ports()
+	}
+	res = rtsputil.Response(rtsp.StatusOK)
+	res.Header.Set("Transport", transport.String())
+	res.Header.Set("Session", p.id+";timeout=60")
+	return res
+}
+
+func (s *Server) record(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	p, res := s.lookup(conn, req)
+	if res != nil {
+		return res
+	}
+	s.mu.Lock()
+	configured := len(p.channels) > 0
+	for _, u := range p.udp {
+		if u != nil {
+			configured = true
+		}
+	}
+	s.mu.Unlock()
+	if !configured {
+		return rtsputil.Response(rtsp.StatusMethodNotValidInThisState)
+	}
+	if s.OnPublish != nil {
+		if err := s.OnPublish(p); err != nil {
+			return rtsputil.Response(rtsp.StatusForbidden)
+		}
+	}
+	s.mu.Lock()
+	p.recording = true
+	for _, u := range p.udp {
+		if u != nil {
+			go u.serve(func(pkt *rtp.Packet) { s.packet(p, u.index, pkt) })
+			go u.drain()
+		}
+	}
+	s.mu.Unlock()
+	res = rtsputil.Response(rtsp.StatusOK)
+	res.Header.Set("Session", p.id)
+	return res
+}
+
+func (s *Server) handleFrame(p *Publisher, f rtsp.Frame) {
+	s.mu.Lock()
+	index, ok := p.channels[f.Channel]
+	s.mu.Unlock()
+	if !ok {
+		// rtcp or unknown channel
+		return
+	}
+	pkt, err := rtp.Parse(f.Data)
+	if err != nil {
+		return
+	}
+	s.packet(p, index, pkt)
+}
+
+func (s *Server) packet(p *Publisher, index int, pkt *rtp.Packet) {
+	p.deliver.RLock()
+	defer p.deliver.RUnlock()
+	s.mu.Lock()
+	recording := p.recording
+	s.mu.Unlock()
+	if recording && s.OnPacket != nil {
+		s.OnPacket(p, index, pkt)
+	}
+}
+
+// lookup finds the publisher which owns the session or, for the SETUP
+// following ANNOUNCE, the connection.
+func (s *Server) lookup(conn *rtsp.ServerConn, req *rtsp.Request) (*Publisher, *rtsp.Response) {
+	id, _ := req.Header.Field("Session", 0)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.publishers {
+		if p.conn != conn {
+			continue
+		}
+		if id == p.id || (id == "" && req.Method == rtsp.MethodSetup) {
+			return p, nil
+		}
+	}
+	return nil, rtsputil.Response(rtsp.StatusSessionNotFound)
+}
+
+// remove releases the path and calls OnClose if the publisher was recording.
+func (s *Server) remove(p *Publisher) {
+	s.mu.Lock()
+	if s.publishers[p.Path] != p {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.publishers, p.Path)
+	recording := p.recording
+	p.recording = false
+	for _, u := range p.udp {
+		if u != nil {
+			u.close()
+		}
+	}
+	s.mu.Unlock()
+	p.once.Do(func() { close(p.done) })
+	// wait for the packets being delivered, the ones after see
+	// recording is false
+	p.deliver.Lock()
+	p.deliver.Unlock()
+	if recording && s.OnClose != nil {
+		s.OnClose(p)
+	}
+}
+
+// track returns the index of the media whose control url matches the
+// SETUP url. Relative controls are compared with the request Track when
+// the server is behind a rtsp.ServeMux.
+func (p *Publisher) track(req *rtsp.Request) (int, bool) {
+	u := *req.URL
+	u.User = nil
+	target := strings.TrimSuffix(u.String(), "/")
+	for i, t := range p.Tracks {
+		control := t.Control()
+		switch {
+		case control == "" || control == "*":
+			if len(p.Tracks) == 1 && target == p.base {
+				return i, true
+			}
+		case strings.Contains(control, "://"):
+			if strings.TrimSuffix(control, "/") == target {
+				return i, true
+			}
+		case req.Track != "":
+			if control == req.Track && rtsputil.AggregateURL(req) == p.base {
+				return i, true
+			}
+		case target == p.base+"/"+control:
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// udpTrack receives the packets of a track sent over UDP.
+type udpTrack struct {
+	index  int
+	source net.IP
+	rtp    *net.UDPConn
+	rtcp   *net.UDPConn
+}
+
+func newUDPTrack(conn *rtsp.ServerConn, index int) (*udpTrack, error) {
+	remote, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return nil, errors.New("ingest: udp requires a tcp connection")
+	}
+	var local net.IP
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		local = addr.IP
+	}
+	rtpConn, rtcpConn, err := rtsputil.ListenUDP(local)
+	if err != nil {
+		return nil, err
+	}
+	return &udpTrack{
+		index:  index,
+		source: remote.IP,
+		rtp:    rtpConn,
+		rtcp:   rtcpConn,
+	}, nil
+}
+
+func (u *udpTrack) ports() [2]int {
+	return [2]int{
+		u.rtp.LocalAddr().(*net.UDPAddr).Port,
+		u.rtcp.LocalAddr().(*net.UDPAddr).Port,
+	}
+}
+
+// serve reads packets until the socket is closed. Packets which don't
+// come from the publisher's address are ignored.
+func (u *udpTrack) serve(handle func(*rtp.Packet)) {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := u.rtp.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if !addr.IP.Equal(u.source) {
+			continue
+		}
+		pkt, err := rtp.Parse(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			continue
+		}
+		handle(pkt)
+	}
+}
+
+// drain reads and discards RTCP packets until the socket is closed so
+// that the publisher's reports don't fill the socket buffer.
+func (u *udpTrack) drain() {
+	buf := make([]byte, 1500)
+	for {
+		if _, _, err := u.rtcp.ReadFromUDP(buf); err != nil {
+			return
+		}
+	}
+}
+
+func (u *udpTrack) close() {
+	u.rtp.Close()
+	u.rtcp.Close()
+}
@@ -0,0 +1,296 @@
+package ingest
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/auth"
+	_ "github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/rtp"
+	"gotest.tools/v3/assert"
+)
+
+const testSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=encoder\r\n" +
+	"t=0 0\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=control:streamid=0\r\n"
+
+type event struct {
+	typ    string
+	path   string
+	packet *rtp.Packet
+}
+
+func serve(t *testing.T) (string, chan event) {
+	events := make(chan event, 100)
+	s := NewServer()
+	s.Auth = &auth.Authenticator{
+		Realm: "ingest",
+		Password: func(u *url.URL, username string) (string, bool) {
+			// SETUP requests use the track urls
+			name := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)[0]
+			if name == "cam1" && username == "admin" {
+				return "secret", true
+			}
+			if name == "cam2" && username == "other" {
+				return "secret", true
+			}
+			return "", false
+		},
+	}
+	s.OnPublish = func(p *Publisher) error {
+		events <- event{typ: "publish", path: p.Path}
+		return nil
+	}
+	s.OnPacket = func(p *Publisher, track int, pkt *rtp.Packet) {
+		events <- event{typ: "packet", path: p.Path, packet: pkt}
+	}
+	s.OnClose = func(p *Publisher) {
+		events <- event{typ: "close", path: p.Path}
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	srv := &rtsp.Server{Handler: s}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return l.Addr().String(), events
+}
+
+func next(t *testing.T, events chan event) event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for event")
+		return event{}
+	}
+}
+
+func connect(t *testing.T, addr, username string) (*rtsp.Client, net.Conn) {
+	conn, err := net.Dial("tcp", addr)
+	assert.NilError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return rtsp.NewClient(conn, auth.WithDigest(username, "secret")), conn
+}
+
+func TestRecordTCP(t *testing.T) {
+	addr, events := serve(t)
+	endpoint := "rtsp://" + addr + "/cam1"
+	c, conn := connect(t, addr, "admin")
+
+	res, err := c.Announce(endpoint, []byte(testSDP))
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+	res, err = c.Setup(endpoint+"/streamid=0", "RTP/AVP/TCP;unicast;interleaved=0-1;mode=record")
+	assert.NilError(t, err)
+	session, err := rtsp.Session(res)
+	assert.NilError(t, err)
+	res, err = c.Record(endpoint, session)
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+	assert.Equal(t, next(t, events).typ, "publish")
+
+	data, err := rtp.NewSequencer(96).Packet(1234, true, []byte{0x65, 0x88}).Marshal()
+	assert.NilError(t, err)
+	assert.NilError(t, c.WriteFrame(rtsp.Frame{Channel: 0, Data: data}))
+	e := next(t, events)
+	assert.Equal(t, e.typ, "packet")
+	assert.Equal(t, e.path, "/cam1")
+	assert.Equal(t, e.packet.TS, uint32(1234))
+
+	// a second publisher is rejected
+	c2, _ := connect(t, addr, "admin")
+	res, err = c2.Announce(endpoint, []byte(testSDP))
+	assert.NilError(t, err)
+	assert.Equal(t, res.StatusCode, rtsp.StatusServiceUnavailable)
+
+	// disconnecting frees the path
+	conn.Close()
+	assert.Equal(t, next(t, events).typ, "close")
+	res, err = c2.Announce(endpoint, []byte(testSDP))
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+}
+
+func TestAuth(t *testing.T) {
+	addr, _ := serve(t)
+	// the credentials are only valid for cam2
+	c, _ := connect(t, addr, "other")
+	res, err := c.Announce("rtsp://"+addr+"/cam1", []byte(testSDP))
+	assert.NilError(t, err)
+	assert.Equal(t, res.StatusCode, rtsp.StatusUnauthorized)
+	res, err = c.Announce("rtsp://"+addr+"/cam2", []byte(testSDP))
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+
+	// the digest uri must match the request url
+	conn, err := net.Dial("tcp", addr)
+	assert.NilError(t, err)
+	defer conn.Close()
+	c = rtsp.NewClient(conn, rtsp.WithAuth(otherURI{auth.Digest{Username: "admin", Password: "secret"}}))
+	res, err = c.Announce("rtsp://"+addr+"/cam1", []byte(testSDP))
+	assert.NilError(t, err)
+	assert.Equal(t, res.StatusCode, rtsp.StatusUnauthorized)
+
+	// OPTIONS is not authenticated
+	res, err = c.Options("rtsp://" + addr + "/cam1")
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+}
+
+// otherURI computes the digest response for a different path.
+type otherURI struct{ auth.Digest }
+
+func (a otherURI) Authorize(req *rtsp.Request, res *rtsp.Response) (bool, error) {
+	u := *req.URL
+	u.Path += "/streamid=0"
+	other := *req
+	other.URL = &u
+	return a.Digest.Authorize(&other, res)
+}
+
+func TestRecordUDP(t *testing.T) {
+	addr, events := serve(t)
+	endpoint := "rtsp://" + addr + "/cam1"
+	c, _ := connect(t, addr, "admin")
+
+	res, err := c.Announce(endpoint, []byte(testSDP))
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+	res, err = c.Setup(endpoint+"/streamid=0", "RTP/AVP;unicast;client_port=5000-5001;mode=record")
+	assert.NilError(t, err)
+	session, err := rtsp.Session(res)
+	assert.NilError(t, err)
+	transport, err := rtsp.ParseTransport(res.Header.Get("Transport"))
+	assert.NilError(t, err)
+	assert.Equal(t, transport.Mode, "RECORD")
+	res, err = c.Record(endpoint, session)
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+	assert.Equal(t, next(t, events).typ, "publish")
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+strconv.Itoa(transport.ServerPort[0]))
+	assert.NilError(t, err)
+	defer conn.Close()
+	data, err := rtp.NewSequencer(96).Packet(99, true, []byte{0x65, 0x88}).Marshal()
+	assert.NilError(t, err)
+	_, err = conn.Write(data)
+	assert.NilError(t, err)
+	e := next(t, events)
+	assert.Equal(t, e.typ, "packet")
+	assert.Equal(t, e.packet.TS, uint32(99))
+
+	res, err = c.Teardown(endpoint, session)
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+	assert.Equal(t, next(t, events).typ, "close")
+}
+
+func TestServeMux(t *testing.T) {
+	s := NewServer()
+	published := make(chan string, 1)
+	s.OnPublish = func(p *Publisher) error {
+		published <- p.Path
+		return nil
+	}
+	mux := rtsp.NewServeMux()
+	mux.Handle("/live/{name}", s)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	srv := &rtsp.Server{Handler: mux}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NilError(t, err)
+	defer conn.Close()
+	c := rtsp.NewClient(conn)
+	endpoint := "rtsp://" + l.Addr().String() + "/live/cam1"
+	res, err := c.Announce(endpoint, []byte(testSDP))
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+	// the track must belong to the announced path
+	res, err = c.Setup("rtsp://"+l.Addr().String()+"/live/cam2/streamid=0", "RTP/AVP/TCP;unicast;interleaved=0-1;mode=record")
+	assert.NilError(t, err)
+	assert.Equal(t, res.StatusCode, rtsp.StatusNotFound)
+	res, err = c.Setup(endpoint+"/streamid=0", "RTP/AVP/TCP;unicast;interleaved=0-1;mode=record")
+	assert.NilError(t, err)
+	session, err := rtsp.Session(res)
+	assert.NilError(t, err)
+	res, err = c.Record(endpoint, session)
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+	assert.Equal(t, <-published, "/live/cam1")
+}
+
+func TestCloseWaitsForPacket(t *testing.T) {
+	s := NewServer()
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	closed := make(chan struct{})
+	s.OnPacket = func(p *Publisher, track int, pkt *rtp.Packet) {
+		entered <- struct{}{}
+		<-release
+	}
+	s.OnClose = func(p *Publisher) {
+		close(closed)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	srv := &rtsp.Server{Handler: s}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NilError(t, err)
+	defer conn.Close()
+	c := rtsp.NewClient(conn)
+	endpoint := "rtsp://" + l.Addr().String() + "/cam1"
+	res, err := c.Announce(endpoint, []byte(testSDP))
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+	res, err = c.Setup(endpoint+"/streamid=0", "RTP/AVP;unicast;client_port=5000-5001;mode=record")
+	assert.NilError(t, err)
+	session, err := rtsp.Session(res)
+	assert.NilError(t, err)
+	transport, err := rtsp.ParseTransport(res.Header.Get("Transport"))
+	assert.NilError(t, err)
+	res, err = c.Record(endpoint, session)
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+
+	udp, err := net.Dial("udp", "127.0.0.1:"+strconv.Itoa(transport.ServerPort[0]))
+	assert.NilError(t, err)
+	defer udp.Close()
+	data, err := rtp.NewSequencer(96).Packet(1, true, []byte{0x65, 0x88}).Marshal()
+	assert.NilError(t, err)
+	_, err = udp.Write(data)
+	assert.NilError(t, err)
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for packet")
+	}
+
+	// the teardown waits for the packet being delivered
+	go c.Teardown(endpoint, session)
+	select {
+	case <-closed:
+		t.Fatal("closed while delivering a packet")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for close")
+	}
+}
@@ -0,0 +1,58 @@
+// Package authutil computes the client side Authorization headers shared
+// by the rtsp and auth packages.
+package authutil
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/icholy/digest"
+)
+
+// Basic returns the Authorization value for basic authentication.
+func Basic(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// Digest returns the Authorization value answering the digest challenge
+// in the response header.
+func Digest(header map[string][]string, method, uri, username, password string) (string, error) {
+	chal, err := digest.FindChallenge(canonical(header))
+	if err != nil {
+		return "", err
+	}
+	cred, err := digest.Digest(chal, digest.Options{
+		Method:   method,
+		URI:      uri,
+		Username: username,
+		Password: password,
+	})
+	if err != nil {
+		return "", err
+	}
+	return cred.String(), nil
+}
+
+// HasBasic returns true when the response header offers basic
+// authentication.
+func HasBasic(header map[string][]string) bool {
+	for _, value := range canonical(header).Values("WWW-Authenticate") {
+		if strings.HasPrefix(strings.ToLower(value), "basic") {
+			return true
+		}
+	}
+	return false
+}
+
+// canonical copies the header with canonical keys so the
+// WWW-Authenticate header is found.
+func canonical(header map[string][]string) http.Header {
+	h := http.Header{}
+	for key, values := range header {
+		for _, value := range values {
+			h.Add(key, value)
+		}
+	}
+	return h
+}
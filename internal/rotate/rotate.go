@@ -0,0 +1,133 @@
+// Package rotate writes access units to a sequence of files. It contains
+// the rotation logic shared by the fmp4 and mpegts recorders.
+package rotate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/icholy/rtsp/codec"
+)
+
+// Muxer writes the access units of a single file.
+type Muxer interface {
+	WriteAccessUnit(index int, au *codec.AccessUnit) error
+	// Cut returns true when a file can start with the access unit.
+	Cut(index int, au *codec.AccessUnit) bool
+	// Elapsed returns the duration between the start of the file and
+	// the access unit.
+	Elapsed(index int, au *codec.AccessUnit) time.Duration
+	// Flush writes any buffered data before the file is closed.
+	Flush() error
+}
+
+// Options configures the rotation. They are passed to each call so the
+// recorders can keep exposing them as fields.
+type Options struct {
+	Dir         string
+	Ext         string // extension of the default file names. ie: .mp4
+	MaxDuration time.Duration
+	MaxSize     int64
+	Filename    func(start time.Time) string
+	OnClose     func(path string)
+	// NewMuxer constructs the muxer of a new file.
+	NewMuxer func(w io.Writer) Muxer
+}
+
+// Files is the state of the current file.
+type Files struct {
+	file  *os.File
+	count *countWriter
+	mux   Muxer
+}
+
+// WriteAccessUnit writes the access unit to the current file. A new file
+// is started at a cut once the current one reaches the maximum duration
+// or size.
+func (f *Files) WriteAccessUnit(o *Options, index int, au *codec.AccessUnit) error {
+	if f.mux != nil && f.mux.Cut(index, au) && f.full(o, index, au) {
+		if err := f.Close(o); err != nil {
+			return err
+		}
+	}
+	if f.mux == nil {
+		if err := f.open(o); err != nil {
+			return err
+		}
+	}
+	return f.mux.WriteAccessUnit(index, au)
+}
+
+func (f *Files) full(o *Options, index int, au *codec.AccessUnit) bool {
+	if o.MaxDuration > 0 && f.mux.Elapsed(index, au) >= o.MaxDuration {
+		return true
+	}
+	return o.MaxSize > 0 && f.count.n >= o.MaxSize
+}
+
+func (f *Files) open(o *Options) error {
+	now := time.Now()
+	name := now.UTC().Format("20060102T150405.000") + o.Ext
+	if o.Filename != nil {
+		name = o.Filename(now)
+	}
+	file, err := create(o.Dir, name)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.count = &countWriter{w: file}
+	f.mux = o.NewMuxer(f.count)
+	return nil
+}
+
+// Close flushes and closes the current file. The next call to
+// WriteAccessUnit starts a new file.
+func (f *Files) Close(o *Options) error {
+	if f.mux == nil {
+		return nil
+	}
+	err := f.mux.Flush()
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	path := f.file.Name()
+	f.mux, f.file, f.count = nil, nil, nil
+	if o.OnClose != nil {
+		o.OnClose(path)
+	}
+	return err
+}
+
+// create creates a new file in the directory. A numeric suffix is added
+// to the name until it doesn't collide with an existing file.
+func create(dir, name string) (*os.File, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; ; i++ {
+		path := filepath.Join(dir, name)
+		if i > 0 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", base, i, ext))
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,154 @@
+// Package rtsputil contains helpers shared by the rtsp.Handler
+// implementations in this module.
+package rtsputil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/icholy/rtsp"
+)
+
+// ErrNoUDPPorts is returned when a pair of consecutive ports can't be found.
+var ErrNoUDPPorts = errors.New("rtsp: no udp ports available")
+
+// PlayMethods is the Public header of servers which stream to clients.
+var PlayMethods = strings.Join([]string{
+	rtsp.MethodOptions,
+	rtsp.MethodDescribe,
+	rtsp.MethodSetup,
+	rtsp.MethodPlay,
+	rtsp.MethodPause,
+	rtsp.MethodTeardown,
+	rtsp.MethodGetParameter,
+}, ", ")
+
+// RecordMethods is the Public header of servers which accept publishers.
+var RecordMethods = strings.Join([]string{
+	rtsp.MethodOptions,
+	rtsp.MethodAnnounce,
+	rtsp.MethodSetup,
+	rtsp.MethodRecord,
+	rtsp.MethodTeardown,
+	rtsp.MethodGetParameter,
+}, ", ")
+
+// Response returns an empty response with the status code.
+func Response(code int) *rtsp.Response {
+	res, _ := rtsp.NewResponse(code, nil)
+	return res
+}
+
+// NewSessionID returns a random session id.
+func NewSessionID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// TrackControl returns the control attribute of the track.
+func TrackControl(index int) string {
+	return "trackID=" + strconv.Itoa(index)
+}
+
+// AggregatePath returns the url path without the track control.
+func AggregatePath(req *rtsp.Request) string {
+	p := strings.TrimSuffix(req.URL.Path, "/")
+	if control, ok := trackControl(req); ok {
+		p = strings.TrimSuffix(p, "/"+control)
+	}
+	return p
+}
+
+// AggregateURL returns the request url without the track control.
+func AggregateURL(req *rtsp.Request) string {
+	u := *req.URL
+	u.User = nil
+	u.Path = AggregatePath(req)
+	u.RawPath = ""
+	return u.String()
+}
+
+// TrackIndex parses the track index from a SETUP url.
+func TrackIndex(req *rtsp.Request) (int, bool) {
+	control, ok := trackControl(req)
+	if !ok || !strings.HasPrefix(control, "trackID=") {
+		return 0, false
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(control, "trackID="))
+	if err != nil || index < 0 {
+		return 0, false
+	}
+	return index, true
+}
+
+// trackControl returns the track set by the rtsp.ServeMux. Without a mux,
+// the last path segment is used when it's one of our track controls.
+func trackControl(req *rtsp.Request) (string, bool) {
+	if req.Track != "" {
+		return req.Track, true
+	}
+	p := strings.TrimSuffix(req.URL.Path, "/")
+	control := p[strings.LastIndex(p, "/")+1:]
+	return control, strings.HasPrefix(control, "trackID=")
+}
+
+// ControlURL resolves a media control attribute against the base url.
+func ControlURL(base, control string) string {
+	switch {
+	case control == "" || control == "*":
+		return base
+	case strings.Contains(control, "://"):
+		return control
+	case strings.HasSuffix(base, "/"):
+		return base + control
+	default:
+		return base + "/" + control
+	}
+}
+
+// KeepAlive returns the interval between keepalive requests for the
+// session of the SETUP response. It's half of the timeout parameter of
+// the Session header when that's shorter than interval.
+func KeepAlive(res *rtsp.Response, interval time.Duration) time.Duration {
+	v, ok := res.Header.Param("Session", "timeout")
+	if !ok {
+		return interval
+	}
+	seconds, err := strconv.Atoi(v)
+	if err != nil || seconds <= 0 {
+		return interval
+	}
+	if half := time.Duration(seconds) * time.Second / 2; half < interval {
+		return half
+	}
+	return interval
+}
+
+// ListenUDP opens a pair of consecutive ports for RTP and RTCP. The RTP
+// port is even as recommended by RFC 3550.
+func ListenUDP(ip net.IP) (rtp, rtcp *net.UDPConn, err error) {
+	for i := 0; i < 10; i++ {
+		rtp, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip})
+		if err != nil {
+			return nil, nil, err
+		}
+		port := rtp.LocalAddr().(*net.UDPAddr).Port
+		if port%2 != 0 {
+			rtp.Close()
+			continue
+		}
+		rtcp, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: port + 1})
+		if err != nil {
+			rtp.Close()
+			continue
+		}
+		return rtp, rtcp, nil
+	}
+	return nil, nil, ErrNoUDPPorts
+}
@@ -0,0 +1,134 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// box is a parsed ISO BMFF box header.
+type box struct {
+	typ string
+	// offset and size include the header.
+	offset int64
+	size   int64
+	header int64
+}
+
+// payload returns the box content from the buffer which starts at base.
+func (b box) payload(buf []byte, base int64) []byte {
+	start := b.offset - base + b.header
+	return buf[start : b.offset-base+b.size]
+}
+
+// readBox reads the header of the box at offset. A size of zero means
+// the box extends to the end of the file.
+func readBox(r io.ReaderAt, offset, end int64) (box, error) {
+	var hdr [16]byte
+	if end-offset < 8 {
+		return box{}, ErrInvalidBox
+	}
+	if _, err := r.ReadAt(hdr[:8], offset); err != nil {
+		return box{}, err
+	}
+	b := box{
+		typ:    string(hdr[4:8]),
+		offset: offset,
+		size:   int64(binary.BigEndian.Uint32(hdr[0:])),
+		header: 8,
+	}
+	switch b.size {
+	case 0:
+		b.size = end - offset
+	case 1:
+		if _, err := r.ReadAt(hdr[8:16], offset+8); err != nil {
+			return box{}, err
+		}
+		b.size = int64(binary.BigEndian.Uint64(hdr[8:]))
+		b.header = 16
+	}
+	if b.size < b.header || offset+b.size > end {
+		return box{}, ErrInvalidBox
+	}
+	return b, nil
+}
+
+// children parses the boxes contained in buf.
+func children(buf []byte) ([]box, error) {
+	var boxes []box
+	r := byteReaderAt(buf)
+	for off := int64(0); off < int64(len(buf)); {
+		b, err := readBox(r, off, int64(len(buf)))
+		if err != nil {
+			return nil, err
+		}
+		boxes = append(boxes, b)
+		off += b.size
+	}
+	return boxes, nil
+}
+
+// child returns the payload of the first child box with the type.
+func child(buf []byte, typ string) ([]byte, bool) {
+	boxes, err := children(buf)
+	if err != nil {
+		return nil, false
+	}
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b.payload(buf, 0), true
+		}
+	}
+	return nil, false
+}
+
+// path returns the payload of the first box found by following the types.
+func path(buf []byte, types ...string) ([]byte, bool) {
+	for _, typ := range types {
+		var ok bool
+		if buf, ok = child(buf, typ); !ok {
+			return nil, false
+		}
+	}
+	return buf, true
+}
+
+type byteReaderAt []byte
+
+func (b byteReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// reader decodes big endian fields and records truncation.
+type reader struct {
+	buf []byte
+	err bool
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err || len(r.buf) < n {
+		r.err = true
+		return make([]byte, n)
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) u8() uint8   { return r.next(1)[0] }
+func (r *reader) u16() uint16 { return binary.BigEndian.Uint16(r.next(2)) }
+func (r *reader) u32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+func (r *reader) u64() uint64 { return binary.BigEndian.Uint64(r.next(8)) }
+func (r *reader) skip(n int)  { r.next(n) }
+
+// fullbox reads the version and flags.
+func (r *reader) fullbox() (version uint8, flags uint32) {
+	v := r.u32()
+	return uint8(v >> 24), v & 0xFFFFFF
+}
@@ -0,0 +1,727 @@
+// Package mp4 reads the samples of progressive and fragmented MP4 files.
+//
+// Only the sample tables are loaded into memory, the sample data is read
+// on demand from the file.
+package mp4
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/aac"
+	"github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/codec/h265"
+	"github.com/icholy/rtsp/sdp"
+)
+
+// Errors returned when reading a file.
+var (
+	ErrInvalidBox   = errors.New("mp4: invalid box")
+	ErrNoMovie      = errors.New("mp4: missing moov box")
+	ErrUnsupported  = errors.New("mp4: unsupported sample entry")
+	ErrTruncated    = errors.New("mp4: truncated box")
+	ErrInvalidTrack = errors.New("mp4: invalid track")
+)
+
+// File is a parsed MP4 file.
+type File struct {
+	Tracks []*Track
+
+	r io.ReaderAt
+}
+
+// Track is a video or audio track. Tracks of other types are skipped.
+type Track struct {
+	ID uint32
+	// Handler is vide or soun.
+	Handler string
+	// TimeScale is the number of time units per second.
+	TimeScale uint32
+	// Entry is the sample entry type. ie: avc1, hvc1, mp4a
+	Entry string
+	// ParameterSets contains the VPS, SPS and PPS NAL units for video.
+	ParameterSets [][]byte
+	// Config is set for AAC tracks.
+	Config aac.AudioSpecificConfig
+	// Samples are in decode order.
+	Samples []Sample
+
+	lengthSize int
+}
+
+// Sample is the location and timing of a media sample.
+type Sample struct {
+	Offset int64
+	Size   int
+	// DTS is the decode time in the track timescale.
+	DTS int64
+	// CompositionOffset is the difference between the presentation and
+	// decode time.
+	CompositionOffset int32
+	Duration          uint32
+	Key               bool
+}
+
+// PTS returns the presentation time in the track timescale.
+func (s Sample) PTS() int64 {
+	return s.DTS + int64(s.CompositionOffset)
+}
+
+// Open reads the track and sample tables. The size is the length of
+// the file in bytes.
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	f := &File{r: r}
+	var (
+		moov  []byte
+		moofs []box
+	)
+	for off := int64(0); off < size; {
+		b, err := readBox(r, off, size)
+		if err != nil {
+			return nil, err
+		}
+		switch b.typ {
+		case "moov":
+			if moov, err = readPayload(r, b); err != nil {
+				return nil, err
+			}
+		case "moof":
+			moofs = append(moofs, b)
+		}
+		off += b.size
+	}
+	if moov == nil {
+		return nil, ErrNoMovie
+	}
+	if err := f.parseMovie(moov, size); err != nil {
+		return nil, err
+	}
+	for _, b := range moofs {
+		data, err := readPayload(r, b)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.parseFragment(data, b.offset); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func readPayload(r io.ReaderAt, b box) ([]byte, error) {
+	data := make([]byte, b.size-b.header)
+	if _, err := r.ReadAt(data, b.offset+b.header); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Track returns the track with the id.
+func (f *File) Track(id uint32) (*Track, bool) {
+	for _, t := range f.Tracks {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Duration returns the duration of the longest track.
+func (f *File) Duration() time.Duration {
+	var max time.Duration
+	for _, t := range f.Tracks {
+		if d := t.Duration(); d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+// ReadSample reads the sample data. Video samples are split into NAL units.
+func (f *File) ReadSample(t *Track, s Sample) ([][]byte, error) {
+	data := make([]byte, s.Size)
+	if _, err := f.r.ReadAt(data, s.Offset); err != nil {
+		return nil, err
+	}
+	return t.Split(data)
+}
+
+// IsVideo returns true for video tracks.
+func (t *Track) IsVideo() bool {
+	return t.Handler == "vide"
+}
+
+// Duration returns the end time of the last sample.
+func (t *Track) Duration() time.Duration {
+	if len(t.Samples) == 0 || t.TimeScale == 0 {
+		return 0
+	}
+	last := t.Samples[len(t.Samples)-1]
+	return t.Time(last.DTS + int64(last.Duration))
+}
+
+// Time converts track time units into a duration.
+func (t *Track) Time(units int64) time.Duration {
+	if t.TimeScale == 0 {
+		return 0
+	}
+	return time.Duration(units) * time.Second / time.Duration(t.TimeScale)
+}
+
+// Seek returns the index of the last key frame at or before the time.
+func (t *Track) Seek(d time.Duration) int {
+	n := sort.Search(len(t.Samples), func(i int) bool {
+		return t.Time(t.Samples[i].PTS()) > d
+	})
+	for i := n - 1; i > 0; i-- {
+		if t.Samples[i].Key {
+			return i
+		}
+	}
+	return 0
+}
+
+// Split splits the sample data into NAL units for video tracks.
+// Audio samples are returned as a single frame.
+func (t *Track) Split(data []byte) ([][]byte, error) {
+	if !t.IsVideo() {
+		return [][]byte{data}, nil
+	}
+	var nalus [][]byte
+	for len(data) > 0 {
+		if len(data) < t.lengthSize {
+			return nil, ErrTruncated
+		}
+		var size int
+		for _, b := range data[:t.lengthSize] {
+			size = size<<8 | int(b)
+		}
+		data = data[t.lengthSize:]
+		if size > len(data) {
+			return nil, ErrTruncated
+		}
+		nalus = append(nalus, data[:size])
+		data = data[size:]
+	}
+	return nalus, nil
+}
+
+// Format returns the RTP payload format for the track.
+func (t *Track) Format(pt int) (codec.Format, error) {
+	switch t.Entry {
+	case "avc1", "avc3":
+		var sps, pps []byte
+		for _, nalu := range t.ParameterSets {
+			switch h264.NALUType(nalu) {
+			case h264.NALUTypeSPS:
+				sps = nalu
+			case h264.NALUTypePPS:
+				pps = nalu
+			}
+		}
+		return codec.Format{
+			RTPMap: sdp.RTPMap{PayloadType: pt, Encoding: "H264", ClockRate: 90000},
+			Fmtp:   h264.Fmtp(sps, pps),
+		}, nil
+	case "hvc1", "hev1":
+		var ps h265.ParameterSets
+		for _, nalu := range t.ParameterSets {
+			switch h265.NALUType(nalu) {
+			case h265.NALUTypeVPS:
+				ps.VPS = nalu
+			case h265.NALUTypeSPS:
+				ps.SPS = nalu
+			case h265.NALUTypePPS:
+				ps.PPS = nalu
+			}
+		}
+		return codec.Format{
+			RTPMap: sdp.RTPMap{PayloadType: pt, Encoding: "H265", ClockRate: 90000},
+			Fmtp:   ps.Fmtp(),
+		}, nil
+	case "mp4a":
+		return codec.Format{
+			RTPMap: sdp.RTPMap{
+				PayloadType: pt,
+				Encoding:    "MPEG4-GENERIC",
+				ClockRate:   t.Config.SampleRate,
+				Channels:    t.Config.ChannelCount,
+			},
+			Fmtp: aac.NewPacketizer(pt, t.Config).Fmtp(),
+		}, nil
+	default:
+		return codec.Format{}, fmt.Errorf("%w: %s", ErrUnsupported, t.Entry)
+	}
+}
+
+// parseMovie parses the tracks of the movie. Tracks with inconsistent
+// sample tables are skipped.
+func (f *File) parseMovie(moov []byte, size int64) error {
+	boxes, err := children(moov)
+	if err != nil {
+		return err
+	}
+	for _, b := range boxes {
+		if b.typ != "trak" {
+			continue
+		}
+		t, err := parseTrack(b.payload(moov, 0), size)
+		if errors.Is(err, ErrInvalidTrack) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if t != nil {
+			f.Tracks = append(f.Tracks, t)
+		}
+	}
+	return nil
+}
+
+// parseTrack returns nil for tracks which aren't audio or video. The size
+// is the file size which bounds the sample tables.
+func parseTrack(trak []byte, size int64) (*Track, error) {
+	t := &Track{}
+	tkhd, ok := child(trak, "tkhd")
+	if !ok {
+		return nil, ErrInvalidBox
+	}
+	r := &reader{buf: tkhd}
+	if v, _ := r.fullbox(); v == 1 {
+		r.skip(16)
+	} else {
+		r.skip(8)
+	}
+	t.ID = r.u32()
+	mdhd, ok := path(trak, "mdia", "mdhd")
+	if !ok {
+		return nil, ErrInvalidBox
+	}
+	r = &reader{buf: mdhd}
+	if v, _ := r.fullbox(); v == 1 {
+		r.skip(16)
+	} else {
+		r.skip(8)
+	}
+	t.TimeScale = r.u32()
+	if t.TimeScale == 0 && !r.err {
+		return nil, fmt.Errorf("%w: zero timescale", ErrInvalidTrack)
+	}
+	hdlr, ok := path(trak, "mdia", "hdlr")
+	if !ok || len(hdlr) < 12 {
+		return nil, ErrInvalidBox
+	}
+	t.Handler = string(hdlr[8:12])
+	if t.Handler != "vide" && t.Handler != "soun" {
+		return nil, nil
+	}
+	stbl, ok := path(trak, "mdia", "minf", "stbl")
+	if !ok {
+		return nil, ErrInvalidBox
+	}
+	stsd, ok := child(stbl, "stsd")
+	if !ok || len(stsd) < 8 {
+		return nil, ErrInvalidBox
+	}
+	// the first sample entry follows the version, flags and entry count
+	if err := t.parseEntry(stsd[8:]); err != nil {
+		return nil, err
+	}
+	if err := t.parseSampleTable(stbl, size); err != nil {
+		return nil, err
+	}
+	if r.err {
+		return nil, ErrTruncated
+	}
+	return t, nil
+}
+
+func (t *Track) parseEntry(buf []byte) error {
+	boxes, err := children(buf)
+	if err != nil || len(boxes) == 0 {
+		return ErrInvalidBox
+	}
+	entry := boxes[0].payload(buf, 0)
+	t.Entry = boxes[0].typ
+	switch t.Entry {
+	case "avc1", "avc3":
+		// VisualSampleEntry is 78 bytes
+		if len(entry) < 78 {
+			return ErrTruncated
+		}
+		avcC, ok := child(entry[78:], "avcC")
+		if !ok {
+			return ErrInvalidBox
+		}
+		return t.parseAVCC(avcC)
+	case "hvc1", "hev1":
+		if len(entry) < 78 {
+			return ErrTruncated
+		}
+		hvcC, ok := child(entry[78:], "hvcC")
+		if !ok {
+			return ErrInvalidBox
+		}
+		return t.parseHVCC(hvcC)
+	case "mp4a":
+		// AudioSampleEntry is 28 bytes
+		if len(entry) < 28 {
+			return ErrTruncated
+		}
+		esds, ok := child(entry[28:], "esds")
+		if !ok {
+			return ErrInvalidBox
+		}
+		return t.parseESDS(esds)
+	default:
+		return nil
+	}
+}
+
+func (t *Track) parseAVCC(buf []byte) error {
+	r := &reader{buf: buf}
+	r.skip(4)
+	t.lengthSize = int(r.u8()&3) + 1
+	for _, mask := range []uint8{0x1F, 0xFF} {
+		count := int(r.u8() & mask)
+		for i := 0; i < count && !r.err; i++ {
+			n := int(r.u16())
+			t.ParameterSets = append(t.ParameterSets, r.next(n))
+		}
+	}
+	if r.err {
+		return ErrTruncated
+	}
+	return nil
+}
+
+func (t *Track) parseHVCC(buf []byte) error {
+	r := &reader{buf: buf}
+	r.skip(21)
+	t.lengthSize = int(r.u8()&3) + 1
+	arrays := int(r.u8())
+	for i := 0; i < arrays && !r.err; i++ {
+		r.skip(1) // array_completeness and NAL_unit_type
+		count := int(r.u16())
+		for j := 0; j < count && !r.err; j++ {
+			n := int(r.u16())
+			t.ParameterSets = append(t.ParameterSets, r.next(n))
+		}
+	}
+	if r.err {
+		return ErrTruncated
+	}
+	return nil
+}
+
+// parseESDS finds the AudioSpecificConfig in the DecoderSpecificInfo
+// descriptor.
+func (t *Track) parseESDS(buf []byte) error {
+	if len(buf) < 4 {
+		return ErrTruncated
+	}
+	buf = buf[4:]
+	for len(buf) > 1 {
+		tag := buf[0]
+		buf = buf[1:]
+		var size int
+		for len(buf) > 0 {
+			b := buf[0]
+			buf = buf[1:]
+			size = size<<7 | int(b&0x7F)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		switch tag {
+		case 0x03: // ES_Descriptor
+			if len(buf) < 3 {
+				return ErrTruncated
+			}
+			flags := buf[2]
+			skip := 3
+			if flags&0x80 != 0 {
+				skip += 2
+			}
+			if flags&0x40 != 0 && len(buf) > skip {
+				skip += 1 + int(buf[skip])
+			}
+			if flags&0x20 != 0 {
+				skip += 2
+			}
+			if skip > len(buf) {
+				return ErrTruncated
+			}
+			buf = buf[skip:]
+		case 0x04: // DecoderConfigDescriptor
+			if len(buf) < 13 {
+				return ErrTruncated
+			}
+			buf = buf[13:]
+		case 0x05: // DecoderSpecificInfo
+			if size > len(buf) {
+				return ErrTruncated
+			}
+			return t.Config.Unmarshal(buf[:size])
+		default:
+			if size > len(buf) {
+				return ErrTruncated
+			}
+			buf = buf[size:]
+		}
+	}
+	return ErrInvalidBox
+}
+
+// parseSampleTable builds the samples of a progressive file. Fragmented
+// files have empty tables. The samples must fit in the file size.
+func (t *Track) parseSampleTable(stbl []byte, fileSize int64) error {
+	table := func(typ string) (*reader, uint32, bool) {
+		buf, ok := child(stbl, typ)
+		if !ok {
+			return nil, 0, false
+		}
+		r := &reader{buf: buf}
+		r.fullbox()
+		return r, r.u32(), true
+	}
+	// sample sizes
+	stsz, count, ok := table("stsz")
+	var sizes []int
+	if ok {
+		// the first field is the constant sample size
+		size := count
+		count = stsz.u32()
+		if size == 0 && uint64(count)*4 > uint64(len(stsz.buf)) {
+			return fmt.Errorf("%w: stsz sample count exceeds the box size", ErrInvalidTrack)
+		}
+		if size != 0 && uint64(count)*uint64(size) > uint64(fileSize) {
+			return fmt.Errorf("%w: stsz samples exceed the file size", ErrInvalidTrack)
+		}
+		for i := uint32(0); i < count && !stsz.err; i++ {
+			if size != 0 {
+				sizes = append(sizes, int(size))
+			} else {
+				sizes = append(sizes, int(stsz.u32()))
+			}
+		}
+		if stsz.err {
+			return ErrTruncated
+		}
+	}
+	if len(sizes) == 0 {
+		return nil
+	}
+	// chunk offsets
+	var chunks []int64
+	if stco, n, ok := table("stco"); ok {
+		for i := uint32(0); i < n && !stco.err; i++ {
+			chunks = append(chunks, int64(stco.u32()))
+		}
+	} else if co64, n, ok := table("co64"); ok {
+		for i := uint32(0); i < n && !co64.err; i++ {
+			chunks = append(chunks, int64(co64.u64()))
+		}
+	}
+	t.Samples = make([]Sample, len(sizes))
+	// sample to chunk
+	stsc, n, ok := table("stsc")
+	if !ok {
+		return ErrInvalidBox
+	}
+	type entry struct{ first, perChunk uint32 }
+	var entries []entry
+	for i := uint32(0); i < n && !stsc.err; i++ {
+		e := entry{first: stsc.u32(), perChunk: stsc.u32()}
+		stsc.u32() // sample_description_index
+		if stsc.err {
+			break
+		}
+		// chunk numbers start at 1 and must increase
+		if e.first < 1 || int64(e.first) > int64(len(chunks)) ||
+			(len(entries) > 0 && e.first <= entries[len(entries)-1].first) {
+			return fmt.Errorf("%w: invalid stsc first chunk %d", ErrInvalidTrack, e.first)
+		}
+		entries = append(entries, e)
+	}
+	sample := 0
+	for i, e := range entries {
+		last := uint32(len(chunks))
+		if i+1 < len(entries) {
+			last = entries[i+1].first - 1
+		}
+		for c := e.first; c <= last && int(c) <= len(chunks); c++ {
+			offset := chunks[c-1]
+			for j := uint32(0); j < e.perChunk && sample < len(sizes); j++ {
+				t.Samples[sample].Offset = offset
+				t.Samples[sample].Size = sizes[sample]
+				offset += int64(sizes[sample])
+				sample++
+			}
+		}
+	}
+	if sample != len(sizes) {
+		return ErrInvalidBox
+	}
+	// decode times
+	stts, n, ok := table("stts")
+	if !ok {
+		return ErrInvalidBox
+	}
+	var dts int64
+	sample = 0
+	for i := uint32(0); i < n && !stts.err; i++ {
+		count, delta := stts.u32(), stts.u32()
+		for j := uint32(0); j < count && sample < len(sizes); j++ {
+			t.Samples[sample].DTS = dts
+			t.Samples[sample].Duration = delta
+			dts += int64(delta)
+			sample++
+		}
+	}
+	// composition offsets
+	if ctts, n, ok := table("ctts"); ok {
+		sample = 0
+		for i := uint32(0); i < n && !ctts.err; i++ {
+			count, offset := ctts.u32(), int32(ctts.u32())
+			for j := uint32(0); j < count && sample < len(sizes); j++ {
+				t.Samples[sample].CompositionOffset = offset
+				sample++
+			}
+		}
+	}
+	// sync samples, every sample is a key frame when there is no table
+	if stss, n, ok := table("stss"); ok {
+		for i := uint32(0); i < n && !stss.err; i++ {
+			if k := int(stss.u32()); k >= 1 && k <= len(sizes) {
+				t.Samples[k-1].Key = true
+			}
+		}
+	} else {
+		for i := range t.Samples {
+			t.Samples[i].Key = true
+		}
+	}
+	return nil
+}
+
+// parseFragment appends the samples in a moof box. The offset is the
+// position of the moof box in the file.
+func (f *File) parseFragment(moof []byte, offset int64) error {
+	boxes, err := children(moof)
+	if err != nil {
+		return err
+	}
+	for _, b := range boxes {
+		if b.typ != "traf" {
+			continue
+		}
+		traf := b.payload(moof, 0)
+		tfhd, ok := child(traf, "tfhd")
+		if !ok {
+			return ErrInvalidBox
+		}
+		r := &reader{buf: tfhd}
+		_, flags := r.fullbox()
+		t, ok := f.Track(r.u32())
+		if !ok {
+			continue
+		}
+		base := offset
+		if flags&0x01 != 0 {
+			base = int64(r.u64())
+		}
+		if flags&0x02 != 0 {
+			r.u32() // sample_description_index
+		}
+		var defaultDuration, defaultSize, defaultFlags uint32
+		if flags&0x08 != 0 {
+			defaultDuration = r.u32()
+		}
+		if flags&0x10 != 0 {
+			defaultSize = r.u32()
+		}
+		if flags&0x20 != 0 {
+			defaultFlags = r.u32()
+		}
+		if r.err {
+			return ErrTruncated
+		}
+		dts := t.nextDTS()
+		if tfdt, ok := child(traf, "tfdt"); ok {
+			r := &reader{buf: tfdt}
+			if v, _ := r.fullbox(); v == 1 {
+				dts = int64(r.u64())
+			} else {
+				dts = int64(r.u32())
+			}
+		}
+		trafs, err := children(traf)
+		if err != nil {
+			return err
+		}
+		for _, b := range trafs {
+			if b.typ != "trun" {
+				continue
+			}
+			r := &reader{buf: b.payload(traf, 0)}
+			_, flags := r.fullbox()
+			count := r.u32()
+			pos := base
+			if flags&0x01 != 0 {
+				pos = base + int64(int32(r.u32()))
+			}
+			firstFlags, hasFirst := uint32(0), flags&0x04 != 0
+			if hasFirst {
+				firstFlags = r.u32()
+			}
+			for i := uint32(0); i < count && !r.err; i++ {
+				s := Sample{
+					Offset:   pos,
+					DTS:      dts,
+					Duration: defaultDuration,
+					Size:     int(defaultSize),
+				}
+				sflags := defaultFlags
+				if flags&0x100 != 0 {
+					s.Duration = r.u32()
+				}
+				if flags&0x200 != 0 {
+					s.Size = int(r.u32())
+				}
+				if flags&0x400 != 0 {
+					sflags = r.u32()
+				}
+				if i == 0 && hasFirst {
+					sflags = firstFlags
+				}
+				if flags&0x800 != 0 {
+					s.CompositionOffset = int32(r.u32())
+				}
+				// sample_is_non_sync_sample
+				s.Key = sflags&0x10000 == 0
+				t.Samples = append(t.Samples, s)
+				pos += int64(s.Size)
+				dts += int64(s.Duration)
+			}
+			if r.err {
+				return ErrTruncated
+			}
+		}
+	}
+	return nil
+}
+
+// nextDTS returns the decode time following the last sample.
+func (t *Track) nextDTS() int64 {
+	if len(t.Samples) == 0 {
+		return 0
+	}
+	last := t.Samples[len(t.Samples)-1]
+	return last.DTS + int64(last.Duration)
+}
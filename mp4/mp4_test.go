@@ -0,0 +1,168 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/aac"
+	"github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/fmp4"
+	"gotest.tools/v3/assert"
+)
+
+const sprop = "Z00AKeKQDwBE/LgLcBAQGkHiRFQ=,aO48gA=="
+
+func TestFragmented(t *testing.T) {
+	sps, pps, err := h264.ParseSpropParameterSets(sprop)
+	assert.NilError(t, err)
+	video, err := fmp4.NewH264Track(sps, pps)
+	assert.NilError(t, err)
+	config := aac.AudioSpecificConfig{ObjectType: 2, SampleRate: 48000, ChannelCount: 2}
+	audio := fmp4.NewAACTrack(config)
+	var buf bytes.Buffer
+	m := fmp4.NewMuxer(&buf, []*fmp4.Track{video, audio})
+	for i := 0; i < 90; i++ {
+		err := m.WriteAccessUnit(0, &codec.AccessUnit{
+			Timestamp: uint32(i * 3000),
+			Data:      [][]byte{{0x65, byte(i)}, {0x65, 0xFF}},
+			Key:       i%30 == 0,
+		})
+		assert.NilError(t, err)
+		err = m.WriteAccessUnit(1, &codec.AccessUnit{
+			Timestamp: uint32(i * 1600),
+			Data:      [][]byte{{0x21, byte(i)}},
+			Key:       true,
+		})
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, m.Flush())
+
+	f, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NilError(t, err)
+	assert.Equal(t, len(f.Tracks), 2)
+
+	v := f.Tracks[0]
+	assert.Assert(t, v.IsVideo())
+	assert.Equal(t, v.Entry, "avc1")
+	assert.Equal(t, len(v.Samples), 90)
+	assert.Equal(t, v.Samples[31].DTS, int64(31*3000))
+	assert.Assert(t, v.Samples[30].Key)
+	assert.Assert(t, !v.Samples[31].Key)
+	nalus, err := f.ReadSample(v, v.Samples[31])
+	assert.NilError(t, err)
+	assert.DeepEqual(t, nalus, [][]byte{{0x65, 31}, {0x65, 0xFF}})
+	assert.Equal(t, v.Seek(1500*time.Millisecond), 30)
+	assert.Equal(t, f.Duration(), 3*time.Second)
+
+	format, err := v.Format(96)
+	assert.NilError(t, err)
+	assert.Equal(t, format.Encoding, "H264")
+	assert.Equal(t, format.Fmtp["sprop-parameter-sets"], sprop)
+
+	a := f.Tracks[1]
+	assert.Equal(t, a.Config, config)
+	assert.Equal(t, a.TimeScale, uint32(48000))
+	frames, err := f.ReadSample(a, a.Samples[5])
+	assert.NilError(t, err)
+	assert.DeepEqual(t, frames, [][]byte{{0x21, 5}})
+	format, err = a.Format(97)
+	assert.NilError(t, err)
+	assert.Equal(t, format.Fmtp["config"], config.String())
+	assert.Equal(t, format.Channels, 2)
+}
+
+func mkbox(typ string, parts ...[]byte) []byte {
+	b := []byte{0, 0, 0, 0}
+	b = append(b, typ...)
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+func u32s(values ...uint32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return b
+}
+
+func TestProgressive(t *testing.T) {
+	sps, pps, err := h264.ParseSpropParameterSets(sprop)
+	assert.NilError(t, err)
+	samples := [][]byte{
+		h264.JoinAVCC([][]byte{{0x65, 1}}),
+		h264.JoinAVCC([][]byte{{0x41, 2}}),
+		h264.JoinAVCC([][]byte{{0x41, 3}}),
+	}
+	ftyp := mkbox("ftyp", []byte("isom"), u32s(0))
+	mdat := mkbox("mdat", bytes.Join(samples, nil))
+	avcC := []byte{1, sps[1], sps[2], sps[3], 0xFF, 0xE1, 0, byte(len(sps))}
+	avcC = append(avcC, sps...)
+	avcC = append(avcC, 1, 0, byte(len(pps)))
+	avcC = append(avcC, pps...)
+	build := func(timescale uint32, stsz, stsc []byte) []byte {
+		stbl := mkbox("stbl",
+			mkbox("stsd", u32s(0, 1), mkbox("avc1", make([]byte, 78), mkbox("avcC", avcC))),
+			mkbox("stts", u32s(0, 1, 3, 3000)),
+			mkbox("ctts", u32s(0, 2, 1, 3000, 2, 0)),
+			mkbox("stss", u32s(0, 1, 1)),
+			mkbox("stsz", stsz),
+			mkbox("stsc", stsc),
+			mkbox("stco", u32s(0, 2, uint32(len(ftyp)+8), uint32(len(ftyp)+8+len(samples[0])+len(samples[1])))),
+		)
+		trak := mkbox("trak",
+			mkbox("tkhd", u32s(0, 0, 0, 7)),
+			mkbox("mdia",
+				mkbox("mdhd", u32s(0, 0, 0, timescale, 0)),
+				mkbox("hdlr", u32s(0, 0), []byte("vide"), make([]byte, 13)),
+				mkbox("minf", stbl),
+			),
+		)
+		return bytes.Join([][]byte{ftyp, mdat, mkbox("moov", trak)}, nil)
+	}
+	stsz := u32s(0, 0, 3, uint32(len(samples[0])), uint32(len(samples[1])), uint32(len(samples[2])))
+	// two samples in the first chunk and one in the second
+	stsc := u32s(0, 2, 1, 2, 1, 2, 1, 1)
+	file := build(90000, stsz, stsc)
+
+	f, err := Open(bytes.NewReader(file), int64(len(file)))
+	assert.NilError(t, err)
+	assert.Equal(t, len(f.Tracks), 1)
+	v := f.Tracks[0]
+	assert.Equal(t, v.ID, uint32(7))
+	assert.DeepEqual(t, v.ParameterSets, [][]byte{sps, pps})
+	assert.Equal(t, len(v.Samples), 3)
+	assert.Assert(t, v.Samples[0].Key)
+	assert.Assert(t, !v.Samples[1].Key)
+	assert.Equal(t, v.Samples[0].PTS(), int64(3000))
+	assert.Equal(t, v.Samples[1].PTS(), int64(3000))
+	assert.Equal(t, v.Samples[2].DTS, int64(6000))
+	for i, s := range v.Samples {
+		nalus, err := f.ReadSample(v, s)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, nalus, [][]byte{samples[i][4:]})
+	}
+
+	_, err = Open(bytes.NewReader(ftyp), int64(len(ftyp)))
+	assert.Equal(t, err, ErrNoMovie)
+
+	// malformed tracks are skipped
+	for name, file := range map[string][]byte{
+		"zero timescale":        build(0, stsz, stsc),
+		"zero first chunk":      build(90000, stsz, u32s(0, 1, 0, 3, 1)),
+		"first chunk too large": build(90000, stsz, u32s(0, 1, 3, 3, 1)),
+		"first chunk decreases": build(90000, stsz, u32s(0, 2, 2, 1, 1, 1, 2, 1)),
+		"sample count":          build(90000, u32s(0, 0, 1<<30, 1), stsc),
+		"constant sample size":  build(90000, u32s(0, 1000, 1<<30), stsc),
+	} {
+		f, err := Open(bytes.NewReader(file), int64(len(file)))
+		assert.NilError(t, err, name)
+		assert.Equal(t, len(f.Tracks), 0, name)
+	}
+}
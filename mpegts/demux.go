@@ -0,0 +1,194 @@
+package mpegts
+
+import "sort"
+
+// Demuxer extracts PES packets from a transport stream. The PAT and PMT
+// are tracked to discover the elementary streams. PES packets are
+// discarded when a continuity counter error is detected.
+type Demuxer struct {
+	pmts    map[uint16]bool
+	psi     map[uint16][]byte
+	streams map[uint16]*stream
+}
+
+type stream struct {
+	Stream
+	buf    []byte
+	cc     uint8
+	seen   bool // cc is valid
+	active bool // a PES packet is being assembled
+	random bool
+	broken bool
+}
+
+// NewDemuxer constructs a Demuxer.
+func NewDemuxer() *Demuxer {
+	return &Demuxer{
+		pmts:    map[uint16]bool{},
+		psi:     map[uint16][]byte{},
+		streams: map[uint16]*stream{},
+	}
+}
+
+// Streams returns the elementary streams found in the PMT ordered by PID.
+func (d *Demuxer) Streams() []Stream {
+	streams := make([]Stream, 0, len(d.streams))
+	for _, s := range d.streams {
+		streams = append(streams, s.Stream)
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].PID < streams[j].PID
+	})
+	return streams
+}
+
+// Demux consumes a single 188 byte TS packet and returns any PES packets
+// it completes. The returned data does not reference pkt.
+func (d *Demuxer) Demux(pkt []byte) ([]*PES, error) {
+	h, err := parsePacket(pkt)
+	if err != nil {
+		return nil, err
+	}
+	if h.PID == PIDNull {
+		return nil, nil
+	}
+	if h.PID == PIDPAT || d.pmts[h.PID] {
+		return nil, d.section(h)
+	}
+	s, ok := d.streams[h.PID]
+	if !ok {
+		return nil, nil
+	}
+	return s.packet(h)
+}
+
+// Flush returns the PES packets which are still being assembled.
+// This is useful at the end of the stream.
+func (d *Demuxer) Flush() ([]*PES, error) {
+	var out []*PES
+	for _, s := range d.streams {
+		p, err := s.flush()
+		if err != nil {
+			return out, err
+		}
+		if p != nil {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (d *Demuxer) section(h header) error {
+	if !h.HasPayload {
+		return nil
+	}
+	payload := h.Payload
+	if h.PUSI {
+		if len(payload) < 1 || 1+int(payload[0]) > len(payload) {
+			return ErrInvalidSection
+		}
+		payload = payload[1+int(payload[0]):]
+		d.psi[h.PID] = append(d.psi[h.PID][:0], payload...)
+	} else if len(d.psi[h.PID]) > 0 {
+		d.psi[h.PID] = append(d.psi[h.PID], payload...)
+	} else {
+		return nil
+	}
+	buf := d.psi[h.PID]
+	n := sectionLength(buf)
+	if n < 0 || len(buf) < n {
+		return nil
+	}
+	d.psi[h.PID] = buf[:0]
+	s, err := parseSection(buf)
+	if err != nil {
+		return err
+	}
+	switch s.TableID {
+	case tableIDPAT:
+		for _, pid := range parsePAT(s.Data) {
+			d.pmts[pid] = true
+		}
+	case tableIDPMT:
+		streams, err := parsePMT(s.Data)
+		if err != nil {
+			return err
+		}
+		for _, es := range streams {
+			if existing, ok := d.streams[es.PID]; ok && existing.Type == es.Type {
+				continue
+			}
+			d.streams[es.PID] = &stream{Stream: es}
+		}
+	}
+	return nil
+}
+
+func (s *stream) packet(h header) ([]*PES, error) {
+	if !h.HasPayload {
+		return nil, nil
+	}
+	if s.seen {
+		if h.CC == s.cc {
+			// duplicate packet
+			return nil, nil
+		}
+		if h.CC != (s.cc+1)&0x0F && !h.Discontinuity {
+			s.broken = true
+		}
+	}
+	s.cc = h.CC
+	s.seen = true
+	var out []*PES
+	if h.PUSI {
+		p, err := s.flush()
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			out = append(out, p)
+		}
+		s.active = true
+		s.broken = false
+		s.random = h.RandomAccess
+	}
+	if !s.active {
+		return out, nil
+	}
+	s.buf = append(s.buf, h.Payload...)
+	// emit bounded PES packets without waiting for the next one
+	if len(s.buf) >= 6 {
+		if length := int(s.buf[4])<<8 | int(s.buf[5]); length != 0 && len(s.buf) >= 6+length {
+			p, err := s.flush()
+			if err != nil {
+				return out, err
+			}
+			if p != nil {
+				out = append(out, p)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (s *stream) flush() (*PES, error) {
+	if !s.active {
+		return nil, nil
+	}
+	buf, broken := s.buf, s.broken
+	s.buf = nil
+	s.active = false
+	s.broken = false
+	if broken || len(buf) == 0 {
+		return nil, nil
+	}
+	p := &PES{
+		PID:          s.PID,
+		StreamType:   s.Type,
+		RandomAccess: s.random,
+	}
+	if err := parsePES(p, buf); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,114 @@
+// Package mpegts implements multiplexing and demultiplexing of MPEG-2
+// transport streams (ISO 13818-1) carrying H.264, H.265 and AAC.
+package mpegts
+
+import "errors"
+
+// PacketSize is the size of a TS packet.
+const PacketSize = 188
+
+// SyncByte is the first byte of every TS packet.
+const SyncByte = 0x47
+
+// Reserved PIDs
+const (
+	PIDPAT  = 0x0000
+	PIDNull = 0x1FFF
+)
+
+// Stream types found in the PMT.
+const (
+	StreamTypeMPEG1Audio = 0x03
+	StreamTypeMPEG2Audio = 0x04
+	StreamTypePrivate    = 0x06
+	StreamTypeAAC        = 0x0F // ADTS
+	StreamTypeAACLATM    = 0x11
+	StreamTypeH264       = 0x1B
+	StreamTypeH265       = 0x24
+)
+
+// Errors returned when demultiplexing.
+var (
+	ErrInvalidPacket  = errors.New("mpegts: invalid packet")
+	ErrLostSync       = errors.New("mpegts: missing sync byte")
+	ErrInvalidSection = errors.New("mpegts: invalid psi section")
+	ErrInvalidCRC     = errors.New("mpegts: psi crc mismatch")
+	ErrInvalidPES     = errors.New("mpegts: invalid pes header")
+	ErrUnsupported    = errors.New("mpegts: unsupported stream type")
+)
+
+// header is the fixed TS packet header and adaptation field.
+type header struct {
+	PUSI          bool // payload unit start indicator
+	PID           uint16
+	CC            uint8 // continuity counter
+	HasPayload    bool
+	Discontinuity bool
+	RandomAccess  bool
+	HasPCR        bool
+	PCR           uint64 // 27MHz
+	Payload       []byte
+}
+
+func parsePacket(b []byte) (header, error) {
+	var h header
+	if len(b) != PacketSize {
+		return h, ErrInvalidPacket
+	}
+	if b[0] != SyncByte {
+		return h, ErrLostSync
+	}
+	h.PUSI = b[1]&0x40 != 0
+	h.PID = uint16(b[1]&0x1F)<<8 | uint16(b[2])
+	afc := b[3] >> 4 & 0x03
+	h.CC = b[3] & 0x0F
+	h.HasPayload = afc&0x01 != 0
+	off := 4
+	if afc&0x02 != 0 {
+		n := int(b[4])
+		if off+1+n > PacketSize {
+			return h, ErrInvalidPacket
+		}
+		if n > 0 {
+			flags := b[5]
+			h.Discontinuity = flags&0x80 != 0
+			h.RandomAccess = flags&0x40 != 0
+			if flags&0x10 != 0 && n >= 7 {
+				base := uint64(b[6])<<25 | uint64(b[7])<<17 | uint64(b[8])<<9 | uint64(b[9])<<1 | uint64(b[10])>>7
+				ext := uint64(b[10]&0x01)<<8 | uint64(b[11])
+				h.HasPCR = true
+				h.PCR = base*300 + ext
+			}
+		}
+		off += 1 + n
+	}
+	if h.HasPayload {
+		h.Payload = b[off:]
+	}
+	return h, nil
+}
+
+var crcTable = func() [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04C11DB7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+// CRC32 computes the MPEG-2 CRC used by PSI sections.
+func CRC32(b []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, v := range b {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^v]
+	}
+	return crc
+}
@@ -0,0 +1,133 @@
+package mpegts
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/icholy/rtsp/codec/aac"
+	"github.com/icholy/rtsp/codec/h264"
+	"gotest.tools/v3/assert"
+)
+
+// tsPackets splits the payload into TS packets, padding the last one
+// using the adaptation field.
+func tsPackets(pid uint16, cc *uint8, payload []byte) [][]byte {
+	var packets [][]byte
+	for first := true; len(payload) > 0; first = false {
+		pkt := []byte{SyncByte, byte(pid >> 8), byte(pid), 0x10 | *cc&0x0F}
+		if first {
+			pkt[1] |= 0x40
+		}
+		*cc++
+		n := PacketSize - 4
+		if len(payload) < n {
+			// adaptation field stuffing
+			pkt[3] |= 0x20
+			stuff := n - len(payload) - 1
+			pkt = append(pkt, byte(stuff))
+			if stuff > 0 {
+				pkt = append(pkt, 0)
+				for i := 1; i < stuff; i++ {
+					pkt = append(pkt, 0xFF)
+				}
+			}
+			n = len(payload)
+		}
+		pkt = append(pkt, payload[:n]...)
+		payload = payload[n:]
+		packets = append(packets, pkt)
+	}
+	return packets
+}
+
+func psiSection(tableID byte, ext uint16, data []byte) []byte {
+	n := 5 + len(data) + 4
+	b := []byte{0, tableID, 0xB0 | byte(n>>8), byte(n), byte(ext >> 8), byte(ext), 0xC1, 0, 0}
+	b = append(b, data...)
+	crc := CRC32(b[1:])
+	return append(b, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+func pesPacket(id byte, pts uint64, data []byte) []byte {
+	b := []byte{0, 0, 1, id, 0, 0, 0x80, 0x80, 5,
+		0x21 | byte(pts>>29)&0x0E, byte(pts >> 22), byte(pts>>14) | 1, byte(pts >> 7), byte(pts<<1) | 1}
+	if id != 0xE0 {
+		n := len(b) - 6 + len(data)
+		b[4], b[5] = byte(n>>8), byte(n)
+	}
+	return append(b, data...)
+}
+
+func TestCRC32(t *testing.T) {
+	assert.Equal(t, CRC32([]byte("123456789")), uint32(0x0376E6E7))
+}
+
+func TestDemuxer(t *testing.T) {
+	var stream [][]byte
+	var cc [3]uint8
+	stream = append(stream, tsPackets(PIDPAT, &cc[0], psiSection(tableIDPAT, 1, []byte{0, 1, 0xF0, 0x00}))...)
+	stream = append(stream, tsPackets(0x1000, &cc[1], psiSection(tableIDPMT, 1, []byte{
+		0xE1, 0x00, 0xF0, 0x00,
+		StreamTypeH264, 0xE1, 0x00, 0xF0, 0x00,
+		StreamTypeAAC, 0xE1, 0x01, 0xF0, 0x00,
+	}))...)
+	nalus := [][]byte{{0x67, 1, 2}, {0x68, 3}, append([]byte{0x65}, bytes.Repeat([]byte{0xAB}, 400)...)}
+	var videoCC, audioCC uint8
+	stream = append(stream, tsPackets(0x100, &videoCC, pesPacket(0xE0, 1<<32|9000, h264.JoinAnnexB(nalus)))...)
+	config := aac.AudioSpecificConfig{ObjectType: aac.ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2}
+	adts := aac.AppendADTS(nil, config, []byte{1, 2, 3})
+	adts = aac.AppendADTS(adts, config, []byte{4, 5, 6})
+	stream = append(stream, tsPackets(0x101, &audioCC, pesPacket(0xC0, 9000, adts))...)
+	stream = append(stream, tsPackets(0x100, &videoCC, pesPacket(0xE0, 12000, h264.JoinAnnexB([][]byte{{0x41, 1}})))...)
+
+	d := NewDemuxer()
+	var out []*PES
+	for _, pkt := range stream {
+		assert.Equal(t, len(pkt), PacketSize)
+		pes, err := d.Demux(pkt)
+		assert.NilError(t, err)
+		out = append(out, pes...)
+	}
+	pes, err := d.Flush()
+	assert.NilError(t, err)
+	out = append(out, pes...)
+
+	assert.DeepEqual(t, d.Streams(), []Stream{{0x100, StreamTypeH264}, {0x101, StreamTypeAAC}})
+	assert.Equal(t, len(out), 3)
+
+	// the audio PES is bounded and emitted first
+	assert.Equal(t, out[0].PID, uint16(0x101))
+	units, err := out[0].AccessUnits()
+	assert.NilError(t, err)
+	assert.Equal(t, len(units), 2)
+	// aac timestamps use the sample rate
+	assert.Equal(t, units[0].Timestamp, uint32(4800))
+	assert.Equal(t, units[1].Timestamp, uint32(4800+1024))
+	assert.DeepEqual(t, units[1].Data, [][]byte{{4, 5, 6}})
+
+	assert.Equal(t, out[1].PTS, uint64(1<<32|9000))
+	units, err = out[1].AccessUnits()
+	assert.NilError(t, err)
+	assert.Equal(t, units[0].Timestamp, uint32(9000))
+	assert.Assert(t, units[0].Key)
+	assert.DeepEqual(t, units[0].Data, nalus)
+
+	assert.Equal(t, out[2].PTS, uint64(12000))
+}
+
+func TestDemuxerContinuity(t *testing.T) {
+	d := NewDemuxer()
+	d.streams[0x100] = &stream{Stream: Stream{0x100, StreamTypeH264}}
+	var cc uint8
+	packets := tsPackets(0x100, &cc, pesPacket(0xE0, 0, make([]byte, 500)))
+	for i, pkt := range packets {
+		if i == 1 {
+			continue
+		}
+		_, err := d.Demux(pkt)
+		assert.NilError(t, err)
+	}
+	out, err := d.Flush()
+	assert.NilError(t, err)
+	assert.Equal(t, len(out), 0)
+}
@@ -0,0 +1,319 @@
+package mpegts
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/aac"
+	"github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/codec/h265"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// ErrInvalidTrack is returned when an access unit refers to an unknown track.
+var ErrInvalidTrack = errors.New("mpegts: invalid track index")
+
+// Muxer PIDs
+const (
+	PIDPMT         = 0x1000
+	PIDFirstStream = 0x0100
+)
+
+// Track is an elementary stream written by the Muxer.
+type Track struct {
+	// Type is StreamTypeH264, StreamTypeH265 or StreamTypeAAC.
+	Type uint8
+	// PID is the elementary stream PID. The Muxer assigns PIDs when zero.
+	PID uint16
+	// ClockRate is the RTP clock rate of the access unit timestamps.
+	ClockRate int
+	// Config is used to write the ADTS headers of AAC tracks.
+	Config aac.AudioSpecificConfig
+}
+
+// NewTrack creates a track for the format.
+func NewTrack(f codec.Format) (*Track, error) {
+	t := &Track{ClockRate: f.ClockRate}
+	switch strings.ToUpper(f.Encoding) {
+	case "H264":
+		t.Type = StreamTypeH264
+	case "H265":
+		t.Type = StreamTypeH265
+	case "MPEG4-GENERIC":
+		config, err := aac.ParseAudioSpecificConfig(f.Fmtp["config"])
+		if err != nil {
+			return nil, err
+		}
+		t.Type = StreamTypeAAC
+		t.Config = config
+	case "MP4A-LATM":
+		mux, err := aac.ParseStreamMuxConfig(f.Fmtp["config"])
+		if err != nil {
+			return nil, err
+		}
+		t.Type = StreamTypeAAC
+		t.Config = mux.Config
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, f.Encoding)
+	}
+	return t, nil
+}
+
+// IsVideo returns true for video tracks.
+func (t *Track) IsVideo() bool {
+	return t.Type == StreamTypeH264 || t.Type == StreamTypeH265
+}
+
+// tsOffset is added to all timestamps so that the PCR can lag behind.
+const tsOffset = 90000
+
+// pcrDelay is how far the PCR is behind the PTS of the access unit.
+const pcrDelay = 9000
+
+// Muxer writes access units as an MPEG-TS stream containing a single
+// program. RTP timestamps are used as presentation times, so streams with
+// B-frames are not supported.
+//
+// The stream starts at the first key frame of the PCR track. Access units
+// of the other tracks received before it are dropped, and the last one
+// dropped marks the start time in that track's clock. The tracks are
+// aligned by arrival, not with RTCP sender reports.
+type Muxer struct {
+	w       io.Writer
+	tracks  []*muxTrack
+	pcr     int // index of the track carrying the PCR
+	patCC   uint8
+	pmtCC   uint8
+	psi     bool
+	psiTime uint64
+	buf     []byte
+	started bool
+}
+
+type muxTrack struct {
+	*Track
+	clock   *rtp.Clock
+	base    int64 // start time in the track clock
+	hasBase bool
+	started bool // the first access unit was written
+	cc      uint8
+}
+
+// NewMuxer constructs a Muxer writing to w. The first video track carries
+// the PCR. The access units passed to WriteAccessUnit refer to the tracks
+// by index.
+func NewMuxer(w io.Writer, tracks []*Track) *Muxer {
+	m := &Muxer{w: w, pcr: -1}
+	for i, t := range tracks {
+		if t.PID == 0 {
+			t.PID = PIDFirstStream + uint16(i)
+		}
+		if t.ClockRate == 0 {
+			t.ClockRate = 90000
+		}
+		if m.pcr < 0 && t.IsVideo() {
+			m.pcr = i
+		}
+		m.tracks = append(m.tracks, &muxTrack{
+			Track: t,
+			clock: rtp.NewClock(t.ClockRate),
+		})
+	}
+	if m.pcr < 0 {
+		m.pcr = 0
+	}
+	return m
+}
+
+// isCut returns true when a segment may start with the access unit.
+func (m *Muxer) isCut(index int, au *codec.AccessUnit) bool {
+	return index == m.pcr && au.Key
+}
+
+// elapsed returns the time of the access unit relative to the start of
+// its track.
+func (m *Muxer) elapsed(index int, au *codec.AccessUnit) time.Duration {
+	t := m.tracks[index]
+	if !t.hasBase {
+		return 0
+	}
+	return t.clock.Duration(t.clock.Unwrap(au.Timestamp) - t.base)
+}
+
+// WriteAccessUnit writes the access unit as a PES packet. Video access
+// units contain NAL units and audio access units contain raw AAC frames.
+// Video access units are dropped until the first key frame. The PAT and
+// PMT are written before key frames of the PCR track.
+func (m *Muxer) WriteAccessUnit(index int, au *codec.AccessUnit) error {
+	if index < 0 || index >= len(m.tracks) {
+		return ErrInvalidTrack
+	}
+	t := m.tracks[index]
+	now := t.clock.Unwrap(au.Timestamp)
+	if !m.started {
+		if !m.isCut(index, au) {
+			t.base, t.hasBase = now, true
+			return nil
+		}
+		m.started = true
+		t.base, t.hasBase = now, true
+	}
+	if !t.hasBase {
+		t.base, t.hasBase = now, true
+	}
+	if !t.started {
+		if t.IsVideo() && !au.Key {
+			return nil
+		}
+		t.started = true
+	}
+	elapsed := now - t.base
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	pts := uint64(tsOffset + elapsed*90000/int64(t.ClockRate))
+	m.buf = m.buf[:0]
+	if !m.psi || m.isCut(index, au) && (t.IsVideo() || pts-m.psiTime >= 45000) {
+		m.writePSI()
+		m.psi = true
+		m.psiTime = pts
+	}
+	var (
+		data []byte
+		id   byte
+	)
+	switch t.Type {
+	case StreamTypeH264:
+		id = 0xE0
+		data = h264.JoinAnnexB(append([][]byte{{h264.NALUTypeAUD, 0xF0}}, au.Data...))
+	case StreamTypeH265:
+		id = 0xE0
+		data = h264.JoinAnnexB(append([][]byte{{h265.NALUTypeAUD << 1, 0x01, 0x50}}, au.Data...))
+	case StreamTypeAAC:
+		id = 0xC0
+		for _, frame := range au.Data {
+			data = aac.AppendADTS(data, t.Config, frame)
+		}
+	default:
+		return ErrUnsupported
+	}
+	var pcr *uint64
+	if index == m.pcr {
+		v := (pts - pcrDelay) * 300
+		pcr = &v
+	}
+	m.writePES(t, id, pts, data, au.Key, pcr)
+	_, err := m.w.Write(m.buf)
+	return err
+}
+
+// writePSI appends the PAT and PMT.
+func (m *Muxer) writePSI() {
+	pat := []byte{0x00, 0x01, 0xE0 | PIDPMT>>8, PIDPMT & 0xFF}
+	m.writeSection(PIDPAT, &m.patCC, tableIDPAT, 1, pat)
+	pcrPID := uint16(PIDNull)
+	if len(m.tracks) > 0 {
+		pcrPID = m.tracks[m.pcr].PID
+	}
+	pmt := []byte{0xE0 | byte(pcrPID>>8), byte(pcrPID), 0xF0, 0x00}
+	for _, t := range m.tracks {
+		pmt = append(pmt, t.Type, 0xE0|byte(t.PID>>8), byte(t.PID), 0xF0, 0x00)
+	}
+	m.writeSection(PIDPMT, &m.pmtCC, tableIDPMT, 1, pmt)
+}
+
+func (m *Muxer) writeSection(pid uint16, cc *uint8, tableID uint8, ext uint16, data []byte) {
+	n := 5 + len(data) + 4
+	section := []byte{tableID, 0xB0 | byte(n>>8), byte(n), byte(ext >> 8), byte(ext), 0xC1, 0, 0}
+	section = append(section, data...)
+	crc := CRC32(section)
+	section = append(section, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+	pkt := []byte{SyncByte, 0x40 | byte(pid>>8), byte(pid), 0x10 | *cc&0x0F, 0}
+	*cc++
+	pkt = append(pkt, section...)
+	for len(pkt) < PacketSize {
+		pkt = append(pkt, 0xFF)
+	}
+	m.buf = append(m.buf, pkt...)
+}
+
+// writePES appends the PES packet split into TS packets.
+func (m *Muxer) writePES(t *muxTrack, id byte, pts uint64, data []byte, random bool, pcr *uint64) {
+	pes := []byte{0, 0, 1, id, 0, 0, 0x80, 0x80, 5,
+		0x21 | byte(pts>>29)&0x0E,
+		byte(pts >> 22),
+		byte(pts>>14) | 0x01,
+		byte(pts >> 7),
+		byte(pts<<1) | 0x01,
+	}
+	// video PES packets are unbounded
+	if length := len(pes) - 6 + len(data); id != 0xE0 && length <= 0xFFFF {
+		pes[4], pes[5] = byte(length>>8), byte(length)
+	}
+	pes = append(pes, data...)
+	for first := true; len(pes) > 0; first = false {
+		start := len(m.buf)
+		m.buf = append(m.buf, SyncByte, byte(t.PID>>8), byte(t.PID), t.cc&0x0F)
+		t.cc++
+		var af []byte
+		if first {
+			m.buf[start+1] |= 0x40
+			if random || pcr != nil {
+				af = []byte{0}
+				if random {
+					af[0] |= 0x40
+				}
+				if pcr != nil {
+					base, ext := *pcr/300, *pcr%300
+					af[0] |= 0x10
+					af = append(af,
+						byte(base>>25), byte(base>>17), byte(base>>9), byte(base>>1),
+						byte(base<<7)|0x7E|byte(ext>>8), byte(ext))
+				}
+			}
+		}
+		room := PacketSize - 4
+		if af != nil {
+			room -= 1 + len(af)
+		}
+		if len(pes) < room {
+			// stuff the adaptation field so the payload fills the packet
+			stuffing := room - len(pes)
+			if af == nil {
+				af = []byte{}
+				stuffing--
+				if stuffing > 0 {
+					af = append(af, 0)
+					stuffing--
+				}
+			}
+			for i := 0; i < stuffing; i++ {
+				af = append(af, 0xFF)
+			}
+			room = len(pes)
+		}
+		if af != nil {
+			m.buf[start+3] |= 0x30
+			m.buf = append(m.buf, byte(len(af)))
+			m.buf = append(m.buf, af...)
+		} else {
+			m.buf[start+3] |= 0x10
+		}
+		m.buf = append(m.buf, pes[:room]...)
+		pes = pes[room:]
+	}
+}
+
+// WriteTables writes the PAT and PMT. This is used to make the next
+// access unit the start of an independently decodable segment.
+func (m *Muxer) WriteTables() error {
+	m.buf = m.buf[:0]
+	m.writePSI()
+	m.psi = true
+	_, err := m.w.Write(m.buf)
+	return err
+}
@@ -0,0 +1,145 @@
+package mpegts
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/aac"
+	"gotest.tools/v3/assert"
+)
+
+func TestMuxer(t *testing.T) {
+	config := aac.AudioSpecificConfig{ObjectType: aac.ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2}
+	tracks := []*Track{
+		{Type: StreamTypeH264},
+		{Type: StreamTypeAAC, ClockRate: 48000, Config: config},
+	}
+	var buf bytes.Buffer
+	m := NewMuxer(&buf, tracks)
+	idr := append([]byte{0x65}, bytes.Repeat([]byte{0xAB}, 1000)...)
+	assert.NilError(t, m.WriteAccessUnit(0, &codec.AccessUnit{Timestamp: 1000, Data: [][]byte{{0x41, 1}}}))
+	assert.NilError(t, m.WriteAccessUnit(0, &codec.AccessUnit{Timestamp: 4000, Data: [][]byte{{0x67, 1}, idr}, Key: true}))
+	assert.NilError(t, m.WriteAccessUnit(1, &codec.AccessUnit{Timestamp: 500, Data: [][]byte{{1, 2, 3}}, Key: true}))
+	assert.NilError(t, m.WriteAccessUnit(1, &codec.AccessUnit{Timestamp: 1524, Data: [][]byte{{4, 5, 6}}, Key: true}))
+	assert.NilError(t, m.WriteAccessUnit(0, &codec.AccessUnit{Timestamp: 7000, Data: [][]byte{{0x41, 2}}}))
+	assert.Equal(t, buf.Len()%PacketSize, 0)
+
+	d := NewDemuxer()
+	var out []*PES
+	for b := buf.Bytes(); len(b) > 0; b = b[PacketSize:] {
+		pes, err := d.Demux(b[:PacketSize])
+		assert.NilError(t, err)
+		out = append(out, pes...)
+	}
+	pes, err := d.Flush()
+	assert.NilError(t, err)
+	out = append(out, pes...)
+	assert.DeepEqual(t, d.Streams(), []Stream{{0x100, StreamTypeH264}, {0x101, StreamTypeAAC}})
+	assert.Equal(t, len(out), 4)
+
+	// the first video PES is completed by the next one
+	assert.Equal(t, out[2].PID, uint16(0x100))
+	assert.Assert(t, out[2].RandomAccess)
+	assert.Equal(t, out[2].PTS, uint64(tsOffset))
+	units, err := out[2].AccessUnits()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, units[0].Data, [][]byte{{0x09, 0xF0}, {0x67, 1}, idr})
+	assert.Assert(t, units[0].Key)
+
+	assert.Equal(t, out[1].PTS, uint64(tsOffset+1920))
+	units, err = out[1].AccessUnits()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, units[0].Data, [][]byte{{4, 5, 6}})
+
+	assert.Equal(t, out[3].PTS, uint64(tsOffset+3000))
+}
+
+func TestMuxerStart(t *testing.T) {
+	config := aac.AudioSpecificConfig{ObjectType: aac.ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2}
+	var buf bytes.Buffer
+	m := NewMuxer(&buf, []*Track{
+		{Type: StreamTypeH264},
+		{Type: StreamTypeAAC, ClockRate: 48000, Config: config},
+	})
+	// dropped until the key frame
+	assert.NilError(t, m.WriteAccessUnit(1, &codec.AccessUnit{Timestamp: 100000, Data: [][]byte{{1}}, Key: true}))
+	assert.NilError(t, m.WriteAccessUnit(0, &codec.AccessUnit{Timestamp: 5000, Data: [][]byte{{0x41, 1}}}))
+	assert.NilError(t, m.WriteAccessUnit(1, &codec.AccessUnit{Timestamp: 101024, Data: [][]byte{{2}}, Key: true}))
+	assert.NilError(t, m.WriteAccessUnit(0, &codec.AccessUnit{Timestamp: 8000, Data: [][]byte{{0x65, 1}}, Key: true}))
+	assert.NilError(t, m.WriteAccessUnit(1, &codec.AccessUnit{Timestamp: 102048, Data: [][]byte{{3}}, Key: true}))
+
+	d := NewDemuxer()
+	var out []*PES
+	for b := buf.Bytes(); len(b) > 0; b = b[PacketSize:] {
+		pes, err := d.Demux(b[:PacketSize])
+		assert.NilError(t, err)
+		out = append(out, pes...)
+	}
+	pes, err := d.Flush()
+	assert.NilError(t, err)
+	out = append(out, pes...)
+	pts := map[uint16][]uint64{}
+	for _, p := range out {
+		pts[p.PID] = append(pts[p.PID], p.PTS)
+	}
+	// the audio starts one frame after the last one dropped
+	assert.DeepEqual(t, pts, map[uint16][]uint64{
+		0x100: {tsOffset},
+		0x101: {tsOffset + 1920},
+	})
+}
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpegts")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	var files []string
+	r := NewRecorder(dir, []*Track{{Type: StreamTypeH264}})
+	r.MaxDuration = time.Second
+	r.Filename = func(time.Time) string {
+		return strconv.Itoa(len(files)) + ".ts"
+	}
+	r.OnClose = func(path string) {
+		files = append(files, path)
+	}
+	for i := 0; i < 100; i++ {
+		err := r.WriteAccessUnit(0, &codec.AccessUnit{
+			Timestamp: uint32(i * 3000),
+			Data:      [][]byte{{0x41, byte(i)}},
+			Key:       i%30 == 0,
+		})
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, r.Close())
+	assert.Equal(t, len(files), 4)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "1.ts"))
+	assert.NilError(t, err)
+	// each file starts with the PAT
+	assert.DeepEqual(t, data[:4], []byte{SyncByte, 0x40, 0x00, 0x10})
+	assert.Equal(t, len(data), 32*PacketSize)
+
+	// rotating within the same millisecond never overwrites a file
+	dir2, err := ioutil.TempDir("", "mpegts")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir2)
+	r = NewRecorder(dir2, []*Track{{Type: StreamTypeH264}})
+	r.MaxSize = 1
+	for i := 0; i < 10; i++ {
+		err := r.WriteAccessUnit(0, &codec.AccessUnit{
+			Timestamp: uint32(i * 3000),
+			Data:      [][]byte{{0x65, byte(i)}},
+			Key:       true,
+		})
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, r.Close())
+	names, err := filepath.Glob(filepath.Join(dir2, "*.ts"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(names), 10)
+}
@@ -0,0 +1,130 @@
+package mpegts
+
+import (
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/aac"
+	"github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/codec/h265"
+)
+
+// PES is a packetized elementary stream packet. Timestamps are in 90kHz
+// units and the DTS equals the PTS when it's not present in the header.
+type PES struct {
+	PID          uint16
+	StreamType   uint8
+	StreamID     uint8
+	HasPTS       bool
+	PTS          uint64
+	DTS          uint64
+	RandomAccess bool // set in the adaptation field of the first TS packet
+	Data         []byte
+}
+
+// Stream IDs without the optional PES header.
+func hasOptionalHeader(id uint8) bool {
+	switch id {
+	case 0xBC, 0xBE, 0xBF, 0xF0, 0xF1, 0xF2, 0xF8, 0xFF:
+		return false
+	default:
+		return true
+	}
+}
+
+// parsePES decodes the PES header in b into p.
+func parsePES(p *PES, b []byte) error {
+	if len(b) < 6 || b[0] != 0 || b[1] != 0 || b[2] != 1 {
+		return ErrInvalidPES
+	}
+	p.StreamID = b[3]
+	length := int(b[4])<<8 | int(b[5])
+	b = b[6:]
+	if length != 0 && length <= len(b) {
+		b = b[:length]
+	}
+	if !hasOptionalHeader(p.StreamID) {
+		p.Data = b
+		return nil
+	}
+	if len(b) < 3 {
+		return ErrInvalidPES
+	}
+	flags := b[1] >> 6
+	n := int(b[2])
+	if len(b) < 3+n {
+		return ErrInvalidPES
+	}
+	opt := b[3 : 3+n]
+	if flags&0x02 != 0 {
+		if len(opt) < 5 {
+			return ErrInvalidPES
+		}
+		p.HasPTS = true
+		p.PTS = parseTimestamp(opt)
+		p.DTS = p.PTS
+		if flags&0x01 != 0 {
+			if len(opt) < 10 {
+				return ErrInvalidPES
+			}
+			p.DTS = parseTimestamp(opt[5:])
+		}
+	}
+	p.Data = b[3+n:]
+	return nil
+}
+
+func parseTimestamp(b []byte) uint64 {
+	return uint64(b[0]>>1&0x07)<<30 |
+		uint64(b[1])<<22 |
+		uint64(b[2]>>1)<<15 |
+		uint64(b[3])<<7 |
+		uint64(b[4]>>1)
+}
+
+// AccessUnits converts the PES payload into access units. H.264 and
+// H.265 produce a single access unit containing the NAL units. AAC
+// produces an access unit for each ADTS frame. Video timestamps are the
+// lower 32 bits of the PTS in 90kHz units. AAC timestamps are converted
+// to the sample rate clock used by the aac package.
+func (p *PES) AccessUnits() ([]*codec.AccessUnit, error) {
+	ts := uint32(p.PTS)
+	switch p.StreamType {
+	case StreamTypeH264:
+		nalus := h264.SplitAnnexB(p.Data)
+		if len(nalus) == 0 {
+			return nil, nil
+		}
+		return []*codec.AccessUnit{{
+			Timestamp: ts,
+			Data:      nalus,
+			Key:       h264.IsKey(nalus),
+		}}, nil
+	case StreamTypeH265:
+		nalus := h264.SplitAnnexB(p.Data)
+		if len(nalus) == 0 {
+			return nil, nil
+		}
+		return []*codec.AccessUnit{{
+			Timestamp: ts,
+			Data:      nalus,
+			Key:       h265.IsKey(nalus),
+		}}, nil
+	case StreamTypeAAC:
+		config, frames, err := aac.SplitADTS(p.Data)
+		if err != nil {
+			return nil, err
+		}
+		// the pts has 33 bits so this can't overflow
+		ts := uint32(p.PTS * uint64(config.SampleRate) / 90000)
+		units := make([]*codec.AccessUnit, len(frames))
+		for i, frame := range frames {
+			units[i] = &codec.AccessUnit{
+				Timestamp: ts + uint32(i*aac.SamplesPerFrame),
+				Data:      [][]byte{frame},
+				Key:       true,
+			}
+		}
+		return units, nil
+	default:
+		return nil, ErrUnsupported
+	}
+}
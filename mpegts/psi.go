@@ -0,0 +1,94 @@
+package mpegts
+
+import "encoding/binary"
+
+// Table IDs
+const (
+	tableIDPAT = 0x00
+	tableIDPMT = 0x02
+)
+
+// section is a PSI section with the CRC verified and removed.
+type section struct {
+	TableID   uint8
+	Extension uint16 // program number for the PMT
+	Version   uint8
+	Data      []byte
+}
+
+// sectionLength returns the total size of the section at the start of b,
+// or -1 when the header is incomplete.
+func sectionLength(b []byte) int {
+	if len(b) < 3 {
+		return -1
+	}
+	return 3 + int(binary.BigEndian.Uint16(b[1:])&0x0FFF)
+}
+
+func parseSection(b []byte) (section, error) {
+	var s section
+	n := sectionLength(b)
+	if n < 12 || len(b) < n {
+		return s, ErrInvalidSection
+	}
+	b = b[:n]
+	if b[1]&0x80 == 0 {
+		return s, ErrInvalidSection
+	}
+	if CRC32(b) != 0 {
+		return s, ErrInvalidCRC
+	}
+	s.TableID = b[0]
+	s.Extension = binary.BigEndian.Uint16(b[3:])
+	s.Version = b[5] >> 1 & 0x1F
+	s.Data = b[8 : n-4]
+	return s, nil
+}
+
+// parsePAT returns the PMT PIDs indexed by program number.
+func parsePAT(data []byte) map[uint16]uint16 {
+	programs := map[uint16]uint16{}
+	for ; len(data) >= 4; data = data[4:] {
+		num := binary.BigEndian.Uint16(data)
+		pid := binary.BigEndian.Uint16(data[2:]) & 0x1FFF
+		// program 0 is the network information table
+		if num != 0 {
+			programs[num] = pid
+		}
+	}
+	return programs
+}
+
+// Stream is an elementary stream described by the PMT.
+type Stream struct {
+	PID  uint16
+	Type uint8
+}
+
+func parsePMT(data []byte) ([]Stream, error) {
+	if len(data) < 4 {
+		return nil, ErrInvalidSection
+	}
+	info := int(binary.BigEndian.Uint16(data[2:]) & 0x0FFF)
+	if len(data) < 4+info {
+		return nil, ErrInvalidSection
+	}
+	data = data[4+info:]
+	var streams []Stream
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, ErrInvalidSection
+		}
+		s := Stream{
+			Type: data[0],
+			PID:  binary.BigEndian.Uint16(data[1:]) & 0x1FFF,
+		}
+		n := int(binary.BigEndian.Uint16(data[3:]) & 0x0FFF)
+		if len(data) < 5+n {
+			return nil, ErrInvalidSection
+		}
+		data = data[5+n:]
+		streams = append(streams, s)
+	}
+	return streams, nil
+}
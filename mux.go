@@ -0,0 +1,268 @@
+package rtsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ServeMux dispatches requests to handlers by url path and method.
+//
+// Patterns are slash separated paths where a segment of the form {name}
+// matches any single segment and a final segment of the form {name...}
+// matches the rest of the path. The matched values are stored in the
+// request Params. When several patterns match, the one with the most
+// literal segments wins. Patterns which only differ by their wildcard
+// names conflict, registering both panics.
+//
+// Track urls are resolved against the aggregate pattern. When no pattern
+// matches the full path of a SETUP, PLAY, PAUSE or TEARDOWN request, the
+// last segment is removed and stored in the request Track. ie:
+// /cam1/trackID=0 matches the /cam1 pattern with Track set to trackID=0.
+// Handlers must validate the Track since any segment is accepted.
+//
+// The mux responds with 404 when no pattern matches and 405 when the
+// method isn't registered for the pattern. OPTIONS requests are answered
+// with the registered methods unless a handler is registered for them.
+type ServeMux struct {
+	mu     sync.RWMutex
+	routes []*route
+}
+
+type route struct {
+	pattern  string
+	segments []string
+	// handlers by method, the empty method matches any method
+	handlers map[string]Handler
+}
+
+// NewServeMux allocates and returns a new ServeMux.
+func NewServeMux() *ServeMux {
+	return &ServeMux{}
+}
+
+// Handle registers the handler for the pattern and methods. When no
+// methods are provided the handler receives every method. Registering
+// the same method twice for a pattern, or a pattern which conflicts with
+// an existing one, panics.
+func (m *ServeMux) Handle(pattern string, handler Handler, methods ...string) {
+	if handler == nil {
+		panic("rtsp: nil handler")
+	}
+	segments := splitPath(pattern)
+	for i, s := range segments {
+		if strings.HasSuffix(s, "...}") && i != len(segments)-1 {
+			panic(fmt.Sprintf("rtsp: %q wildcard must be the last segment", s))
+		}
+	}
+	if len(methods) == 0 {
+		methods = []string{""}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.route(segments)
+	if r != nil && strings.Join(r.segments, "/") != strings.Join(segments, "/") {
+		panic(fmt.Sprintf("rtsp: pattern %s conflicts with %s", pattern, r.pattern))
+	}
+	if r == nil {
+		r = &route{
+			pattern:  pattern,
+			segments: segments,
+			handlers: map[string]Handler{},
+		}
+		m.routes = append(m.routes, r)
+	}
+	for _, method := range methods {
+		if _, ok := r.handlers[method]; ok {
+			panic(fmt.Sprintf("rtsp: multiple registrations for %s %s", method, pattern))
+		}
+		r.handlers[method] = handler
+	}
+}
+
+// HandleFunc registers the handler function for the pattern and methods.
+func (m *ServeMux) HandleFunc(pattern string, handler func(*ServerConn, *Request) *Response, methods ...string) {
+	m.Handle(pattern, HandlerFunc(handler), methods...)
+}
+
+// route returns the route matching the same paths as the segments.
+func (m *ServeMux) route(segments []string) *route {
+	shape := patternShape(segments)
+	for _, r := range m.routes {
+		if patternShape(r.segments) == shape {
+			return r
+		}
+	}
+	return nil
+}
+
+// patternShape returns the pattern with the wildcard names removed.
+func patternShape(segments []string) string {
+	shape := make([]string, len(segments))
+	for i, s := range segments {
+		switch {
+		case strings.HasPrefix(s, "{") && strings.HasSuffix(s, "...}"):
+			shape[i] = "{...}"
+		case strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}"):
+			shape[i] = "{}"
+		default:
+			shape[i] = s
+		}
+	}
+	return strings.Join(shape, "/")
+}
+
+// ServeRTSP implements Handler.
+func (m *ServeMux) ServeRTSP(conn *ServerConn, req *Request) *Response {
+	h, res := m.handler(req)
+	if res != nil {
+		return res
+	}
+	return h.ServeRTSP(conn, req)
+}
+
+// handler returns the handler for the request, or the response when the
+// mux answers the request itself.
+func (m *ServeMux) handler(req *Request) (Handler, *Response) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if req.Method == MethodOptions && (req.URL.Path == "*" || req.URL.Opaque == "*") {
+		return nil, m.options(m.routes)
+	}
+	r, params, track, ok := m.match(req.Method, req.URL.Path)
+	if !ok {
+		res, _ := NewResponse(StatusNotFound, nil)
+		return nil, res
+	}
+	req.Params = params
+	req.Track = track
+	if h, ok := r.handlers[req.Method]; ok {
+		return h, nil
+	}
+	if h, ok := r.handlers[""]; ok {
+		return h, nil
+	}
+	if req.Method == MethodOptions {
+		return nil, m.options([]*route{r})
+	}
+	res, _ := NewResponse(StatusMethodNotAllowed, nil)
+	res.Header.Set("Allow", strings.Join(methods([]*route{r}), ", "))
+	return nil, res
+}
+
+// options responds with the methods registered for the routes.
+func (m *ServeMux) options(routes []*route) *Response {
+	res, _ := NewResponse(StatusOK, nil)
+	res.Header.Set("Public", strings.Join(methods(routes), ", "))
+	return res
+}
+
+// methods returns the sorted methods of the routes including OPTIONS.
+func methods(routes []*route) []string {
+	set := map[string]bool{MethodOptions: true}
+	for _, r := range routes {
+		for method := range r.handlers {
+			if method != "" {
+				set[method] = true
+			}
+		}
+	}
+	var mm []string
+	for method := range set {
+		mm = append(mm, method)
+	}
+	sort.Strings(mm)
+	return mm
+}
+
+// match finds the route for the path. If the full path doesn't match a
+// track method, the parent path is tried and the last segment is returned
+// as the track.
+func (m *ServeMux) match(method, path string) (*route, map[string]string, string, bool) {
+	segments := splitPath(path)
+	if r, params, ok := m.best(segments); ok {
+		return r, params, "", true
+	}
+	if len(segments) == 0 || !isTrackMethod(method) {
+		return nil, nil, "", false
+	}
+	track := segments[len(segments)-1]
+	if r, params, ok := m.best(segments[:len(segments)-1]); ok {
+		return r, params, track, true
+	}
+	return nil, nil, "", false
+}
+
+// isTrackMethod returns true for the methods which can target a track url.
+func isTrackMethod(method string) bool {
+	switch method {
+	case MethodSetup, MethodPlay, MethodPause, MethodTeardown:
+		return true
+	default:
+		return false
+	}
+}
+
+// best returns the most specific route matching the segments.
+func (m *ServeMux) best(segments []string) (*route, map[string]string, bool) {
+	var (
+		best       *route
+		bestParams map[string]string
+		bestScore  int
+	)
+	for _, r := range m.routes {
+		params, score, ok := r.match(segments)
+		if ok && (best == nil || score > bestScore) {
+			best, bestParams, bestScore = r, params, score
+		}
+	}
+	return best, bestParams, best != nil
+}
+
+// match returns the wildcard values and a specificity score. The score is
+// ordered by the number of literal segments, then the number of single
+// segment wildcards, and finally exact matches beat rest wildcards.
+func (r *route) match(segments []string) (map[string]string, int, bool) {
+	var params map[string]string
+	set := func(name, value string) {
+		if params == nil {
+			params = map[string]string{}
+		}
+		params[name] = value
+	}
+	score := 0
+	for i, s := range r.segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "...}") {
+			set(s[1:len(s)-4], strings.Join(segments[i:], "/"))
+			return params, score, true
+		}
+		if i >= len(segments) {
+			return nil, 0, false
+		}
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			set(s[1:len(s)-1], segments[i])
+			score += 10
+			continue
+		}
+		if s != segments[i] {
+			return nil, 0, false
+		}
+		score += 100
+	}
+	if len(segments) != len(r.segments) {
+		return nil, 0, false
+	}
+	return params, score + 1, true
+}
+
+// splitPath splits the path into its non-empty segments.
+func splitPath(path string) []string {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
@@ -0,0 +1,341 @@
+// Package pull implements a long running RTSP pull which survives
+// connection failures.
+//
+// A Session connects to the source, replays DESCRIBE, SETUP and PLAY, and
+// delivers the interleaved frames. When the connection fails or no RTP
+// arrives for the timeout, it reconnects with exponential backoff and
+// jitter. Consumers are told when the session description changed and
+// which frames follow a discontinuity.
+package pull
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/internal/rtsputil"
+	"github.com/icholy/rtsp/sdp"
+)
+
+// ErrTimeout is returned when no RTP packets arrive for the timeout.
+var ErrTimeout = errors.New("pull: no packets received")
+
+// Defaults used when the corresponding Session field is zero.
+const (
+	DefaultTimeout    = 10 * time.Second
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+	DefaultKeepAlive  = 30 * time.Second
+)
+
+// Frame is an interleaved frame received from the source.
+type Frame struct {
+	// Track is the index of the media description in the SDP.
+	Track int
+	// RTCP is true for control packets.
+	RTCP bool
+	Data []byte
+	// Discontinuity is set on the first RTP and the first RTCP frame of
+	// each track after a reconnect. The sequence numbers, timestamps and
+	// SSRC may jump.
+	Discontinuity bool
+}
+
+// Session pulls from a source until its context is cancelled.
+type Session struct {
+	// URL is the source endpoint.
+	URL string
+	// Options configure the client of every connection. ie: auth.WithDigest
+	Options []rtsp.Option
+	// Dial connects to the source address. A net.Dialer is used when nil.
+	Dial func(ctx context.Context, addr string) (net.Conn, error)
+	// Timeout is how long the session waits for a response or an RTP
+	// packet before reconnecting.
+	Timeout time.Duration
+	// MinBackoff and MaxBackoff bound the delay between reconnects. The
+	// delay doubles after each failed attempt.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// KeepAlive is the interval between keepalive requests. It's shortened
+	// to half of the session timeout announced by the source.
+	KeepAlive time.Duration
+
+	// OnConnect is called with the session description after SETUP and
+	// before PLAY. Changed is true when the media differ from the previous
+	// connection, which means depacketizers should be recreated.
+	OnConnect func(desc *sdp.Session, changed bool)
+	// OnFrame is called with every frame. It's called from the connection's
+	// receive goroutine.
+	OnFrame func(f Frame)
+	// OnDisconnect is called with the error which ended a connection
+	// attempt before waiting to reconnect.
+	OnDisconnect func(err error)
+
+	desc *sdp.Session
+}
+
+// Run connects and reconnects until the context is cancelled. It always
+// returns the context error.
+func (s *Session) Run(ctx context.Context) error {
+	attempt := 0
+	// frames are discontinuous once a connection has played
+	played := false
+	for {
+		playing, err := s.run(ctx, played)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if s.OnDisconnect != nil {
+			s.OnDisconnect(err)
+		}
+		if playing {
+			attempt = 0
+			played = true
+		}
+		delay := s.backoff(attempt)
+		attempt++
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// backoff returns the delay before the attempt. Half of the delay is
+// randomized so that many sessions don't reconnect in lockstep.
+func (s *Session) backoff(attempt int) time.Duration {
+	min := s.MinBackoff
+	if min <= 0 {
+		min = DefaultMinBackoff
+	}
+	max := s.MaxBackoff
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (s *Session) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (s *Session) keepAlive() time.Duration {
+	if s.KeepAlive > 0 {
+		return s.KeepAlive
+	}
+	return DefaultKeepAlive
+}
+
+func (s *Session) dial(ctx context.Context) (net.Conn, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "554")
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	if s.Dial != nil {
+		return s.Dial(ctx, addr)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// conn is the state of a single connection.
+type conn struct {
+	mu   sync.Mutex
+	last time.Time
+	// discontinued by channel
+	discontinued map[int]bool
+}
+
+// run performs a single connection attempt. It returns true if playback
+// started.
+func (s *Session) run(ctx context.Context, reconnect bool) (bool, error) {
+	nc, err := s.dial(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer nc.Close()
+	c := &conn{last: time.Now(), discontinued: map[int]bool{}}
+	options := append([]rtsp.Option{rtsp.WithFrameHandler(func(f rtsp.Frame) error {
+		s.handleFrame(c, reconnect, f)
+		return nil
+	})}, s.Options...)
+	client := rtsp.NewClient(nc, options...)
+
+	// abort the handshake if the context is cancelled
+	handshake := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			nc.Close()
+		case <-handshake:
+		}
+	}()
+	_ = nc.SetDeadline(time.Now().Add(s.timeout()))
+	base, session, interval, err := s.play(client)
+	close(handshake)
+	if err != nil {
+		return false, err
+	}
+	_ = nc.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	c.last = time.Now()
+	c.mu.Unlock()
+	keepalive := time.NewTicker(interval)
+	defer keepalive.Stop()
+	watchdog := time.NewTicker(s.timeout() / 4)
+	defer watchdog.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// release the session on the source
+			_ = nc.SetDeadline(time.Now().Add(time.Second))
+			_, _ = client.Teardown(base, session)
+			return true, ctx.Err()
+		case <-client.Done():
+			return true, client.Err()
+		case <-keepalive.C:
+			_ = nc.SetDeadline(time.Now().Add(s.timeout()))
+			_, err := client.Options(base)
+			_ = nc.SetDeadline(time.Time{})
+			if err != nil {
+				return true, err
+			}
+		case <-watchdog.C:
+			c.mu.Lock()
+			idle := time.Since(c.last)
+			c.mu.Unlock()
+			if idle > s.timeout() {
+				return true, ErrTimeout
+			}
+		}
+	}
+}
+
+// play sends DESCRIBE, SETUP and PLAY. It returns the base url, the
+// session id and the keepalive interval.
+func (s *Session) play(client *rtsp.Client) (string, string, time.Duration, error) {
+	res, err := client.Describe(s.URL)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if err := res.Err(); err != nil {
+		return "", "", 0, err
+	}
+	desc, err := sdp.Parse(res.Body)
+	if err != nil {
+		return "", "", 0, err
+	}
+	base := s.URL
+	if cb := res.Header.Get("Content-Base"); cb != "" {
+		base = cb
+	}
+	var session string
+	interval := s.keepAlive()
+	for i, m := range desc.Media {
+		req, err := rtsp.NewRequest(rtsp.MethodSetup, rtsputil.ControlURL(base, m.Control()), nil)
+		if err != nil {
+			return "", "", 0, err
+		}
+		req.Header.Set("Transport", fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", 2*i, 2*i+1))
+		if session != "" {
+			req.Header.Set("Session", session)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return "", "", 0, err
+		}
+		if session, err = rtsp.Session(res); err != nil {
+			return "", "", 0, err
+		}
+		interval = rtsputil.KeepAlive(res, interval)
+	}
+	changed := s.desc != nil && !sameMedia(s.desc, desc)
+	s.desc = desc
+	if s.OnConnect != nil {
+		s.OnConnect(desc, changed)
+	}
+	res, err = client.Play(base, session)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if err := res.Err(); err != nil {
+		return "", "", 0, err
+	}
+	return base, session, interval, nil
+}
+
+func (s *Session) handleFrame(c *conn, reconnect bool, f rtsp.Frame) {
+	track := f.Channel / 2
+	rtcp := f.Channel%2 == 1
+	c.mu.Lock()
+	if !rtcp {
+		c.last = time.Now()
+	}
+	discontinuity := reconnect && !c.discontinued[f.Channel]
+	c.discontinued[f.Channel] = true
+	c.mu.Unlock()
+	if s.OnFrame != nil {
+		s.OnFrame(Frame{
+			Track:         track,
+			RTCP:          rtcp,
+			Data:          f.Data,
+			Discontinuity: discontinuity,
+		})
+	}
+}
+
+// sameMedia returns true when the media descriptions are equivalent.
+// Control urls and session level fields are ignored since they commonly
+// change between connections.
+func sameMedia(a, b *sdp.Session) bool {
+	if len(a.Media) != len(b.Media) {
+		return false
+	}
+	for i := range a.Media {
+		ma, mb := a.Media[i], b.Media[i]
+		if ma.Type != mb.Type || ma.Proto != mb.Proto || !reflect.DeepEqual(ma.Formats, mb.Formats) {
+			return false
+		}
+		if !reflect.DeepEqual(mediaAttributes(ma), mediaAttributes(mb)) {
+			return false
+		}
+	}
+	return true
+}
+
+func mediaAttributes(m *sdp.Media) []sdp.Attribute {
+	var attrs []sdp.Attribute
+	for _, a := range m.Attributes {
+		if a.Key != "control" {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,257 @@
+package pull
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/rtp"
+	"github.com/icholy/rtsp/sdp"
+	"gotest.tools/v3/assert"
+)
+
+const cameraSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=camera\r\n" +
+	"t=0 0\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=control:video\r\n"
+
+// camera is a fake source which misbehaves differently on each connection.
+// The first connection is dropped after a few packets, the second stalls,
+// and the third changes the SDP and sends a sender report before the RTP.
+type camera struct {
+	mu    sync.Mutex
+	plays int
+}
+
+func (c *camera) ServeRTSP(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	c.mu.Lock()
+	plays := c.plays
+	c.mu.Unlock()
+	res, _ := rtsp.NewResponse(rtsp.StatusOK, nil)
+	switch req.Method {
+	case rtsp.MethodDescribe:
+		body := cameraSDP
+		if plays >= 2 {
+			body += "a=fmtp:96 packetization-mode=1\r\n"
+		}
+		res, _ = rtsp.NewResponse(rtsp.StatusOK, []byte(body))
+	case rtsp.MethodSetup:
+		res.Header.Set("Transport", req.Header.Get("Transport"))
+		res.Header.Set("Session", "camera")
+	case rtsp.MethodPlay:
+		c.mu.Lock()
+		c.plays++
+		c.mu.Unlock()
+		switch plays {
+		case 0:
+			go c.stream(conn, 3, false)
+		case 1:
+			// stall
+		default:
+			go c.stream(conn, -1, true)
+		}
+	}
+	return res
+}
+
+func (c *camera) stream(conn *rtsp.ServerConn, n int, report bool) {
+	if report {
+		sr := []byte{0x80, 200, 0, 6, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+		if err := conn.WriteFrame(rtsp.Frame{Channel: 1, Data: sr}); err != nil {
+			return
+		}
+	}
+	seq := rtp.NewSequencer(96)
+	for i := 0; i != n; i++ {
+		data, _ := seq.Packet(uint32(i*3000), true, []byte{0x65, 0x88}).Marshal()
+		if err := conn.WriteFrame(rtsp.Frame{Channel: 0, Data: data}); err != nil {
+			return
+		}
+		select {
+		case <-conn.Done():
+			return
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	conn.Close()
+}
+
+func TestSession(t *testing.T) {
+	cam := &camera{}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	srv := &rtsp.Server{Handler: cam}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	var (
+		mu       sync.Mutex
+		changes  []bool
+		errs     []error
+		frames   []Frame
+		received = make(chan struct{}, 100)
+	)
+	s := &Session{
+		URL:        "rtsp://" + l.Addr().String() + "/stream",
+		Timeout:    200 * time.Millisecond,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		OnConnect: func(desc *sdp.Session, changed bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, changed)
+		},
+		OnDisconnect: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+		OnFrame: func(f Frame) {
+			mu.Lock()
+			defer mu.Unlock()
+			frames = append(frames, f)
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	// wait until the third connection is streaming
+	deadline := time.After(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(frames)
+		mu.Unlock()
+		if n >= 6 {
+			break
+		}
+		select {
+		case <-received:
+		case <-deadline:
+			t.Fatal("timeout waiting for frames")
+		}
+	}
+	cancel()
+	assert.Assert(t, errors.Is(<-done, context.Canceled))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.DeepEqual(t, changes, []bool{false, false, true})
+	assert.Equal(t, len(errs), 2)
+	assert.Assert(t, errors.Is(errs[1], ErrTimeout))
+	var discontinuities []int
+	for i, f := range frames {
+		assert.Equal(t, f.Track, 0)
+		assert.Equal(t, f.RTCP, i == 3)
+		if f.Discontinuity {
+			discontinuities = append(discontinuities, i)
+		}
+	}
+	// the sender report doesn't hide the discontinuity of the rtp
+	assert.DeepEqual(t, discontinuities, []int{3, 4})
+}
+
+func TestBackoff(t *testing.T) {
+	s := &Session{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	for attempt, max := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		max *= time.Second
+		for i := 0; i < 20; i++ {
+			d := s.backoff(attempt)
+			assert.Assert(t, d >= max/2 && d <= max, "attempt %d: %v", attempt, d)
+		}
+	}
+}
+
+// steady is a fake source which streams until the connection closes and
+// announces a short session timeout.
+type steady struct {
+	options chan struct{}
+}
+
+func (c *steady) ServeRTSP(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	res, _ := rtsp.NewResponse(rtsp.StatusOK, nil)
+	switch req.Method {
+	case rtsp.MethodDescribe:
+		res, _ = rtsp.NewResponse(rtsp.StatusOK, []byte(cameraSDP))
+	case rtsp.MethodSetup:
+		res.Header.Set("Transport", req.Header.Get("Transport"))
+		res.Header.Set("Session", "camera;timeout=1")
+	case rtsp.MethodPlay:
+		go (&camera{}).stream(conn, -1, false)
+	case rtsp.MethodOptions:
+		select {
+		case c.options <- struct{}{}:
+		default:
+		}
+	}
+	return res
+}
+
+func TestSessionFirstAttempt(t *testing.T) {
+	cam := &steady{options: make(chan struct{}, 1)}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	srv := &rtsp.Server{Handler: cam}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	var (
+		mu     sync.Mutex
+		dials  int
+		frames []Frame
+	)
+	s := &Session{
+		URL:        "rtsp://" + l.Addr().String() + "/stream",
+		Timeout:    time.Second,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		Dial: func(ctx context.Context, addr string) (net.Conn, error) {
+			mu.Lock()
+			dials++
+			first := dials == 1
+			mu.Unlock()
+			if first {
+				return nil, errors.New("unreachable")
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", addr)
+		},
+		OnFrame: func(f Frame) {
+			mu.Lock()
+			defer mu.Unlock()
+			frames = append(frames, f)
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	// the keepalive follows the session timeout
+	select {
+	case <-cam.options:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for keepalive")
+	}
+	cancel()
+	assert.Assert(t, errors.Is(<-done, context.Canceled))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, dials, 2)
+	assert.Assert(t, len(frames) > 0)
+	// a failed attempt doesn't make the first playback a reconnect
+	for _, f := range frames {
+		assert.Assert(t, !f.Discontinuity)
+	}
+}
@@ -0,0 +1,466 @@
+// Package relay implements an RTSP server which shares a single upstream
+// pull session with any number of downstream viewers.
+//
+// The upstream is started when the first viewer arrives and stopped a
+// short while after the last one leaves. Every track is forwarded with
+// its own SSRC, sequence numbers and timestamps so that viewers see a
+// continuous stream even when the upstream source changes.
+package relay
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/internal/rtsputil"
+	"github.com/icholy/rtsp/sdp"
+)
+
+// Defaults used when the corresponding Relay field is zero.
+const (
+	DefaultLinger    = 10 * time.Second
+	DefaultQueueSize = 256
+	DefaultKeepAlive = 30 * time.Second
+)
+
+// sessionTimeout is the timeout advertised in the Session header. Viewer
+// sessions actually end with their connection.
+const sessionTimeout = 60
+
+// Relay pulls from an upstream RTSP source and serves it to downstream
+// clients. It implements rtsp.Handler. Only interleaved TCP transport
+// is supported for viewers.
+type Relay struct {
+	// URL is the upstream endpoint.
+	URL string
+	// Options configure the upstream client. ie: rtsp.WithAuth
+	Options []rtsp.Option
+	// Dial connects to the upstream address. net.Dial is used when nil.
+	Dial func(addr string) (net.Conn, error)
+	// Linger is how long the upstream is kept running without viewers.
+	Linger time.Duration
+	// QueueSize is the number of frames buffered per viewer. Frames
+	// are dropped for viewers which fall further behind.
+	QueueSize int
+	// KeepAlive is the interval between upstream keepalive requests. It's
+	// shortened to half of the session timeout announced by the source.
+	KeepAlive time.Duration
+
+	mu       sync.Mutex
+	up       *upstream
+	refs     int
+	idle     *time.Timer
+	sessions map[string]*session
+}
+
+// New constructs a Relay for the upstream url.
+func New(url string, options ...rtsp.Option) *Relay {
+	return &Relay{URL: url, Options: options}
+}
+
+// session is a downstream viewer.
+type session struct {
+	id      string
+	conn    *rtsp.ServerConn
+	up      *upstream
+	queue   chan rtsp.Frame
+	done    chan struct{}
+	once    sync.Once
+	playing bool
+	// channels maps the track index to the viewer's interleaved rtp channel.
+	channels map[int]int
+}
+
+func (s *session) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// writeLoop sends queued frames until the session or connection ends.
+func (s *session) writeLoop() {
+	for {
+		select {
+		case f := <-s.queue:
+			if err := s.conn.WriteFrame(f); err != nil {
+				s.conn.Close()
+				return
+			}
+		case <-s.done:
+			return
+		case <-s.conn.Done():
+			return
+		}
+	}
+}
+
+// ServeRTSP implements rtsp.Handler.
+func (r *Relay) ServeRTSP(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	switch req.Method {
+	case rtsp.MethodOptions:
+		res := rtsputil.Response(rtsp.StatusOK)
+		res.Header.Set("Public", rtsputil.PlayMethods)
+		return res
+	case rtsp.MethodDescribe:
+		return r.describe(req)
+	case rtsp.MethodSetup:
+		return r.setup(conn, req)
+	case rtsp.MethodPlay:
+		return r.play(conn, req)
+	case rtsp.MethodPause:
+		return r.pause(conn, req)
+	case rtsp.MethodTeardown:
+		return r.teardown(conn, req)
+	case rtsp.MethodGetParameter:
+		if _, res := r.lookup(conn, req); res != nil {
+			return res
+		}
+		return rtsputil.Response(rtsp.StatusOK)
+	default:
+		return rtsputil.Response(rtsp.StatusMethodNotAllowed)
+	}
+}
+
+func (r *Relay) describe(req *rtsp.Request) *rtsp.Response {
+	up, err := r.acquire()
+	if err != nil {
+		return rtsputil.Response(rtsp.StatusBadGateway)
+	}
+	defer r.release()
+	// replace the upstream controls with our own
+	s := *up.sdp
+	s.Media = nil
+	for i, m := range up.sdp.Media {
+		m2 := *m
+		m2.Attributes = nil
+		for _, a := range m.Attributes {
+			if a.Key != "control" {
+				m2.Attributes = append(m2.Attributes, a)
+			}
+		}
+		m2.Attributes = append(m2.Attributes, sdp.Attribute{Key: "control", Value: rtsputil.TrackControl(i)})
+		s.Media = append(s.Media, &m2)
+	}
+	res, _ := rtsp.NewResponse(rtsp.StatusOK, s.Marshal())
+	res.Header.Set("Content-Type", "application/sdp")
+	res.Header.Set("Content-Base", rtsputil.AggregateURL(req)+"/")
+	return res
+}
+
+func (r *Relay) setup(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	index, ok := rtsputil.TrackIndex(req)
+	if !ok {
+		return rtsputil.Response(rtsp.StatusNotFound)
+	}
+	t, err := rtsp.ParseTransport(req.Header.Get("Transport"))
+	if err != nil {
+		return rtsputil.Response(rtsp.StatusBadRequest)
+	}
+	if !t.IsTCP() || t.Mode == "RECORD" {
+		return rtsputil.Response(rtsp.StatusUnsupportedTransport)
+	}
+	var s *session
+	if req.Header.Get("Session") != "" {
+		var res *rtsp.Response
+		if s, res = r.lookup(conn, req); res != nil {
+			return res
+		}
+	} else {
+		up, err := r.acquire()
+		if err != nil {
+			return rtsputil.Response(rtsp.StatusBadGateway)
+		}
+		if index >= len(up.tracks) {
+			r.release()
+			return rtsputil.Response(rtsp.StatusNotFound)
+		}
+		s = r.newSession(conn, up)
+	}
+	if index >= len(s.up.tracks) {
+		return rtsputil.Response(rtsp.StatusNotFound)
+	}
+	if t.Interleaved[0] < 0 {
+		t.Interleaved = [2]int{2 * index, 2*index + 1}
+	}
+	r.mu.Lock()
+	s.channels[index] = t.Interleaved[0]
+	r.mu.Unlock()
+	transport := rtsp.Transport{
+		Protocol:    t.Protocol,
+		Unicast:     true,
+		Interleaved: t.Interleaved,
+		SSRC:        fmt.Sprintf("%08X", s.up.tracks[index].SSRC()),
+	}
+	res := rtsputil.Response(rtsp.StatusOK)
+	res.Header.Set("Transport", transport.String())
+	res.Header.Set("Session", s.id+";timeout="+strconv.Itoa(sessionTimeout))
+	return res
+}
+
+func (r *Relay) play(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	s, res := r.lookup(conn, req)
+	if res != nil {
+		return res
+	}
+	r.mu.Lock()
+	s.playing = true
+	var info []string
+	for index := range s.up.tracks {
+		if _, ok := s.channels[index]; !ok {
+			continue
+		}
+		seq, ts := s.up.tracks[index].Next()
+		info = append(info, fmt.Sprintf("url=%s/%s;seq=%d;rtptime=%d",
+			rtsputil.AggregateURL(req), rtsputil.TrackControl(index), seq, ts))
+	}
+	r.mu.Unlock()
+	res = rtsputil.Response(rtsp.StatusOK)
+	res.Header.Set("Session", s.id)
+	res.Header.Set("Range", "npt=0.000-")
+	res.Header.Set("RTP-Info", strings.Join(info, ","))
+	return res
+}
+
+func (r *Relay) pause(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	s, res := r.lookup(conn, req)
+	if res != nil {
+		return res
+	}
+	r.mu.Lock()
+	s.playing = false
+	r.mu.Unlock()
+	res = rtsputil.Response(rtsp.StatusOK)
+	res.Header.Set("Session", s.id)
+	return res
+}
+
+func (r *Relay) teardown(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	s, res := r.lookup(conn, req)
+	if res != nil {
+		return res
+	}
+	r.removeSession(s)
+	return rtsputil.Response(rtsp.StatusOK)
+}
+
+// lookup finds the session referenced by the request. Sessions can only
+// be used from the connection which created them.
+func (r *Relay) lookup(conn *rtsp.ServerConn, req *rtsp.Request) (*session, *rtsp.Response) {
+	id, _ := req.Header.Field("Session", 0)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[id]
+	if !ok || s.conn != conn {
+		return nil, rtsputil.Response(rtsp.StatusSessionNotFound)
+	}
+	return s, nil
+}
+
+func (r *Relay) newSession(conn *rtsp.ServerConn, up *upstream) *session {
+	s := &session{
+		id:       rtsputil.NewSessionID(),
+		conn:     conn,
+		up:       up,
+		queue:    make(chan rtsp.Frame, r.queueSize()),
+		done:     make(chan struct{}),
+		channels: map[int]int{},
+	}
+	r.mu.Lock()
+	if r.sessions == nil {
+		r.sessions = map[string]*session{}
+	}
+	r.sessions[s.id] = s
+	r.mu.Unlock()
+	go s.writeLoop()
+	go func() {
+		select {
+		case <-conn.Done():
+			r.removeSession(s)
+		case <-s.done:
+		}
+	}()
+	return s
+}
+
+func (r *Relay) removeSession(s *session) {
+	r.mu.Lock()
+	_, ok := r.sessions[s.id]
+	delete(r.sessions, s.id)
+	r.mu.Unlock()
+	if ok {
+		s.close()
+		r.release()
+	}
+}
+
+// broadcast queues a packet for every viewer playing the track.
+func (r *Relay) broadcast(up *upstream, index int, rtcp bool, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.sessions {
+		if s.up != up || !s.playing {
+			continue
+		}
+		channel, ok := s.channels[index]
+		if !ok {
+			continue
+		}
+		if rtcp {
+			channel++
+		}
+		select {
+		case s.queue <- rtsp.Frame{Channel: channel, Data: data}:
+		default:
+			// the viewer is too slow, drop the frame
+		}
+	}
+}
+
+// acquire returns the running upstream, starting it if required.
+// Every successful call must be paired with a call to release.
+func (r *Relay) acquire() (*upstream, error) {
+	r.mu.Lock()
+	r.refs++
+	if r.idle != nil {
+		r.idle.Stop()
+		r.idle = nil
+	}
+	up := r.up
+	if up == nil {
+		up = &upstream{
+			relay: r,
+			ready: make(chan struct{}),
+			stop:  make(chan struct{}),
+		}
+		r.up = up
+		go r.start(up)
+	}
+	r.mu.Unlock()
+	<-up.ready
+	if up.err != nil {
+		r.release()
+		return nil, up.err
+	}
+	return up, nil
+}
+
+// release decrements the viewer count and schedules the upstream
+// to stop when it reaches zero.
+func (r *Relay) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refs--
+	if r.refs > 0 || r.up == nil {
+		return
+	}
+	if r.idle != nil {
+		r.idle.Stop()
+	}
+	up := r.up
+	r.idle = time.AfterFunc(r.linger(), func() {
+		r.mu.Lock()
+		if r.refs > 0 || r.up != up {
+			r.mu.Unlock()
+			return
+		}
+		r.up = nil
+		r.idle = nil
+		r.mu.Unlock()
+		up.close()
+	})
+}
+
+func (r *Relay) start(up *upstream) {
+	up.err = up.connect()
+	if up.err != nil {
+		r.mu.Lock()
+		if r.up == up {
+			r.up = nil
+		}
+		r.mu.Unlock()
+		up.close()
+		close(up.ready)
+		return
+	}
+	up.stopped = make(chan struct{})
+	go up.keepalive()
+	close(up.ready)
+	select {
+	case <-up.client.Done():
+	case <-up.stop:
+		return
+	}
+	// the upstream failed, release the source session and disconnect
+	// its viewers
+	up.conn.Close()
+	r.mu.Lock()
+	if r.up == up {
+		r.up = nil
+	}
+	var conns []*rtsp.ServerConn
+	for _, s := range r.sessions {
+		if s.up == up {
+			conns = append(conns, s.conn)
+		}
+	}
+	r.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// Close stops the upstream and disconnects all viewers.
+func (r *Relay) Close() error {
+	r.mu.Lock()
+	up := r.up
+	r.up = nil
+	if r.idle != nil {
+		r.idle.Stop()
+		r.idle = nil
+	}
+	var conns []*rtsp.ServerConn
+	for _, s := range r.sessions {
+		conns = append(conns, s.conn)
+	}
+	r.mu.Unlock()
+	if up != nil {
+		<-up.ready
+		if up.err == nil {
+			up.close()
+		}
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+	return nil
+}
+
+func (r *Relay) dial(addr string) (net.Conn, error) {
+	if r.Dial != nil {
+		return r.Dial(addr)
+	}
+	return net.Dial("tcp", addr)
+}
+
+func (r *Relay) linger() time.Duration {
+	if r.Linger > 0 {
+		return r.Linger
+	}
+	return DefaultLinger
+}
+
+func (r *Relay) queueSize() int {
+	if r.QueueSize > 0 {
+		return r.QueueSize
+	}
+	return DefaultQueueSize
+}
+
+func (r *Relay) keepAlive() time.Duration {
+	if r.KeepAlive > 0 {
+		return r.KeepAlive
+	}
+	return DefaultKeepAlive
+}
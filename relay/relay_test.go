@@ -0,0 +1,270 @@
+package relay
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/internal/rtsputil"
+	"github.com/icholy/rtsp/rtp"
+	"github.com/icholy/rtsp/sdp"
+	"gotest.tools/v3/assert"
+)
+
+const cameraSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=camera\r\n" +
+	"t=0 0\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=control:video\r\n"
+
+// camera is a fake upstream which streams packets after PLAY.
+type camera struct {
+	mu        sync.Mutex
+	sessions  int
+	teardowns int
+	addr      string
+}
+
+func (c *camera) ServeRTSP(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	res := rtsputil.Response(rtsp.StatusOK)
+	switch req.Method {
+	case rtsp.MethodDescribe:
+		res, _ = rtsp.NewResponse(rtsp.StatusOK, []byte(cameraSDP))
+		res.Header.Set("Content-Base", "rtsp://"+c.addr+"/stream/")
+	case rtsp.MethodSetup:
+		if req.URL.Path != "/stream/video" {
+			return rtsputil.Response(rtsp.StatusNotFound)
+		}
+		res.Header.Set("Transport", req.Header.Get("Transport"))
+		res.Header.Set("Session", "camera;timeout=60")
+	case rtsp.MethodPlay:
+		c.mu.Lock()
+		c.sessions++
+		c.mu.Unlock()
+		go c.stream(conn)
+	case rtsp.MethodTeardown:
+		c.mu.Lock()
+		c.teardowns++
+		c.mu.Unlock()
+	}
+	return res
+}
+
+func (c *camera) stream(conn *rtsp.ServerConn) {
+	seq := rtp.NewSequencer(96)
+	for ts := uint32(0); ; ts += 3000 {
+		data, _ := seq.Packet(ts, true, []byte{0x65, 0x88}).Marshal()
+		if err := conn.WriteFrame(rtsp.Frame{Channel: 0, Data: data}); err != nil {
+			return
+		}
+		select {
+		case <-conn.Done():
+			return
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func (c *camera) counts() (sessions, teardowns int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessions, c.teardowns
+}
+
+func serve(t *testing.T, h rtsp.Handler) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	srv := &rtsp.Server{Handler: h}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return l.Addr().String()
+}
+
+type viewer struct {
+	client  *rtsp.Client
+	conn    net.Conn
+	packets chan *rtp.Packet
+	session string
+}
+
+func play(t *testing.T, addr string) *viewer {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	assert.NilError(t, err)
+	v := &viewer{conn: conn, packets: make(chan *rtp.Packet, 100)}
+	v.client = rtsp.NewClient(conn, rtsp.WithFrameHandler(func(f rtsp.Frame) error {
+		if f.Channel != 0 {
+			return nil
+		}
+		p, err := rtp.Parse(f.Data)
+		if err != nil {
+			return err
+		}
+		select {
+		case v.packets <- p:
+		default:
+		}
+		return nil
+	}))
+	endpoint := "rtsp://" + addr + "/relay"
+	res, err := v.client.Describe(endpoint)
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+	s, err := sdp.Parse(res.Body)
+	assert.NilError(t, err)
+	assert.Equal(t, len(s.Media), 1)
+	assert.Equal(t, s.Media[0].Control(), "trackID=0")
+	base := res.Header.Get("Content-Base")
+	assert.Equal(t, base, endpoint+"/")
+	res, err = v.client.Setup(base+"trackID=0", "RTP/AVP/TCP;unicast;interleaved=0-1")
+	assert.NilError(t, err)
+	v.session, err = rtsp.Session(res)
+	assert.NilError(t, err)
+	res, err = v.client.Play(endpoint, v.session)
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+	return v
+}
+
+func (v *viewer) next(t *testing.T) *rtp.Packet {
+	t.Helper()
+	select {
+	case p := <-v.packets:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for packet")
+		return nil
+	}
+}
+
+func TestRelay(t *testing.T) {
+	cam := &camera{}
+	cam.addr = serve(t, cam)
+	r := New("rtsp://" + cam.addr + "/stream")
+	r.Linger = 50 * time.Millisecond
+	addr := serve(t, r)
+	defer r.Close()
+
+	v1 := play(t, addr)
+	v2 := play(t, addr)
+
+	// both viewers share one upstream session and see the same stream
+	p1, p2 := v1.next(t), v2.next(t)
+	assert.Equal(t, p1.SSRC, p2.SSRC)
+	assert.Equal(t, p1.SSRC, r.up.tracks[0].SSRC())
+	sessions, _ := cam.counts()
+	assert.Equal(t, sessions, 1)
+
+	// sequence numbers are continuous
+	last := v1.next(t)
+	for i := 0; i < 5; i++ {
+		p := v1.next(t)
+		assert.Equal(t, p.SN, last.SN+1)
+		assert.Equal(t, p.TS, last.TS+3000)
+		last = p
+	}
+
+	// the upstream is stopped after the last viewer leaves
+	_, err := v1.client.Teardown("rtsp://"+addr+"/relay", v1.session)
+	assert.NilError(t, err)
+	v2.conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, teardowns := cam.counts(); teardowns == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("upstream was not torn down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a new viewer starts it again
+	v3 := play(t, addr)
+	v3.next(t)
+	sessions, _ = cam.counts()
+	assert.Equal(t, sessions, 2)
+}
+
+func TestUpstreamFailure(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer l.Close()
+	closed := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		for {
+			req, err := rtsp.ReadRequest(br)
+			if err != nil {
+				// the relay closed the connection
+				close(closed)
+				return
+			}
+			res := rtsputil.Response(rtsp.StatusOK)
+			switch req.Method {
+			case rtsp.MethodDescribe:
+				res, _ = rtsp.NewResponse(rtsp.StatusOK, []byte(cameraSDP))
+			case rtsp.MethodSetup:
+				res.Header.Set("Transport", req.Header.Get("Transport"))
+				res.Header.Set("Session", "camera")
+			}
+			res.Header.Set("CSeq", req.Header.Get("CSeq"))
+			_ = res.Write(conn)
+			if req.Method == rtsp.MethodPlay {
+				// a protocol error fails the upstream
+				_, _ = conn.Write([]byte("garbage\r\n\r\n"))
+			}
+		}
+	}()
+	r := New("rtsp://" + l.Addr().String() + "/stream")
+	r.Linger = time.Minute
+	addr := serve(t, r)
+	defer r.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	assert.NilError(t, err)
+	defer conn.Close()
+	_, err = rtsp.NewClient(conn).Describe("rtsp://" + addr + "/relay")
+	assert.NilError(t, err)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream connection was not closed")
+	}
+}
+
+func TestRewriter(t *testing.T) {
+	w := newRewriter(90000)
+	now := time.Now()
+	p := &rtp.Packet{SSRC: 1, SN: 100, TS: 1000}
+	w.RTP(p, now)
+	first := *p
+	assert.Equal(t, p.SSRC, w.SSRC())
+
+	p = &rtp.Packet{SSRC: 1, SN: 101, TS: 4000}
+	w.RTP(p, now.Add(time.Second/30))
+	assert.Equal(t, p.SN, first.SN+1)
+	assert.Equal(t, p.TS, first.TS+3000)
+
+	// a new source continues the outgoing stream
+	p = &rtp.Packet{SSRC: 2, SN: 7, TS: 5}
+	w.RTP(p, now.Add(2*time.Second/30))
+	assert.Equal(t, p.SSRC, w.SSRC())
+	assert.Equal(t, p.SN, first.SN+2)
+	assert.Equal(t, p.TS, first.TS+6000)
+
+	seq, ts := w.Next()
+	assert.Equal(t, seq, first.SN+3)
+	assert.Equal(t, ts, first.TS+6000)
+}
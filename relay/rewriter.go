@@ -0,0 +1,131 @@
+package relay
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/icholy/rtsp/rtcp"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// rewriter maps the upstream RTP header fields onto a single outgoing
+// stream. Viewers always see the same SSRC with continuous sequence
+// numbers and timestamps, even when the upstream source changes.
+type rewriter struct {
+	mu        sync.Mutex
+	clockRate int
+	ssrc      uint32
+
+	started   bool
+	source    uint32
+	seqOffset uint16
+	tsOffset  uint32
+
+	// last outgoing values, used to splice in a new source
+	lastSeq     uint16
+	lastTS      uint32
+	lastArrival time.Time
+}
+
+func newRewriter(clockRate int) *rewriter {
+	return &rewriter{
+		clockRate: clockRate,
+		ssrc:      rand.Uint32(),
+		lastSeq:   uint16(rand.Uint32()),
+		lastTS:    rand.Uint32(),
+	}
+}
+
+// RTP rewrites the packet header in place.
+func (w *rewriter) RTP(p *rtp.Packet, arrival time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.started || p.SSRC != w.source {
+		w.splice(p, arrival)
+	}
+	p.SSRC = w.ssrc
+	p.SN += w.seqOffset
+	p.TS += w.tsOffset
+	if int16(p.SN-w.lastSeq) > 0 {
+		w.lastSeq = p.SN
+		w.lastTS = p.TS
+		w.lastArrival = arrival
+	}
+}
+
+// splice computes offsets which continue the outgoing stream from
+// the first packet of a new source.
+func (w *rewriter) splice(p *rtp.Packet, arrival time.Time) {
+	ts := w.lastTS
+	if w.started && w.clockRate > 0 {
+		elapsed := arrival.Sub(w.lastArrival)
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		ts += uint32(elapsed.Seconds()*float64(w.clockRate) + 0.5)
+	}
+	w.started = true
+	w.source = p.SSRC
+	w.seqOffset = w.lastSeq + 1 - p.SN
+	w.tsOffset = ts - p.TS
+	w.lastSeq = p.SN + w.seqOffset - 1
+}
+
+// RTCP rewrites the sender reports and source descriptions of the
+// current source. Other packets and sources are dropped. It returns
+// false when nothing is left to forward.
+func (w *rewriter) RTCP(buf []byte) ([]byte, bool) {
+	packets, err := rtcp.Unmarshal(buf)
+	if err != nil {
+		return nil, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.started {
+		return nil, false
+	}
+	var out []rtcp.Packet
+	for _, p := range packets {
+		switch p := p.(type) {
+		case *rtcp.SenderReport:
+			if p.SSRC != w.source {
+				continue
+			}
+			p.SSRC = w.ssrc
+			p.RTPTime += w.tsOffset
+			p.Reports = nil
+			out = append(out, p)
+		case *rtcp.SourceDescription:
+			for _, c := range p.Chunks {
+				if c.Source == w.source {
+					c.Source = w.ssrc
+					out = append(out, &rtcp.SourceDescription{
+						Chunks: []rtcp.SourceDescriptionChunk{c},
+					})
+				}
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, false
+	}
+	data, err := rtcp.Marshal(out)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Next returns the sequence number and timestamp of the next packet
+// for the RTP-Info header.
+func (w *rewriter) Next() (seq uint16, ts uint32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastSeq + 1, w.lastTS
+}
+
+// SSRC returns the outgoing synchronization source.
+func (w *rewriter) SSRC() uint32 {
+	return w.ssrc
+}
@@ -0,0 +1,163 @@
+package relay
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/internal/rtsputil"
+	"github.com/icholy/rtsp/rtp"
+	"github.com/icholy/rtsp/sdp"
+)
+
+// upstream is a single pull session from the source.
+type upstream struct {
+	relay     *Relay
+	client    *rtsp.Client
+	conn      net.Conn
+	base      string
+	session   string
+	keepAlive time.Duration // interval between keepalive requests
+	sdp       *sdp.Session
+	tracks    []*rewriter
+
+	ready   chan struct{}
+	err     error
+	stop    chan struct{}
+	stopped chan struct{} // closed when keepalive returns
+}
+
+// connect performs the DESCRIBE, SETUP and PLAY exchange. Every media
+// is requested over interleaved channels 2i and 2i+1.
+func (u *upstream) connect() error {
+	r := u.relay
+	endpoint, err := url.Parse(r.URL)
+	if err != nil {
+		return err
+	}
+	addr := endpoint.Host
+	if endpoint.Port() == "" {
+		addr = net.JoinHostPort(endpoint.Hostname(), "554")
+	}
+	if u.conn, err = r.dial(addr); err != nil {
+		return err
+	}
+	options := append([]rtsp.Option{rtsp.WithFrameHandler(u.handleFrame)}, r.Options...)
+	u.client = rtsp.NewClient(u.conn, options...)
+	res, err := u.client.Describe(r.URL)
+	if err != nil {
+		return err
+	}
+	if err := res.Err(); err != nil {
+		return err
+	}
+	if u.sdp, err = sdp.Parse(res.Body); err != nil {
+		return err
+	}
+	u.base = r.URL
+	if base := res.Header.Get("Content-Base"); base != "" {
+		u.base = base
+	}
+	u.keepAlive = r.keepAlive()
+	for i, m := range u.sdp.Media {
+		clockRate, _ := m.ClockRate()
+		u.tracks = append(u.tracks, newRewriter(clockRate))
+		transport := fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", 2*i, 2*i+1)
+		res, err = u.setup(rtsputil.ControlURL(u.base, m.Control()), transport)
+		if err != nil {
+			return err
+		}
+		if u.session, err = rtsp.Session(res); err != nil {
+			return err
+		}
+		u.keepAlive = rtsputil.KeepAlive(res, u.keepAlive)
+	}
+	res, err = u.client.Play(u.base, u.session)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+// setup sends a SETUP request which joins the existing session if there is one.
+func (u *upstream) setup(endpoint, transport string) (*rtsp.Response, error) {
+	req, err := rtsp.NewRequest(rtsp.MethodSetup, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Transport", transport)
+	if u.session != "" {
+		req.Header.Set("Session", u.session)
+	}
+	return u.client.Do(req)
+}
+
+// keepalive sends an OPTIONS request periodically so the source doesn't
+// time out the session.
+func (u *upstream) keepalive() {
+	defer close(u.stopped)
+	ticker := time.NewTicker(u.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := u.client.Options(u.base); err != nil {
+				return
+			}
+		case <-u.stop:
+			return
+		case <-u.client.Done():
+			return
+		}
+	}
+}
+
+// close tears down the session and closes the connection.
+func (u *upstream) close() {
+	close(u.stop)
+	if u.client != nil && u.session != "" {
+		// don't wait forever for a response
+		timer := time.AfterFunc(time.Second, func() { u.conn.Close() })
+		go func() {
+			// the client doesn't support concurrent requests, so wait
+			// for an in-flight keepalive to finish first
+			if u.stopped != nil {
+				<-u.stopped
+			}
+			_, _ = u.client.Teardown(u.base, u.session)
+			timer.Stop()
+			u.conn.Close()
+		}()
+		return
+	}
+	if u.conn != nil {
+		u.conn.Close()
+	}
+}
+
+func (u *upstream) handleFrame(f rtsp.Frame) error {
+	index := f.Channel / 2
+	if index >= len(u.tracks) {
+		return nil
+	}
+	w := u.tracks[index]
+	if f.Channel%2 == 1 {
+		if data, ok := w.RTCP(f.Data); ok {
+			u.relay.broadcast(u, index, true, data)
+		}
+		return nil
+	}
+	var p rtp.Packet
+	if err := p.Unmarshal(f.Data); err != nil {
+		return nil
+	}
+	w.RTP(&p, time.Now())
+	data, err := p.Marshal()
+	if err != nil {
+		return nil
+	}
+	u.relay.broadcast(u, index, false, data)
+	return nil
+}
@@ -30,6 +30,12 @@ type Request struct {
 	URL    *url.URL
 	Header Header
 	Body   []byte
+
+	// Params contains the values of the ServeMux pattern wildcards.
+	Params map[string]string
+	// Track is the last path segment when ServeMux matched a track url
+	// against an aggregate pattern. ie: trackID=0
+	Track string
 }
 
 // Write the request to the provided writer in the wire format.
@@ -50,7 +56,9 @@ func (r Request) Write(w io.Writer) error {
 }
 
 // String returns a string representation of the request.
+// The url userinfo is omitted.
 func (r Request) String() string {
+	r.URL = stripUserinfo(r.URL)
 	var s strings.Builder
 	if err := r.Write(&s); err != nil {
 		return err.Error()
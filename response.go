@@ -28,7 +28,7 @@ func (res Response) Err() error {
 
 // Write the response to the provided writer in wire format.
 func (res Response) Write(w io.Writer) error {
-	if _, err := fmt.Fprintf(w, "%s %d %s\n",
+	if _, err := fmt.Fprintf(w, "%s %d %s\r\n",
 		version, res.StatusCode, res.Status,
 	); err != nil {
 		return err
@@ -0,0 +1,43 @@
+package rtcp
+
+// ApplicationDefined is an RTCP APP packet.
+type ApplicationDefined struct {
+	SubType uint8
+	SSRC    uint32
+	Name    string // 4 ASCII characters
+	Data    []byte // must be a multiple of 4 bytes
+}
+
+// Marshal implements Packet.
+func (a ApplicationDefined) Marshal() ([]byte, error) {
+	if a.SubType > 0x1F {
+		return nil, ErrInvalidSubType
+	}
+	if len(a.Name) != 4 {
+		return nil, ErrInvalidName
+	}
+	if len(a.Data)%4 != 0 {
+		return nil, ErrInvalidData
+	}
+	body := make([]byte, 8, 8+len(a.Data))
+	order.PutUint32(body, a.SSRC)
+	copy(body[4:], a.Name)
+	body = append(body, a.Data...)
+	return marshalPacket(TypeApplicationDefined, int(a.SubType), body)
+}
+
+// Unmarshal implements Packet.
+func (a *ApplicationDefined) Unmarshal(buf []byte) error {
+	h, body, err := unmarshalBody(buf, TypeApplicationDefined)
+	if err != nil {
+		return err
+	}
+	if len(body) < 8 {
+		return ErrTruncatedPacket
+	}
+	a.SubType = h.Count
+	a.SSRC = order.Uint32(body)
+	a.Name = string(body[4:8])
+	a.Data = append([]byte(nil), body[8:]...)
+	return nil
+}
@@ -0,0 +1,53 @@
+package rtcp
+
+// Goodbye is an RTCP BYE packet.
+type Goodbye struct {
+	Sources []uint32
+	Reason  string
+}
+
+// Marshal implements Packet.
+func (g Goodbye) Marshal() ([]byte, error) {
+	if len(g.Sources) > 0x1F {
+		return nil, ErrTooManySources
+	}
+	if len(g.Reason) > 255 {
+		return nil, ErrReasonTooLong
+	}
+	body := make([]byte, len(g.Sources)*4)
+	for i, s := range g.Sources {
+		order.PutUint32(body[i*4:], s)
+	}
+	if g.Reason != "" {
+		body = append(body, byte(len(g.Reason)))
+		body = append(body, g.Reason...)
+		body = pad4(body)
+	}
+	return marshalPacket(TypeGoodbye, len(g.Sources), body)
+}
+
+// Unmarshal implements Packet.
+func (g *Goodbye) Unmarshal(buf []byte) error {
+	h, body, err := unmarshalBody(buf, TypeGoodbye)
+	if err != nil {
+		return err
+	}
+	n := int(h.Count)
+	if len(body) < n*4 {
+		return ErrTruncatedPacket
+	}
+	g.Sources = make([]uint32, n)
+	for i := range g.Sources {
+		g.Sources[i] = order.Uint32(body[i*4:])
+	}
+	body = body[n*4:]
+	g.Reason = ""
+	if len(body) > 0 {
+		size := int(body[0])
+		if 1+size > len(body) {
+			return ErrTruncatedPacket
+		}
+		g.Reason = string(body[1 : 1+size])
+	}
+	return nil
+}
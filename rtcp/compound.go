@@ -0,0 +1,52 @@
+package rtcp
+
+// CompoundPacket is a sequence of RTCP packets sent together.
+type CompoundPacket []Packet
+
+// Validate checks the packets against the RFC 3550 compound packet rules.
+// The first packet must be a report and an SDES packet with a CNAME item
+// must be included.
+func (c CompoundPacket) Validate() error {
+	if len(c) == 0 {
+		return ErrEmptyCompound
+	}
+	switch c[0].(type) {
+	case *SenderReport, *ReceiverReport:
+	default:
+		return ErrBadFirstPacket
+	}
+	for _, p := range c[1:] {
+		if sdes, ok := p.(*SourceDescription); ok {
+			for _, chunk := range sdes.Chunks {
+				for _, item := range chunk.Items {
+					if item.Type == SDESCNAME {
+						return nil
+					}
+				}
+			}
+		}
+	}
+	return ErrMissingCNAME
+}
+
+// Marshal encodes the compound packet.
+func (c CompoundPacket) Marshal() ([]byte, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return Marshal(c)
+}
+
+// Unmarshal decodes and validates a compound packet.
+func (c *CompoundPacket) Unmarshal(buf []byte) error {
+	packets, err := Unmarshal(buf)
+	if err != nil {
+		return err
+	}
+	compound := CompoundPacket(packets)
+	if err := compound.Validate(); err != nil {
+		return err
+	}
+	*c = compound
+	return nil
+}
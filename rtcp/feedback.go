@@ -0,0 +1,92 @@
+package rtcp
+
+// NACKPair is a generic NACK feedback control item. It identifies a lost
+// packet and a bitmask of the following 16 lost packets.
+type NACKPair struct {
+	PacketID    uint16
+	LostPackets uint16
+}
+
+// SequenceNumbers returns all the sequence numbers reported as lost.
+func (n NACKPair) SequenceNumbers() []uint16 {
+	seqs := []uint16{n.PacketID}
+	for i := uint16(0); i < 16; i++ {
+		if n.LostPackets&(1<<i) != 0 {
+			seqs = append(seqs, n.PacketID+i+1)
+		}
+	}
+	return seqs
+}
+
+// GenericNACK is an RTPFB generic negative acknowledgement (RFC 4585).
+type GenericNACK struct {
+	SenderSSRC uint32
+	MediaSSRC  uint32
+	Nacks      []NACKPair
+}
+
+// Marshal implements Packet.
+func (g GenericNACK) Marshal() ([]byte, error) {
+	body := make([]byte, 8+len(g.Nacks)*4)
+	order.PutUint32(body[0:], g.SenderSSRC)
+	order.PutUint32(body[4:], g.MediaSSRC)
+	for i, n := range g.Nacks {
+		order.PutUint16(body[8+i*4:], n.PacketID)
+		order.PutUint16(body[10+i*4:], n.LostPackets)
+	}
+	return marshalPacket(TypeTransportFeedback, FormatGenericNACK, body)
+}
+
+// Unmarshal implements Packet.
+func (g *GenericNACK) Unmarshal(buf []byte) error {
+	h, body, err := unmarshalBody(buf, TypeTransportFeedback)
+	if err != nil {
+		return err
+	}
+	if h.Count != FormatGenericNACK {
+		return ErrWrongType
+	}
+	if len(body) < 8 || len(body)%4 != 0 {
+		return ErrTruncatedPacket
+	}
+	g.SenderSSRC = order.Uint32(body[0:])
+	g.MediaSSRC = order.Uint32(body[4:])
+	g.Nacks = make([]NACKPair, (len(body)-8)/4)
+	for i := range g.Nacks {
+		g.Nacks[i].PacketID = order.Uint16(body[8+i*4:])
+		g.Nacks[i].LostPackets = order.Uint16(body[10+i*4:])
+	}
+	return nil
+}
+
+// PictureLossIndication is a PSFB picture loss indication (RFC 4585).
+// It is used to request a key frame from the sender.
+type PictureLossIndication struct {
+	SenderSSRC uint32
+	MediaSSRC  uint32
+}
+
+// Marshal implements Packet.
+func (p PictureLossIndication) Marshal() ([]byte, error) {
+	body := make([]byte, 8)
+	order.PutUint32(body[0:], p.SenderSSRC)
+	order.PutUint32(body[4:], p.MediaSSRC)
+	return marshalPacket(TypePayloadFeedback, FormatPLI, body)
+}
+
+// Unmarshal implements Packet.
+func (p *PictureLossIndication) Unmarshal(buf []byte) error {
+	h, body, err := unmarshalBody(buf, TypePayloadFeedback)
+	if err != nil {
+		return err
+	}
+	if h.Count != FormatPLI {
+		return ErrWrongType
+	}
+	if len(body) < 8 {
+		return ErrTruncatedPacket
+	}
+	p.SenderSSRC = order.Uint32(body[0:])
+	p.MediaSSRC = order.Uint32(body[4:])
+	return nil
+}
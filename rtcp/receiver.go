@@ -0,0 +1,396 @@
+package rtcp
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/icholy/rtsp/rtp"
+)
+
+// RFC 3550 A.1 sequence number validation parameters
+const (
+	maxDropout    = 3000
+	maxMisorder   = 100
+	minSequential = 2
+	seqMod        = 1 << 16
+)
+
+// SourceStats contains reception statistics for a single source.
+type SourceStats struct {
+	SSRC               uint32
+	PacketsReceived    uint64
+	PacketsLost        int64
+	ExtendedHighestSeq uint32
+	Jitter             float64   // interarrival jitter in timestamp units
+	LastSenderReport   time.Time // arrival time of the last SR
+}
+
+// source tracks the reception state of a single SSRC as described in
+// RFC 3550 Appendix A.1, A.3 and A.8.
+type source struct {
+	ssrc      uint32
+	maxSeq    uint16
+	cycles    uint32
+	baseSeq   uint32
+	badSeq    uint32
+	probation int
+	received  uint64
+
+	expectedPrior uint64
+	receivedPrior uint64
+
+	transit    uint32
+	jitter     float64
+	hasTransit bool
+
+	lsr        uint32
+	lsrArrival time.Time
+}
+
+func newSource(ssrc uint32, seq uint16) *source {
+	s := &source{ssrc: ssrc, probation: minSequential}
+	s.init(seq)
+	s.maxSeq = seq - 1
+	return s
+}
+
+func (s *source) init(seq uint16) {
+	s.baseSeq = uint32(seq)
+	s.maxSeq = seq
+	s.badSeq = seqMod + 1
+	s.cycles = 0
+	s.received = 0
+	s.receivedPrior = 0
+	s.expectedPrior = 0
+}
+
+// update validates the sequence number and returns false when the
+// packet should be ignored.
+func (s *source) update(seq uint16) bool {
+	udelta := seq - s.maxSeq
+	if s.probation > 0 {
+		// the packet is in sequence
+		if seq == s.maxSeq+1 {
+			s.probation--
+			s.maxSeq = seq
+			if s.probation == 0 {
+				s.init(seq)
+				s.received++
+				return true
+			}
+		} else {
+			s.probation = minSequential - 1
+			s.maxSeq = seq
+		}
+		return false
+	}
+	switch {
+	case udelta < maxDropout:
+		// in order, with permissible gap
+		if seq < s.maxSeq {
+			s.cycles += seqMod
+		}
+		s.maxSeq = seq
+	case uint32(udelta) <= seqMod-maxMisorder:
+		// the sequence number made a very large jump
+		if uint32(seq) == s.badSeq {
+			// two sequential packets, assume the other side restarted
+			s.init(seq)
+		} else {
+			s.badSeq = (uint32(seq) + 1) & (seqMod - 1)
+			return false
+		}
+	default:
+		// duplicate or reordered packet
+	}
+	s.received++
+	return true
+}
+
+func (s *source) extendedMax() uint32 {
+	return s.cycles + uint32(s.maxSeq)
+}
+
+func (s *source) expected() uint64 {
+	return uint64(s.extendedMax()) - uint64(s.baseSeq) + 1
+}
+
+func (s *source) lost() int64 {
+	lost := int64(s.expected()) - int64(s.received)
+	// clamp to a signed 24 bit value
+	if lost > 0x7FFFFF {
+		lost = 0x7FFFFF
+	}
+	if lost < -0x800000 {
+		lost = -0x800000
+	}
+	return lost
+}
+
+// report builds the reception report block and starts a new interval.
+func (s *source) report(now time.Time) ReceptionReport {
+	expected := s.expected()
+	expectedInterval := expected - s.expectedPrior
+	s.expectedPrior = expected
+	receivedInterval := s.received - s.receivedPrior
+	s.receivedPrior = s.received
+	var fraction uint8
+	if lostInterval := int64(expectedInterval) - int64(receivedInterval); expectedInterval != 0 && lostInterval > 0 {
+		fraction = uint8((lostInterval << 8) / int64(expectedInterval))
+	}
+	r := ReceptionReport{
+		SSRC:               s.ssrc,
+		FractionLost:       fraction,
+		TotalLost:          uint32(s.lost()) & 0xFFFFFF,
+		LastSequenceNumber: s.extendedMax(),
+		Jitter:             uint32(s.jitter),
+		LastSenderReport:   s.lsr,
+	}
+	if !s.lsrArrival.IsZero() {
+		r.Delay = uint32(now.Sub(s.lsrArrival).Seconds() * 65536)
+	}
+	return r
+}
+
+// DefaultMinInterval is the minimum RTCP report interval from RFC 3550.
+const DefaultMinInterval = 5 * time.Second
+
+// Receiver tracks the reception statistics of incoming RTP streams and
+// generates RTCP receiver reports.
+type Receiver struct {
+	// SSRC identifies the receiver in reports.
+	SSRC uint32
+	// CNAME is sent in the SDES packet accompanying each report.
+	CNAME string
+	// ClockRate is the RTP timestamp clock rate used for the jitter calculation.
+	ClockRate int
+	// Bandwidth is the session bandwidth in bits per second.
+	// When zero, the minimum report interval is used.
+	Bandwidth int
+	// MinInterval is the minimum report interval. When zero, the
+	// RFC 3550 minimum of 5 seconds is used.
+	MinInterval time.Duration
+
+	mu      sync.Mutex
+	epoch   time.Time
+	sources map[uint32]*source
+	clocks  map[uint32]*rtp.Clock
+	avgSize float64
+}
+
+// NewReceiver constructs a Receiver with a random SSRC.
+func NewReceiver(cname string, clockRate int) *Receiver {
+	return &Receiver{
+		SSRC:      rand.Uint32(),
+		CNAME:     cname,
+		ClockRate: clockRate,
+	}
+}
+
+// ReceiveRTP updates the statistics using a received packet.
+func (r *Receiver) ReceiveRTP(p *rtp.Packet, arrival time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sources == nil {
+		r.sources = map[uint32]*source{}
+		r.epoch = arrival
+	}
+	s, ok := r.sources[p.SSRC]
+	if !ok {
+		s = newSource(p.SSRC, p.SN)
+		r.sources[p.SSRC] = s
+	}
+	if !s.update(p.SN) {
+		return
+	}
+	if r.ClockRate > 0 {
+		// the transit time is computed modulo 2^32 so the difference
+		// survives timestamp wraparound (RFC 3550 A.8)
+		units := int64(arrival.Sub(r.epoch).Seconds() * float64(r.ClockRate))
+		transit := uint32(units) - p.TS
+		if s.hasTransit {
+			d := int64(int32(transit - s.transit))
+			if d < 0 {
+				d = -d
+			}
+			s.jitter += (float64(d) - s.jitter) / 16
+		}
+		s.transit = transit
+		s.hasTransit = true
+	}
+}
+
+// ReceiveRTCP updates the statistics using a received compound RTCP packet.
+// Sender reports are used to compute the delay since the last SR and to
+// synchronize the clock of the sender.
+func (r *Receiver) ReceiveRTCP(buf []byte, arrival time.Time) error {
+	packets, err := Unmarshal(buf)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updateAvgSize(len(buf))
+	for _, p := range packets {
+		sr, ok := p.(*SenderReport)
+		if !ok {
+			continue
+		}
+		if s, ok := r.sources[sr.SSRC]; ok {
+			s.lsr = uint32(sr.NTPTime >> 16)
+			s.lsrArrival = arrival
+		}
+		if r.clocks == nil {
+			r.clocks = map[uint32]*rtp.Clock{}
+		}
+		c, ok := r.clocks[sr.SSRC]
+		if !ok {
+			c = rtp.NewClock(r.ClockRate)
+			r.clocks[sr.SSRC] = c
+		}
+		c.Sync(sr.NTPTime, sr.RTPTime)
+	}
+	return nil
+}
+
+// Time converts the packet timestamp into wall-clock time using the last
+// sender report of its source. The returned bool is false until a sender
+// report has been received.
+func (r *Receiver) Time(p *rtp.Packet) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.clocks[p.SSRC]
+	if !ok {
+		return time.Time{}, false
+	}
+	return c.Time(p.TS)
+}
+
+// Stats returns the statistics for the source.
+func (r *Receiver) Stats(ssrc uint32) (SourceStats, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sources[ssrc]
+	if !ok {
+		return SourceStats{}, false
+	}
+	return SourceStats{
+		SSRC:               s.ssrc,
+		PacketsReceived:    s.received,
+		PacketsLost:        s.lost(),
+		ExtendedHighestSeq: s.extendedMax(),
+		Jitter:             s.jitter,
+		LastSenderReport:   s.lsrArrival,
+	}, true
+}
+
+// Report generates a compound packet containing a receiver report
+// and the SDES CNAME. Each call starts a new reporting interval.
+func (r *Receiver) Report(now time.Time) CompoundPacket {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rr := &ReceiverReport{SSRC: r.SSRC}
+	for _, s := range r.sources {
+		if s.probation > 0 {
+			continue
+		}
+		if len(rr.Reports) == 0x1F {
+			break
+		}
+		rr.Reports = append(rr.Reports, s.report(now))
+	}
+	return CompoundPacket{
+		rr,
+		&SourceDescription{
+			Chunks: []SourceDescriptionChunk{{
+				Source: r.SSRC,
+				Items:  []SourceDescriptionItem{{SDESCNAME, r.CNAME}},
+			}},
+		},
+	}
+}
+
+func (r *Receiver) updateAvgSize(size int) {
+	if r.avgSize == 0 {
+		r.avgSize = float64(size)
+		return
+	}
+	r.avgSize += (float64(size) - r.avgSize) / 16
+}
+
+// interval computes the time until the next report.
+func (r *Receiver) interval(initial bool) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	senders := len(r.sources)
+	min := r.MinInterval
+	if min <= 0 {
+		min = DefaultMinInterval
+	}
+	return interval(min, senders+1, senders, float64(r.Bandwidth)/8*0.05, false, r.avgSize, initial)
+}
+
+// Run sends periodic reports using the send function until the context
+// is cancelled or send returns an error. The send function typically
+// writes to the RTCP interleaved channel or UDP port.
+func (r *Receiver) Run(ctx context.Context, send func([]byte) error) error {
+	t := time.NewTimer(r.interval(true))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-t.C:
+			data, err := r.Report(now).Marshal()
+			if err != nil {
+				return err
+			}
+			if err := send(data); err != nil {
+				return err
+			}
+			r.mu.Lock()
+			r.updateAvgSize(len(data))
+			r.mu.Unlock()
+			t.Reset(r.interval(false))
+		}
+	}
+}
+
+// Interval computes the randomized RTCP transmission interval as described
+// in RFC 3550 Appendix A.7. The bandwidth is the RTCP bandwidth in octets
+// per second and avgSize is the average compound packet size in octets.
+func Interval(members, senders int, bandwidth float64, weSent bool, avgSize float64, initial bool) time.Duration {
+	return interval(DefaultMinInterval, members, senders, bandwidth, weSent, avgSize, initial)
+}
+
+func interval(min time.Duration, members, senders int, bandwidth float64, weSent bool, avgSize float64, initial bool) time.Duration {
+	const (
+		senderShare  = 0.25
+		compensation = 2.71828 - 1.5
+	)
+	tmin := min.Seconds()
+	if initial {
+		tmin /= 2
+	}
+	t := tmin
+	if bandwidth > 0 && avgSize > 0 {
+		n := members
+		if senders <= int(float64(members)*senderShare) {
+			if weSent {
+				bandwidth *= senderShare
+				n = senders
+			} else {
+				bandwidth *= 1 - senderShare
+				n -= senders
+			}
+		}
+		if d := avgSize * float64(n) / bandwidth; d > tmin {
+			t = d
+		}
+	}
+	t *= rand.Float64() + 0.5
+	t /= compensation
+	return time.Duration(t * float64(time.Second))
+}
@@ -0,0 +1,157 @@
+package rtcp
+
+// ReceptionReportSize is the size of a single reception report block.
+const ReceptionReportSize = 24
+
+// ReceptionReport contains reception statistics for a single source.
+type ReceptionReport struct {
+	SSRC               uint32 // Source being reported on
+	FractionLost       uint8  // Fraction of packets lost since the last report (fixed point /256)
+	TotalLost          uint32 // Cumulative number of packets lost (24 bits)
+	LastSequenceNumber uint32 // Extended highest sequence number received
+	Jitter             uint32 // Interarrival jitter in timestamp units
+	LastSenderReport   uint32 // Middle 32 bits of the last SR NTP timestamp
+	Delay              uint32 // Delay since the last SR in 1/65536 seconds
+}
+
+func (r ReceptionReport) marshalTo(buf []byte) {
+	order.PutUint32(buf[0:], r.SSRC)
+	order.PutUint32(buf[4:], r.TotalLost&0xFFFFFF)
+	buf[4] = r.FractionLost
+	order.PutUint32(buf[8:], r.LastSequenceNumber)
+	order.PutUint32(buf[12:], r.Jitter)
+	order.PutUint32(buf[16:], r.LastSenderReport)
+	order.PutUint32(buf[20:], r.Delay)
+}
+
+func (r *ReceptionReport) unmarshal(buf []byte) {
+	r.SSRC = order.Uint32(buf[0:])
+	r.FractionLost = buf[4]
+	r.TotalLost = order.Uint32(buf[4:]) & 0xFFFFFF
+	r.LastSequenceNumber = order.Uint32(buf[8:])
+	r.Jitter = order.Uint32(buf[12:])
+	r.LastSenderReport = order.Uint32(buf[16:])
+	r.Delay = order.Uint32(buf[20:])
+}
+
+func marshalReports(reports []ReceptionReport) ([]byte, error) {
+	if len(reports) > 0x1F {
+		return nil, ErrTooManyReports
+	}
+	buf := make([]byte, len(reports)*ReceptionReportSize)
+	for i, r := range reports {
+		r.marshalTo(buf[i*ReceptionReportSize:])
+	}
+	return buf, nil
+}
+
+func unmarshalReports(buf []byte, count int) ([]ReceptionReport, []byte, error) {
+	if len(buf) < count*ReceptionReportSize {
+		return nil, nil, ErrTruncatedPacket
+	}
+	reports := make([]ReceptionReport, count)
+	for i := range reports {
+		reports[i].unmarshal(buf[i*ReceptionReportSize:])
+	}
+	return reports, buf[count*ReceptionReportSize:], nil
+}
+
+// SenderReport is an RTCP SR packet.
+type SenderReport struct {
+	SSRC              uint32            // Sender
+	NTPTime           uint64            // Wall-clock time when the report was sent
+	RTPTime           uint32            // RTP timestamp corresponding to NTPTime
+	PacketCount       uint32            // Total packets sent
+	OctetCount        uint32            // Total payload octets sent
+	Reports           []ReceptionReport // Reception report blocks
+	ProfileExtensions []byte            // Profile specific extensions
+}
+
+// Marshal implements Packet.
+func (sr SenderReport) Marshal() ([]byte, error) {
+	if len(sr.ProfileExtensions)%4 != 0 {
+		return nil, ErrInvalidData
+	}
+	reports, err := marshalReports(sr.Reports)
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, 24, 24+len(reports)+len(sr.ProfileExtensions))
+	order.PutUint32(body[0:], sr.SSRC)
+	order.PutUint64(body[4:], sr.NTPTime)
+	order.PutUint32(body[12:], sr.RTPTime)
+	order.PutUint32(body[16:], sr.PacketCount)
+	order.PutUint32(body[20:], sr.OctetCount)
+	body = append(body, reports...)
+	body = append(body, sr.ProfileExtensions...)
+	return marshalPacket(TypeSenderReport, len(sr.Reports), body)
+}
+
+// Unmarshal implements Packet.
+func (sr *SenderReport) Unmarshal(buf []byte) error {
+	h, body, err := unmarshalBody(buf, TypeSenderReport)
+	if err != nil {
+		return err
+	}
+	if len(body) < 24 {
+		return ErrTruncatedPacket
+	}
+	sr.SSRC = order.Uint32(body[0:])
+	sr.NTPTime = order.Uint64(body[4:])
+	sr.RTPTime = order.Uint32(body[12:])
+	sr.PacketCount = order.Uint32(body[16:])
+	sr.OctetCount = order.Uint32(body[20:])
+	sr.Reports, body, err = unmarshalReports(body[24:], int(h.Count))
+	if err != nil {
+		return err
+	}
+	sr.ProfileExtensions = nil
+	if len(body) > 0 {
+		sr.ProfileExtensions = append([]byte(nil), body...)
+	}
+	return nil
+}
+
+// ReceiverReport is an RTCP RR packet.
+type ReceiverReport struct {
+	SSRC              uint32            // Receiver
+	Reports           []ReceptionReport // Reception report blocks
+	ProfileExtensions []byte            // Profile specific extensions
+}
+
+// Marshal implements Packet.
+func (rr ReceiverReport) Marshal() ([]byte, error) {
+	if len(rr.ProfileExtensions)%4 != 0 {
+		return nil, ErrInvalidData
+	}
+	reports, err := marshalReports(rr.Reports)
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, 4, 4+len(reports)+len(rr.ProfileExtensions))
+	order.PutUint32(body, rr.SSRC)
+	body = append(body, reports...)
+	body = append(body, rr.ProfileExtensions...)
+	return marshalPacket(TypeReceiverReport, len(rr.Reports), body)
+}
+
+// Unmarshal implements Packet.
+func (rr *ReceiverReport) Unmarshal(buf []byte) error {
+	h, body, err := unmarshalBody(buf, TypeReceiverReport)
+	if err != nil {
+		return err
+	}
+	if len(body) < 4 {
+		return ErrTruncatedPacket
+	}
+	rr.SSRC = order.Uint32(body)
+	rr.Reports, body, err = unmarshalReports(body[4:], int(h.Count))
+	if err != nil {
+		return err
+	}
+	rr.ProfileExtensions = nil
+	if len(body) > 0 {
+		rr.ProfileExtensions = append([]byte(nil), body...)
+	}
+	return nil
+}
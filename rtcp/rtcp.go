@@ -0,0 +1,257 @@
+// Package rtcp implements encoding and decoding of RTCP packets as
+// described in RFC 3550 and the feedback messages from RFC 4585.
+package rtcp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// Version is the only supported RTCP version.
+	Version = 2
+	// HeaderSize is the size of the common RTCP header.
+	HeaderSize = 4
+)
+
+// PacketType identifies the type of an RTCP packet.
+type PacketType uint8
+
+// RTCP packet types
+const (
+	TypeSenderReport       PacketType = 200
+	TypeReceiverReport     PacketType = 201
+	TypeSourceDescription  PacketType = 202
+	TypeGoodbye            PacketType = 203
+	TypeApplicationDefined PacketType = 204
+	TypeTransportFeedback  PacketType = 205
+	TypePayloadFeedback    PacketType = 206
+)
+
+// Feedback message types. These are stored in the header Count field.
+const (
+	FormatGenericNACK = 1
+	FormatPLI         = 1
+)
+
+// Errors returned when unmarshalling or marshalling packets.
+var (
+	ErrInvalidVersion  = errors.New("rtcp: invalid version")
+	ErrTruncatedPacket = errors.New("rtcp: truncated packet")
+	ErrInvalidLength   = errors.New("rtcp: invalid length")
+	ErrInvalidPadding  = errors.New("rtcp: invalid padding")
+	ErrWrongType       = errors.New("rtcp: wrong packet type")
+	ErrTooManyReports  = errors.New("rtcp: too many reports")
+	ErrTooManySources  = errors.New("rtcp: too many sources")
+	ErrInvalidItem     = errors.New("rtcp: invalid sdes item")
+	ErrInvalidName     = errors.New("rtcp: app name must be 4 bytes")
+	ErrInvalidData     = errors.New("rtcp: data must be a multiple of 4 bytes")
+	ErrReasonTooLong   = errors.New("rtcp: reason too long")
+	ErrEmptyCompound   = errors.New("rtcp: empty compound packet")
+	ErrBadFirstPacket  = errors.New("rtcp: compound packet must start with SR or RR")
+	ErrMissingCNAME    = errors.New("rtcp: compound packet missing CNAME")
+	ErrPaddingNotLast  = errors.New("rtcp: padding only allowed on the last packet")
+	ErrInvalidSubType  = errors.New("rtcp: invalid subtype")
+)
+
+var order = binary.BigEndian
+
+// Header is the common header shared by all RTCP packets.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|V=2|P|    RC   |   PT          |             length            |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type Header struct {
+	Padding bool       // Padding flag
+	Count   uint8      // Report count, source count, subtype or feedback format
+	Type    PacketType // Packet Type
+	Length  uint16     // Length in 32 bit words minus one
+}
+
+// Unmarshal decodes the header from buf.
+func (h *Header) Unmarshal(buf []byte) error {
+	if len(buf) < HeaderSize {
+		return ErrTruncatedPacket
+	}
+	if buf[0]>>6 != Version {
+		return ErrInvalidVersion
+	}
+	h.Padding = buf[0]&0x20 != 0
+	h.Count = buf[0] & 0x1F
+	h.Type = PacketType(buf[1])
+	h.Length = order.Uint16(buf[2:])
+	return nil
+}
+
+// MarshalTo encodes the header into buf.
+func (h Header) MarshalTo(buf []byte) error {
+	if len(buf) < HeaderSize {
+		return ErrTruncatedPacket
+	}
+	if h.Count > 0x1F {
+		return ErrTooManyReports
+	}
+	buf[0] = Version<<6 | h.Count
+	if h.Padding {
+		buf[0] |= 0x20
+	}
+	buf[1] = byte(h.Type)
+	order.PutUint16(buf[2:], h.Length)
+	return nil
+}
+
+// Packet is a single RTCP packet.
+type Packet interface {
+	// Marshal encodes the packet including its header.
+	Marshal() ([]byte, error)
+	// Unmarshal decodes a single packet including its header.
+	Unmarshal(buf []byte) error
+}
+
+// Unmarshal decodes a compound RTCP packet.
+// Unknown packet types are returned as *RawPacket.
+func Unmarshal(buf []byte) ([]Packet, error) {
+	var packets []Packet
+	for len(buf) > 0 {
+		var h Header
+		if err := h.Unmarshal(buf); err != nil {
+			return nil, err
+		}
+		size := (int(h.Length) + 1) * 4
+		if size > len(buf) {
+			return nil, ErrTruncatedPacket
+		}
+		if h.Padding && size != len(buf) {
+			return nil, ErrPaddingNotLast
+		}
+		p := newPacket(h)
+		if err := p.Unmarshal(buf[:size]); err != nil {
+			return nil, err
+		}
+		packets = append(packets, p)
+		buf = buf[size:]
+	}
+	return packets, nil
+}
+
+// Marshal encodes the packets into a compound RTCP packet.
+func Marshal(packets []Packet) ([]byte, error) {
+	var buf []byte
+	for _, p := range packets {
+		data, err := p.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, data...)
+	}
+	return buf, nil
+}
+
+func newPacket(h Header) Packet {
+	switch h.Type {
+	case TypeSenderReport:
+		return new(SenderReport)
+	case TypeReceiverReport:
+		return new(ReceiverReport)
+	case TypeSourceDescription:
+		return new(SourceDescription)
+	case TypeGoodbye:
+		return new(Goodbye)
+	case TypeApplicationDefined:
+		return new(ApplicationDefined)
+	case TypeTransportFeedback:
+		if h.Count == FormatGenericNACK {
+			return new(GenericNACK)
+		}
+	case TypePayloadFeedback:
+		if h.Count == FormatPLI {
+			return new(PictureLossIndication)
+		}
+	}
+	return new(RawPacket)
+}
+
+// unmarshalBody validates the header of a single packet and returns
+// it along with the body. Any padding is removed from the body.
+func unmarshalBody(buf []byte, typ PacketType) (Header, []byte, error) {
+	var h Header
+	if err := h.Unmarshal(buf); err != nil {
+		return h, nil, err
+	}
+	if h.Type != typ {
+		return h, nil, ErrWrongType
+	}
+	size := (int(h.Length) + 1) * 4
+	if size != len(buf) {
+		return h, nil, ErrInvalidLength
+	}
+	body := buf[HeaderSize:]
+	if h.Padding {
+		if len(body) == 0 {
+			return h, nil, ErrInvalidPadding
+		}
+		n := int(body[len(body)-1])
+		if n == 0 || n > len(body) {
+			return h, nil, ErrInvalidPadding
+		}
+		body = body[:len(body)-n]
+	}
+	return h, body, nil
+}
+
+// marshalPacket prepends a header to the body.
+// The body must be a multiple of 4 bytes.
+func marshalPacket(typ PacketType, count int, body []byte) ([]byte, error) {
+	if count > 0x1F {
+		return nil, ErrTooManyReports
+	}
+	if len(body)%4 != 0 {
+		return nil, ErrInvalidLength
+	}
+	buf := make([]byte, HeaderSize+len(body))
+	h := Header{
+		Count:  uint8(count),
+		Type:   typ,
+		Length: uint16(len(buf)/4 - 1),
+	}
+	if err := h.MarshalTo(buf); err != nil {
+		return nil, err
+	}
+	copy(buf[HeaderSize:], body)
+	return buf, nil
+}
+
+// pad4 pads the buffer with zeros up to a multiple of 4 bytes.
+func pad4(buf []byte) []byte {
+	for len(buf)%4 != 0 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// RawPacket is an RTCP packet of an unsupported type.
+type RawPacket []byte
+
+// Header returns the packet header.
+func (r RawPacket) Header() Header {
+	var h Header
+	_ = h.Unmarshal(r)
+	return h
+}
+
+// Marshal implements Packet.
+func (r RawPacket) Marshal() ([]byte, error) {
+	return r, nil
+}
+
+// Unmarshal implements Packet.
+func (r *RawPacket) Unmarshal(buf []byte) error {
+	var h Header
+	if err := h.Unmarshal(buf); err != nil {
+		return err
+	}
+	*r = append((*r)[:0], buf...)
+	return nil
+}
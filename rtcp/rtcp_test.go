@@ -0,0 +1,160 @@
+package rtcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/icholy/rtsp/rtp"
+	"gotest.tools/v3/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	packets := []Packet{
+		&SenderReport{
+			SSRC:        1,
+			NTPTime:     0xDA8BD1FCDDDDA05A,
+			RTPTime:     0xAAF4EDD5,
+			PacketCount: 10,
+			OctetCount:  1000,
+			Reports: []ReceptionReport{{
+				SSRC:               2,
+				FractionLost:       12,
+				TotalLost:          0x123456,
+				LastSequenceNumber: 0x10005,
+				Jitter:             33,
+				LastSenderReport:   44,
+				Delay:              55,
+			}},
+		},
+		&ReceiverReport{
+			SSRC:    3,
+			Reports: []ReceptionReport{{SSRC: 4, TotalLost: 1}},
+		},
+		&SourceDescription{
+			Chunks: []SourceDescriptionChunk{
+				{Source: 1, Items: []SourceDescriptionItem{{SDESCNAME, "camera"}}},
+				{Source: 2, Items: []SourceDescriptionItem{{SDESCNAME, "ab"}, {SDESTool, "rtsp"}}},
+			},
+		},
+		&Goodbye{Sources: []uint32{1, 2}, Reason: "shutdown"},
+		&ApplicationDefined{SubType: 3, SSRC: 1, Name: "TEST", Data: []byte{1, 2, 3, 4}},
+		&GenericNACK{SenderSSRC: 1, MediaSSRC: 2, Nacks: []NACKPair{{PacketID: 100, LostPackets: 0x5}}},
+		&PictureLossIndication{SenderSSRC: 1, MediaSSRC: 2},
+	}
+	for _, p := range packets {
+		// each packet on its own
+		buf, err := p.Marshal()
+		assert.NilError(t, err)
+		assert.Equal(t, len(buf)%4, 0)
+		decoded, err := Unmarshal(buf)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, decoded, []Packet{p})
+	}
+
+	// all together as a compound packet
+	buf, err := CompoundPacket(packets).Marshal()
+	assert.NilError(t, err)
+	var compound CompoundPacket
+	assert.NilError(t, compound.Unmarshal(buf))
+	assert.DeepEqual(t, compound, CompoundPacket(packets))
+}
+
+func TestNACKPair(t *testing.T) {
+	n := NACKPair{PacketID: 65535, LostPackets: 0x3}
+	assert.DeepEqual(t, n.SequenceNumbers(), []uint16{65535, 0, 1})
+}
+
+func TestCompoundValidate(t *testing.T) {
+	sdes := &SourceDescription{
+		Chunks: []SourceDescriptionChunk{
+			{Source: 1, Items: []SourceDescriptionItem{{SDESCNAME, "camera"}}},
+		},
+	}
+	tests := []struct {
+		name     string
+		compound CompoundPacket
+		err      error
+	}{
+		{"empty", CompoundPacket{}, ErrEmptyCompound},
+		{"first", CompoundPacket{sdes}, ErrBadFirstPacket},
+		{"cname", CompoundPacket{&ReceiverReport{SSRC: 1}}, ErrMissingCNAME},
+		{"valid", CompoundPacket{&ReceiverReport{SSRC: 1}, sdes}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.compound.Validate(), tt.err)
+		})
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	rr, err := (&ReceiverReport{SSRC: 1}).Marshal()
+	assert.NilError(t, err)
+
+	// bad version
+	bad := append([]byte(nil), rr...)
+	bad[0] = 0x40
+	_, err = Unmarshal(bad)
+	assert.Equal(t, err, ErrInvalidVersion)
+
+	// truncated
+	_, err = Unmarshal(rr[:6])
+	assert.Equal(t, err, ErrTruncatedPacket)
+
+	// padding on a packet which isn't last
+	padded := append([]byte(nil), rr...)
+	padded[0] |= 0x20
+	_, err = Unmarshal(append(padded, rr...))
+	assert.Equal(t, err, ErrPaddingNotLast)
+
+	// report count larger than the packet
+	counted := append([]byte(nil), rr...)
+	counted[0] |= 1
+	_, err = Unmarshal(counted)
+	assert.Equal(t, err, ErrTruncatedPacket)
+}
+
+func TestReceiver(t *testing.T) {
+	r := NewReceiver("test", 90000)
+	now := time.Now()
+	// wrap around the sequence numbers and lose two packets
+	for _, sn := range []uint16{65530, 65531, 65532, 65533, 65535, 0, 2, 3} {
+		r.ReceiveRTP(&rtp.Packet{SSRC: 7, SN: sn, TS: uint32(sn) * 3000}, now)
+		now = now.Add(time.Second / 30)
+	}
+	stats, ok := r.Stats(7)
+	assert.Assert(t, ok)
+	assert.Equal(t, stats.ExtendedHighestSeq, uint32(1<<16+3))
+	assert.Equal(t, stats.PacketsLost, int64(2))
+
+	report := r.Report(now)
+	assert.NilError(t, report.Validate())
+	rr := report[0].(*ReceiverReport)
+	assert.Equal(t, len(rr.Reports), 1)
+	assert.Equal(t, rr.Reports[0].SSRC, uint32(7))
+	assert.Equal(t, rr.Reports[0].TotalLost, uint32(2))
+	assert.Assert(t, rr.Reports[0].FractionLost > 0)
+
+	// the jitter is unaffected by timestamp wraparound
+	r = NewReceiver("test", 90000)
+	now = time.Now()
+	ts := uint32(0xFFFFFFFF - 3*3000)
+	for sn := uint16(0); sn < 10; sn++ {
+		r.ReceiveRTP(&rtp.Packet{SSRC: 7, SN: sn, TS: ts}, now)
+		now = now.Add(time.Second / 30)
+		ts += 3000
+	}
+	stats, _ = r.Stats(7)
+	assert.Assert(t, stats.Jitter < 1, "jitter: %v", stats.Jitter)
+
+	// sender reports map the timestamps to wall-clock time
+	_, ok = r.Time(&rtp.Packet{SSRC: 7, TS: 0})
+	assert.Assert(t, !ok)
+	ref := time.Unix(1600000000, 0)
+	sr, err := (&SenderReport{SSRC: 7, NTPTime: rtp.NTPTime(ref), RTPTime: 0xFFFFFFFF}).Marshal()
+	assert.NilError(t, err)
+	assert.NilError(t, r.ReceiveRTCP(sr, now))
+	wall, ok := r.Time(&rtp.Packet{SSRC: 7, TS: 90000 - 1})
+	assert.Assert(t, ok)
+	assert.Equal(t, wall.Sub(ref), time.Second)
+}
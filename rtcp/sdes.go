@@ -0,0 +1,122 @@
+package rtcp
+
+// SDESType is the type of a source description item.
+type SDESType uint8
+
+// Source description item types
+const (
+	SDESEnd   SDESType = 0
+	SDESCNAME SDESType = 1
+	SDESName  SDESType = 2
+	SDESEmail SDESType = 3
+	SDESPhone SDESType = 4
+	SDESLoc   SDESType = 5
+	SDESTool  SDESType = 6
+	SDESNote  SDESType = 7
+	SDESPriv  SDESType = 8
+)
+
+// SourceDescriptionItem is a single item describing a source.
+type SourceDescriptionItem struct {
+	Type SDESType
+	Text string
+}
+
+// SourceDescriptionChunk contains the items describing a single source.
+type SourceDescriptionChunk struct {
+	Source uint32
+	Items  []SourceDescriptionItem
+}
+
+// SourceDescription is an RTCP SDES packet.
+type SourceDescription struct {
+	Chunks []SourceDescriptionChunk
+}
+
+// CNAME returns the canonical name of the source if present.
+func (s SourceDescription) CNAME(source uint32) (string, bool) {
+	for _, c := range s.Chunks {
+		if c.Source != source {
+			continue
+		}
+		for _, item := range c.Items {
+			if item.Type == SDESCNAME {
+				return item.Text, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Marshal implements Packet.
+func (s SourceDescription) Marshal() ([]byte, error) {
+	if len(s.Chunks) > 0x1F {
+		return nil, ErrTooManySources
+	}
+	var body []byte
+	for _, c := range s.Chunks {
+		var ssrc [4]byte
+		order.PutUint32(ssrc[:], c.Source)
+		body = append(body, ssrc[:]...)
+		for _, item := range c.Items {
+			if item.Type == SDESEnd || len(item.Text) > 255 {
+				return nil, ErrInvalidItem
+			}
+			body = append(body, byte(item.Type), byte(len(item.Text)))
+			body = append(body, item.Text...)
+		}
+		// the item list is terminated by at least one null octet
+		body = append(body, 0)
+		body = pad4(body)
+	}
+	return marshalPacket(TypeSourceDescription, len(s.Chunks), body)
+}
+
+// Unmarshal implements Packet.
+func (s *SourceDescription) Unmarshal(buf []byte) error {
+	h, body, err := unmarshalBody(buf, TypeSourceDescription)
+	if err != nil {
+		return err
+	}
+	s.Chunks = make([]SourceDescriptionChunk, h.Count)
+	for i := range s.Chunks {
+		if len(body) < 4 {
+			return ErrTruncatedPacket
+		}
+		c := &s.Chunks[i]
+		c.Source = order.Uint32(body)
+		off := 4
+		for {
+			if off >= len(body) {
+				return ErrTruncatedPacket
+			}
+			typ := SDESType(body[off])
+			if typ == SDESEnd {
+				// skip the terminator and the padding up to the next word
+				off++
+				for off%4 != 0 {
+					off++
+				}
+				break
+			}
+			if off+2 > len(body) {
+				return ErrTruncatedPacket
+			}
+			size := int(body[off+1])
+			off += 2
+			if off+size > len(body) {
+				return ErrTruncatedPacket
+			}
+			c.Items = append(c.Items, SourceDescriptionItem{
+				Type: typ,
+				Text: string(body[off : off+size]),
+			})
+			off += size
+		}
+		if off > len(body) {
+			return ErrTruncatedPacket
+		}
+		body = body[off:]
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package rtp
+
+import (
+	"errors"
+	"time"
+)
+
+// Header extension profiles
+const (
+	// ExtensionProfileOneByte identifies RFC 8285 one-byte header extensions.
+	ExtensionProfileOneByte = 0xBEDE
+	// ExtensionProfileTwoByte identifies RFC 8285 two-byte header extensions.
+	// The lower 4 bits are application dependent.
+	ExtensionProfileTwoByte = 0x1000
+	// ExtensionProfileONVIF identifies the ONVIF replay header extension.
+	ExtensionProfileONVIF = 0xABAC
+)
+
+// Errors returned when reading or writing header extensions.
+var (
+	ErrExtensionProfile = errors.New("rtp: unsupported extension profile")
+	ErrExtensionID      = errors.New("rtp: invalid extension id")
+	ErrExtensionSize    = errors.New("rtp: invalid extension element size")
+	ErrExtensionUnknown = errors.New("rtp: extension not registered")
+)
+
+// ExtensionElement is a single RFC 8285 header extension element.
+type ExtensionElement struct {
+	ID   uint8
+	Data []byte
+}
+
+// ExtensionElements decodes the RFC 8285 header extension elements.
+// A packet without a header extension has no elements.
+func (p *Packet) ExtensionElements() ([]ExtensionElement, error) {
+	if !p.Extension() {
+		return nil, nil
+	}
+	switch {
+	case p.XH == ExtensionProfileOneByte:
+		return parseOneByte(p.XD)
+	case p.XH&0xFFF0 == ExtensionProfileTwoByte:
+		return parseTwoByte(p.XD)
+	default:
+		return nil, ErrExtensionProfile
+	}
+}
+
+// SetExtensionElements encodes the elements as an RFC 8285 header extension.
+// The one-byte format is used when all elements allow it, otherwise the
+// two-byte format is used. An empty list removes the header extension.
+func (p *Packet) SetExtensionElements(elems []ExtensionElement) error {
+	if len(elems) == 0 {
+		p.SetExtension(false)
+		p.XH, p.XL, p.XD = 0, 0, nil
+		return nil
+	}
+	oneByte := true
+	for _, e := range elems {
+		if e.ID == 0 {
+			return ErrExtensionID
+		}
+		if len(e.Data) > 255 {
+			return ErrExtensionSize
+		}
+		if e.ID > 14 || len(e.Data) == 0 || len(e.Data) > 16 {
+			oneByte = false
+		}
+	}
+	var data []byte
+	if oneByte {
+		p.XH = ExtensionProfileOneByte
+		for _, e := range elems {
+			data = append(data, e.ID<<4|byte(len(e.Data)-1))
+			data = append(data, e.Data...)
+		}
+	} else {
+		p.XH = ExtensionProfileTwoByte
+		for _, e := range elems {
+			data = append(data, e.ID, byte(len(e.Data)))
+			data = append(data, e.Data...)
+		}
+	}
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+	p.SetExtension(true)
+	p.XD = data
+	p.XL = uint16(len(data) / 4)
+	return nil
+}
+
+// ExtensionElement returns the data of the header extension element with
+// the provided id.
+func (p *Packet) ExtensionElement(id uint8) ([]byte, bool) {
+	elems, err := p.ExtensionElements()
+	if err != nil {
+		return nil, false
+	}
+	for _, e := range elems {
+		if e.ID == id {
+			return e.Data, true
+		}
+	}
+	return nil, false
+}
+
+// SetExtensionElement adds or replaces the header extension element with
+// the provided id.
+func (p *Packet) SetExtensionElement(id uint8, data []byte) error {
+	elems, err := p.ExtensionElements()
+	if err != nil {
+		return err
+	}
+	for i, e := range elems {
+		if e.ID == id {
+			elems[i].Data = data
+			return p.SetExtensionElements(elems)
+		}
+	}
+	return p.SetExtensionElements(append(elems, ExtensionElement{ID: id, Data: data}))
+}
+
+// RemoveExtensionElement removes the header extension element with the
+// provided id.
+func (p *Packet) RemoveExtensionElement(id uint8) error {
+	elems, err := p.ExtensionElements()
+	if err != nil {
+		return err
+	}
+	kept := elems[:0]
+	for _, e := range elems {
+		if e.ID != id {
+			kept = append(kept, e)
+		}
+	}
+	return p.SetExtensionElements(kept)
+}
+
+func parseOneByte(data []byte) ([]ExtensionElement, error) {
+	var elems []ExtensionElement
+	for i := 0; i < len(data); {
+		id := data[i] >> 4
+		size := int(data[i]&0x0F) + 1
+		switch id {
+		case 0:
+			// padding
+			i++
+			continue
+		case 15:
+			// reserved, stop processing
+			return elems, nil
+		}
+		i++
+		if i+size > len(data) {
+			return nil, ErrExtensionSize
+		}
+		elems = append(elems, ExtensionElement{ID: id, Data: data[i : i+size]})
+		i += size
+	}
+	return elems, nil
+}
+
+func parseTwoByte(data []byte) ([]ExtensionElement, error) {
+	var elems []ExtensionElement
+	for i := 0; i < len(data); {
+		id := data[i]
+		if id == 0 {
+			// padding
+			i++
+			continue
+		}
+		if i+2 > len(data) {
+			return nil, ErrExtensionSize
+		}
+		size := int(data[i+1])
+		i += 2
+		if i+size > len(data) {
+			return nil, ErrExtensionSize
+		}
+		elems = append(elems, ExtensionElement{ID: id, Data: data[i : i+size]})
+		i += size
+	}
+	return elems, nil
+}
+
+// Extension URIs as negotiated by the SDP extmap attribute.
+const (
+	URIAbsSendTime = "http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time"
+	URITransportCC = "http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01"
+)
+
+// HeaderExtension is a typed header extension element.
+type HeaderExtension interface {
+	// URI identifies the extension in SDP extmap attributes.
+	URI() string
+	// Marshal encodes the element data.
+	Marshal() ([]byte, error)
+	// Unmarshal decodes the element data.
+	Unmarshal(data []byte) error
+}
+
+// ExtensionMap maps extension URIs to the ids negotiated with the SDP
+// extmap attribute. ie: a=extmap:3 http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time
+type ExtensionMap map[string]uint8
+
+// Register associates the extension uri with an id.
+func (m ExtensionMap) Register(id uint8, uri string) {
+	m[uri] = id
+}
+
+// Get decodes the extension from the packet.
+// The returned bool is false when the packet doesn't contain the extension.
+func (m ExtensionMap) Get(p *Packet, ext HeaderExtension) (bool, error) {
+	id, ok := m[ext.URI()]
+	if !ok {
+		return false, ErrExtensionUnknown
+	}
+	data, ok := p.ExtensionElement(id)
+	if !ok {
+		return false, nil
+	}
+	return true, ext.Unmarshal(data)
+}
+
+// Set encodes the extension into the packet.
+func (m ExtensionMap) Set(p *Packet, ext HeaderExtension) error {
+	id, ok := m[ext.URI()]
+	if !ok {
+		return ErrExtensionUnknown
+	}
+	data, err := ext.Marshal()
+	if err != nil {
+		return err
+	}
+	return p.SetExtensionElement(id, data)
+}
+
+// AbsSendTime is the abs-send-time header extension. The timestamp is a
+// 6.18 fixed point number of seconds taken from the NTP time.
+type AbsSendTime struct {
+	Timestamp uint32
+}
+
+// NewAbsSendTime constructs an AbsSendTime from the provided time.
+func NewAbsSendTime(t time.Time) AbsSendTime {
+	return AbsSendTime{Timestamp: uint32(NTPTime(t)>>14) & 0xFFFFFF}
+}
+
+// URI implements HeaderExtension.
+func (AbsSendTime) URI() string { return URIAbsSendTime }
+
+// Marshal implements HeaderExtension.
+func (a AbsSendTime) Marshal() ([]byte, error) {
+	return []byte{byte(a.Timestamp >> 16), byte(a.Timestamp >> 8), byte(a.Timestamp)}, nil
+}
+
+// Unmarshal implements HeaderExtension.
+func (a *AbsSendTime) Unmarshal(data []byte) error {
+	if len(data) != 3 {
+		return ErrExtensionSize
+	}
+	a.Timestamp = uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2])
+	return nil
+}
+
+// TransportCC is the transport-wide congestion control header extension.
+type TransportCC struct {
+	SequenceNumber uint16
+}
+
+// URI implements HeaderExtension.
+func (TransportCC) URI() string { return URITransportCC }
+
+// Marshal implements HeaderExtension.
+func (t TransportCC) Marshal() ([]byte, error) {
+	return []byte{byte(t.SequenceNumber >> 8), byte(t.SequenceNumber)}, nil
+}
+
+// Unmarshal implements HeaderExtension.
+func (t *TransportCC) Unmarshal(data []byte) error {
+	if len(data) != 2 {
+		return ErrExtensionSize
+	}
+	t.SequenceNumber = order.Uint16(data)
+	return nil
+}
+
+// ONVIFReplay is the header extension used by ONVIF replay servers
+// for recorded playback. Unlike RFC 8285 extensions, it occupies the
+// entire header extension using the 0xABAC profile.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|            0xABAC             |        length=3               |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                          NTP timestamp...                     |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                          ...NTP timestamp                     |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|C|E|D|T|mbz    |  CSeq         |        padding                |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type ONVIFReplay struct {
+	NTP           uint64 // NTP timestamp of the recorded frame
+	CleanPoint    bool   // C: the access unit is a key frame
+	End           bool   // E: last access unit of a contiguous section
+	Discontinuity bool   // D: data is missing before this access unit
+	Terminate     bool   // T: last access unit of the replay
+	CSeq          uint8  // low byte of the PLAY request CSeq
+}
+
+// Time returns the NTP timestamp as wall-clock time.
+func (r ONVIFReplay) Time() time.Time {
+	return NTPToTime(r.NTP)
+}
+
+// ONVIFReplay decodes the ONVIF replay header extension.
+// The returned bool is false when the packet doesn't contain one.
+func (p *Packet) ONVIFReplay() (ONVIFReplay, bool) {
+	if !p.Extension() || p.XH != ExtensionProfileONVIF || len(p.XD) < 12 {
+		return ONVIFReplay{}, false
+	}
+	flags := p.XD[8]
+	return ONVIFReplay{
+		NTP:           order.Uint64(p.XD),
+		CleanPoint:    flags&0x80 != 0,
+		End:           flags&0x40 != 0,
+		Discontinuity: flags&0x20 != 0,
+		Terminate:     flags&0x10 != 0,
+		CSeq:          p.XD[9],
+	}, true
+}
+
+// SetONVIFReplay encodes the ONVIF replay header extension into the packet.
+// This replaces any existing header extension.
+func (p *Packet) SetONVIFReplay(r ONVIFReplay) {
+	data := make([]byte, 12)
+	order.PutUint64(data, r.NTP)
+	data[8] = flag(r.CleanPoint, 0x80) | flag(r.End, 0x40) |
+		flag(r.Discontinuity, 0x20) | flag(r.Terminate, 0x10)
+	data[9] = r.CSeq
+	p.SetExtension(true)
+	p.XH = ExtensionProfileONVIF
+	p.XL = 3
+	p.XD = data
+}
+
+func flag(v bool, mask byte) byte {
+	return setBit(0, mask, v)
+}
@@ -0,0 +1,275 @@
+package rtp
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultJitterBufferSize is the default number of packets a
+// JitterBuffer can hold.
+const DefaultJitterBufferSize = 512
+
+// MaxJitterBufferSize is the largest number of packets a JitterBuffer can
+// hold. Larger windows make sequence number comparisons ambiguous.
+const MaxJitterBufferSize = 1 << 15
+
+// ErrJitterBufferSize is returned for sizes outside 1 to MaxJitterBufferSize.
+var ErrJitterBufferSize = errors.New("rtp: invalid jitter buffer size")
+
+// Loss describes a gap of missing packets skipped by a JitterBuffer.
+type Loss struct {
+	SN    uint16 // first missing sequence number
+	Count int    // number of missing packets
+}
+
+// JitterBufferStats contains counters maintained by a JitterBuffer.
+type JitterBufferStats struct {
+	Received   int
+	Duplicates int
+	Late       int
+	Lost       int
+	Reordered  int
+}
+
+type jitterEntry struct {
+	packet  *Packet
+	arrival time.Time
+}
+
+// JitterBuffer reorders the packets of a single SSRC by sequence number.
+// Packets are released in order once the next packet is available or the
+// oldest buffered packet has waited for the latency budget, in which case
+// the missing packets are reported as lost. Receiving a packet with a
+// different SSRC resets the buffer, and so do two sequential packets far
+// behind the expected sequence number.
+type JitterBuffer struct {
+	// Latency is how long a packet is held while waiting for missing ones.
+	Latency time.Duration
+	// OnLoss is called when missing packets are skipped.
+	OnLoss func(Loss)
+	// OnKeyframeRequest is called after a loss, and then not again until
+	// KeyframeReceived is called. Video applications use this to send a
+	// PLI or FIR to the sender.
+	OnKeyframeRequest func()
+
+	slots     []jitterEntry
+	mask      uint16
+	count     int
+	started   bool
+	ssrc      uint32
+	next      uint16
+	highest   uint16
+	ready     []*Packet
+	requested bool
+	stats     JitterBufferStats
+
+	// restart detection
+	restarting bool
+	restartSN  uint16
+}
+
+// NewJitterBuffer constructs a JitterBuffer with the provided latency budget.
+func NewJitterBuffer(latency time.Duration) *JitterBuffer {
+	j, _ := NewJitterBufferSize(latency, DefaultJitterBufferSize)
+	return j
+}
+
+// NewJitterBufferSize constructs a JitterBuffer which holds at most size
+// packets. The size is rounded up to a power of two so that the slots
+// stay aligned across sequence number wraparound.
+func NewJitterBufferSize(latency time.Duration, size int) (*JitterBuffer, error) {
+	if size <= 0 || size > MaxJitterBufferSize {
+		return nil, ErrJitterBufferSize
+	}
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	return &JitterBuffer{
+		Latency: latency,
+		slots:   make([]jitterEntry, n),
+		mask:    uint16(n - 1),
+	}, nil
+}
+
+// Stats returns the buffer counters.
+func (j *JitterBuffer) Stats() JitterBufferStats {
+	return j.stats
+}
+
+// Len returns the number of buffered packets.
+func (j *JitterBuffer) Len() int {
+	return j.count + len(j.ready)
+}
+
+// KeyframeReceived re-arms OnKeyframeRequest.
+func (j *JitterBuffer) KeyframeReceived() {
+	j.requested = false
+}
+
+// Reset discards all buffered packets.
+func (j *JitterBuffer) Reset() {
+	for i := range j.slots {
+		j.slots[i] = jitterEntry{}
+	}
+	j.count = 0
+	j.ready = nil
+	j.started = false
+	j.restarting = false
+}
+
+func (j *JitterBuffer) slot(sn uint16) *jitterEntry {
+	return &j.slots[sn&j.mask]
+}
+
+// Push adds a packet to the buffer. It returns false if the packet was
+// dropped because it's a duplicate or arrived after its slot was released.
+func (j *JitterBuffer) Push(p *Packet, arrival time.Time) bool {
+	if j.started && p.SSRC != j.ssrc {
+		j.Reset()
+	}
+	if !j.started {
+		j.started = true
+		j.ssrc = p.SSRC
+		j.next = p.SN
+		j.highest = p.SN
+	}
+	j.stats.Received++
+	d := int16(p.SN - j.next)
+	if d < 0 {
+		if !j.restarted(p.SN, int(-d)) {
+			j.stats.Late++
+			return false
+		}
+		// release everything and continue from the new sequence number
+		for j.count > 0 {
+			j.skip()
+		}
+		j.next = p.SN
+		j.highest = p.SN
+		d = 0
+	}
+	j.restarting = false
+	// the packet is too far ahead, release everything and
+	// treat the packets in between as lost
+	if int(d) >= len(j.slots) {
+		for j.count > 0 {
+			j.skip()
+		}
+		j.lose(j.next, int(uint16(p.SN-j.next)))
+		j.next = p.SN
+	}
+	s := j.slot(p.SN)
+	if s.packet != nil {
+		j.stats.Duplicates++
+		return false
+	}
+	if int16(p.SN-j.highest) < 0 {
+		j.stats.Reordered++
+	} else {
+		j.highest = p.SN
+	}
+	*s = jitterEntry{packet: p, arrival: arrival}
+	j.count++
+	return true
+}
+
+// restarted returns true when the packet is the second of two sequential
+// packets which are further behind than the buffer size. Those indicate
+// that the sender restarted its sequence numbers rather than late arrivals.
+func (j *JitterBuffer) restarted(sn uint16, behind int) bool {
+	if behind < len(j.slots) {
+		return false
+	}
+	if j.restarting && sn == j.restartSN {
+		j.restarting = false
+		return true
+	}
+	j.restarting = true
+	j.restartSN = sn + 1
+	return false
+}
+
+// Pop returns the next packet in sequence order when it's available or
+// when the latency budget of the oldest buffered packet has elapsed.
+func (j *JitterBuffer) Pop(now time.Time) (*Packet, bool) {
+	if len(j.ready) > 0 {
+		p := j.ready[0]
+		j.ready = j.ready[1:]
+		return p, true
+	}
+	if j.count == 0 {
+		return nil, false
+	}
+	if p, ok := j.take(); ok {
+		return p, true
+	}
+	deadline, ok := j.Deadline()
+	if !ok || now.Before(deadline) {
+		return nil, false
+	}
+	// give up on the missing packets
+	j.skip()
+	return j.take()
+}
+
+// Deadline returns the time at which the buffer will give up waiting
+// for missing packets. The returned bool is false when there's nothing
+// to wait for.
+func (j *JitterBuffer) Deadline() (time.Time, bool) {
+	var oldest time.Time
+	found := false
+	for i, sn := 0, j.next; i < len(j.slots); i, sn = i+1, sn+1 {
+		s := j.slot(sn)
+		if s.packet != nil && (!found || s.arrival.Before(oldest)) {
+			oldest = s.arrival
+			found = true
+		}
+	}
+	if !found {
+		return time.Time{}, false
+	}
+	return oldest.Add(j.Latency), true
+}
+
+// take removes and returns the next packet if it's present.
+func (j *JitterBuffer) take() (*Packet, bool) {
+	s := j.slot(j.next)
+	if s.packet == nil {
+		return nil, false
+	}
+	p := s.packet
+	*s = jitterEntry{}
+	j.count--
+	j.next++
+	return p, true
+}
+
+// skip advances past the next sequence number. A buffered packet is
+// moved to the ready queue, otherwise the missing packets up to the next
+// buffered one are reported as lost.
+func (j *JitterBuffer) skip() {
+	if p, ok := j.take(); ok {
+		j.ready = append(j.ready, p)
+		return
+	}
+	start := j.next
+	for j.slot(j.next).packet == nil {
+		j.next++
+	}
+	j.lose(start, int(j.next-start))
+}
+
+func (j *JitterBuffer) lose(sn uint16, count int) {
+	if count <= 0 {
+		return
+	}
+	j.stats.Lost += count
+	if j.OnLoss != nil {
+		j.OnLoss(Loss{SN: sn, Count: count})
+	}
+	if !j.requested && j.OnKeyframeRequest != nil {
+		j.requested = true
+		j.OnKeyframeRequest()
+	}
+}
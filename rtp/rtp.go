@@ -11,21 +11,35 @@ const (
 	RtpVersion = 2 << 6
 	// HeaderSize defines the size of the fixed part of the packet, up to and inclding SSRC.
 	HeaderSize = 12
+	// MaxCSRC is the maximum number of contributing sources a packet can hold.
+	MaxCSRC = 15
+)
+
+// Errors returned when unmarshalling or marshalling a packet.
+var (
+	ErrInvalidVersion     = errors.New("rtp: invalid version")
+	ErrTruncatedHeader    = errors.New("rtp: truncated header")
+	ErrInvalidCSRCCount   = errors.New("rtp: invalid csrc count")
+	ErrTruncatedExtension = errors.New("rtp: truncated extension")
+	ErrInvalidExtension   = errors.New("rtp: invalid extension length")
+	ErrInvalidPadding     = errors.New("rtp: invalid padding")
+	ErrShortBuffer        = errors.New("rtp: short buffer")
 )
 
 // Packet encapsulates RTP packet structure.
-//  0                   1                   2                   3
-//  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
-// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-// |V=2|P|X|  CC   |M|     PT      |       sequence number         |
-// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-// |                           timestamp                           |
-// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-// |           synchronization source (SSRC) identifier            |
-// +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
-// |            contributing source (CSRC) identifiers             |
-// |                             ....                              |
-// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|V=2|P|X|  CC   |M|     PT      |       sequence number         |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                           timestamp                           |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|           synchronization source (SSRC) identifier            |
+//	+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+//	|            contributing source (CSRC) identifiers             |
+//	|                             ....                              |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 type Packet struct {
 	VPXCC   byte     // Version, Padding, Extension, Contributing Source Count
 	MPT     byte     // Marker, Payload Type
@@ -37,47 +51,159 @@ type Packet struct {
 	XL      uint16   // Extension Length (in `uint`s not inclusing this header)
 	XD      []byte   // Extension Data
 	Payload []byte   // Payload
+	PL      byte     // Padding Length (in bytes including the trailing count byte)
 }
 
 var order = binary.BigEndian
 
 // Parse validates a packed RTP packet and converts it into a sparse structure.
 func Parse(buf []byte) (*Packet, error) {
-	if (buf[0] & 0xC0) != RtpVersion {
-		return nil, errors.New("Invalid version of RTP packet")
+	packet := &Packet{}
+	if err := packet.Unmarshal(buf); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// Unmarshal validates a packed RTP packet and decodes it into p.
+// The Payload and XD fields reference buf rather than copying it, and the
+// CSRC slice is reused when it has enough capacity. Reusing a Packet across
+// calls allows parsing without allocating.
+func (p *Packet) Unmarshal(buf []byte) error {
+	if len(buf) < HeaderSize {
+		return ErrTruncatedHeader
 	}
-	packet := &Packet{
-		VPXCC: buf[0],
-		MPT:   buf[1],
-		SN:    order.Uint16(buf[2:]),
-		TS:    order.Uint32(buf[4:]),
-		SSRC:  order.Uint32(buf[8:]),
+	if (buf[0] & 0xC0) != RtpVersion {
+		return ErrInvalidVersion
 	}
+	p.VPXCC = buf[0]
+	p.MPT = buf[1]
+	p.SN = order.Uint16(buf[2:])
+	p.TS = order.Uint32(buf[4:])
+	p.SSRC = order.Uint32(buf[8:])
+	p.XH, p.XL, p.XD = 0, 0, nil
+	p.PL = 0
 
 	off := HeaderSize
-	packet.CSRC = make([]uint32, packet.ContributingCount())
-	for i := range packet.CSRC {
-		packet.CSRC[i] = order.Uint32(buf[off:])
+	cc := p.ContributingCount()
+	if len(buf) < off+cc*4 {
+		return ErrInvalidCSRCCount
+	}
+	if cap(p.CSRC) >= cc {
+		p.CSRC = p.CSRC[:cc]
+	} else {
+		p.CSRC = make([]uint32, cc)
+	}
+	for i := range p.CSRC {
+		p.CSRC[i] = order.Uint32(buf[off:])
 		off += 4
 	}
 
-	if packet.Extension() {
-		packet.XH = order.Uint16(buf[off:])
-		packet.XL = order.Uint16(buf[off+2:])
+	if p.Extension() {
+		if len(buf) < off+4 {
+			return ErrTruncatedExtension
+		}
+		p.XH = order.Uint16(buf[off:])
+		p.XL = order.Uint16(buf[off+2:])
 		off += 4
-		if packet.XL > 0 {
-			packet.XD = buf[off : off+int(packet.XL)*4]
-			off += int(packet.XL) * 4
+		n := int(p.XL) * 4
+		if len(buf) < off+n {
+			return ErrTruncatedExtension
+		}
+		if n > 0 {
+			p.XD = buf[off : off+n]
+			off += n
 		}
 	}
 
-	packet.Payload = buf[off:]
+	end := len(buf)
+	if p.Padding() {
+		if end == off {
+			return ErrInvalidPadding
+		}
+		p.PL = buf[end-1]
+		if p.PL == 0 || int(p.PL) > end-off {
+			return ErrInvalidPadding
+		}
+		end -= int(p.PL)
+	}
 
-	//s.rtpChan <- packet
-	return packet, nil
+	p.Payload = buf[off:end]
+	return nil
+}
+
+// MarshalSize returns the number of bytes required to marshal the packet.
+func (p *Packet) MarshalSize() int {
+	n := HeaderSize + len(p.CSRC)*4
+	if p.Extension() {
+		n += 4 + len(p.XD)
+	}
+	n += len(p.Payload)
+	if p.Padding() {
+		n += int(p.PL)
+	}
+	return n
+}
+
+// Marshal encodes the packet into a newly allocated buffer.
+func (p *Packet) Marshal() ([]byte, error) {
+	buf := make([]byte, p.MarshalSize())
+	n, err := p.MarshalTo(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
 }
 
-// Time returns Timestamp value
+// MarshalTo encodes the packet into buf and returns the number of bytes written.
+// The contributing source count and extension length are derived from the
+// CSRC and XD fields.
+func (p *Packet) MarshalTo(buf []byte) (int, error) {
+	if len(p.CSRC) > MaxCSRC {
+		return 0, ErrInvalidCSRCCount
+	}
+	if p.Extension() && len(p.XD)%4 != 0 {
+		return 0, ErrInvalidExtension
+	}
+	if p.Padding() && p.PL == 0 {
+		return 0, ErrInvalidPadding
+	}
+	size := p.MarshalSize()
+	if len(buf) < size {
+		return 0, ErrShortBuffer
+	}
+	buf[0] = RtpVersion | (p.VPXCC & 0x30) | byte(len(p.CSRC))
+	buf[1] = p.MPT
+	order.PutUint16(buf[2:], p.SN)
+	order.PutUint32(buf[4:], p.TS)
+	order.PutUint32(buf[8:], p.SSRC)
+	off := HeaderSize
+	for _, csrc := range p.CSRC {
+		order.PutUint32(buf[off:], csrc)
+		off += 4
+	}
+	if p.Extension() {
+		order.PutUint16(buf[off:], p.XH)
+		order.PutUint16(buf[off+2:], uint16(len(p.XD)/4))
+		off += 4
+		off += copy(buf[off:], p.XD)
+	}
+	off += copy(buf[off:], p.Payload)
+	if p.Padding() {
+		for i := 0; i < int(p.PL)-1; i++ {
+			buf[off] = 0
+			off++
+		}
+		buf[off] = p.PL
+		off++
+	}
+	return off, nil
+}
+
+// Time returns Timestamp value interpreted as Unix seconds.
+//
+// Deprecated: RTP timestamps are in clock rate units with a random offset.
+// Use a Clock to convert them into wall-clock time.
 func (p Packet) Time() time.Time {
 	return time.Unix(int64(p.TS), 0)
 }
@@ -87,11 +213,23 @@ func (p Packet) Padding() bool {
 	return (p.VPXCC & 0x20) != 0
 }
 
+// SetPadding sets the Padding flag and padding length of the packet.
+// A zero length clears the flag.
+func (p *Packet) SetPadding(length byte) {
+	p.PL = length
+	p.VPXCC = setBit(p.VPXCC, 0x20, length > 0)
+}
+
 // Extension returns Extension flag value of the packet.
 func (p Packet) Extension() bool {
 	return (p.VPXCC & 0x10) != 0
 }
 
+// SetExtension sets the Extension flag value of the packet.
+func (p *Packet) SetExtension(x bool) {
+	p.VPXCC = setBit(p.VPXCC, 0x10, x)
+}
+
 // ContributingCount returns Contributing Source Count of the packet.
 func (p Packet) ContributingCount() int {
 	return int(p.VPXCC & 0x0F)
@@ -102,7 +240,24 @@ func (p Packet) Marker() bool {
 	return (p.MPT & 0x80) != 0
 }
 
+// SetMarker sets the Marker value of the packet.
+func (p *Packet) SetMarker(m bool) {
+	p.MPT = setBit(p.MPT, 0x80, m)
+}
+
 // PayloadType returns Payload Type of the packet.
 func (p Packet) PayloadType() int {
 	return int(p.MPT & 0x7F)
 }
+
+// SetPayloadType sets the Payload Type of the packet.
+func (p *Packet) SetPayloadType(pt int) {
+	p.MPT = (p.MPT & 0x80) | byte(pt&0x7F)
+}
+
+func setBit(b, mask byte, v bool) byte {
+	if v {
+		return b | mask
+	}
+	return b &^ mask
+}
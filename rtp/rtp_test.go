@@ -0,0 +1,241 @@
+package rtp
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPacketMarshal(t *testing.T) {
+	p := &Packet{
+		SN:      1234,
+		TS:      90000,
+		SSRC:    0xDEADBEEF,
+		CSRC:    []uint32{1, 2},
+		XH:      0xBEDE,
+		XD:      []byte{0x10, 0xAA, 0, 0},
+		Payload: []byte("hello"),
+	}
+	p.SetMarker(true)
+	p.SetPayloadType(96)
+	p.SetExtension(true)
+	p.SetPadding(3)
+
+	// encode it
+	buf, err := p.Marshal()
+	assert.NilError(t, err)
+	assert.Equal(t, len(buf), p.MarshalSize())
+
+	// decode it
+	p2, err := Parse(buf)
+	assert.NilError(t, err)
+	assert.Equal(t, p2.ContributingCount(), 2)
+	assert.Equal(t, p2.XL, uint16(1))
+	assert.Equal(t, p2.PayloadType(), 96)
+	assert.Assert(t, p2.Marker())
+	assert.DeepEqual(t, p2.CSRC, p.CSRC)
+	assert.DeepEqual(t, p2.XD, p.XD)
+	assert.DeepEqual(t, p2.Payload, p.Payload)
+	assert.Equal(t, p2.PL, byte(3))
+}
+
+func TestPacketUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+		err  error
+	}{
+		{"empty", nil, ErrTruncatedHeader},
+		{"short", []byte{0x80, 0, 0, 0}, ErrTruncatedHeader},
+		{"version", make([]byte, 12), ErrInvalidVersion},
+		{"csrc", []byte{0x82, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, ErrInvalidCSRCCount},
+		{"extension", []byte{0x90, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xBE, 0xDE, 0, 1}, ErrTruncatedExtension},
+		{"padding", []byte{0xA0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xFF, 5}, ErrInvalidPadding},
+		{"zero padding", []byte{0xA0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, ErrInvalidPadding},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Packet
+			assert.Equal(t, p.Unmarshal(tt.buf), tt.err)
+		})
+	}
+}
+
+func TestExtensionElements(t *testing.T) {
+	var p Packet
+	assert.NilError(t, p.SetExtensionElement(1, []byte{1, 2, 3}))
+	assert.NilError(t, p.SetExtensionElement(2, []byte{4}))
+	assert.Equal(t, p.XH, uint16(ExtensionProfileOneByte))
+
+	// round trip through the wire format
+	buf, err := p.Marshal()
+	assert.NilError(t, err)
+	p2, err := Parse(buf)
+	assert.NilError(t, err)
+	data, ok := p2.ExtensionElement(1)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, data, []byte{1, 2, 3})
+
+	// ids above 14 require the two-byte format
+	assert.NilError(t, p2.SetExtensionElement(20, []byte{5, 6}))
+	assert.Equal(t, p2.XH, uint16(ExtensionProfileTwoByte))
+	data, ok = p2.ExtensionElement(2)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, data, []byte{4})
+
+	// typed extensions
+	m := ExtensionMap{}
+	m.Register(3, URITransportCC)
+	assert.NilError(t, m.Set(p2, &TransportCC{SequenceNumber: 42}))
+	var cc TransportCC
+	ok, err = m.Get(p2, &cc)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.Equal(t, cc.SequenceNumber, uint16(42))
+}
+
+func TestONVIFReplay(t *testing.T) {
+	now := time.Unix(1600000000, 500000000)
+	var p Packet
+	p.SetONVIFReplay(ONVIFReplay{NTP: NTPTime(now), CleanPoint: true, CSeq: 7})
+	buf, err := p.Marshal()
+	assert.NilError(t, err)
+	p2, err := Parse(buf)
+	assert.NilError(t, err)
+	r, ok := p2.ONVIFReplay()
+	assert.Assert(t, ok)
+	assert.Assert(t, r.CleanPoint)
+	assert.Assert(t, !r.Discontinuity)
+	assert.Equal(t, r.CSeq, uint8(7))
+	assert.Assert(t, r.Time().Sub(now) < time.Microsecond)
+}
+
+func TestUnmarshalAllocs(t *testing.T) {
+	buf, err := (&Packet{
+		SN:      1,
+		CSRC:    []uint32{1, 2, 3},
+		Payload: make([]byte, 1400),
+	}).Marshal()
+	assert.NilError(t, err)
+	var p Packet
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := p.Unmarshal(buf); err != nil {
+			t.Fatal(err)
+		}
+	})
+	assert.Equal(t, allocs, float64(0))
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	buf, err := (&Packet{
+		SN:      1,
+		CSRC:    []uint32{1, 2, 3},
+		Payload: make([]byte, 1400),
+	}).Marshal()
+	assert.NilError(b, err)
+	var p Packet
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := p.Unmarshal(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestClock(t *testing.T) {
+	ref := time.Unix(1600000000, 0)
+	c := NewClock(90000)
+	_, ok := c.Time(0)
+	assert.Assert(t, !ok)
+
+	// the reference timestamp is just before the wrap
+	c.Sync(NTPTime(ref), 0xFFFFFFFF-45000+1)
+	ts, ok := c.Time(45000)
+	assert.Assert(t, ok)
+	assert.Equal(t, ts.Sub(ref), time.Second)
+	ts, _ = c.Time(0xFFFFFFFF - 90000 + 1)
+	assert.Equal(t, ts.Sub(ref), -time.Second/2)
+
+	// unwrapping
+	assert.Equal(t, c.Unwrap(0xFFFFFF00), int64(0xFFFFFF00))
+	assert.Equal(t, c.Unwrap(0x00000100), int64(1<<32+0x100))
+	assert.Equal(t, c.Unwrap(0xFFFFFFF0), int64(0xFFFFFFF0))
+	assert.Equal(t, c.Unwrap(0x00000200), int64(1<<32+0x200))
+}
+
+func TestJitterBuffer(t *testing.T) {
+	now := time.Now()
+	var losses []Loss
+	var requests int
+	jb, err := NewJitterBufferSize(100*time.Millisecond, 16)
+	assert.NilError(t, err)
+	jb.OnLoss = func(l Loss) { losses = append(losses, l) }
+	jb.OnKeyframeRequest = func() { requests++ }
+
+	pop := func() []uint16 {
+		var sns []uint16
+		for {
+			p, ok := jb.Pop(now)
+			if !ok {
+				return sns
+			}
+			sns = append(sns, p.SN)
+		}
+	}
+
+	// reordered across the wrap with a duplicate
+	for _, sn := range []uint16{65534, 0, 65535} {
+		assert.Assert(t, jb.Push(&Packet{SN: sn}, now))
+	}
+	assert.Assert(t, !jb.Push(&Packet{SN: 0}, now))
+	assert.DeepEqual(t, pop(), []uint16{65534, 65535, 0})
+
+	// a gap is held until the latency expires
+	assert.Assert(t, jb.Push(&Packet{SN: 3}, now))
+	assert.DeepEqual(t, pop(), []uint16(nil))
+	now = now.Add(100 * time.Millisecond)
+	assert.DeepEqual(t, pop(), []uint16{3})
+	assert.DeepEqual(t, losses, []Loss{{SN: 1, Count: 2}})
+	assert.Equal(t, requests, 1)
+
+	// late packets are dropped
+	assert.Assert(t, !jb.Push(&Packet{SN: 2}, now))
+
+	// jumping past the buffer size
+	assert.Assert(t, jb.Push(&Packet{SN: 100}, now))
+	assert.DeepEqual(t, pop(), []uint16{100})
+	assert.DeepEqual(t, losses[1], Loss{SN: 4, Count: 96})
+	assert.Equal(t, requests, 1)
+
+	stats := jb.Stats()
+	assert.Equal(t, stats.Duplicates, 1)
+	assert.Equal(t, stats.Late, 1)
+	assert.Equal(t, stats.Lost, 98)
+
+	// a sender restart far behind is detected after two sequential packets
+	assert.Assert(t, !jb.Push(&Packet{SN: 10}, now))
+	assert.Assert(t, jb.Push(&Packet{SN: 11}, now))
+	assert.Assert(t, jb.Push(&Packet{SN: 12}, now))
+	assert.DeepEqual(t, pop(), []uint16{11, 12})
+}
+
+func TestJitterBufferSize(t *testing.T) {
+	_, err := NewJitterBufferSize(time.Second, 0)
+	assert.Equal(t, err, ErrJitterBufferSize)
+	_, err = NewJitterBufferSize(time.Second, -1)
+	assert.Equal(t, err, ErrJitterBufferSize)
+
+	// 500 doesn't divide 65536, the slots must stay aligned across the wrap
+	now := time.Now()
+	jb, err := NewJitterBufferSize(time.Second, 500)
+	assert.NilError(t, err)
+	assert.Equal(t, len(jb.slots), 512)
+	assert.Assert(t, jb.Push(&Packet{SN: 65535}, now))
+	assert.Assert(t, jb.Push(&Packet{SN: 35}, now))
+	p, ok := jb.Pop(now)
+	assert.Assert(t, ok)
+	assert.Equal(t, p.SN, uint16(65535))
+	assert.Equal(t, jb.Stats().Duplicates, 0)
+}
@@ -0,0 +1,36 @@
+package rtp
+
+import "math/rand"
+
+// Sequencer fills in the header of outgoing packets. The sequence
+// number is incremented for every packet.
+type Sequencer struct {
+	PayloadType int
+	SSRC        uint32
+	SN          uint16
+}
+
+// NewSequencer constructs a Sequencer with a random SSRC and initial
+// sequence number as recommended by RFC 3550.
+func NewSequencer(pt int) *Sequencer {
+	return &Sequencer{
+		PayloadType: pt,
+		SSRC:        rand.Uint32(),
+		SN:          uint16(rand.Uint32()),
+	}
+}
+
+// Packet constructs the next packet.
+func (s *Sequencer) Packet(ts uint32, marker bool, payload []byte) *Packet {
+	p := &Packet{
+		VPXCC:   RtpVersion,
+		SN:      s.SN,
+		TS:      ts,
+		SSRC:    s.SSRC,
+		Payload: payload,
+	}
+	p.SetPayloadType(s.PayloadType)
+	p.SetMarker(marker)
+	s.SN++
+	return p
+}
@@ -0,0 +1,106 @@
+package rtp
+
+import "time"
+
+// ntpEpochOffset is the number of seconds between 1900 and 1970.
+const ntpEpochOffset = 2208988800
+
+// NTPTime converts the time into a 64 bit NTP timestamp.
+func NTPTime(t time.Time) uint64 {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return sec<<32 | frac
+}
+
+// NTPToTime converts a 64 bit NTP timestamp into a time.
+func NTPToTime(ntp uint64) time.Time {
+	sec := int64(ntp >> 32)
+	nsec := int64((ntp & 0xFFFFFFFF) * uint64(time.Second) >> 32)
+	return time.Unix(sec-ntpEpochOffset, nsec)
+}
+
+// Clock converts RTP timestamps into wall-clock time. RTP timestamps are
+// in clock rate units and start at a random offset, so a reference pair
+// mapping an NTP time to an RTP timestamp is required. This pair usually
+// comes from an RTCP sender report. The rtcp.Receiver maintains a Clock
+// for every source which sends reports.
+type Clock struct {
+	rate   int
+	synced bool
+	ntp    time.Time
+	rtp    uint32
+
+	// timestamp unwrapping
+	started bool
+	last    uint32
+	cycles  int64
+}
+
+// NewClock constructs a Clock using the media clock rate from the SDP rtpmap.
+func NewClock(rate int) *Clock {
+	return &Clock{rate: rate}
+}
+
+// Rate returns the clock rate.
+func (c *Clock) Rate() int {
+	return c.rate
+}
+
+// Sync sets the reference pair from an RTCP sender report.
+// Servers which never send sender reports can be approximated by
+// calling Sync with the local time of the first packet.
+func (c *Clock) Sync(ntp uint64, rtp uint32) {
+	c.synced = true
+	c.ntp = NTPToTime(ntp)
+	c.rtp = rtp
+}
+
+// Synced returns true once a reference pair has been set.
+func (c *Clock) Synced() bool {
+	return c.synced
+}
+
+// Time converts the RTP timestamp into a wall-clock time. The timestamp
+// is interpreted relative to the reference pair as a signed 32 bit
+// difference, which handles wraparound. The returned bool is false when
+// no reference pair has been set.
+func (c *Clock) Time(ts uint32) (time.Time, bool) {
+	if !c.synced || c.rate <= 0 {
+		return time.Time{}, false
+	}
+	return c.ntp.Add(c.Duration(int64(int32(ts - c.rtp)))), true
+}
+
+// Duration converts a number of clock rate units into a duration.
+func (c *Clock) Duration(units int64) time.Duration {
+	if c.rate <= 0 {
+		return 0
+	}
+	sec := units / int64(c.rate)
+	rem := units % int64(c.rate)
+	return time.Duration(sec)*time.Second + time.Duration(rem)*time.Second/time.Duration(c.rate)
+}
+
+// Unwrap extends the 32 bit RTP timestamp into a 64 bit timestamp which
+// keeps increasing across wraparound. Timestamps must be passed in
+// approximately arrival order.
+func (c *Clock) Unwrap(ts uint32) int64 {
+	if !c.started {
+		c.started = true
+		c.last = ts
+		return int64(ts)
+	}
+	diff := int32(ts - c.last)
+	switch {
+	case diff > 0 && ts < c.last:
+		// wrapped forward
+		c.cycles++
+	case diff < 0 && ts > c.last:
+		// reordered across the wrap
+		return (c.cycles-1)<<32 + int64(ts)
+	}
+	if diff > 0 {
+		c.last = ts
+	}
+	return c.cycles<<32 + int64(ts)
+}
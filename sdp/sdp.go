@@ -0,0 +1,381 @@
+// Package sdp implements parsing and encoding of the Session Description
+// Protocol (RFC 4566) as used by RTSP DESCRIBE and ANNOUNCE.
+package sdp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Attribute is an a= line. Flag attributes have an empty Value.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// String returns the attribute in the a= line format without the prefix.
+func (a Attribute) String() string {
+	if a.Value == "" {
+		return a.Key
+	}
+	return a.Key + ":" + a.Value
+}
+
+// Session is a parsed session description.
+type Session struct {
+	Version    int
+	Origin     string
+	Name       string
+	Info       string
+	URI        string
+	Connection string
+	Bandwidth  []string
+	Timing     []string
+	Attributes []Attribute
+	Media      []*Media
+}
+
+// Media is a media description. ie: m=video 0 RTP/AVP 96
+type Media struct {
+	Type       string
+	Port       int
+	Proto      string
+	Formats    []string
+	Info       string
+	Connection string
+	Bandwidth  []string
+	Attributes []Attribute
+}
+
+// Parse parses the session description.
+func Parse(data []byte) (*Session, error) {
+	s := &Session{}
+	var m *Media
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return nil, fmt.Errorf("sdp: invalid line: %q", line)
+		}
+		typ, value := line[0], line[2:]
+		if typ == 'm' {
+			var err error
+			m, err = parseMedia(value)
+			if err != nil {
+				return nil, err
+			}
+			s.Media = append(s.Media, m)
+			continue
+		}
+		if m != nil {
+			switch typ {
+			case 'i':
+				m.Info = value
+			case 'c':
+				m.Connection = value
+			case 'b':
+				m.Bandwidth = append(m.Bandwidth, value)
+			case 'a':
+				m.Attributes = append(m.Attributes, parseAttribute(value))
+			}
+			continue
+		}
+		switch typ {
+		case 'v':
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("sdp: invalid version: %q", value)
+			}
+			s.Version = v
+		case 'o':
+			s.Origin = value
+		case 's':
+			s.Name = value
+		case 'i':
+			s.Info = value
+		case 'u':
+			s.URI = value
+		case 'c':
+			s.Connection = value
+		case 'b':
+			s.Bandwidth = append(s.Bandwidth, value)
+		case 't':
+			s.Timing = append(s.Timing, value)
+		case 'a':
+			s.Attributes = append(s.Attributes, parseAttribute(value))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func parseMedia(value string) (*Media, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("sdp: invalid media: %q", value)
+	}
+	// the port may be followed by a number of ports. ie: 49170/2
+	port, err := strconv.Atoi(strings.SplitN(fields[1], "/", 2)[0])
+	if err != nil {
+		return nil, fmt.Errorf("sdp: invalid media port: %q", value)
+	}
+	return &Media{
+		Type:    fields[0],
+		Port:    port,
+		Proto:   fields[2],
+		Formats: fields[3:],
+	}, nil
+}
+
+func parseAttribute(value string) Attribute {
+	kv := strings.SplitN(value, ":", 2)
+	if len(kv) == 1 {
+		return Attribute{Key: kv[0]}
+	}
+	return Attribute{Key: kv[0], Value: kv[1]}
+}
+
+// Marshal encodes the session description.
+func (s *Session) Marshal() []byte {
+	var b bytes.Buffer
+	line := func(typ byte, value string) {
+		b.WriteByte(typ)
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteString("\r\n")
+	}
+	line('v', strconv.Itoa(s.Version))
+	line('o', s.Origin)
+	line('s', s.Name)
+	if s.Info != "" {
+		line('i', s.Info)
+	}
+	if s.URI != "" {
+		line('u', s.URI)
+	}
+	if s.Connection != "" {
+		line('c', s.Connection)
+	}
+	for _, bw := range s.Bandwidth {
+		line('b', bw)
+	}
+	if len(s.Timing) == 0 {
+		line('t', "0 0")
+	}
+	for _, t := range s.Timing {
+		line('t', t)
+	}
+	for _, a := range s.Attributes {
+		line('a', a.String())
+	}
+	for _, m := range s.Media {
+		fields := append([]string{m.Type, strconv.Itoa(m.Port), m.Proto}, m.Formats...)
+		line('m', strings.Join(fields, " "))
+		if m.Info != "" {
+			line('i', m.Info)
+		}
+		if m.Connection != "" {
+			line('c', m.Connection)
+		}
+		for _, bw := range m.Bandwidth {
+			line('b', bw)
+		}
+		for _, a := range m.Attributes {
+			line('a', a.String())
+		}
+	}
+	return b.Bytes()
+}
+
+// Attribute returns the value of the first session attribute with the key.
+func (s *Session) Attribute(key string) (string, bool) {
+	return attribute(s.Attributes, key)
+}
+
+// Attribute returns the value of the first media attribute with the key.
+func (m *Media) Attribute(key string) (string, bool) {
+	return attribute(m.Attributes, key)
+}
+
+func attribute(attrs []Attribute, key string) (string, bool) {
+	for _, a := range attrs {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// Control returns the media control url attribute.
+func (m *Media) Control() string {
+	control, _ := m.Attribute("control")
+	return control
+}
+
+// PayloadType returns the first payload type listed in the media formats.
+func (m *Media) PayloadType() (int, bool) {
+	if len(m.Formats) == 0 {
+		return 0, false
+	}
+	pt, err := strconv.Atoi(m.Formats[0])
+	if err != nil {
+		return 0, false
+	}
+	return pt, true
+}
+
+// RTPMap is a parsed rtpmap attribute. ie: a=rtpmap:96 H264/90000
+type RTPMap struct {
+	PayloadType int
+	Encoding    string
+	ClockRate   int
+	Channels    int
+}
+
+// String returns the rtpmap attribute value.
+func (r RTPMap) String() string {
+	s := fmt.Sprintf("%d %s/%d", r.PayloadType, r.Encoding, r.ClockRate)
+	if r.Channels > 0 {
+		s += "/" + strconv.Itoa(r.Channels)
+	}
+	return s
+}
+
+// ParseRTPMap parses an rtpmap attribute value.
+func ParseRTPMap(value string) (RTPMap, error) {
+	var r RTPMap
+	fields := strings.SplitN(strings.TrimSpace(value), " ", 2)
+	if len(fields) != 2 {
+		return r, fmt.Errorf("sdp: invalid rtpmap: %q", value)
+	}
+	pt, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return r, fmt.Errorf("sdp: invalid rtpmap payload type: %q", value)
+	}
+	r.PayloadType = pt
+	parts := strings.Split(fields[1], "/")
+	r.Encoding = parts[0]
+	if len(parts) > 1 {
+		if r.ClockRate, err = strconv.Atoi(parts[1]); err != nil {
+			return r, fmt.Errorf("sdp: invalid rtpmap clock rate: %q", value)
+		}
+	}
+	if len(parts) > 2 {
+		if r.Channels, err = strconv.Atoi(parts[2]); err != nil {
+			return r, fmt.Errorf("sdp: invalid rtpmap channels: %q", value)
+		}
+	}
+	return r, nil
+}
+
+// staticRTPMaps contains the static payload types from RFC 3551.
+var staticRTPMaps = map[int]RTPMap{
+	0:  {0, "PCMU", 8000, 1},
+	3:  {3, "GSM", 8000, 1},
+	4:  {4, "G723", 8000, 1},
+	5:  {5, "DVI4", 8000, 1},
+	6:  {6, "DVI4", 16000, 1},
+	7:  {7, "LPC", 8000, 1},
+	8:  {8, "PCMA", 8000, 1},
+	9:  {9, "G722", 8000, 1},
+	10: {10, "L16", 44100, 2},
+	11: {11, "L16", 44100, 1},
+	12: {12, "QCELP", 8000, 1},
+	13: {13, "CN", 8000, 1},
+	14: {14, "MPA", 90000, 0},
+	15: {15, "G728", 8000, 1},
+	16: {16, "DVI4", 11025, 1},
+	17: {17, "DVI4", 22050, 1},
+	18: {18, "G729", 8000, 1},
+	25: {25, "CelB", 90000, 0},
+	26: {26, "JPEG", 90000, 0},
+	28: {28, "nv", 90000, 0},
+	31: {31, "H261", 90000, 0},
+	32: {32, "MPV", 90000, 0},
+	33: {33, "MP2T", 90000, 0},
+	34: {34, "H263", 90000, 0},
+}
+
+// RTPMap returns the rtpmap for the payload type. Static payload types
+// without an rtpmap attribute are resolved using the RFC 3551 table.
+func (m *Media) RTPMap(pt int) (RTPMap, bool) {
+	for _, a := range m.Attributes {
+		if a.Key != "rtpmap" {
+			continue
+		}
+		r, err := ParseRTPMap(a.Value)
+		if err == nil && r.PayloadType == pt {
+			return r, true
+		}
+	}
+	r, ok := staticRTPMaps[pt]
+	return r, ok
+}
+
+// ClockRate returns the clock rate of the first payload type.
+func (m *Media) ClockRate() (int, bool) {
+	pt, ok := m.PayloadType()
+	if !ok {
+		return 0, false
+	}
+	r, ok := m.RTPMap(pt)
+	if !ok || r.ClockRate == 0 {
+		return 0, false
+	}
+	return r.ClockRate, true
+}
+
+// Fmtp returns the format parameters for the payload type.
+// ie: a=fmtp:96 packetization-mode=1;profile-level-id=4d0029
+func (m *Media) Fmtp(pt int) (map[string]string, bool) {
+	prefix := strconv.Itoa(pt) + " "
+	for _, a := range m.Attributes {
+		if a.Key == "fmtp" && strings.HasPrefix(a.Value, prefix) {
+			return ParseFmtp(a.Value[len(prefix):]), true
+		}
+	}
+	return nil, false
+}
+
+// ParseFmtp parses format parameters. The keys are lower case.
+func ParseFmtp(value string) map[string]string {
+	params := map[string]string{}
+	for _, p := range strings.Split(value, ";") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		kv := strings.SplitN(p, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if len(kv) == 1 {
+			params[key] = ""
+		} else {
+			params[key] = strings.TrimSpace(kv[1])
+		}
+	}
+	return params
+}
+
+// FormatFmtp formats the parameters as an fmtp attribute value for the
+// payload type. The parameters are sorted by key.
+func FormatFmtp(pt int, params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + params[k]
+	}
+	return strconv.Itoa(pt) + " " + strings.Join(pairs, ";")
+}
@@ -0,0 +1,58 @@
+package sdp
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParse(t *testing.T) {
+	f, err := os.Open("../testdata/DESCRIBE.response")
+	assert.NilError(t, err)
+	defer f.Close()
+	// skip the response headers and keep the sdp lines
+	sc := bufio.NewScanner(f)
+	for sc.Scan() && sc.Text() != "" {
+	}
+	var lines []string
+	for sc.Scan() && len(sc.Text()) > 1 && sc.Text()[1] == '=' {
+		lines = append(lines, sc.Text())
+	}
+	data := []byte(strings.Join(lines, "\n"))
+
+	s, err := Parse(data)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Name, "Session streamed with GStreamer")
+	assert.Equal(t, len(s.Media), 1)
+
+	m := s.Media[0]
+	assert.Equal(t, m.Type, "video")
+	assert.Equal(t, m.Control(), "rtsp://localhost:8082/axis-media/media.amp/stream=0?videocodec=h264")
+	rate, ok := m.ClockRate()
+	assert.Assert(t, ok)
+	assert.Equal(t, rate, 90000)
+	rtpmap, ok := m.RTPMap(96)
+	assert.Assert(t, ok)
+	assert.Equal(t, rtpmap.Encoding, "H264")
+	fmtp, ok := m.Fmtp(96)
+	assert.Assert(t, ok)
+	assert.Equal(t, fmtp["packetization-mode"], "1")
+	assert.Equal(t, fmtp["sprop-parameter-sets"], "Z00AKeKQDwBE/LgLcBAQGkHiRFQ=,aO48gA==")
+
+	// round trip
+	s2, err := Parse(s.Marshal())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s, s2)
+}
+
+func TestStaticRTPMap(t *testing.T) {
+	s, err := Parse([]byte("v=0\r\nm=audio 0 RTP/AVP 8\r\n"))
+	assert.NilError(t, err)
+	rtpmap, ok := s.Media[0].RTPMap(8)
+	assert.Assert(t, ok)
+	assert.Equal(t, rtpmap.Encoding, "PCMA")
+	assert.Equal(t, rtpmap.ClockRate, 8000)
+}
@@ -0,0 +1,248 @@
+package rtsp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// ErrServerClosed is returned by Serve after Close is called.
+var ErrServerClosed = errors.New("rtsp: server closed")
+
+// Handler responds to RTSP requests. The returned response is written
+// with the request's CSeq. Handlers may keep a reference to the
+// connection to send interleaved frames after responding.
+type Handler interface {
+	ServeRTSP(conn *ServerConn, req *Request) *Response
+}
+
+// HandlerFunc adapts a function to the Handler interface.
+type HandlerFunc func(conn *ServerConn, req *Request) *Response
+
+// ServeRTSP calls f(conn, req).
+func (f HandlerFunc) ServeRTSP(conn *ServerConn, req *Request) *Response {
+	return f(conn, req)
+}
+
+// Server accepts RTSP connections and dispatches requests to the handler.
+type Server struct {
+	// Addr is the TCP address to listen on. The default is ":554".
+	Addr    string
+	Handler Handler
+	// ErrorLog is called with errors which terminate a connection.
+	// Errors are ignored when it's nil.
+	ErrorLog func(err error)
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[*ServerConn]struct{}
+	closed   bool
+}
+
+// ListenAndServe listens on the TCP address and serves connections.
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":554"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections from the listener and serves each one in a
+// new goroutine. The listener is closed when Serve returns.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		sc := NewServerConn(conn)
+		if !s.track(sc) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go func() {
+			defer s.untrack(sc)
+			if err := sc.Serve(s.Handler); err != nil && s.ErrorLog != nil {
+				s.ErrorLog(err)
+			}
+		}()
+	}
+}
+
+func (s *Server) track(c *ServerConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = map[*ServerConn]struct{}{}
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(c *ServerConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
+
+// Close stops the listener and closes all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return err
+}
+
+// ServerConn is the server side of an RTSP connection.
+type ServerConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	wmu sync.Mutex
+
+	hmu          sync.Mutex
+	frameHandler func(Frame) error
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewServerConn wraps a connection. Server uses this for every accepted
+// connection, it's exposed for serving connections from other sources.
+func NewServerConn(conn net.Conn) *ServerConn {
+	return &ServerConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		done: make(chan struct{}),
+	}
+}
+
+// RemoteAddr returns the address of the client.
+func (c *ServerConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// LocalAddr returns the local address of the connection.
+func (c *ServerConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// SetFrameHandler sets a callback for incoming interleaved binary frames.
+// Frames are discarded when no handler is set.
+func (c *ServerConn) SetFrameHandler(handler func(Frame) error) {
+	c.hmu.Lock()
+	defer c.hmu.Unlock()
+	c.frameHandler = handler
+}
+
+// WriteFrame sends an interleaved binary frame. It's safe to call
+// concurrently with the request handling.
+func (c *ServerConn) WriteFrame(f Frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return f.Write(c.conn)
+}
+
+// Done returns a channel which is closed when the connection ends.
+func (c *ServerConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the connection.
+func (c *ServerConn) Close() error {
+	err := c.conn.Close()
+	c.closeOnce.Do(func() { close(c.done) })
+	return err
+}
+
+// Serve reads requests and frames until the connection fails.
+// The connection is closed when Serve returns. A clean disconnect
+// by the client returns nil.
+func (c *ServerConn) Serve(h Handler) error {
+	defer c.Close()
+	for {
+		err := c.serveOne(h)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *ServerConn) serveOne(h Handler) error {
+	ok, err := IsFrame(c.r)
+	if err != nil {
+		return err
+	}
+	if ok {
+		f, err := ReadFrame(c.r)
+		if err != nil {
+			return err
+		}
+		c.hmu.Lock()
+		handler := c.frameHandler
+		c.hmu.Unlock()
+		if handler == nil {
+			return nil
+		}
+		return handler(f)
+	}
+	req, err := ReadRequest(c.r)
+	if err != nil {
+		return err
+	}
+	res := h.ServeRTSP(c, req)
+	if res == nil {
+		res, _ = NewResponse(StatusInternalServerError, nil)
+	}
+	if res.Header == nil {
+		res.Header = Header{}
+	}
+	if cseq := req.Header.Get("CSeq"); cseq != "" {
+		res.Header.Set("CSeq", cseq)
+	}
+	// write the response with a single call so it isn't split by frames
+	var buf bytes.Buffer
+	if err := res.Write(&buf); err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.conn.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,132 @@
+package rtsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Transport is a parsed Transport header.
+// ie: RTP/AVP/TCP;unicast;interleaved=0-1
+type Transport struct {
+	// Protocol is RTP/AVP, RTP/AVP/UDP or RTP/AVP/TCP.
+	Protocol    string
+	Unicast     bool
+	Multicast   bool
+	Interleaved [2]int
+	ClientPort  [2]int
+	ServerPort  [2]int
+	Destination string
+	Source      string
+	Mode        string
+	SSRC        string
+	// Other contains the parameters which don't have a field.
+	Other []string
+}
+
+// IsTCP returns true when the transport uses interleaved frames.
+func (t Transport) IsTCP() bool {
+	return strings.HasSuffix(strings.ToUpper(t.Protocol), "/TCP")
+}
+
+// ParseTransport parses the first transport specification in a Transport
+// header value.
+func ParseTransport(value string) (Transport, error) {
+	var t Transport
+	// multiple transports are separated by commas in order of preference
+	spec := strings.Split(value, ",")[0]
+	params := strings.Split(spec, ";")
+	t.Protocol = strings.TrimSpace(params[0])
+	if t.Protocol == "" {
+		return t, fmt.Errorf("invalid transport: %q", value)
+	}
+	t.Interleaved = [2]int{-1, -1}
+	for _, p := range params[1:] {
+		p = strings.TrimSpace(p)
+		kv := strings.SplitN(p, "=", 2)
+		key := strings.ToLower(kv[0])
+		var val string
+		if len(kv) == 2 {
+			val = strings.Trim(kv[1], `"`)
+		}
+		var err error
+		switch key {
+		case "unicast":
+			t.Unicast = true
+		case "multicast":
+			t.Multicast = true
+		case "interleaved":
+			t.Interleaved, err = parseRange(val)
+		case "client_port":
+			t.ClientPort, err = parseRange(val)
+		case "server_port":
+			t.ServerPort, err = parseRange(val)
+		case "destination":
+			t.Destination = val
+		case "source":
+			t.Source = val
+		case "mode":
+			t.Mode = strings.ToUpper(val)
+		case "ssrc":
+			t.SSRC = val
+		case "":
+		default:
+			t.Other = append(t.Other, p)
+		}
+		if err != nil {
+			return t, fmt.Errorf("invalid transport %s: %v", key, err)
+		}
+	}
+	return t, nil
+}
+
+// parseRange parses a port or channel pair. A single value n is
+// interpreted as n-(n+1).
+func parseRange(s string) ([2]int, error) {
+	parts := strings.SplitN(s, "-", 2)
+	a, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return [2]int{}, err
+	}
+	b := a + 1
+	if len(parts) == 2 {
+		if b, err = strconv.Atoi(parts[1]); err != nil {
+			return [2]int{}, err
+		}
+	}
+	return [2]int{a, b}, nil
+}
+
+// String formats the transport as a header value.
+func (t Transport) String() string {
+	params := []string{t.Protocol}
+	if t.Unicast {
+		params = append(params, "unicast")
+	}
+	if t.Multicast {
+		params = append(params, "multicast")
+	}
+	if t.Destination != "" {
+		params = append(params, "destination="+t.Destination)
+	}
+	if t.Source != "" {
+		params = append(params, "source="+t.Source)
+	}
+	if t.IsTCP() && t.Interleaved[0] >= 0 {
+		params = append(params, fmt.Sprintf("interleaved=%d-%d", t.Interleaved[0], t.Interleaved[1]))
+	}
+	if t.ClientPort[0] > 0 {
+		params = append(params, fmt.Sprintf("client_port=%d-%d", t.ClientPort[0], t.ClientPort[1]))
+	}
+	if t.ServerPort[0] > 0 {
+		params = append(params, fmt.Sprintf("server_port=%d-%d", t.ServerPort[0], t.ServerPort[1]))
+	}
+	if t.SSRC != "" {
+		params = append(params, "ssrc="+t.SSRC)
+	}
+	if t.Mode != "" {
+		params = append(params, "mode="+t.Mode)
+	}
+	params = append(params, t.Other...)
+	return strings.Join(params, ";")
+}
@@ -3,6 +3,7 @@ package rtsp
 import (
 	"bufio"
 	"fmt"
+	"net/url"
 	"strings"
 )
 
@@ -28,3 +29,13 @@ func readLine(r *bufio.Reader) (string, error) {
 		}
 	}
 }
+
+// stripUserinfo returns a copy of the url without the userinfo.
+func stripUserinfo(u *url.URL) *url.URL {
+	if u == nil || u.User == nil {
+		return u
+	}
+	u2 := *u
+	u2.User = nil
+	return &u2
+}
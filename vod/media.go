@@ -0,0 +1,223 @@
+package vod
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/mp4"
+	"github.com/icholy/rtsp/sdp"
+)
+
+// media is an opened file.
+type media struct {
+	tracks   []*track
+	duration time.Duration
+	file     *os.File
+}
+
+// track is a stream of samples in decode order. Timestamps are in the
+// units of the format clock rate.
+type track struct {
+	format  codec.Format
+	samples []sample
+	read    func(index int) ([][]byte, error)
+}
+
+type sample struct {
+	dts int64
+	pts int64
+	key bool
+}
+
+// time converts clock rate units into a duration.
+func (t *track) time(units int64) time.Duration {
+	return time.Duration(units) * time.Second / time.Duration(t.format.ClockRate)
+}
+
+// units converts a duration into clock rate units, rounding to the
+// nearest unit.
+func (t *track) units(d time.Duration) int64 {
+	rate := int64(t.format.ClockRate)
+	sec, rem := int64(d/time.Second), int64(d%time.Second)
+	return sec*rate + (rem*rate+int64(time.Second)/2)/int64(time.Second)
+}
+
+// seek returns the index of the first sample to play from the time. The
+// time is moved back to the previous key frame of the first video track,
+// all other tracks start at that time.
+func (m *media) seek(d time.Duration) (time.Duration, []int) {
+	for _, t := range m.tracks {
+		if !isVideo(t.format) {
+			continue
+		}
+		start := time.Duration(0)
+		for _, s := range t.samples {
+			if t.time(s.dts) > d {
+				break
+			}
+			if s.key {
+				start = t.time(s.dts)
+			}
+		}
+		d = start
+		break
+	}
+	next := make([]int, len(m.tracks))
+	for i, t := range m.tracks {
+		for next[i] < len(t.samples) && t.time(t.samples[next[i]].dts) < d {
+			next[i]++
+		}
+	}
+	return d, next
+}
+
+func (m *media) close() error {
+	if m.file == nil {
+		return nil
+	}
+	return m.file.Close()
+}
+
+func isVideo(f codec.Format) bool {
+	switch strings.ToUpper(f.Encoding) {
+	case "H264", "H265":
+		return true
+	default:
+		return false
+	}
+}
+
+// openMedia opens an MP4 or Annex-B file depending on the extension.
+func openMedia(name string, frameRate int) (*media, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp4", ".m4v", ".m4a", ".mov":
+		return openMP4(name)
+	case ".h264", ".264":
+		return openAnnexB(name, frameRate)
+	default:
+		return nil, ErrUnsupportedFile
+	}
+}
+
+func openMP4(name string) (*media, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f, err := mp4.Open(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	m := &media{file: file, duration: f.Duration()}
+	for _, mt := range f.Tracks {
+		format, err := mt.Format(96 + len(m.tracks))
+		if err != nil || format.ClockRate <= 0 {
+			// skip tracks we can't stream
+			continue
+		}
+		mt := mt
+		t := &track{format: format}
+		scale := func(units int64) int64 {
+			return units * int64(format.ClockRate) / int64(mt.TimeScale)
+		}
+		for _, s := range mt.Samples {
+			t.samples = append(t.samples, sample{
+				dts: scale(s.DTS),
+				pts: scale(s.PTS()),
+				key: s.Key,
+			})
+		}
+		t.read = func(index int) ([][]byte, error) {
+			return f.ReadSample(mt, mt.Samples[index])
+		}
+		m.tracks = append(m.tracks, t)
+	}
+	if len(m.tracks) == 0 {
+		file.Close()
+		return nil, ErrUnsupportedFile
+	}
+	return m, nil
+}
+
+// openAnnexB reads a raw H.264 byte stream. The file has no timing
+// information so access units are spaced using the frame rate.
+func openAnnexB(name string, frameRate int) (*media, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var sps, pps []byte
+	var units [][][]byte
+	for _, nalu := range h264.SplitAnnexB(data) {
+		switch h264.NALUType(nalu) {
+		case h264.NALUTypeSPS:
+			if sps == nil {
+				sps = nalu
+			}
+		case h264.NALUTypePPS:
+			if pps == nil {
+				pps = nalu
+			}
+		}
+		if len(units) == 0 || startsAccessUnit(units[len(units)-1], nalu) {
+			units = append(units, nil)
+		}
+		units[len(units)-1] = append(units[len(units)-1], nalu)
+	}
+	if sps == nil || pps == nil {
+		return nil, ErrMissingParameterSets
+	}
+	t := &track{
+		format: codec.Format{
+			RTPMap: sdp.RTPMap{PayloadType: 96, Encoding: "H264", ClockRate: 90000},
+			Fmtp:   h264.Fmtp(sps, pps),
+		},
+		read: func(index int) ([][]byte, error) {
+			return units[index], nil
+		},
+	}
+	duration := int64(90000 / frameRate)
+	for i, nalus := range units {
+		ts := int64(i) * duration
+		t.samples = append(t.samples, sample{dts: ts, pts: ts, key: h264.IsKey(nalus)})
+	}
+	return &media{
+		tracks:   []*track{t},
+		duration: t.time(int64(len(units)) * duration),
+	}, nil
+}
+
+// startsAccessUnit returns true when the NAL unit begins a new access unit
+// (ITU-T H.264 7.4.1.2.3).
+func startsAccessUnit(au [][]byte, nalu []byte) bool {
+	var vcl bool
+	for _, n := range au {
+		if typ := h264.NALUType(n); typ >= h264.NALUTypeNonIDR && typ <= h264.NALUTypeIDR {
+			vcl = true
+		}
+	}
+	if !vcl {
+		return false
+	}
+	switch typ := h264.NALUType(nalu); {
+	case typ == h264.NALUTypeAUD, typ == h264.NALUTypeSEI,
+		typ == h264.NALUTypeSPS, typ == h264.NALUTypePPS:
+		return true
+	case typ >= h264.NALUTypeNonIDR && typ <= h264.NALUTypeIDR:
+		// first_mb_in_slice is zero when the first bit of the exp-golomb code is set
+		return len(nalu) > 1 && nalu[1]&0x80 != 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,310 @@
+// Package vod implements an on-demand RTSP server which streams H.264,
+// H.265 and AAC from MP4 files and H.264 from raw Annex-B files.
+//
+// Sessions support PLAY with a Range start, PAUSE and resuming. Packets
+// are paced using the sample timestamps and sent over interleaved TCP
+// channels or UDP.
+package vod
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/internal/rtsputil"
+	"github.com/icholy/rtsp/sdp"
+
+	// register the packetizers
+	_ "github.com/icholy/rtsp/codec/aac"
+	_ "github.com/icholy/rtsp/codec/h264"
+	_ "github.com/icholy/rtsp/codec/h265"
+)
+
+// Errors returned when opening a file.
+var (
+	ErrUnsupportedFile      = errors.New("vod: unsupported file")
+	ErrMissingParameterSets = errors.New("vod: missing sps or pps")
+)
+
+// DefaultFrameRate is used for Annex-B files when Server.FrameRate is zero.
+const DefaultFrameRate = 25
+
+// reportInterval is the time between RTCP sender reports.
+const reportInterval = 5 * time.Second
+
+// Server streams files from a directory. It implements rtsp.Handler.
+// The request path is the file name relative to the directory.
+// ie: rtsp://host/movies/demo.mp4
+type Server struct {
+	// Dir is the directory containing the files.
+	Dir string
+	// FrameRate is the frame rate of Annex-B files.
+	FrameRate int
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewServer constructs a Server for the directory.
+func NewServer(dir string) *Server {
+	return &Server{Dir: dir}
+}
+
+// ServeRTSP implements rtsp.Handler.
+func (s *Server) ServeRTSP(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	switch req.Method {
+	case rtsp.MethodOptions:
+		res := rtsputil.Response(rtsp.StatusOK)
+		res.Header.Set("Public", rtsputil.PlayMethods)
+		return res
+	case rtsp.MethodDescribe:
+		return s.describe(req)
+	case rtsp.MethodSetup:
+		return s.setup(conn, req)
+	case rtsp.MethodPlay:
+		return s.play(conn, req)
+	case rtsp.MethodPause:
+		return s.pause(conn, req)
+	case rtsp.MethodTeardown:
+		sess, res := s.lookup(conn, req)
+		if res != nil {
+			return res
+		}
+		s.remove(sess)
+		return rtsputil.Response(rtsp.StatusOK)
+	case rtsp.MethodGetParameter:
+		if _, res := s.lookup(conn, req); res != nil {
+			return res
+		}
+		return rtsputil.Response(rtsp.StatusOK)
+	default:
+		return rtsputil.Response(rtsp.StatusMethodNotAllowed)
+	}
+}
+
+// open opens the file named by the aggregate url path.
+func (s *Server) open(req *rtsp.Request) (*media, *rtsp.Response) {
+	name := filepath.Join(s.Dir, filepath.FromSlash(path.Clean("/"+rtsputil.AggregatePath(req))))
+	frameRate := s.FrameRate
+	if frameRate <= 0 {
+		frameRate = DefaultFrameRate
+	}
+	m, err := openMedia(name, frameRate)
+	switch {
+	case err == nil:
+		return m, nil
+	case os.IsNotExist(err):
+		return nil, rtsputil.Response(rtsp.StatusNotFound)
+	case errors.Is(err, ErrUnsupportedFile):
+		return nil, rtsputil.Response(rtsp.StatusUnsupportedMediaType)
+	default:
+		return nil, rtsputil.Response(rtsp.StatusInternalServerError)
+	}
+}
+
+func (s *Server) describe(req *rtsp.Request) *rtsp.Response {
+	m, res := s.open(req)
+	if res != nil {
+		return res
+	}
+	defer m.close()
+	desc := &sdp.Session{
+		Origin: "- 0 0 IN IP4 0.0.0.0",
+		Name:   path.Base(rtsputil.AggregatePath(req)),
+		Attributes: []sdp.Attribute{
+			{Key: "control", Value: "*"},
+			{Key: "range", Value: fmt.Sprintf("npt=0-%.3f", m.duration.Seconds())},
+		},
+	}
+	for i, t := range m.tracks {
+		desc.Media = append(desc.Media, mediaDescription(i, t.format))
+	}
+	res, _ = rtsp.NewResponse(rtsp.StatusOK, desc.Marshal())
+	res.Header.Set("Content-Type", "application/sdp")
+	res.Header.Set("Content-Base", rtsputil.AggregateURL(req)+"/")
+	return res
+}
+
+func mediaDescription(index int, f codec.Format) *sdp.Media {
+	typ := "audio"
+	if isVideo(f) {
+		typ = "video"
+	}
+	m := &sdp.Media{
+		Type:    typ,
+		Proto:   "RTP/AVP",
+		Formats: []string{strconv.Itoa(f.PayloadType)},
+		Attributes: []sdp.Attribute{
+			{Key: "rtpmap", Value: f.RTPMap.String()},
+		},
+	}
+	if len(f.Fmtp) > 0 {
+		m.Attributes = append(m.Attributes, sdp.Attribute{
+			Key:   "fmtp",
+			Value: sdp.FormatFmtp(f.PayloadType, f.Fmtp),
+		})
+	}
+	m.Attributes = append(m.Attributes, sdp.Attribute{Key: "control", Value: rtsputil.TrackControl(index)})
+	return m
+}
+
+func (s *Server) setup(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	index, ok := rtsputil.TrackIndex(req)
+	if !ok {
+		return rtsputil.Response(rtsp.StatusNotFound)
+	}
+	t, err := rtsp.ParseTransport(req.Header.Get("Transport"))
+	if err != nil {
+		return rtsputil.Response(rtsp.StatusBadRequest)
+	}
+	if t.Multicast || t.Mode == "RECORD" || (!t.IsTCP() && t.ClientPort[0] == 0) {
+		return rtsputil.Response(rtsp.StatusUnsupportedTransport)
+	}
+	var sess *session
+	if req.Header.Get("Session") != "" {
+		var res *rtsp.Response
+		if sess, res = s.lookup(conn, req); res != nil {
+			return res
+		}
+		if sess.path != rtsputil.AggregatePath(req) {
+			return rtsputil.Response(rtsp.StatusAggregateOperationNotAllowed)
+		}
+	} else {
+		m, res := s.open(req)
+		if res != nil {
+			return res
+		}
+		sess, err = s.newSession(conn, rtsputil.AggregatePath(req), m)
+		if err != nil {
+			m.close()
+			return rtsputil.Response(rtsp.StatusInternalServerError)
+		}
+	}
+	if index >= len(sess.tracks) {
+		return rtsputil.Response(rtsp.StatusNotFound)
+	}
+	transport, err := sess.setup(index, t)
+	if err != nil {
+		return rtsputil.Response(rtsp.StatusUnsupportedTransport)
+	}
+	res := rtsputil.Response(rtsp.StatusOK)
+	res.Header.Set("Transport", transport.String())
+	res.Header.Set("Session", sess.id+";timeout=60")
+	return res
+}
+
+func (s *Server) play(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	sess, res := s.lookup(conn, req)
+	if res != nil {
+		return res
+	}
+	start, ok := time.Duration(-1), true
+	if value := req.Header.Get("Range"); value != "" {
+		if start, ok = parseRange(value); !ok || start > sess.media.duration {
+			return rtsputil.Response(rtsp.StatusInvalidRange)
+		}
+	}
+	start, info, err := sess.play(start)
+	if err != nil {
+		return rtsputil.Response(rtsp.StatusMethodNotValidInThisState)
+	}
+	var rtpInfo []string
+	for _, i := range info {
+		rtpInfo = append(rtpInfo, fmt.Sprintf("url=%s/%s;seq=%d;rtptime=%d",
+			rtsputil.AggregateURL(req), rtsputil.TrackControl(i.index), i.seq, i.ts))
+	}
+	res = rtsputil.Response(rtsp.StatusOK)
+	res.Header.Set("Session", sess.id)
+	res.Header.Set("Range", fmt.Sprintf("npt=%.3f-%.3f", start.Seconds(), sess.media.duration.Seconds()))
+	res.Header.Set("RTP-Info", strings.Join(rtpInfo, ","))
+	return res
+}
+
+func (s *Server) pause(conn *rtsp.ServerConn, req *rtsp.Request) *rtsp.Response {
+	sess, res := s.lookup(conn, req)
+	if res != nil {
+		return res
+	}
+	sess.pause()
+	res = rtsputil.Response(rtsp.StatusOK)
+	res.Header.Set("Session", sess.id)
+	return res
+}
+
+// lookup finds the session referenced by the request. Sessions can only
+// be used from the connection which created them.
+func (s *Server) lookup(conn *rtsp.ServerConn, req *rtsp.Request) (*session, *rtsp.Response) {
+	id, _ := req.Header.Field("Session", 0)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok || sess.conn != conn {
+		return nil, rtsputil.Response(rtsp.StatusSessionNotFound)
+	}
+	return sess, nil
+}
+
+func (s *Server) newSession(conn *rtsp.ServerConn, path string, m *media) (*session, error) {
+	sess, err := newSession(conn, path, m)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.sessions == nil {
+		s.sessions = map[string]*session{}
+	}
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+	go func() {
+		select {
+		case <-conn.Done():
+			s.remove(sess)
+		case <-sess.done:
+		}
+	}()
+	return sess, nil
+}
+
+func (s *Server) remove(sess *session) {
+	s.mu.Lock()
+	delete(s.sessions, sess.id)
+	s.mu.Unlock()
+	sess.close()
+}
+
+// Close ends all sessions.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	sessions := s.sessions
+	s.sessions = nil
+	s.mu.Unlock()
+	for _, sess := range sessions {
+		sess.close()
+	}
+	return nil
+}
+
+// parseRange parses the start of an npt range. ie: npt=10.5-
+// The start is -1 for "now".
+func parseRange(value string) (time.Duration, bool) {
+	if !strings.HasPrefix(value, "npt=") {
+		return 0, false
+	}
+	start := strings.SplitN(strings.TrimPrefix(value, "npt="), "-", 2)[0]
+	if start == "now" {
+		return -1, true
+	}
+	sec, err := strconv.ParseFloat(start, 64)
+	if err != nil || sec < 0 {
+		return 0, false
+	}
+	return time.Duration(sec * float64(time.Second)), true
+}
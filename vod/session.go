@@ -0,0 +1,319 @@
+package vod
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/internal/rtsputil"
+	"github.com/icholy/rtsp/rtcp"
+	"github.com/icholy/rtsp/rtp"
+)
+
+// session is the playback state of a client.
+type session struct {
+	id     string
+	conn   *rtsp.ServerConn
+	path   string
+	media  *media
+	tracks []*sessionTrack
+	done   chan struct{}
+	once   sync.Once
+
+	mu       sync.Mutex
+	next     []int
+	position time.Duration
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// sessionTrack is a track which can be set up for sending.
+type sessionTrack struct {
+	*track
+	packetizer codec.Packetizer
+	// base is added to the sample timestamps.
+	base uint32
+	// send is nil until the track is set up.
+	send     func(rtcp bool, data []byte) error
+	rtpConn  *net.UDPConn
+	rtcpConn *net.UDPConn
+	packets  uint32
+	octets   uint32
+}
+
+type rtpInfo struct {
+	index int
+	seq   uint16
+	ts    uint32
+}
+
+func newSession(conn *rtsp.ServerConn, path string, m *media) (*session, error) {
+	s := &session{
+		id:    rtsputil.NewSessionID(),
+		conn:  conn,
+		path:  path,
+		media: m,
+		done:  make(chan struct{}),
+	}
+	for _, t := range m.tracks {
+		p, err := codec.NewPacketizer(t.format)
+		if err != nil {
+			return nil, err
+		}
+		s.tracks = append(s.tracks, &sessionTrack{
+			track:      t,
+			packetizer: p,
+			base:       rand.Uint32(),
+		})
+	}
+	return s, nil
+}
+
+// setup configures the transport of a track and returns the transport
+// for the response.
+func (s *session) setup(index int, t rtsp.Transport) (rtsp.Transport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return rtsp.Transport{}, errors.New("vod: session is playing")
+	}
+	st := s.tracks[index]
+	ssrc := fmt.Sprintf("%08X", st.packetizer.Sequencer().SSRC)
+	if t.IsTCP() {
+		if t.Interleaved[0] < 0 {
+			t.Interleaved = [2]int{2 * index, 2*index + 1}
+		}
+		channel := t.Interleaved[0]
+		st.send = func(rtcp bool, data []byte) error {
+			f := rtsp.Frame{Channel: channel, Data: data}
+			if rtcp {
+				f.Channel++
+			}
+			return s.conn.WriteFrame(f)
+		}
+		return rtsp.Transport{
+			Protocol:    t.Protocol,
+			Unicast:     true,
+			Interleaved: t.Interleaved,
+			SSRC:        ssrc,
+		}, nil
+	}
+	remote, ok := s.conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return rtsp.Transport{}, errors.New("vod: udp requires a tcp connection")
+	}
+	var local net.IP
+	if addr, ok := s.conn.LocalAddr().(*net.TCPAddr); ok {
+		local = addr.IP
+	}
+	if st.rtpConn == nil {
+		var err error
+		if st.rtpConn, st.rtcpConn, err = rtsputil.ListenUDP(local); err != nil {
+			return rtsp.Transport{}, err
+		}
+	}
+	rtpAddr := &net.UDPAddr{IP: remote.IP, Port: t.ClientPort[0]}
+	rtcpAddr := &net.UDPAddr{IP: remote.IP, Port: t.ClientPort[1]}
+	rtpConn, rtcpConn := st.rtpConn, st.rtcpConn
+	st.send = func(rtcp bool, data []byte) error {
+		var err error
+		if rtcp {
+			_, err = rtcpConn.WriteToUDP(data, rtcpAddr)
+		} else {
+			_, err = rtpConn.WriteToUDP(data, rtpAddr)
+		}
+		return err
+	}
+	return rtsp.Transport{
+		Protocol:   t.Protocol,
+		Unicast:    true,
+		ClientPort: t.ClientPort,
+		ServerPort: [2]int{
+			rtpConn.LocalAddr().(*net.UDPAddr).Port,
+			rtcpConn.LocalAddr().(*net.UDPAddr).Port,
+		},
+		SSRC: ssrc,
+	}, nil
+}
+
+// play starts sending from the time, or from the current position when
+// it's negative. It returns the actual start time and the RTP-Info of the
+// tracks which are set up.
+func (s *session) play(start time.Duration) (time.Duration, []rtpInfo, error) {
+	s.pause()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var info []rtpInfo
+	for i, t := range s.tracks {
+		if t.send != nil {
+			info = append(info, rtpInfo{index: i})
+		}
+	}
+	if len(info) == 0 {
+		return 0, nil, errors.New("vod: no tracks are set up")
+	}
+	if start >= 0 || s.next == nil {
+		if start < 0 {
+			start = 0
+		}
+		s.position, s.next = s.media.seek(start)
+	}
+	for i := range info {
+		t := s.tracks[info[i].index]
+		info[i].seq = t.packetizer.Sequencer().SN
+		info[i].ts = t.base + uint32(t.units(s.position))
+	}
+	s.stop = make(chan struct{})
+	s.stopped = make(chan struct{})
+	go s.run(s.position, s.stop, s.stopped)
+	return s.position, info, nil
+}
+
+// pause stops sending and records the position to resume from.
+func (s *session) pause() {
+	s.mu.Lock()
+	if s.stop == nil {
+		s.mu.Unlock()
+		return
+	}
+	close(s.stop)
+	stopped := s.stopped
+	s.mu.Unlock()
+	<-stopped
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop, s.stopped = nil, nil
+	s.position = s.media.duration
+	for i, t := range s.tracks {
+		if t.send == nil || s.next[i] >= len(t.samples) {
+			continue
+		}
+		if d := t.time(t.samples[s.next[i]].dts); d < s.position {
+			s.position = d
+		}
+	}
+}
+
+// run sends the samples of all tracks in decode time order. The samples
+// are paced relative to the wall-clock time playback started.
+func (s *session) run(start time.Duration, stop, stopped chan struct{}) {
+	defer close(stopped)
+	wall := time.Now()
+	var report time.Time
+	for {
+		index, at := -1, time.Duration(0)
+		for i, t := range s.tracks {
+			if t.send == nil || s.next[i] >= len(t.samples) {
+				continue
+			}
+			if d := t.time(t.samples[s.next[i]].dts); index < 0 || d < at {
+				index, at = i, d
+			}
+		}
+		if index < 0 {
+			return
+		}
+		if wait := time.Until(wall.Add(at - start)); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-stop:
+				timer.Stop()
+				return
+			}
+		} else {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+		if now := time.Now(); now.Sub(report) >= reportInterval {
+			report = now
+			if err := s.report(start + now.Sub(wall)); err != nil {
+				return
+			}
+		}
+		if err := s.send(index); err != nil {
+			return
+		}
+	}
+}
+
+// send packetizes and sends the next sample of the track.
+func (s *session) send(index int) error {
+	t := s.tracks[index]
+	n := s.next[index]
+	s.next[index]++
+	data, err := t.read(n)
+	if err != nil {
+		// skip unreadable samples
+		return nil
+	}
+	sample := t.samples[n]
+	packets, err := t.packetizer.Packetize(&codec.AccessUnit{
+		Timestamp: t.base + uint32(sample.pts),
+		Data:      data,
+		Key:       sample.key,
+	})
+	if err != nil {
+		return nil
+	}
+	for _, p := range packets {
+		buf, err := p.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := t.send(false, buf); err != nil {
+			return err
+		}
+		t.packets++
+		t.octets += uint32(len(p.Payload))
+	}
+	return nil
+}
+
+// report sends a sender report for every track. The position is the
+// current media time.
+func (s *session) report(position time.Duration) error {
+	now := time.Now()
+	for _, t := range s.tracks {
+		if t.send == nil {
+			continue
+		}
+		buf, err := rtcp.SenderReport{
+			SSRC:        t.packetizer.Sequencer().SSRC,
+			NTPTime:     rtp.NTPTime(now),
+			RTPTime:     t.base + uint32(t.units(position)),
+			PacketCount: t.packets,
+			OctetCount:  t.octets,
+		}.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := t.send(true, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close stops playback and releases the file and sockets.
+func (s *session) close() {
+	s.once.Do(func() {
+		s.pause()
+		close(s.done)
+		for _, t := range s.tracks {
+			if t.rtpConn != nil {
+				t.rtpConn.Close()
+				t.rtcpConn.Close()
+			}
+		}
+		s.media.close()
+	})
+}
@@ -0,0 +1,259 @@
+package vod
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icholy/rtsp"
+	"github.com/icholy/rtsp/codec"
+	"github.com/icholy/rtsp/codec/aac"
+	"github.com/icholy/rtsp/codec/h264"
+	"github.com/icholy/rtsp/fmp4"
+	"github.com/icholy/rtsp/rtp"
+	"github.com/icholy/rtsp/sdp"
+	"gotest.tools/v3/assert"
+)
+
+const sprop = "Z00AKeKQDwBE/LgLcBAQGkHiRFQ=,aO48gA=="
+
+// writeFiles creates 30fps H.264 test files with a key frame every 10 frames.
+func writeFiles(t *testing.T, dir string, frames int) {
+	sps, pps, err := h264.ParseSpropParameterSets(sprop)
+	assert.NilError(t, err)
+	frame := func(i int) [][]byte {
+		if i%10 == 0 {
+			return [][]byte{sps, pps, {0x65, 0x88, byte(i)}}
+		}
+		return [][]byte{{0x41, 0x9A, byte(i)}}
+	}
+	// annex-b
+	var annexb []byte
+	for i := 0; i < frames; i++ {
+		annexb = append(annexb, h264.JoinAnnexB(frame(i))...)
+	}
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "test.h264"), annexb, 0644))
+	// mp4 with audio
+	video, err := fmp4.NewH264Track(sps, pps)
+	assert.NilError(t, err)
+	audio := fmp4.NewAACTrack(aac.AudioSpecificConfig{ObjectType: 2, SampleRate: 48000, ChannelCount: 2})
+	var buf bytes.Buffer
+	m := fmp4.NewMuxer(&buf, []*fmp4.Track{video, audio})
+	for i := 0; i < frames; i++ {
+		err := m.WriteAccessUnit(0, &codec.AccessUnit{
+			Timestamp: uint32(i * 3000),
+			Data:      frame(i),
+			Key:       i%10 == 0,
+		})
+		assert.NilError(t, err)
+		err = m.WriteAccessUnit(1, &codec.AccessUnit{
+			Timestamp: uint32(i * 1600),
+			Data:      [][]byte{{0x21, byte(i)}},
+			Key:       true,
+		})
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, m.Flush())
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "test.mp4"), buf.Bytes(), 0644))
+}
+
+func serve(t *testing.T, frames int) string {
+	dir := t.TempDir()
+	writeFiles(t, dir, frames)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	s := NewServer(dir)
+	s.FrameRate = 30
+	srv := &rtsp.Server{Handler: s}
+	go srv.Serve(l)
+	t.Cleanup(func() {
+		srv.Close()
+		s.Close()
+	})
+	return l.Addr().String()
+}
+
+type client struct {
+	*rtsp.Client
+	frames chan rtsp.Frame
+}
+
+func dial(t *testing.T, addr string) *client {
+	conn, err := net.Dial("tcp", addr)
+	assert.NilError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	c := &client{frames: make(chan rtsp.Frame, 1000)}
+	c.Client = rtsp.NewClient(conn, rtsp.WithFrameHandler(func(f rtsp.Frame) error {
+		c.frames <- f
+		return nil
+	}))
+	return c
+}
+
+func (c *client) do(t *testing.T, method, endpoint string, header map[string]string) *rtsp.Response {
+	req, err := rtsp.NewRequest(method, endpoint, nil)
+	assert.NilError(t, err)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := c.Do(req)
+	assert.NilError(t, err)
+	return res
+}
+
+// rtpInfo returns the rtptime of the first track in the RTP-Info header.
+func rtpTime(t *testing.T, res *rtsp.Response) uint32 {
+	info := strings.Split(res.Header.Get("RTP-Info"), ",")[0]
+	for _, param := range strings.Split(info, ";") {
+		if strings.HasPrefix(param, "rtptime=") {
+			ts, err := strconv.ParseUint(strings.TrimPrefix(param, "rtptime="), 10, 32)
+			assert.NilError(t, err)
+			return uint32(ts)
+		}
+	}
+	t.Fatal("missing rtptime")
+	return 0
+}
+
+func TestAnnexB(t *testing.T) {
+	addr := serve(t, 20)
+	c := dial(t, addr)
+	endpoint := "rtsp://" + addr + "/test.h264"
+
+	res, err := c.Describe(endpoint)
+	assert.NilError(t, err)
+	assert.NilError(t, res.Err())
+	desc, err := sdp.Parse(res.Body)
+	assert.NilError(t, err)
+	assert.Equal(t, len(desc.Media), 1)
+	rng, _ := desc.Attribute("range")
+	assert.Equal(t, rng, "npt=0-0.667")
+	format, err := codec.ParseFormat(desc.Media[0])
+	assert.NilError(t, err)
+	assert.Equal(t, format.Fmtp["sprop-parameter-sets"], sprop)
+
+	res, err = c.Setup(endpoint+"/trackID=0", "RTP/AVP/TCP;unicast;interleaved=0-1")
+	assert.NilError(t, err)
+	session, err := rtsp.Session(res)
+	assert.NilError(t, err)
+
+	// seeking moves back to the key frame at 10
+	start := time.Now()
+	res = c.do(t, rtsp.MethodPlay, endpoint, map[string]string{
+		"Session": session,
+		"Range":   "npt=0.5-",
+	})
+	assert.NilError(t, res.Err())
+	assert.Equal(t, res.Header.Get("Range"), "npt=0.333-0.667")
+	base := rtpTime(t, res)
+
+	d, err := h264.NewDepacketizer(format.Fmtp)
+	assert.NilError(t, err)
+	var units []*codec.AccessUnit
+	for len(units) < 9 {
+		select {
+		case f := <-c.frames:
+			if f.Channel != 0 {
+				continue
+			}
+			p, err := rtp.Parse(f.Data)
+			assert.NilError(t, err)
+			aus, err := d.Depacketize(p)
+			assert.NilError(t, err)
+			units = append(units, aus...)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	assert.Assert(t, units[0].Key)
+	assert.Equal(t, units[0].Timestamp, base)
+	assert.Equal(t, units[1].Timestamp, base+3000)
+	assert.DeepEqual(t, units[1].Data, [][]byte{{0x41, 0x9A, 11}})
+	// the packets are paced
+	assert.Assert(t, time.Since(start) > 200*time.Millisecond)
+
+	res = c.do(t, rtsp.MethodTeardown, endpoint, map[string]string{"Session": session})
+	assert.NilError(t, res.Err())
+	res = c.do(t, rtsp.MethodPlay, endpoint, map[string]string{"Session": session})
+	assert.Equal(t, res.StatusCode, rtsp.StatusSessionNotFound)
+}
+
+func TestPauseUDP(t *testing.T) {
+	addr := serve(t, 300)
+	c := dial(t, addr)
+	endpoint := "rtsp://" + addr + "/test.mp4"
+
+	res, err := c.Describe(endpoint)
+	assert.NilError(t, err)
+	desc, err := sdp.Parse(res.Body)
+	assert.NilError(t, err)
+	assert.Equal(t, len(desc.Media), 2)
+	assert.Equal(t, desc.Media[1].Type, "audio")
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NilError(t, err)
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	res, err = c.Setup(endpoint+"/trackID=0", "RTP/AVP;unicast;client_port="+strconv.Itoa(port)+"-"+strconv.Itoa(port+1))
+	assert.NilError(t, err)
+	session, err := rtsp.Session(res)
+	assert.NilError(t, err)
+	transport, err := rtsp.ParseTransport(res.Header.Get("Transport"))
+	assert.NilError(t, err)
+	assert.Assert(t, transport.ServerPort[0] != 0)
+
+	next := func() *rtp.Packet {
+		buf := make([]byte, 1500)
+		assert.NilError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, err := conn.Read(buf)
+		assert.NilError(t, err)
+		p, err := rtp.Parse(buf[:n])
+		assert.NilError(t, err)
+		return p
+	}
+
+	res = c.do(t, rtsp.MethodPlay, endpoint, map[string]string{"Session": session})
+	assert.NilError(t, res.Err())
+	first := next()
+	assert.Equal(t, first.TS, rtpTime(t, res))
+	var last *rtp.Packet
+	for i := 0; i < 5; i++ {
+		last = next()
+	}
+	res = c.do(t, rtsp.MethodPause, endpoint, map[string]string{"Session": session})
+	assert.NilError(t, res.Err())
+	// drain anything sent before the pause
+	assert.NilError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	for {
+		buf := make([]byte, 1500)
+		n, err := conn.Read(buf)
+		if err != nil {
+			break
+		}
+		last, err = rtp.Parse(buf[:n])
+		assert.NilError(t, err)
+	}
+
+	// resuming continues from the same position
+	res = c.do(t, rtsp.MethodPlay, endpoint, map[string]string{"Session": session})
+	assert.NilError(t, res.Err())
+	p := next()
+	assert.Equal(t, p.SN, last.SN+1)
+	assert.Equal(t, p.TS, last.TS+3000)
+}
+
+func TestNotFound(t *testing.T) {
+	addr := serve(t, 10)
+	c := dial(t, addr)
+	res, err := c.Describe("rtsp://" + addr + "/missing.mp4")
+	assert.NilError(t, err)
+	assert.Equal(t, res.StatusCode, rtsp.StatusNotFound)
+	res, err = c.Describe("rtsp://" + addr + "/../test.txt")
+	assert.NilError(t, err)
+	assert.Equal(t, res.StatusCode, rtsp.StatusUnsupportedMediaType)
+}